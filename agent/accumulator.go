@@ -18,6 +18,11 @@ type MetricMaker interface {
 	MakeMetric(metric telex.Metric) telex.Metric
 }
 
+// errorRecorder is implemented by the plugins keeping their last error.
+type errorRecorder interface {
+	RecordError(err error)
+}
+
 type accumulator struct {
 	maker     MetricMaker
 	metrics   chan<- telex.Metric
@@ -111,6 +116,9 @@ func (ac *accumulator) AddError(err error) {
 		return
 	}
 	NErrors.Incr(1)
+	if recorder, ok := ac.maker.(errorRecorder); ok {
+		recorder.RecordError(err)
+	}
 	log.Printf("E! [%s]: Error in plugin: %v", ac.maker.Name(), err)
 }
 
@@ -2,8 +2,12 @@ package agent
 
 import (
 	"context"
+	"errors"
 	"fmt"
 	"log"
+	"net"
+	"net/http"
+	"reflect"
 	"runtime"
 	"sync"
 	"time"
@@ -18,13 +22,56 @@ import (
 // Agent runs a set of plugins.
 type Agent struct {
 	Config *config.Config
+
+	// cardinality is the agent wide cardinality guard, nil if disabled.
+	cardinality *models.CardinalityGuard
+
+	reload  chan reloadRequest
+	stopped chan struct{}
+
+	// api serves the health and status API, nil if disabled.
+	api *http.Server
+
+	// control listens on the control socket, nil if disabled.
+	control net.Listener
+
+	// inputC receives the metrics of the inputs across generations.
+	inputC chan telex.Metric
+
+	// mu protects running, and the fields read by the API: Config, ready
+	// and started, the start of the current generation.
+	mu      sync.Mutex
+	running bool
+	ready   bool
+	started time.Time
+}
+
+// reloadRequest asks the running agent to switch to a new configuration.
+type reloadRequest struct {
+	config *config.Config
+	done   chan error
+}
+
+// generation is a run of the plugins between two configuration reloads.
+type generation struct {
+	cancel context.CancelFunc
+	done   chan struct{}
+
+	// stopInputs are the service inputs stopped when the generation ends,
+	// keepOutputs the outputs which continue to run in the next one.  Both
+	// are set before cancel is called.
+	stopInputs  []*models.RunningInput
+	keepOutputs map[*models.RunningOutput]bool
 }
 
 // NewAgent returns an Agent for the given Config.
 func NewAgent(config *config.Config) (*Agent, error) {
 	a := &Agent{
-		Config: config,
+		Config:  config,
+		reload:  make(chan reloadRequest),
+		stopped: make(chan struct{}),
 	}
+	a.cardinality = newCardinalityGuard(config)
 	return a, nil
 }
 
@@ -39,46 +86,302 @@ func (a *Agent) Run(ctx context.Context) error {
 		return ctx.Err()
 	}
 
-	log.Printf("D! [agent] Connecting outputs")
-	err := a.connectOutputs(ctx)
+	if address := a.Config.Agent.APIAddress; address != "" {
+		api, err := a.startAPI(address)
+		if err != nil {
+			a.closeOutputs(a.Config.Outputs)
+			return err
+		}
+		a.api = api
+	}
+	defer func() {
+		if a.api != nil {
+			a.api.Close()
+		}
+	}()
+
+	if path := a.Config.Agent.ControlSocket; path != "" {
+		control, err := a.startControl(path)
+		if err != nil {
+			a.closeOutputs(a.Config.Outputs)
+			return err
+		}
+		a.control = control
+	}
+	defer func() {
+		if a.control != nil {
+			a.control.Close()
+		}
+	}()
+
+	a.mu.Lock()
+	a.running = true
+	a.mu.Unlock()
+	defer close(a.stopped)
+
+	// The input channel outlives the generations so that service inputs
+	// keep running across reloads.
+	inputC := make(chan telex.Metric, 100)
+	a.inputC = inputC
+
+	log.Printf("D! [agent] Starting service inputs")
+	err := a.startServiceInputs(ctx, inputC, a.Config.Inputs)
 	if err != nil {
+		a.closeOutputs(a.Config.Outputs)
 		return err
 	}
 
-	inputC := make(chan telex.Metric, 100)
-	procC := make(chan telex.Metric, 100)
-	outputC := make(chan telex.Metric, 100)
+	for {
+		gen := a.runGeneration(inputC)
 
-	startTime := time.Now()
+		a.mu.Lock()
+		a.ready = true
+		a.started = time.Now()
+		a.mu.Unlock()
+
+		select {
+		case <-ctx.Done():
+			a.mu.Lock()
+			a.ready = false
+			a.mu.Unlock()
+
+			gen.stopInputs = a.Config.Inputs
+			gen.cancel()
+			<-gen.done
+
+			log.Printf("D! [agent] Closing outputs")
+			err = a.closeOutputs(a.Config.Outputs)
+			if err != nil {
+				return err
+			}
+
+			log.Printf("D! [agent] Stopped Successfully")
+			return nil
+		case req := <-a.reload:
+			// A failed reload keeps running the current configuration.
+			req.done <- a.switchConfig(ctx, gen, inputC, req.config)
+		}
+	}
+}
+
+// Reload replaces the configuration of the running agent.  Plugins taken
+// from the current configuration by config.SetPrevious keep running, only
+// the others are stopped or started.  It returns once the new configuration
+// is running.
+func (a *Agent) Reload(c *config.Config) error {
+	a.mu.Lock()
+	running := a.running
+	a.mu.Unlock()
+	if !running {
+		return errors.New("agent is not running")
+	}
+
+	req := reloadRequest{config: c, done: make(chan error, 1)}
+	select {
+	case a.reload <- req:
+		return <-req.done
+	case <-a.stopped:
+		return errors.New("agent is not running")
+	}
+}
+
+// switchConfig ends the generation and replaces the configuration with next.
+// Outputs and service inputs present in both configurations keep running.
+// If a service input of next fails to start, the plugins of the current
+// configuration are started again and the error is returned.
+func (a *Agent) switchConfig(
+	ctx context.Context,
+	gen *generation,
+	inputC chan telex.Metric,
+	next *config.Config,
+) error {
+	prev := a.Config
+	tagsChanged := !reflect.DeepEqual(prev.Tags, next.Tags)
+
+	inputs := make(map[*models.RunningInput]bool)
+	for _, input := range next.Inputs {
+		inputs[input] = true
+	}
+
+	// Service inputs add the default tags while running, they are restarted
+	// to change them.
+	var stopped []*models.RunningInput
+	for _, input := range prev.Inputs {
+		if !inputs[input] || tagsChanged {
+			stopped = append(stopped, input)
+		}
+	}
+
+	gen.keepOutputs = make(map[*models.RunningOutput]bool)
+	for _, output := range next.Outputs {
+		gen.keepOutputs[output] = true
+	}
+
+	log.Printf("D! [agent] Stopping plugins for reload")
+	gen.stopInputs = stopped
+	gen.cancel()
+	<-gen.done
+
+	var start []*models.RunningInput
+	restarted := make(map[*models.RunningInput]bool)
+	for _, input := range stopped {
+		restarted[input] = true
+	}
+	for _, input := range next.Inputs {
+		if next.Reused(input) {
+			if tagsChanged {
+				input.SetDefaultTags(next.Tags)
+			}
+			if !restarted[input] {
+				continue
+			}
+		}
+		start = append(start, input)
+	}
 
 	log.Printf("D! [agent] Starting service inputs")
-	err = a.startServiceInputs(ctx, inputC)
-	if err != nil {
+	if err := a.startServiceInputs(ctx, inputC, start); err != nil {
+		log.Printf("E! [agent] Error reloading, restoring the running configuration")
+		if tagsChanged {
+			for _, input := range prev.Inputs {
+				input.SetDefaultTags(prev.Tags)
+			}
+		}
+		if err := a.startServiceInputs(ctx, inputC, stopped); err != nil {
+			log.Printf("E! [agent] Error restarting service inputs: %v", err)
+		}
 		return err
 	}
 
-	var wg sync.WaitGroup
+	// The outputs removed are only closed once the new configuration runs,
+	// they are kept otherwise.
+	var removed []*models.RunningOutput
+	for _, output := range prev.Outputs {
+		if !gen.keepOutputs[output] {
+			removed = append(removed, output)
+		}
+	}
+	if err := a.closeOutputs(removed); err != nil {
+		log.Printf("E! [agent] Error closing outputs: %v", err)
+	}
+
+	a.mu.Lock()
+	a.Config = next
+	a.mu.Unlock()
+	if prev.Agent.Cardinality() != next.Agent.Cardinality() {
+		a.cardinality = newCardinalityGuard(next)
+	}
+	if prev.Agent.APIAddress != next.Agent.APIAddress {
+		a.restartAPI(next.Agent.APIAddress)
+	}
+	if prev.Agent.ControlSocket != next.Agent.ControlSocket {
+		a.restartControl(next.Agent.ControlSocket)
+	}
+
+	log.Printf("I! [agent] Configuration reloaded")
+	return nil
+}
+
+// restartAPI serves the API on a new address, it is stopped if the address
+// is empty.
+func (a *Agent) restartAPI(address string) {
+	if a.api != nil {
+		a.api.Close()
+		a.api = nil
+	}
+	if address == "" {
+		return
+	}
+
+	api, err := a.startAPI(address)
+	if err != nil {
+		log.Printf("E! [agent] %v", err)
+		return
+	}
+	a.api = api
+}
+
+// restartControl listens on a new control socket, it is closed if the path
+// is empty.
+func (a *Agent) restartControl(path string) {
+	if a.control != nil {
+		a.control.Close()
+		a.control = nil
+	}
+	if path == "" {
+		return
+	}
+
+	control, err := a.startControl(path)
+	if err != nil {
+		log.Printf("E! [agent] %v", err)
+		return
+	}
+	a.control = control
+}
+
+// newCardinalityGuard creates the agent wide cardinality guard of the
+// configuration, it returns nil if the guard is disabled.
+func newCardinalityGuard(c *config.Config) *models.CardinalityGuard {
+	if c.Agent.CardinalityLimit <= 0 {
+		return nil
+	}
+	return models.NewCardinalityGuard("", c.Agent.Cardinality())
+}
+
+// runGeneration starts the plugins of the current configuration, it runs
+// until the generation is cancelled.
+func (a *Agent) runGeneration(inputC chan telex.Metric) *generation {
+	ctx, cancel := context.WithCancel(context.Background())
+	gen := &generation{
+		cancel: cancel,
+		done:   make(chan struct{}),
+	}
+
+	log.Printf("D! [agent] Connecting outputs")
+	var reconnects sync.WaitGroup
+	var unconnected []*models.RunningOutput
+	for _, output := range a.Config.Outputs {
+		if !output.Connected() {
+			unconnected = append(unconnected, output)
+		}
+	}
+	a.connectOutputs(ctx, &reconnects, unconnected)
 
-	src := inputC
-	dst := inputC
+	genC := make(chan telex.Metric, 100)
+	procC := make(chan telex.Metric, 100)
+	outputC := make(chan telex.Metric, 100)
+
+	startTime := time.Now()
 
+	var wg sync.WaitGroup
+
+	inputsDone := make(chan struct{})
 	wg.Add(1)
-	go func(dst chan telex.Metric) {
+	go func() {
 		defer wg.Done()
 
-		err := a.runInputs(ctx, startTime, dst)
+		err := a.runInputs(ctx, startTime, inputC)
 		if err != nil {
 			log.Printf("E! [agent] Error running inputs: %v", err)
 		}
 
 		log.Printf("D! [agent] Stopping service inputs")
-		a.stopServiceInputs()
+		a.stopServiceInputs(gen.stopInputs)
+		close(inputsDone)
+	}()
 
+	wg.Add(1)
+	go func(dst chan telex.Metric) {
+		defer wg.Done()
+
+		a.forwardInputs(inputC, dst, inputsDone)
 		close(dst)
 		log.Printf("D! [agent] Input channel closed")
-	}(dst)
+	}(genC)
 
-	src = dst
+	src := genC
+	dst := genC
 
 	if len(a.Config.Processors) > 0 {
 		dst = procC
@@ -120,22 +423,44 @@ func (a *Agent) Run(ctx context.Context) error {
 	go func(src chan telex.Metric) {
 		defer wg.Done()
 
-		err := a.runOutputs(startTime, src)
+		err := a.runOutputs(startTime, src, gen)
 		if err != nil {
 			log.Printf("E! [agent] Error running outputs: %v", err)
 		}
 	}(src)
 
-	wg.Wait()
+	go func() {
+		wg.Wait()
+		reconnects.Wait()
+		close(gen.done)
+	}()
 
-	log.Printf("D! [agent] Closing outputs")
-	err = a.closeOutputs()
-	if err != nil {
-		return err
-	}
+	return gen
+}
 
-	log.Printf("D! [agent] Stopped Successfully")
-	return nil
+// forwardInputs passes metrics from the inputs to the generation until the
+// inputs are done, then forwards the metrics already queued.  Metrics added
+// later by service inputs stay queued for the next generation.
+func (a *Agent) forwardInputs(
+	src <-chan telex.Metric,
+	dst chan<- telex.Metric,
+	done <-chan struct{},
+) {
+	for {
+		select {
+		case metric := <-src:
+			dst <- metric
+		case <-done:
+			for {
+				select {
+				case metric := <-src:
+					dst <- metric
+				default:
+					return
+				}
+			}
+		}
+	}
 }
 
 // Test runs the inputs once and prints the output to stdout in line protocol.
@@ -276,9 +601,14 @@ func (a *Agent) gatherOnInterval(
 			return
 		}
 
-		err = a.gatherOnce(acc, input, interval)
-		if err != nil {
-			acc.AddError(err)
+		if input.Paused() {
+			log.Printf("D! [agent] Skipped gathering from paused input %q",
+				input.Name())
+		} else {
+			err = a.gatherOnce(acc, input, interval)
+			if err != nil {
+				acc.AddError(err)
+			}
 		}
 
 		select {
@@ -291,24 +621,40 @@ func (a *Agent) gatherOnInterval(
 }
 
 // gatherOnce runs the input's Gather function once, logging a warning each
-// interval it fails to complete before.
+// interval it fails to complete before.  The gather is abandoned once the
+// gather_timeout of the input expires, it is not run again until it returns.
 func (a *Agent) gatherOnce(
 	acc telex.Accumulator,
 	input *models.RunningInput,
-	timeout time.Duration,
+	interval time.Duration,
 ) error {
-	ticker := time.NewTicker(timeout)
+	ticker := time.NewTicker(interval)
 	defer ticker.Stop()
 
-	done := make(chan error)
+	ctx, cancel := context.Background(), context.CancelFunc(func() {})
+	timeout := input.Config.GatherTimeout
+	if timeout > 0 {
+		ctx, cancel = context.WithTimeout(ctx, timeout)
+	}
+	defer cancel()
+
+	// Buffered so that an abandoned gather does not block once it returns.
+	done := make(chan error, 1)
 	go func() {
-		done <- input.Gather(acc)
+		done <- input.Gather(ctx, acc)
 	}()
 
 	for {
 		select {
 		case err := <-done:
+			if err != models.ErrGatherRunning && ctx.Err() == context.DeadlineExceeded {
+				return input.GatherTimedOut(timeout)
+			}
 			return err
+		case <-ctx.Done():
+			log.Printf("W! [agent] input %q did not complete within its "+
+				"gather_timeout, abandoning it", input.Name())
+			return input.GatherTimedOut(timeout)
 		case <-ticker.C:
 			log.Printf("W! [agent] input %q did not complete within its interval",
 				input.Name())
@@ -316,26 +662,95 @@ func (a *Agent) gatherOnce(
 	}
 }
 
-// runProcessors applies processors to metrics.
+// runProcessors applies processors to metrics.  The metrics emitted by
+// streaming processors continue through the following processors to agg.
 func (a *Agent) runProcessors(
 	src <-chan telex.Metric,
 	agg chan<- telex.Metric,
 ) error {
+	stop := a.startStreamingProcessors(agg)
+
 	for metric := range src {
-		metrics := a.applyProcessors(metric)
+		metrics := applyProcessors(a.Config.Processors, metric, true)
 
 		for _, metric := range metrics {
 			agg <- metric
 		}
 	}
 
+	stop()
 	return nil
 }
 
-// applyProcessors applies all processors to a metric.
-func (a *Agent) applyProcessors(m telex.Metric) []telex.Metric {
+// startStreamingProcessors starts the streaming processors, it returns a
+// function stopping them in order once no more metrics are applied.
+func (a *Agent) startStreamingProcessors(dst chan<- telex.Metric) func() {
+	var stops []func()
+	processors := a.Config.Processors
+	for i, processor := range processors {
+		sp, ok := processor.Processor.(telex.StreamingProcessor)
+		if !ok {
+			continue
+		}
+
+		next := processors[i+1:]
+		metricC := make(chan telex.Metric, 100)
+		done := make(chan struct{})
+		go func() {
+			defer close(done)
+			for metric := range metricC {
+				for _, metric := range applyProcessors(next, metric, true) {
+					dst <- metric
+				}
+			}
+		}()
+
+		name := "processors." + processor.Name
+		if err := sp.Start(NewAccumulator(processorMaker(name), metricC)); err != nil {
+			log.Printf("E! [agent] Error starting %s: %v", name, err)
+			close(metricC)
+			<-done
+			continue
+		}
+
+		stops = append(stops, func() {
+			sp.Stop()
+			close(metricC)
+			<-done
+		})
+	}
+
+	return func() {
+		for _, stop := range stops {
+			stop()
+		}
+	}
+}
+
+// processorMaker is the MetricMaker of the streaming processors, their
+// metrics are left unmodified.
+type processorMaker string
+
+func (p processorMaker) Name() string {
+	return string(p)
+}
+
+func (p processorMaker) MakeMetric(metric telex.Metric) telex.Metric {
+	return metric
+}
+
+// applyProcessors applies processors to a metric.  Streaming processors are
+// skipped unless streaming is true.
+func applyProcessors(
+	processors models.RunningProcessors,
+	m telex.Metric,
+	streaming bool,
+) []telex.Metric {
 	metrics := []telex.Metric{m}
-	for _, processor := range a.Config.Processors {
+	for _, processor := range processors {
+		if _, ok := processor.Processor.(telex.StreamingProcessor); ok && !streaming {
+			continue
+		}
 		metrics = processor.Apply(metrics...)
 	}
 
@@ -398,8 +813,10 @@ func (a *Agent) runAggregators(
 		}(agg)
 	}
 
+	// Streaming processors are skipped, they may be stopped before the last
+	// push of the aggregators.
 	for metric := range aggregations {
-		metrics := a.applyProcessors(metric)
+		metrics := applyProcessors(a.Config.Processors, metric, false)
 		for _, metric := range metrics {
 			dst <- metric
 		}
@@ -436,10 +853,12 @@ func (a *Agent) push(
 // runOutputs triggers the periodic write for Outputs.
 //
 // When the context is done, outputs continue to run until their buffer is
-// closed, afterwich they run flush once more.
+// closed, afterwich they run flush once more unless they are kept for the
+// next generation.
 func (a *Agent) runOutputs(
 	startTime time.Time,
 	src <-chan telex.Metric,
+	gen *generation,
 ) error {
 	interval := a.Config.Agent.FlushInterval.Duration
 	jitter := a.Config.Agent.FlushJitter.Duration
@@ -466,11 +885,15 @@ func (a *Agent) runOutputs(
 				}
 			}
 
-			a.flush(ctx, output, interval, jitter)
+			a.flush(ctx, output, interval, jitter, gen)
 		}(output)
 	}
 
 	for metric := range src {
+		if a.cardinality != nil && !a.cardinality.Apply(metric) {
+			metric.Drop()
+			continue
+		}
 		for i, output := range a.Config.Outputs {
 			if i == len(a.Config.Outputs)-1 {
 				output.AddMetric(metric)
@@ -480,7 +903,9 @@ func (a *Agent) runOutputs(
 		}
 	}
 
-	log.Println("I! [agent] Hang on, flushing any cached metrics before shutdown")
+	if gen.keepOutputs == nil {
+		log.Println("I! [agent] Hang on, flushing any cached metrics before shutdown")
+	}
 	cancel()
 	wg.Wait()
 
@@ -494,6 +919,7 @@ func (a *Agent) flush(
 	output *models.RunningOutput,
 	interval time.Duration,
 	jitter time.Duration,
+	gen *generation,
 ) {
 	// since we are watching two channels we need a ticker with the jitter
 	// integrated.
@@ -501,35 +927,73 @@ func (a *Agent) flush(
 	defer ticker.Stop()
 
 	logError := func(err error) {
-		if err != nil {
+		if err == models.ErrCircuitOpen {
+			log.Printf("D! [agent] Skipped writing to output [%s]: %v", output.Name, err)
+		} else if err != nil {
 			log.Printf("E! [agent] Error writing to output [%s]: %v", output.Name, err)
 		}
 	}
 
+	// Outputs kept for the next generation hold on to their metrics.
+	final := func() {
+		if !gen.keepOutputs[output] {
+			logError(a.flushOnce(output, interval, output.Write))
+		}
+	}
+
+	// retry is set while a failed write is waiting to be retried.
+	var retry *time.Timer
+	var retryC <-chan time.Time
+	defer func() {
+		if retry != nil {
+			retry.Stop()
+		}
+	}()
+
 	for {
 		// Favor shutdown over other methods.
 		select {
 		case <-ctx.Done():
-			logError(a.flushOnce(output, interval, output.Write))
+			final()
 			return
 		default:
 		}
 
+		var err error
 		select {
 		case <-ticker.C:
-			logError(a.flushOnce(output, interval, output.Write))
+			err = a.flushOnce(output, interval, output.Write)
+		case <-retryC:
+			err = a.flushOnce(output, interval, output.Write)
+		case done := <-output.FlushRequests:
+			err = a.flushOnce(output, interval, output.Write)
+			done <- err
 		case <-output.BatchReady:
 			// Favor the ticker over batch ready
 			select {
 			case <-ticker.C:
-				logError(a.flushOnce(output, interval, output.Write))
+				err = a.flushOnce(output, interval, output.Write)
 			default:
-				logError(a.flushOnce(output, interval, output.WriteBatch))
+				err = a.flushOnce(output, interval, output.WriteBatch)
 			}
 		case <-ctx.Done():
-			logError(a.flushOnce(output, interval, output.Write))
+			final()
 			return
 		}
+		logError(err)
+
+		if retry != nil {
+			retry.Stop()
+			retry, retryC = nil, nil
+		}
+		if err != nil {
+			if delay, ok := output.RetryBackoff(); ok {
+				log.Printf("D! [agent] Retrying write to output [%s] in %s",
+					output.Name, delay)
+				retry = time.NewTimer(delay)
+				retryC = retry.C
+			}
+		}
 	}
 }
 
@@ -562,47 +1026,69 @@ func (a *Agent) flushOnce(
 
 }
 
-// connectOutputs connects to all outputs.
-func (a *Agent) connectOutputs(ctx context.Context) error {
-	for _, output := range a.Config.Outputs {
+// connectOutputs connects to the outputs.  Outputs that fail to connect are
+// retried in the background until the context is done, their metrics are
+// buffered in the meantime.
+func (a *Agent) connectOutputs(
+	ctx context.Context,
+	wg *sync.WaitGroup,
+	outputs []*models.RunningOutput,
+) {
+	for _, output := range outputs {
 		log.Printf("D! [agent] Attempting connection to output: %s\n", output.Name)
-		err := output.Output.Connect()
+		err := output.Connect()
 		if err != nil {
-			log.Printf("E! [agent] Failed to connect to output %s, retrying in 15s, "+
-				"error was '%s' \n", output.Name, err)
+			log.Printf("E! [agent] Failed to connect to output %s, retrying in "+
+				"the background, error was '%s' \n", output.Name, err)
+
+			wg.Add(1)
+			go func(output *models.RunningOutput) {
+				defer wg.Done()
+				a.reconnect(ctx, output)
+			}(output)
+			continue
+		}
+		log.Printf("D! [agent] Successfully connected to output: %s\n", output.Name)
+	}
+}
 
-			err := internal.SleepContext(ctx, 15*time.Second)
-			if err != nil {
-				return err
-			}
+// reconnect tries to connect an output with an exponential backoff until it
+// succeeds or the context is done.
+func (a *Agent) reconnect(ctx context.Context, output *models.RunningOutput) {
+	for attempt := 1; ; attempt++ {
+		err := internal.SleepContext(ctx, output.ConnectBackoff(attempt))
+		if err != nil {
+			return
+		}
 
-			err = output.Output.Connect()
-			if err != nil {
-				return err
-			}
+		err = output.Connect()
+		if err == nil {
+			log.Printf("I! [agent] Successfully connected to output: %s\n", output.Name)
+			return
 		}
-		log.Printf("D! [agent] Successfully connected to output: %s\n", output.Name)
+		log.Printf("E! [agent] Failed to connect to output %s, error was '%s' \n",
+			output.Name, err)
 	}
-	return nil
 }
 
-// closeOutputs closes all outputs.
-func (a *Agent) closeOutputs() error {
+// closeOutputs closes the outputs.
+func (a *Agent) closeOutputs(outputs []*models.RunningOutput) error {
 	var err error
-	for _, output := range a.Config.Outputs {
-		err = output.Output.Close()
+	for _, output := range outputs {
+		err = output.Close()
 	}
 	return err
 }
 
-// startServiceInputs starts all service inputs.
+// startServiceInputs starts the service inputs.
 func (a *Agent) startServiceInputs(
 	ctx context.Context,
 	dst chan<- telex.Metric,
+	inputs []*models.RunningInput,
 ) error {
 	started := []telex.ServiceInput{}
 
-	for _, input := range a.Config.Inputs {
+	for _, input := range inputs {
 		if si, ok := input.Input.(telex.ServiceInput); ok {
 			// Service input plugins are not subject to timestamp rounding.
 			// This only applies to the accumulator passed to Start(), the
@@ -630,9 +1116,9 @@ func (a *Agent) startServiceInputs(
 	return nil
 }
 
-// stopServiceInputs stops all service inputs.
-func (a *Agent) stopServiceInputs() {
-	for _, input := range a.Config.Inputs {
+// stopServiceInputs stops the service inputs.
+func (a *Agent) stopServiceInputs(inputs []*models.RunningInput) {
+	for _, input := range inputs {
 		if si, ok := input.Input.(telex.ServiceInput); ok {
 			si.Stop()
 		}
@@ -0,0 +1,259 @@
+package agent
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"net"
+	"net/http"
+	"sort"
+	"time"
+
+	"github.com/lavaorg/telex/internal/models"
+	"github.com/lavaorg/telex/selfstat"
+)
+
+// gatherGracePeriods is the number of intervals an input can go without a
+// successful gather before the agent is unhealthy.
+const gatherGracePeriods = 3
+
+type agentStatus struct {
+	Ready       bool               `json:"ready"`
+	Healthy     bool               `json:"healthy"`
+	Problems    []string           `json:"problems,omitempty"`
+	Started     *time.Time         `json:"started,omitempty"`
+	Stats       map[string]int64   `json:"stats"`
+	Inputs      []inputStatus      `json:"inputs"`
+	Processors  []processorStatus  `json:"processors"`
+	Aggregators []aggregatorStatus `json:"aggregators"`
+	Outputs     []outputStatus     `json:"outputs"`
+}
+
+type inputStatus struct {
+	Name          string           `json:"name"`
+	Interval      string           `json:"interval"`
+	LastGather    *time.Time       `json:"last_gather,omitempty"`
+	LastError     string           `json:"last_error,omitempty"`
+	LastErrorTime *time.Time       `json:"last_error_time,omitempty"`
+	TimedOut      bool             `json:"timed_out"`
+	Hung          bool             `json:"hung"`
+	Stats         map[string]int64 `json:"stats"`
+}
+
+type processorStatus struct {
+	Name  string `json:"name"`
+	Order int64  `json:"order"`
+}
+
+type aggregatorStatus struct {
+	Name   string           `json:"name"`
+	Period string           `json:"period"`
+	Stats  map[string]int64 `json:"stats"`
+}
+
+type outputStatus struct {
+	Name          string           `json:"name"`
+	Connected     bool             `json:"connected"`
+	BufferSize    int              `json:"buffer_size"`
+	BufferLimit   int              `json:"buffer_limit"`
+	BufferFull    bool             `json:"buffer_full"`
+	LastWrite     *time.Time       `json:"last_write,omitempty"`
+	LastError     string           `json:"last_error,omitempty"`
+	LastErrorTime *time.Time       `json:"last_error_time,omitempty"`
+	Stats         map[string]int64 `json:"stats"`
+}
+
+// startAPI serves the health and status API on the address.
+func (a *Agent) startAPI(address string) (*http.Server, error) {
+	listener, err := net.Listen("tcp", address)
+	if err != nil {
+		return nil, fmt.Errorf("error listening on api_address: %v", err)
+	}
+
+	server := &http.Server{Handler: a.apiHandler()}
+	go func() {
+		err := server.Serve(listener)
+		if err != nil && err != http.ErrServerClosed {
+			log.Printf("E! [agent] Error serving the API: %v", err)
+		}
+	}()
+
+	log.Printf("I! [agent] Serving the API on http://%s", listener.Addr())
+	return server, nil
+}
+
+func (a *Agent) apiHandler() http.Handler {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/health", a.serveHealth)
+	mux.HandleFunc("/ready", a.serveReady)
+	mux.HandleFunc("/status", a.serveStatus)
+	return mux
+}
+
+// serveHealth responds with 503 if an input did not gather recently or its
+// last gather timed out, or an output is not connected, failed its last
+// write or has a full buffer.
+func (a *Agent) serveHealth(w http.ResponseWriter, r *http.Request) {
+	problems := a.status(time.Now()).Problems
+	if len(problems) > 0 {
+		writeJSON(w, http.StatusServiceUnavailable, map[string]interface{}{
+			"status":   "fail",
+			"problems": problems,
+		})
+		return
+	}
+	writeJSON(w, http.StatusOK, map[string]interface{}{"status": "pass"})
+}
+
+// serveReady responds with 503 until the outputs are connected and the
+// inputs started, and once the agent is stopping.
+func (a *Agent) serveReady(w http.ResponseWriter, r *http.Request) {
+	a.mu.Lock()
+	ready := a.ready
+	a.mu.Unlock()
+
+	if !ready {
+		writeJSON(w, http.StatusServiceUnavailable, map[string]interface{}{"status": "not ready"})
+		return
+	}
+	writeJSON(w, http.StatusOK, map[string]interface{}{"status": "ready"})
+}
+
+func (a *Agent) serveStatus(w http.ResponseWriter, r *http.Request) {
+	writeJSON(w, http.StatusOK, a.status(time.Now()))
+}
+
+// status returns the status of the agent and of its plugins, sorted by name.
+func (a *Agent) status(now time.Time) *agentStatus {
+	a.mu.Lock()
+	c := a.Config
+	ready := a.ready
+	started := a.started
+	a.mu.Unlock()
+
+	s := &agentStatus{
+		Ready:       ready,
+		Started:     timeOrNil(started),
+		Stats:       selfstat.Values("agent", map[string]string{}),
+		Inputs:      []inputStatus{},
+		Processors:  []processorStatus{},
+		Aggregators: []aggregatorStatus{},
+		Outputs:     []outputStatus{},
+	}
+
+	inputs := append([]*models.RunningInput(nil), c.Inputs...)
+	sort.SliceStable(inputs, func(i, j int) bool {
+		return inputs[i].Name() < inputs[j].Name()
+	})
+	for _, input := range inputs {
+		interval := c.Agent.Interval.Duration
+		if input.Config.Interval != 0 {
+			interval = input.Config.Interval
+		}
+
+		status := input.Status()
+		timedOut, hung := input.TimedOut()
+		s.Inputs = append(s.Inputs, inputStatus{
+			Name:          input.Name(),
+			Interval:      interval.String(),
+			LastGather:    timeOrNil(status.LastSuccess),
+			LastError:     status.LastError,
+			LastErrorTime: timeOrNil(status.LastErrorTime),
+			TimedOut:      timedOut,
+			Hung:          hung,
+			Stats:         selfstat.Values("gather", map[string]string{"input": input.Config.Name}),
+		})
+
+		switch {
+		case hung:
+			s.Problems = append(s.Problems, fmt.Sprintf(
+				"%s: gather timed out and is still running", input.Name()))
+		case timedOut:
+			s.Problems = append(s.Problems, fmt.Sprintf(
+				"%s: last gather timed out", input.Name()))
+		}
+
+		// Inputs started in this generation have a grace period.
+		last := status.LastSuccess
+		if last.Before(started) {
+			last = started
+		}
+		if ready && now.Sub(last) > gatherGracePeriods*interval {
+			s.Problems = append(s.Problems, fmt.Sprintf(
+				"%s: no successful gather in %d intervals", input.Name(),
+				gatherGracePeriods))
+		}
+	}
+
+	for _, processor := range c.Processors {
+		s.Processors = append(s.Processors, processorStatus{
+			Name:  "processors." + processor.Name,
+			Order: processor.Config.Order,
+		})
+	}
+
+	aggregators := append([]*models.RunningAggregator(nil), c.Aggregators...)
+	sort.SliceStable(aggregators, func(i, j int) bool {
+		return aggregators[i].Name() < aggregators[j].Name()
+	})
+	for _, aggregator := range aggregators {
+		s.Aggregators = append(s.Aggregators, aggregatorStatus{
+			Name:   aggregator.Name(),
+			Period: aggregator.Period().String(),
+			Stats:  selfstat.Values("aggregate", map[string]string{"aggregator": aggregator.Config.Name}),
+		})
+	}
+
+	outputs := append([]*models.RunningOutput(nil), c.Outputs...)
+	sort.SliceStable(outputs, func(i, j int) bool {
+		return outputs[i].Name < outputs[j].Name
+	})
+	for _, output := range outputs {
+		name := "outputs." + output.Name
+		status := output.Status()
+		o := outputStatus{
+			Name:          name,
+			Connected:     output.Connected(),
+			BufferSize:    output.BufferLen(),
+			BufferLimit:   output.MetricBufferLimit,
+			BufferFull:    output.BufferFull(),
+			LastWrite:     timeOrNil(status.LastSuccess),
+			LastError:     status.LastError,
+			LastErrorTime: timeOrNil(status.LastErrorTime),
+			Stats:         selfstat.Values("write", map[string]string{"output": output.Name}),
+		}
+		s.Outputs = append(s.Outputs, o)
+
+		switch {
+		case !o.Connected:
+			s.Problems = append(s.Problems, fmt.Sprintf("%s: not connected", name))
+		case status.Failing():
+			s.Problems = append(s.Problems, fmt.Sprintf(
+				"%s: last write failed: %s", name, status.LastError))
+		}
+		if o.BufferFull {
+			s.Problems = append(s.Problems, fmt.Sprintf("%s: buffer full", name))
+		}
+	}
+
+	if !ready {
+		s.Problems = append(s.Problems, "agent is not running")
+	}
+	s.Healthy = len(s.Problems) == 0
+	return s
+}
+
+func timeOrNil(t time.Time) *time.Time {
+	if t.IsZero() {
+		return nil
+	}
+	return &t
+}
+
+func writeJSON(w http.ResponseWriter, code int, v interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(code)
+	if err := json.NewEncoder(w).Encode(v); err != nil {
+		log.Printf("E! [agent] Error writing API response: %v", err)
+	}
+}
@@ -0,0 +1,260 @@
+package agent
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"reflect"
+	"testing"
+
+	"github.com/lavaorg/telex"
+	"github.com/lavaorg/telex/internal/config"
+	"github.com/lavaorg/telex/plugins/inputs"
+	"github.com/lavaorg/telex/plugins/outputs"
+	"github.com/stretchr/testify/require"
+)
+
+type failingInput struct{}
+
+func (i *failingInput) SampleConfig() string { return "" }
+func (i *failingInput) Description() string  { return "" }
+func (i *failingInput) Gather(acc telex.Accumulator) error {
+	return errors.New("gather failed")
+}
+
+// hangingRelease unblocks the gathers of hangingInput.
+var hangingRelease chan struct{}
+
+type hangingInput struct{}
+
+func (i *hangingInput) SampleConfig() string { return "" }
+func (i *hangingInput) Description() string  { return "" }
+func (i *hangingInput) Gather(acc telex.Accumulator) error {
+	<-hangingRelease
+	return nil
+}
+
+type failingOutput struct{}
+
+func (o *failingOutput) SampleConfig() string { return "" }
+func (o *failingOutput) Description() string  { return "" }
+func (o *failingOutput) Connect() error       { return nil }
+func (o *failingOutput) Close() error         { return nil }
+func (o *failingOutput) Write(metrics []telex.Metric) error {
+	return errors.New("write failed")
+}
+
+func init() {
+	inputs.Add("api_test_failing", func() telex.Input { return &failingInput{} })
+	inputs.Add("api_test_hanging", func() telex.Input { return &hangingInput{} })
+	outputs.Add("api_test_failing", func() telex.Output { return &failingOutput{} })
+}
+
+const failingConfig = `
+[agent]
+  interval = "10ms"
+  flush_interval = "10ms"
+  round_interval = false
+  omit_hostname = true
+
+[[inputs.api_test_failing]]
+
+[[inputs.reload_test]]
+  value = 1
+
+[[outputs.api_test_failing]]
+`
+
+const hangingConfig = `
+[agent]
+  interval = "50ms"
+  flush_interval = "10ms"
+  round_interval = false
+  omit_hostname = true
+
+[[inputs.api_test_hanging]]
+  gather_timeout = "10ms"
+
+[[outputs.reload_test]]
+`
+
+func get(t *testing.T, handler http.Handler, path string, v interface{}) int {
+	w := httptest.NewRecorder()
+	handler.ServeHTTP(w, httptest.NewRequest("GET", path, nil))
+	require.Equal(t, "application/json", w.Header().Get("Content-Type"))
+	if v != nil {
+		require.NoError(t, json.Unmarshal(w.Body.Bytes(), v))
+	}
+	return w.Code
+}
+
+func runAgent(t *testing.T, a *Agent) func() {
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan error)
+	go func() {
+		done <- a.Run(ctx)
+	}()
+	return func() {
+		cancel()
+		require.NoError(t, <-done)
+	}
+}
+
+func TestAPI_Healthy(t *testing.T) {
+	c := loadReloadConfig(t, nil, 1)
+	output := c.Outputs[0].Output.(*reloadOutput)
+	a, err := NewAgent(c)
+	require.NoError(t, err)
+	handler := a.apiHandler()
+
+	require.Equal(t, http.StatusServiceUnavailable, get(t, handler, "/ready", nil))
+	require.Equal(t, http.StatusServiceUnavailable, get(t, handler, "/health", nil))
+
+	stop := runAgent(t, a)
+	waitFor(t, func() bool { return output.has(1) })
+
+	var ready map[string]string
+	require.Equal(t, http.StatusOK, get(t, handler, "/ready", &ready))
+	require.Equal(t, "ready", ready["status"])
+
+	var health map[string]interface{}
+	require.Equal(t, http.StatusOK, get(t, handler, "/health", &health))
+	require.Equal(t, "pass", health["status"])
+
+	var status agentStatus
+	require.Equal(t, http.StatusOK, get(t, handler, "/status", &status))
+	require.True(t, status.Ready)
+	require.True(t, status.Healthy)
+	require.NotNil(t, status.Started)
+
+	require.Len(t, status.Inputs, 1)
+	require.Equal(t, "inputs.reload_test", status.Inputs[0].Name)
+	require.Equal(t, "10ms", status.Inputs[0].Interval)
+	require.NotNil(t, status.Inputs[0].LastGather)
+	require.Empty(t, status.Inputs[0].LastError)
+	require.True(t, status.Inputs[0].Stats["metrics_gathered"] > 0)
+
+	require.Len(t, status.Outputs, 1)
+	require.Equal(t, "outputs.reload_test", status.Outputs[0].Name)
+	require.True(t, status.Outputs[0].Connected)
+	require.NotNil(t, status.Outputs[0].LastWrite)
+	require.False(t, status.Outputs[0].BufferFull)
+	require.Contains(t, status.Outputs[0].Stats, "metrics_written")
+
+	stop()
+	require.Equal(t, http.StatusServiceUnavailable, get(t, handler, "/ready", nil))
+}
+
+func loadConfigString(t *testing.T, s string) *config.Config {
+	f, err := ioutil.TempFile("", "api")
+	require.NoError(t, err)
+	defer os.Remove(f.Name())
+	_, err = f.WriteString(s)
+	require.NoError(t, err)
+	require.NoError(t, f.Close())
+
+	c := config.NewConfig()
+	require.NoError(t, c.LoadConfig(f.Name()))
+	return c
+}
+
+func findInput(t *testing.T, s agentStatus, name string) inputStatus {
+	for _, input := range s.Inputs {
+		if input.Name == name {
+			return input
+		}
+	}
+	require.FailNow(t, "input not found", name)
+	return inputStatus{}
+}
+
+func findOutput(t *testing.T, s agentStatus, name string) outputStatus {
+	for _, output := range s.Outputs {
+		if output.Name == name {
+			return output
+		}
+	}
+	require.FailNow(t, "output not found", name)
+	return outputStatus{}
+}
+
+func TestAPI_Unhealthy(t *testing.T) {
+	c := loadConfigString(t, failingConfig)
+	a, err := NewAgent(c)
+	require.NoError(t, err)
+	handler := a.apiHandler()
+
+	stop := runAgent(t, a)
+	defer stop()
+
+	var health struct {
+		Status   string   `json:"status"`
+		Problems []string `json:"problems"`
+	}
+	expected := []string{
+		"inputs.api_test_failing: no successful gather in 3 intervals",
+		"outputs.api_test_failing: last write failed: write failed",
+	}
+	waitFor(t, func() bool {
+		get(t, handler, "/health", &health)
+		return reflect.DeepEqual(expected, health.Problems)
+	})
+	require.Equal(t, "fail", health.Status)
+
+	var status agentStatus
+	require.Equal(t, http.StatusOK, get(t, handler, "/status", &status))
+	require.False(t, status.Healthy)
+	require.Equal(t, []string{"inputs.api_test_failing", "inputs.reload_test"},
+		[]string{status.Inputs[0].Name, status.Inputs[1].Name})
+
+	input := findInput(t, status, "inputs.api_test_failing")
+	require.Equal(t, "gather failed", input.LastError)
+	require.Nil(t, input.LastGather)
+	require.NotNil(t, input.LastErrorTime)
+
+	output := findOutput(t, status, "outputs.api_test_failing")
+	require.Equal(t, "write failed", output.LastError)
+	require.Nil(t, output.LastWrite)
+}
+
+func TestAPI_GatherTimeout(t *testing.T) {
+	hangingRelease = make(chan struct{})
+	c := loadConfigString(t, hangingConfig)
+	a, err := NewAgent(c)
+	require.NoError(t, err)
+	handler := a.apiHandler()
+
+	stop := runAgent(t, a)
+	defer stop()
+
+	var health struct {
+		Status   string   `json:"status"`
+		Problems []string `json:"problems"`
+	}
+	waitFor(t, func() bool {
+		get(t, handler, "/health", &health)
+		for _, problem := range health.Problems {
+			if problem == "inputs.api_test_hanging: gather timed out and is still running" {
+				return true
+			}
+		}
+		return false
+	})
+
+	var status agentStatus
+	get(t, handler, "/status", &status)
+	require.True(t, status.Inputs[0].TimedOut)
+	require.True(t, status.Inputs[0].Hung)
+	require.Equal(t, "gather timed out after 10ms", status.Inputs[0].LastError)
+	require.True(t, status.Inputs[0].Stats["gather_timeouts"] > 0)
+
+	// The next gather once the hung one returns makes the agent healthy.
+	close(hangingRelease)
+	waitFor(t, func() bool {
+		return get(t, handler, "/health", nil) == http.StatusOK
+	})
+}
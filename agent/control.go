@@ -0,0 +1,334 @@
+package agent
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/lavaorg/telex/internal/models"
+	"github.com/lavaorg/telex/logger"
+	"github.com/lavaorg/telex/plugins/serializers/influx"
+)
+
+// controlTimeout bounds the time to read a request, and to hand it to the
+// goroutines of the agent.
+const controlTimeout = 10 * time.Second
+
+// ControlUsage describes the commands of the control socket.
+const ControlUsage = `Commands:
+
+  list                         list the inputs and outputs
+  pause <input>...             stop gathering from the inputs
+  resume <input>...            resume gathering from the inputs
+  gather <input>               gather from the input once
+  flush <output>               write the buffer of the output
+  dump <output> [count]        print the metrics buffered by the output
+  log-level <level> [plugin]   change the log level, of a plugin or of all
+`
+
+// ControlRequest is a command sent to the control socket of the agent.
+type ControlRequest struct {
+	Command string   `json:"command"`
+	Args    []string `json:"args,omitempty"`
+}
+
+// ControlResponse is the result of a ControlRequest.
+type ControlResponse struct {
+	Output string `json:"output,omitempty"`
+	Error  string `json:"error,omitempty"`
+}
+
+// SendControl sends a request to the control socket at path and returns the
+// output of the command.
+func SendControl(path string, req ControlRequest) (string, error) {
+	conn, err := net.DialTimeout("unix", path, controlTimeout)
+	if err != nil {
+		return "", err
+	}
+	defer conn.Close()
+
+	if err := json.NewEncoder(conn).Encode(req); err != nil {
+		return "", err
+	}
+
+	var resp ControlResponse
+	if err := json.NewDecoder(conn).Decode(&resp); err != nil {
+		return "", err
+	}
+	if resp.Error != "" {
+		return resp.Output, errors.New(resp.Error)
+	}
+	return resp.Output, nil
+}
+
+// startControl listens on the control socket at path.  A socket left by a
+// previous agent is removed, unless an agent still listens on it.
+func (a *Agent) startControl(path string) (net.Listener, error) {
+	if fi, err := os.Lstat(path); err == nil && fi.Mode()&os.ModeSocket != 0 {
+		if conn, err := net.Dial("unix", path); err == nil {
+			conn.Close()
+			return nil, fmt.Errorf("control socket %s is in use", path)
+		}
+		os.Remove(path)
+	}
+
+	listener, err := net.Listen("unix", path)
+	if err != nil {
+		return nil, fmt.Errorf("error listening on control_socket: %v", err)
+	}
+	if err := os.Chmod(path, 0660); err != nil {
+		listener.Close()
+		return nil, err
+	}
+
+	go func() {
+		for {
+			conn, err := listener.Accept()
+			if err != nil {
+				return
+			}
+			go a.handleControl(conn)
+		}
+	}()
+
+	log.Printf("I! [agent] Listening on control socket %s", path)
+	return listener, nil
+}
+
+func (a *Agent) handleControl(conn net.Conn) {
+	defer conn.Close()
+	conn.SetReadDeadline(time.Now().Add(controlTimeout))
+
+	var resp ControlResponse
+	var req ControlRequest
+	err := json.NewDecoder(bufio.NewReader(conn)).Decode(&req)
+	if err == nil {
+		log.Printf("D! [agent] Control command: %s %s", req.Command,
+			strings.Join(req.Args, " "))
+		resp.Output, err = a.runControl(req)
+	}
+	if err != nil {
+		resp.Error = err.Error()
+	}
+
+	if err := json.NewEncoder(conn).Encode(resp); err != nil {
+		log.Printf("E! [agent] Error writing control response: %v", err)
+	}
+}
+
+// runControl runs a command, it returns its output.
+func (a *Agent) runControl(req ControlRequest) (string, error) {
+	a.mu.Lock()
+	ready := a.ready
+	a.mu.Unlock()
+	if !ready {
+		return "", errors.New("agent is not running")
+	}
+
+	args := req.Args
+	switch req.Command {
+	case "list":
+		return a.controlList(), nil
+	case "pause", "resume":
+		if len(args) == 0 {
+			return "", fmt.Errorf("usage: %s <input>...", req.Command)
+		}
+		var inputs []*models.RunningInput
+		for _, name := range args {
+			found, err := a.findInputs(name)
+			if err != nil {
+				return "", err
+			}
+			inputs = append(inputs, found...)
+		}
+		for _, input := range inputs {
+			if req.Command == "pause" {
+				input.Pause()
+				log.Printf("I! [agent] Paused input %s", input.Name())
+			} else {
+				input.Resume()
+				log.Printf("I! [agent] Resumed input %s", input.Name())
+			}
+		}
+		return "", nil
+	case "gather":
+		if len(args) != 1 {
+			return "", errors.New("usage: gather <input>")
+		}
+		inputs, err := a.findInputs(args[0])
+		if err != nil {
+			return "", err
+		}
+		for _, input := range inputs {
+			if err := a.gatherNow(input); err != nil {
+				return "", fmt.Errorf("%s: %v", input.Name(), err)
+			}
+		}
+		return "", nil
+	case "flush":
+		if len(args) != 1 {
+			return "", errors.New("usage: flush <output>")
+		}
+		outputs, err := a.findOutputs(args[0])
+		if err != nil {
+			return "", err
+		}
+		for _, output := range outputs {
+			if err := a.flushNow(output); err != nil {
+				return "", fmt.Errorf("outputs.%s: %v", output.Name, err)
+			}
+		}
+		return "", nil
+	case "dump":
+		if len(args) != 1 && len(args) != 2 {
+			return "", errors.New("usage: dump <output> [count]")
+		}
+		count := 0
+		if len(args) == 2 {
+			var err error
+			if count, err = strconv.Atoi(args[1]); err != nil || count <= 0 {
+				return "", fmt.Errorf("invalid count %q", args[1])
+			}
+		}
+		outputs, err := a.findOutputs(args[0])
+		if err != nil {
+			return "", err
+		}
+		return dumpBuffers(outputs, count), nil
+	case "log-level":
+		if len(args) != 1 && len(args) != 2 {
+			return "", errors.New("usage: log-level <level> [plugin]")
+		}
+		level, err := logger.ParseLevel(args[0])
+		if err != nil {
+			return "", err
+		}
+		plugin := ""
+		if len(args) == 2 {
+			plugin = args[1]
+		}
+		logger.SetLevel(plugin, level)
+		return "", nil
+	}
+	return "", fmt.Errorf("unknown command %q", req.Command)
+}
+
+func (a *Agent) controlList() string {
+	a.mu.Lock()
+	c := a.Config
+	a.mu.Unlock()
+
+	var b strings.Builder
+	for _, input := range c.Inputs {
+		state := "running"
+		if input.Paused() {
+			state = "paused"
+		}
+		fmt.Fprintf(&b, "%s\t%s\n", input.Name(), state)
+	}
+	for _, output := range c.Outputs {
+		state := "connected"
+		if !output.Connected() {
+			state = "not connected"
+		}
+		fmt.Fprintf(&b, "outputs.%s\t%s, %d/%d buffered\n", output.Name, state,
+			output.BufferLen(), output.MetricBufferLimit)
+	}
+	return b.String()
+}
+
+// findInputs returns the inputs named "inputs.<name>", or "<name>".
+func (a *Agent) findInputs(name string) ([]*models.RunningInput, error) {
+	a.mu.Lock()
+	c := a.Config
+	a.mu.Unlock()
+
+	var found []*models.RunningInput
+	for _, input := range c.Inputs {
+		if input.Name() == name || input.Config.Name == name {
+			found = append(found, input)
+		}
+	}
+	if len(found) == 0 {
+		return nil, fmt.Errorf("no input named %q", name)
+	}
+	return found, nil
+}
+
+// findOutputs returns the outputs named "outputs.<name>", or "<name>".
+func (a *Agent) findOutputs(name string) ([]*models.RunningOutput, error) {
+	a.mu.Lock()
+	c := a.Config
+	a.mu.Unlock()
+
+	var found []*models.RunningOutput
+	for _, output := range c.Outputs {
+		if "outputs."+output.Name == name || output.Name == name {
+			found = append(found, output)
+		}
+	}
+	if len(found) == 0 {
+		return nil, fmt.Errorf("no output named %q", name)
+	}
+	return found, nil
+}
+
+// gatherNow gathers from the input once, its metrics are sent through the
+// processors and aggregators to the outputs.
+func (a *Agent) gatherNow(input *models.RunningInput) error {
+	a.mu.Lock()
+	c := a.Config
+	a.mu.Unlock()
+
+	interval := c.Agent.Interval.Duration
+	if input.Config.Interval != 0 {
+		interval = input.Config.Interval
+	}
+
+	acc := NewAccumulator(input, a.inputC)
+	acc.SetPrecision(c.Agent.Precision.Duration, interval)
+	return a.gatherOnce(acc, input, interval)
+}
+
+// flushNow asks the flush goroutine of the output to write its buffer.
+func (a *Agent) flushNow(output *models.RunningOutput) error {
+	done := make(chan error, 1)
+	select {
+	case output.FlushRequests <- done:
+	case <-time.After(controlTimeout):
+		return errors.New("output is not flushing")
+	}
+	return <-done
+}
+
+// dumpBuffers returns the metrics buffered by the outputs in line protocol,
+// at most count per output if count is positive.
+func dumpBuffers(outputs []*models.RunningOutput, count int) string {
+	s := influx.NewSerializer()
+	s.SetFieldSortOrder(influx.SortFields)
+
+	var b strings.Builder
+	for _, output := range outputs {
+		n := count
+		if n <= 0 {
+			// The batch may add up to a batch size to the buffer.
+			n = output.BufferLen() + output.MetricBatchSize
+		}
+		for _, metric := range output.BufferedMetrics(n) {
+			octets, err := s.Serialize(metric)
+			if err != nil {
+				log.Printf("D! [agent] Could not serialize metric: %v", err)
+				continue
+			}
+			b.Write(octets)
+		}
+	}
+	return b.String()
+}
@@ -0,0 +1,116 @@
+package agent
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/lavaorg/telex/internal/config"
+	"github.com/stretchr/testify/require"
+)
+
+const controlConfig = `
+[agent]
+  interval = "1h"
+  flush_interval = "1h"
+  round_interval = false
+  omit_hostname = true
+  control_socket = %q
+
+[[inputs.reload_test]]
+  value = 1
+
+[[outputs.reload_test]]
+`
+
+func TestControl(t *testing.T) {
+	dir, err := ioutil.TempDir("", "control")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	path := filepath.Join(dir, "telex.sock")
+	conf := filepath.Join(dir, "telex.conf")
+	err = ioutil.WriteFile(conf, []byte(fmt.Sprintf(controlConfig, path)), 0644)
+	require.NoError(t, err)
+
+	c := config.NewConfig()
+	require.NoError(t, c.LoadConfig(conf))
+	output := c.Outputs[0].Output.(*reloadOutput)
+	a, err := NewAgent(c)
+	require.NoError(t, err)
+
+	stop := runAgent(t, a)
+	defer stop()
+
+	send := func(command string, args ...string) (string, error) {
+		return SendControl(path, ControlRequest{Command: command, Args: args})
+	}
+	waitFor(t, func() bool {
+		_, err := send("list")
+		return err == nil
+	})
+
+	out, err := send("list")
+	require.NoError(t, err)
+	require.Equal(t, "inputs.reload_test\trunning\n"+
+		"outputs.reload_test\tconnected, 0/10000 buffered\n", out)
+
+	// The metrics of a one-shot gather are buffered until the next flush.
+	_, err = send("gather", "reload_test")
+	require.NoError(t, err)
+	waitFor(t, func() bool {
+		out, err := send("dump", "outputs.reload_test")
+		require.NoError(t, err)
+		return out != ""
+	})
+	out, err = send("dump", "reload_test", "1")
+	require.NoError(t, err)
+	require.Regexp(t, `^reload value=1i \d+\n$`, out)
+	require.False(t, output.has(1))
+
+	_, err = send("flush", "reload_test")
+	require.NoError(t, err)
+	require.True(t, output.has(1))
+	out, err = send("dump", "reload_test")
+	require.NoError(t, err)
+	require.Empty(t, out)
+
+	_, err = send("pause", "inputs.reload_test")
+	require.NoError(t, err)
+	require.True(t, c.Inputs[0].Paused())
+	_, err = send("resume", "reload_test")
+	require.NoError(t, err)
+	require.False(t, c.Inputs[0].Paused())
+
+	_, err = send("log-level", "debug", "inputs.reload_test")
+	require.NoError(t, err)
+
+	_, err = send("log-level", "loud")
+	require.Error(t, err)
+	_, err = send("pause", "missing")
+	require.EqualError(t, err, `no input named "missing"`)
+	_, err = send("dump", "reload_test", "none")
+	require.EqualError(t, err, `invalid count "none"`)
+	_, err = send("restart")
+	require.EqualError(t, err, `unknown command "restart"`)
+}
+
+func TestControl_SocketInUse(t *testing.T) {
+	dir, err := ioutil.TempDir("", "control")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "telex.sock")
+
+	a := &Agent{}
+	listener, err := a.startControl(path)
+	require.NoError(t, err)
+	defer listener.Close()
+
+	_, err = a.startControl(path)
+	require.EqualError(t, err, fmt.Sprintf("control socket %s is in use", path))
+
+	_, err = SendControl(path, ControlRequest{Command: "list"})
+	require.EqualError(t, err, "agent is not running")
+}
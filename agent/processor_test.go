@@ -0,0 +1,99 @@
+package agent
+
+import (
+	"testing"
+
+	"github.com/lavaorg/telex"
+	"github.com/lavaorg/telex/plugins/processors"
+	"github.com/stretchr/testify/require"
+)
+
+// streamingProcessor emits the metrics multiplied by ten from its goroutine.
+type streamingProcessor struct {
+	acc  telex.Accumulator
+	in   chan telex.Metric
+	done chan struct{}
+}
+
+func (p *streamingProcessor) SampleConfig() string { return "" }
+func (p *streamingProcessor) Description() string  { return "" }
+
+func (p *streamingProcessor) Start(acc telex.Accumulator) error {
+	p.acc = acc
+	p.in = make(chan telex.Metric)
+	p.done = make(chan struct{})
+	go func() {
+		defer close(p.done)
+		for m := range p.in {
+			v, _ := m.GetField("value")
+			acc.AddFields(m.Name(), map[string]interface{}{"value": v.(int64) * 10}, nil)
+		}
+	}()
+	return nil
+}
+
+func (p *streamingProcessor) Apply(in ...telex.Metric) []telex.Metric {
+	for _, m := range in {
+		p.in <- m
+	}
+	return nil
+}
+
+func (p *streamingProcessor) Stop() {
+	close(p.in)
+	<-p.done
+}
+
+// incrementProcessor adds one to the metrics.
+type incrementProcessor struct{}
+
+func (p *incrementProcessor) SampleConfig() string { return "" }
+func (p *incrementProcessor) Description() string  { return "" }
+func (p *incrementProcessor) Apply(in ...telex.Metric) []telex.Metric {
+	for _, m := range in {
+		v, _ := m.GetField("value")
+		m.AddField("value", v.(int64)+1)
+	}
+	return in
+}
+
+func init() {
+	processors.Add("streaming_test", func() telex.Processor { return &streamingProcessor{} })
+	processors.Add("increment_test", func() telex.Processor { return &incrementProcessor{} })
+}
+
+const streamingConfig = `
+[agent]
+  interval = "10ms"
+  flush_interval = "10ms"
+  round_interval = false
+  omit_hostname = true
+
+[[inputs.reload_test]]
+  value = 1
+
+[[processors.streaming_test]]
+  order = 1
+
+[[processors.increment_test]]
+  order = 2
+
+[[outputs.reload_test]]
+`
+
+func TestAgent_StreamingProcessor(t *testing.T) {
+	c := loadConfigString(t, streamingConfig)
+	output := c.Outputs[0].Output.(*reloadOutput)
+	a, err := NewAgent(c)
+	require.NoError(t, err)
+
+	stop := runAgent(t, a)
+	defer stop()
+
+	// The metrics emitted by the streaming processor continue through the
+	// following processors.
+	waitFor(t, func() bool { return output.has(11) })
+	require.False(t, output.has(1))
+	require.False(t, output.has(2))
+	require.False(t, output.has(10))
+}
@@ -0,0 +1,181 @@
+package agent
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/lavaorg/telex"
+	"github.com/lavaorg/telex/internal/config"
+	"github.com/lavaorg/telex/plugins/inputs"
+	"github.com/lavaorg/telex/plugins/outputs"
+	"github.com/stretchr/testify/require"
+)
+
+type reloadInput struct {
+	Value int64 `toml:"value"`
+}
+
+func (i *reloadInput) SampleConfig() string { return "" }
+func (i *reloadInput) Description() string  { return "" }
+func (i *reloadInput) Gather(acc telex.Accumulator) error {
+	acc.AddFields("reload", map[string]interface{}{"value": i.Value}, nil)
+	return nil
+}
+
+type reloadOutput struct {
+	sync.Mutex
+	Name     string `toml:"name"`
+	connects int
+	values   []int64
+}
+
+func (o *reloadOutput) SampleConfig() string { return "" }
+func (o *reloadOutput) Description() string  { return "" }
+func (o *reloadOutput) Close() error         { return nil }
+func (o *reloadOutput) Connect() error {
+	o.Lock()
+	defer o.Unlock()
+	o.connects++
+	return nil
+}
+func (o *reloadOutput) Write(metrics []telex.Metric) error {
+	o.Lock()
+	defer o.Unlock()
+	for _, m := range metrics {
+		v, _ := m.GetField("value")
+		o.values = append(o.values, v.(int64))
+	}
+	return nil
+}
+
+func (o *reloadOutput) has(value int64) bool {
+	o.Lock()
+	defer o.Unlock()
+	for _, v := range o.values {
+		if v == value {
+			return true
+		}
+	}
+	return false
+}
+
+func init() {
+	inputs.Add("reload_test", func() telex.Input { return &reloadInput{} })
+	outputs.Add("reload_test", func() telex.Output { return &reloadOutput{} })
+}
+
+const reloadConfig = `
+[agent]
+  interval = "10ms"
+  flush_interval = "10ms"
+  round_interval = false
+  omit_hostname = true
+
+[[inputs.reload_test]]
+  value = %d
+
+[[outputs.reload_test]]
+  name = "kept"
+`
+
+func loadReloadConfig(t *testing.T, previous *config.Config, value int) *config.Config {
+	f, err := ioutil.TempFile("", "reload")
+	require.NoError(t, err)
+	defer os.Remove(f.Name())
+	_, err = f.WriteString(fmt.Sprintf(reloadConfig, value))
+	require.NoError(t, err)
+	require.NoError(t, f.Close())
+
+	c := config.NewConfig()
+	c.SetPrevious(previous)
+	require.NoError(t, c.LoadConfig(f.Name()))
+	return c
+}
+
+func waitFor(t *testing.T, condition func() bool) {
+	deadline := time.Now().Add(5 * time.Second)
+	for !condition() {
+		if time.Now().After(deadline) {
+			t.Fatal("timed out waiting for condition")
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
+
+func TestAgent_ReloadKeepsUnchangedOutput(t *testing.T) {
+	c := loadReloadConfig(t, nil, 1)
+	output := c.Outputs[0].Output.(*reloadOutput)
+
+	a, err := NewAgent(c)
+	require.NoError(t, err)
+	require.Error(t, a.Reload(c))
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan error)
+	go func() {
+		done <- a.Run(ctx)
+	}()
+
+	waitFor(t, func() bool { return output.has(1) })
+
+	next := loadReloadConfig(t, a.Config, 2)
+	require.True(t, next.Outputs[0] == c.Outputs[0])
+	require.False(t, next.Inputs[0] == c.Inputs[0])
+	require.NoError(t, a.Reload(next))
+
+	waitFor(t, func() bool { return output.has(2) })
+
+	cancel()
+	require.NoError(t, <-done)
+
+	output.Lock()
+	defer output.Unlock()
+	require.Equal(t, 1, output.connects)
+}
+
+type failingServiceInput struct{}
+
+func (i *failingServiceInput) SampleConfig() string               { return "" }
+func (i *failingServiceInput) Description() string                { return "" }
+func (i *failingServiceInput) Gather(acc telex.Accumulator) error { return nil }
+func (i *failingServiceInput) Start(acc telex.Accumulator) error {
+	return errors.New("start failed")
+}
+func (i *failingServiceInput) Stop() {}
+
+func init() {
+	inputs.Add("reload_test_failing_service", func() telex.Input {
+		return &failingServiceInput{}
+	})
+}
+
+func TestAgent_ReloadRestoresOnStartError(t *testing.T) {
+	c := loadReloadConfig(t, nil, 1)
+	output := c.Outputs[0].Output.(*reloadOutput)
+
+	a, err := NewAgent(c)
+	require.NoError(t, err)
+	stop := runAgent(t, a)
+	defer stop()
+
+	waitFor(t, func() bool { return output.has(1) })
+
+	next := loadConfigString(t, fmt.Sprintf(reloadConfig, 2)+
+		"\n[[inputs.reload_test_failing_service]]\n")
+	require.Error(t, a.Reload(next))
+	next.Discard()
+	require.True(t, a.Config == c)
+
+	// The running configuration continues with its output.
+	output.Lock()
+	output.values = nil
+	output.Unlock()
+	waitFor(t, func() bool { return output.has(1) })
+	require.False(t, output.has(2))
+}
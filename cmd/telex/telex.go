@@ -13,6 +13,7 @@ import (
 	"runtime"
 	"strings"
 	"syscall"
+	"time"
 
 	"github.com/kardianos/service"
 	"github.com/lavaorg/telex/agent"
@@ -37,6 +38,10 @@ var fTest = flag.Bool("test", false, "gather metrics, print them out, and exit")
 var fConfig = flag.String("config", "", "configuration file to load")
 var fConfigDirectory = flag.String("config-directory", "",
 	"directory containing additional *.conf files")
+var fValidate = flag.Bool("validate", false,
+	"check the configuration for errors without running any plugin, and exit")
+var fWatchConfig = flag.Bool("watch-config", false,
+	"reload the configuration when the config file or directory changes")
 var fVersion = flag.Bool("version", false, "display the version and exit")
 var fSampleConfig = flag.Bool("sample-config", false,
 	"print out full sample configuration")
@@ -55,6 +60,8 @@ var fProcessorFilters = flag.String("processor-filter", "",
 	"filter the processors to enable, separator is :")
 var fUsage = flag.String("usage", "",
 	"print usage for a plugin, ie, 'telex --usage mysql'")
+var fControlSocket = flag.String("control-socket", "",
+	"control socket of the agent used by ctl, defaults to the agent control_socket")
 var fService = flag.String("service", "",
 	"operate on the service (windows only)")
 var fServiceName = flag.String("service-name", "telex", "service name (windows only)")
@@ -68,6 +75,10 @@ var (
 
 var stop chan struct{}
 
+// watchDebounce is how long the configuration must be unchanged before it is
+// reloaded by --watch-config.
+const watchDebounce = time.Second
+
 func reloadLoop(
 	stop chan struct{},
 	inputFilters []string,
@@ -75,61 +86,39 @@ func reloadLoop(
 	aggregatorFilters []string,
 	processorFilters []string,
 ) {
-	reload := make(chan bool, 1)
-	reload <- true
-	for <-reload {
-		reload <- false
-
-		ctx, cancel := context.WithCancel(context.Background())
-
-		signals := make(chan os.Signal)
-		signal.Notify(signals, os.Interrupt, syscall.SIGHUP,
-			syscall.SIGTERM, syscall.SIGINT)
-		go func() {
-			select {
-			case sig := <-signals:
-				if sig == syscall.SIGHUP {
-					log.Printf("I! Reloading telex config")
-					<-reload
-					reload <- true
-				}
-				cancel()
-			case <-stop:
-				cancel()
-			}
-		}()
-
-		err := runAgent(ctx, inputFilters, outputFilters)
-		if err != nil {
-			log.Fatalf("E! [telex] Error running agent: %v", err)
-		}
+	err := runAgent(stop, inputFilters, outputFilters)
+	if err != nil {
+		log.Fatalf("E! [telex] Error running agent: %v", err)
 	}
 }
 
-func runAgent(ctx context.Context,
+// loadConfig loads and validates the configuration.  Plugins configured
+// identically in the previous configuration are reused.
+func loadConfig(
+	previous *config.Config,
 	inputFilters []string,
 	outputFilters []string,
-) error {
-	// Setup default logging. This may need to change after reading the config
-	// file, but we can configure it to use our logger implementation now.
-	logger.SetupLogging(false, false, "")
-	log.Printf("I! Starting telex %s", version)
-
-	// If no other options are specified, load the config file and run.
+) (*config.Config, error) {
 	c := config.NewConfig()
 	c.OutputFilters = outputFilters
 	c.InputFilters = inputFilters
+	c.SetPrevious(previous)
+
 	err := c.LoadConfig(*fConfig)
+	if err == nil && *fConfigDirectory != "" {
+		err = c.LoadDirectory(*fConfigDirectory)
+	}
+	if err == nil {
+		err = checkConfig(c)
+	}
 	if err != nil {
-		return err
+		c.Discard()
+		return nil, err
 	}
+	return c, nil
+}
 
-	if *fConfigDirectory != "" {
-		err = c.LoadDirectory(*fConfigDirectory)
-		if err != nil {
-			return err
-		}
-	}
+func checkConfig(c *config.Config) error {
 	if !*fTest && len(c.Outputs) == 0 {
 		return errors.New("Error: no outputs found, did you provide a valid config file?")
 	}
@@ -146,6 +135,67 @@ func runAgent(ctx context.Context,
 		return fmt.Errorf("Agent flush_interval must be positive; found %s",
 			c.Agent.Interval.Duration)
 	}
+	return nil
+}
+
+// setupLogging configures logging as set in the agent configuration.
+func setupLogging(c *config.Config) {
+	logger.SetupLogging(logger.LogConfig{
+		Debug:               c.Agent.Debug || *fDebug,
+		Quiet:               c.Agent.Quiet || *fQuiet,
+		Logfile:             c.Agent.Logfile,
+		Format:              c.Agent.LogFormat,
+		RotationInterval:    c.Agent.LogfileRotationInterval.Duration,
+		RotationMaxSize:     c.Agent.LogfileRotationMaxSize.Size,
+		RotationMaxArchives: c.Agent.LogfileRotationMaxArchives,
+		Levels:              c.Agent.LogLevels,
+	})
+}
+
+func logPlugins(c *config.Config) {
+	log.Printf("I! Loaded inputs: %s", strings.Join(c.InputNames(), " "))
+	log.Printf("I! Loaded aggregators: %s", strings.Join(c.AggregatorNames(), " "))
+	log.Printf("I! Loaded processors: %s", strings.Join(c.ProcessorNames(), " "))
+	log.Printf("I! Loaded outputs: %s", strings.Join(c.OutputNames(), " "))
+	log.Printf("I! Tags enabled: %s", c.ListTags())
+}
+
+// reloadConfig loads the configuration again and switches the running agent
+// to it.  The running configuration is kept if the new one is invalid.
+func reloadConfig(ag *agent.Agent, inputFilters, outputFilters []string) {
+	log.Printf("I! Reloading telex config")
+	c, err := loadConfig(ag.Config, inputFilters, outputFilters)
+	if err != nil {
+		log.Printf("E! [telex] Error reloading config, keeping the running "+
+			"configuration: %v", err)
+		return
+	}
+
+	err = ag.Reload(c)
+	if err != nil {
+		log.Printf("E! [telex] Error reloading config: %v", err)
+		c.Discard()
+		return
+	}
+
+	setupLogging(c)
+	logPlugins(c)
+}
+
+func runAgent(
+	stop chan struct{},
+	inputFilters []string,
+	outputFilters []string,
+) error {
+	// Setup default logging. This may need to change after reading the config
+	// file, but we can configure it to use our logger implementation now.
+	logger.SetupLogging(logger.LogConfig{})
+	log.Printf("I! Starting telex %s", version)
+
+	c, err := loadConfig(nil, inputFilters, outputFilters)
+	if err != nil {
+		return err
+	}
 
 	ag, err := agent.NewAgent(c)
 	if err != nil {
@@ -153,21 +203,53 @@ func runAgent(ctx context.Context,
 	}
 
 	// Setup logging as configured.
-	logger.SetupLogging(
-		ag.Config.Agent.Debug || *fDebug,
-		ag.Config.Agent.Quiet || *fQuiet,
-		ag.Config.Agent.Logfile,
-	)
+	setupLogging(c)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	// changes is nil unless the configuration is watched.
+	var changes <-chan struct{}
+	if *fWatchConfig && !*fTest {
+		watcher, err := config.NewWatcher(*fConfig, *fConfigDirectory,
+			watchDebounce)
+		if err != nil {
+			return err
+		}
+		defer watcher.Close()
+		changes = watcher.C
+	}
+
+	signals := make(chan os.Signal, 1)
+	signal.Notify(signals, os.Interrupt, syscall.SIGHUP,
+		syscall.SIGTERM, syscall.SIGINT)
+	defer signal.Stop(signals)
+	go func() {
+		for {
+			select {
+			case sig := <-signals:
+				if sig == syscall.SIGHUP {
+					reloadConfig(ag, inputFilters, outputFilters)
+					continue
+				}
+				cancel()
+				return
+			case <-changes:
+				reloadConfig(ag, inputFilters, outputFilters)
+			case <-stop:
+				cancel()
+				return
+			case <-ctx.Done():
+				return
+			}
+		}
+	}()
 
 	if *fTest {
 		return ag.Test(ctx)
 	}
 
-	log.Printf("I! Loaded inputs: %s", strings.Join(c.InputNames(), " "))
-	log.Printf("I! Loaded aggregators: %s", strings.Join(c.AggregatorNames(), " "))
-	log.Printf("I! Loaded processors: %s", strings.Join(c.ProcessorNames(), " "))
-	log.Printf("I! Loaded outputs: %s", strings.Join(c.OutputNames(), " "))
-	log.Printf("I! Tags enabled: %s", c.ListTags())
+	logPlugins(c)
 
 	if *fPidfile != "" {
 		f, err := os.OpenFile(*fPidfile, os.O_CREATE|os.O_WRONLY, 0644)
@@ -190,8 +272,61 @@ func runAgent(ctx context.Context,
 	return ag.Run(ctx)
 }
 
+// validateConfig checks the configuration, printing the problems found, and
+// exits with a non-zero status if there are any.
+func validateConfig() {
+	diags := config.Check(*fConfig, *fConfigDirectory)
+	for _, d := range diags {
+		fmt.Fprintln(os.Stderr, d)
+	}
+	if len(diags) > 0 {
+		fmt.Fprintf(os.Stderr, "%d problem(s) found\n", len(diags))
+		os.Exit(1)
+	}
+	fmt.Println("Configuration is valid")
+	os.Exit(0)
+}
+
+// runCtl sends a command to the control socket of the running agent and
+// exits.
+func runCtl(args []string) {
+	if len(args) == 0 {
+		fmt.Fprint(os.Stderr, "Usage: telex ctl <command> [args]\n\n"+agent.ControlUsage)
+		os.Exit(1)
+	}
+
+	path := *fControlSocket
+	if path == "" {
+		// Only the [agent] table is loaded, the plugins of the running
+		// agent, such as the disk buffers of its outputs, are not touched.
+		c := config.NewConfig()
+		err := c.LoadAgentConfig(*fConfig)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Error loading config: %v\n", err)
+			os.Exit(1)
+		}
+		path = c.Agent.ControlSocket
+	}
+	if path == "" {
+		fmt.Fprintln(os.Stderr, "No control socket, set control_socket in the [agent] "+
+			"section or use --control-socket")
+		os.Exit(1)
+	}
+
+	out, err := agent.SendControl(path, agent.ControlRequest{
+		Command: args[0],
+		Args:    args[1:],
+	})
+	fmt.Print(out)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		os.Exit(1)
+	}
+	os.Exit(0)
+}
+
 func usageExit(rc int) {
-	fmt.Println(internal.Usage)
+	fmt.Print(internal.Usage)
 	os.Exit(rc)
 }
 
@@ -287,7 +422,12 @@ func main() {
 		case "version":
 			fmt.Println(formatFullVersion())
 			return
+		case "ctl":
+			runCtl(args[1:])
 		case "config":
+			if len(args) > 1 && args[1] == "check" {
+				validateConfig()
+			}
 			config.PrintSampleConfig(
 				inputFilters,
 				outputFilters,
@@ -315,6 +455,8 @@ func main() {
 	case *fVersion:
 		fmt.Println(formatFullVersion())
 		return
+	case *fValidate:
+		validateConfig()
 	case *fSampleConfig:
 		config.PrintSampleConfig(
 			inputFilters,
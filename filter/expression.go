@@ -0,0 +1,459 @@
+package filter
+
+import (
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+	"unicode"
+
+	"github.com/lavaorg/telex"
+)
+
+// Expression is a boolean expression on the name, tags and fields of a
+// metric, ie:
+//
+//	e, _ := CompileExpression(`name = cpu and usage_idle < 10 or host = db*`)
+//	e.Eval(metric)
+//
+// Comparisons have a key on the left and a value on the right:
+//   - "name" is the metric name, "tags.<key>" a tag, "fields.<key>" a field
+//     and any other key the tag or else the field of this key.
+//   - the value is a number, true, false or a string, quoted or not.
+//   - = and != compare numbers and booleans, and match strings against a glob
+//     pattern; <, <=, > and >= compare numbers or strings; =~ and !~ match a
+//     regular expression.
+//
+// A comparison with a missing key is false.  A key alone is true if it is
+// present, unless it is a false boolean field.  Comparisons are combined
+// with parentheses, and, or and not, also written &&, || and !.
+type Expression struct {
+	source string
+	root   node
+}
+
+// CompileExpression parses an expression.
+func CompileExpression(source string) (*Expression, error) {
+	tokens, err := tokenize(source)
+	if err != nil {
+		return nil, err
+	}
+	p := &parser{tokens: tokens}
+	root, err := p.parseOr()
+	if err != nil {
+		return nil, err
+	}
+	if tok := p.peek(); tok.kind != tokEOF {
+		return nil, fmt.Errorf("unexpected %s at offset %d", tok, tok.pos)
+	}
+	return &Expression{source: source, root: root}, nil
+}
+
+// Eval returns true if the metric matches the expression.
+func (e *Expression) Eval(metric telex.Metric) bool {
+	return e.root.eval(metric)
+}
+
+func (e *Expression) String() string {
+	return e.source
+}
+
+type tokenKind int
+
+const (
+	tokEOF tokenKind = iota
+	tokLParen
+	tokRParen
+	tokAnd
+	tokOr
+	tokNot
+	tokOp
+	tokString
+	tokWord
+)
+
+type token struct {
+	kind  tokenKind
+	value string
+	pos   int
+}
+
+func (t token) String() string {
+	switch t.kind {
+	case tokEOF:
+		return "end of expression"
+	case tokString:
+		return strconv.Quote(t.value)
+	}
+	return fmt.Sprintf("'%s'", t.value)
+}
+
+// isWordChar reports whether r can be part of an unquoted key or value.
+func isWordChar(r rune) bool {
+	if unicode.IsSpace(r) {
+		return false
+	}
+	return !strings.ContainsRune(`()=!<>~"'&|`, r)
+}
+
+func tokenize(s string) ([]token, error) {
+	var tokens []token
+	runes := []rune(s)
+	for i := 0; i < len(runes); {
+		r := runes[i]
+		next := func(n int) string {
+			if i+n > len(runes) {
+				return ""
+			}
+			return string(runes[i : i+n])
+		}
+		switch {
+		case unicode.IsSpace(r):
+			i++
+		case r == '(':
+			tokens = append(tokens, token{tokLParen, "(", i})
+			i++
+		case r == ')':
+			tokens = append(tokens, token{tokRParen, ")", i})
+			i++
+		case next(2) == "&&":
+			tokens = append(tokens, token{tokAnd, "&&", i})
+			i += 2
+		case next(2) == "||":
+			tokens = append(tokens, token{tokOr, "||", i})
+			i += 2
+		case next(2) == "==" || next(2) == "!=" || next(2) == "<=" ||
+			next(2) == ">=" || next(2) == "=~" || next(2) == "!~":
+			tokens = append(tokens, token{tokOp, next(2), i})
+			i += 2
+		case r == '=' || r == '<' || r == '>':
+			tokens = append(tokens, token{tokOp, string(r), i})
+			i++
+		case r == '!':
+			tokens = append(tokens, token{tokNot, "!", i})
+			i++
+		case r == '"' || r == '\'':
+			start := i
+			var b strings.Builder
+			i++
+			for ; i < len(runes) && runes[i] != r; i++ {
+				if runes[i] == '\\' && i+1 < len(runes) && (runes[i+1] == r || runes[i+1] == '\\') {
+					i++
+				}
+				b.WriteRune(runes[i])
+			}
+			if i == len(runes) {
+				return nil, fmt.Errorf("unterminated string at offset %d", start)
+			}
+			i++
+			tokens = append(tokens, token{tokString, b.String(), start})
+		case isWordChar(r):
+			start := i
+			for i < len(runes) && isWordChar(runes[i]) {
+				i++
+			}
+			word := string(runes[start:i])
+			switch strings.ToLower(word) {
+			case "and":
+				tokens = append(tokens, token{tokAnd, word, start})
+			case "or":
+				tokens = append(tokens, token{tokOr, word, start})
+			case "not":
+				tokens = append(tokens, token{tokNot, word, start})
+			default:
+				tokens = append(tokens, token{tokWord, word, start})
+			}
+		default:
+			return nil, fmt.Errorf("unexpected '%c' at offset %d", r, i)
+		}
+	}
+	return append(tokens, token{kind: tokEOF, pos: len(runes)}), nil
+}
+
+type parser struct {
+	tokens []token
+	pos    int
+}
+
+func (p *parser) peek() token {
+	return p.tokens[p.pos]
+}
+
+func (p *parser) next() token {
+	tok := p.tokens[p.pos]
+	if tok.kind != tokEOF {
+		p.pos++
+	}
+	return tok
+}
+
+func (p *parser) parseOr() (node, error) {
+	left, err := p.parseAnd()
+	if err != nil {
+		return nil, err
+	}
+	for p.peek().kind == tokOr {
+		p.next()
+		right, err := p.parseAnd()
+		if err != nil {
+			return nil, err
+		}
+		left = &orNode{left, right}
+	}
+	return left, nil
+}
+
+func (p *parser) parseAnd() (node, error) {
+	left, err := p.parseNot()
+	if err != nil {
+		return nil, err
+	}
+	for p.peek().kind == tokAnd {
+		p.next()
+		right, err := p.parseNot()
+		if err != nil {
+			return nil, err
+		}
+		left = &andNode{left, right}
+	}
+	return left, nil
+}
+
+func (p *parser) parseNot() (node, error) {
+	if p.peek().kind == tokNot {
+		p.next()
+		n, err := p.parseNot()
+		if err != nil {
+			return nil, err
+		}
+		return &notNode{n}, nil
+	}
+	return p.parsePrimary()
+}
+
+func (p *parser) parsePrimary() (node, error) {
+	tok := p.next()
+	switch tok.kind {
+	case tokLParen:
+		n, err := p.parseOr()
+		if err != nil {
+			return nil, err
+		}
+		if closing := p.next(); closing.kind != tokRParen {
+			return nil, fmt.Errorf("expected ')' at offset %d, got %s", closing.pos, closing)
+		}
+		return n, nil
+	case tokWord:
+		if p.peek().kind != tokOp {
+			return &existsNode{key: tok.value}, nil
+		}
+		op := p.next()
+		value := p.next()
+		if value.kind != tokWord && value.kind != tokString {
+			return nil, fmt.Errorf("expected a value after %s at offset %d, got %s", op, value.pos, value)
+		}
+		return newCompareNode(tok.value, op, value)
+	}
+	return nil, fmt.Errorf("unexpected %s at offset %d", tok, tok.pos)
+}
+
+type node interface {
+	eval(metric telex.Metric) bool
+}
+
+type orNode struct{ left, right node }
+
+func (n *orNode) eval(metric telex.Metric) bool {
+	return n.left.eval(metric) || n.right.eval(metric)
+}
+
+type andNode struct{ left, right node }
+
+func (n *andNode) eval(metric telex.Metric) bool {
+	return n.left.eval(metric) && n.right.eval(metric)
+}
+
+type notNode struct{ n node }
+
+func (n *notNode) eval(metric telex.Metric) bool {
+	return !n.n.eval(metric)
+}
+
+// lookup returns the value of a key of the metric.
+func lookup(metric telex.Metric, key string) (interface{}, bool) {
+	switch {
+	case key == "name":
+		return metric.Name(), true
+	case strings.HasPrefix(key, "tags."):
+		return metric.GetTag(strings.TrimPrefix(key, "tags."))
+	case strings.HasPrefix(key, "fields."):
+		return metric.GetField(strings.TrimPrefix(key, "fields."))
+	}
+	if value, ok := metric.GetTag(key); ok {
+		return value, true
+	}
+	return metric.GetField(key)
+}
+
+type existsNode struct {
+	key string
+}
+
+func (n *existsNode) eval(metric telex.Metric) bool {
+	value, ok := lookup(metric, n.key)
+	if !ok {
+		return false
+	}
+	if b, ok := value.(bool); ok {
+		return b
+	}
+	return true
+}
+
+type valueKind int
+
+const (
+	kindString valueKind = iota
+	kindNumber
+	kindBool
+)
+
+type compareNode struct {
+	key   string
+	op    string
+	kind  valueKind
+	str   string
+	num   float64
+	bool  bool
+	glob  Filter
+	regex *regexp.Regexp
+}
+
+func newCompareNode(key string, op, value token) (node, error) {
+	n := &compareNode{key: key, op: op.value, str: value.value}
+	if value.kind == tokWord {
+		if num, err := strconv.ParseFloat(value.value, 64); err == nil {
+			n.kind, n.num = kindNumber, num
+		} else if value.value == "true" || value.value == "false" {
+			n.kind, n.bool = kindBool, value.value == "true"
+		}
+	}
+
+	var err error
+	switch n.op {
+	case "=", "==", "!=":
+		if n.kind == kindString {
+			if n.glob, err = Compile([]string{n.str}); err != nil {
+				return nil, fmt.Errorf("invalid glob pattern %q at offset %d: %v", n.str, value.pos, err)
+			}
+		}
+	case "<", "<=", ">", ">=":
+		if n.kind == kindBool {
+			return nil, fmt.Errorf("cannot compare %s with %s at offset %d", key, op.value, value.pos)
+		}
+	case "=~", "!~":
+		if n.regex, err = regexp.Compile(n.str); err != nil {
+			return nil, fmt.Errorf("invalid regular expression %q at offset %d: %v", n.str, value.pos, err)
+		}
+	}
+	return n, nil
+}
+
+func (n *compareNode) eval(metric telex.Metric) bool {
+	value, ok := lookup(metric, n.key)
+	if !ok {
+		return false
+	}
+
+	switch n.op {
+	case "=", "==":
+		return n.equal(value)
+	case "!=":
+		return !n.equal(value)
+	case "=~":
+		return n.regex.MatchString(toString(value))
+	case "!~":
+		return !n.regex.MatchString(toString(value))
+	}
+
+	var cmp int
+	if n.kind == kindNumber {
+		f, ok := toFloat(value)
+		if !ok {
+			return false
+		}
+		cmp = compareFloat(f, n.num)
+	} else {
+		cmp = strings.Compare(toString(value), n.str)
+	}
+	switch n.op {
+	case "<":
+		return cmp < 0
+	case "<=":
+		return cmp <= 0
+	case ">":
+		return cmp > 0
+	case ">=":
+		return cmp >= 0
+	}
+	return false
+}
+
+func (n *compareNode) equal(value interface{}) bool {
+	switch n.kind {
+	case kindNumber:
+		f, ok := toFloat(value)
+		return ok && f == n.num
+	case kindBool:
+		switch v := value.(type) {
+		case bool:
+			return v == n.bool
+		case string:
+			b, err := strconv.ParseBool(v)
+			return err == nil && b == n.bool
+		}
+		return false
+	}
+	return n.glob.Match(toString(value))
+}
+
+func compareFloat(a, b float64) int {
+	switch {
+	case a < b:
+		return -1
+	case a > b:
+		return 1
+	}
+	return 0
+}
+
+func toFloat(value interface{}) (float64, bool) {
+	switch v := value.(type) {
+	case float64:
+		return v, true
+	case int64:
+		return float64(v), true
+	case uint64:
+		return float64(v), true
+	case string:
+		f, err := strconv.ParseFloat(v, 64)
+		return f, err == nil
+	}
+	return 0, false
+}
+
+func toString(value interface{}) string {
+	switch v := value.(type) {
+	case string:
+		return v
+	case float64:
+		return strconv.FormatFloat(v, 'f', -1, 64)
+	case int64:
+		return strconv.FormatInt(v, 10)
+	case uint64:
+		return strconv.FormatUint(v, 10)
+	case bool:
+		return strconv.FormatBool(v)
+	}
+	return fmt.Sprint(value)
+}
@@ -0,0 +1,124 @@
+package filter
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/lavaorg/telex/testutil"
+)
+
+func TestExpression(t *testing.T) {
+	cpu := testutil.MustMetric("cpu",
+		map[string]string{"host": "db01", "cpu": "cpu0", "name": "tag"},
+		map[string]interface{}{
+			"usage_idle": float64(5.5),
+			"usage_user": int64(80),
+			"count":      uint64(3),
+			"online":     true,
+			"throttled":  false,
+			"state":      "running",
+			"cpu":        "field",
+			"version":    "1.10",
+			"sockets":    "2",
+		},
+		time.Now(),
+	)
+
+	tests := []struct {
+		expr     string
+		expected bool
+	}{
+		{`name = cpu`, true},
+		{`name == "cpu"`, true},
+		{`name = mem`, false},
+		{`name != mem`, true},
+		{`name = c*`, true},
+		{`host = db*`, true},
+		{`host = "db0[1-3]"`, true},
+		{`host != db*`, false},
+		{`usage_idle < 10`, true},
+		{`usage_idle <= 5.5`, true},
+		{`usage_idle > 5.5`, false},
+		{`usage_idle >= 5.5`, true},
+		{`usage_user = 80`, true},
+		{`usage_user > 79.9`, true},
+		{`count = 3`, true},
+		{`sockets = 2`, true},
+		{`sockets = "2"`, true},
+		{`state = run*`, true},
+		{`state =~ "^run"`, true},
+		{`state !~ '^run'`, false},
+		{`usage_user =~ "^8"`, true},
+		{`version < "1.9"`, true},
+		{`version < 1.9`, true},
+		{`online = true`, true},
+		{`throttled = false`, true},
+		{`online`, true},
+		{`throttled`, false},
+		{`missing`, false},
+		{`missing = x`, false},
+		{`missing != x`, false},
+		{`not missing = x`, true},
+		{`cpu = cpu0`, true},
+		{`tags.cpu = cpu0`, true},
+		{`fields.cpu = field`, true},
+		{`tags.name = tag`, true},
+		{`tags.usage_idle`, false},
+		{`fields.usage_idle`, true},
+		{`name=cpu AND usage_idle < 10 OR host=web*`, true},
+		{`name=cpu and usage_idle > 10 or host=web*`, false},
+		{`name=mem or usage_idle < 10 and host=db*`, true},
+		{`(name=mem or usage_idle < 10) and host=web*`, false},
+		{`name=mem || usage_idle < 10 && !(host=web*)`, true},
+		{`not not online`, true},
+		{`NOT online`, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.expr, func(t *testing.T) {
+			e, err := CompileExpression(tt.expr)
+			require.NoError(t, err)
+			require.Equal(t, tt.expected, e.Eval(cpu))
+		})
+	}
+}
+
+func TestExpressionErrors(t *testing.T) {
+	tests := []struct {
+		expr string
+		err  string
+	}{
+		{``, `unexpected end of expression at offset 0`},
+		{`name =`, `expected a value after '=' at offset 6, got end of expression`},
+		{`name = cpu mem`, `unexpected 'mem' at offset 11`},
+		{`(name = cpu`, `expected ')' at offset 11, got end of expression`},
+		{`name = cpu)`, `unexpected ')' at offset 10`},
+		{`name = "cpu`, `unterminated string at offset 7`},
+		{`and name = cpu`, `unexpected 'and' at offset 0`},
+		{`name = "cpu["`, `invalid glob pattern "cpu[" at offset 7: unexpected end of input`},
+		{`name =~ "("`, "invalid regular expression \"(\" at offset 8: error parsing regexp: missing closing ): `(`"},
+		{`online > true`, `cannot compare online with > at offset 9`},
+		{`name = = cpu`, `expected a value after '=' at offset 7, got '='`},
+	}
+	for _, tt := range tests {
+		t.Run(tt.expr, func(t *testing.T) {
+			_, err := CompileExpression(tt.expr)
+			assert.EqualError(t, err, tt.err)
+		})
+	}
+}
+
+func BenchmarkExpression(b *testing.B) {
+	m := testutil.MustMetric("cpu",
+		map[string]string{"host": "db01"},
+		map[string]interface{}{"usage_idle": float64(5.5)},
+		time.Now(),
+	)
+	e, err := CompileExpression(`name=cpu AND usage_idle < 10 OR host=db*`)
+	require.NoError(b, err)
+	for n := 0; n < b.N; n++ {
+		e.Eval(m)
+	}
+}
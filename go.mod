@@ -1,30 +1,34 @@
 module github.com/lavaorg/telex
 
+go 1.16
+
 require (
 	github.com/StackExchange/wmi v0.0.0-20180116203802-5d049714c4a6 // indirect
-	github.com/fsnotify/fsnotify v1.4.7 // indirect
+	github.com/fsnotify/fsnotify v1.4.7
 	github.com/go-ole/go-ole v1.2.1 // indirect
 	github.com/golang/protobuf v1.2.0 // indirect
+	github.com/golang/snappy v0.0.1
 	github.com/google/go-cmp v0.2.0
 	github.com/influxdata/go-syslog v0.0.0-20181218100917-0cd00a9f0a5e
 	github.com/influxdata/tail v0.0.0-20180327235535-c43482518d41
 	github.com/kardianos/osext v0.0.0-20170510131534-ae77be60afb1 // indirect
 	github.com/kardianos/service v0.0.0-20180320115954-615a14ed7509
-	github.com/lavaorg/lrt v0.0.0-20180611211705-3f4b42526164
-	github.com/nats-io/gnatsd v1.2.0 // indirect
+	github.com/nats-io/gnatsd v1.2.0
 	github.com/nats-io/go-nats v1.5.0
 	github.com/nats-io/nuid v1.0.0 // indirect
+	github.com/pierrec/lz4 v2.0.5+incompatible
 	github.com/shirou/gopsutil v0.0.0-20180801053943-8048a2e9c577
 	github.com/shirou/w32 v0.0.0-20160930032740-bb4de0191aa4 // indirect
 	github.com/stretchr/objx v0.1.1 // indirect
 	github.com/stretchr/testify v1.2.2
 	github.com/vishvananda/netlink v0.0.0-20171020171820-b2de5d10e38e
 	github.com/vishvananda/netns v0.0.0-20180720170159-13995c7128cc
+	go.starlark.net v0.0.0-20200821142938-949cc6f4b097
 	golang.org/x/crypto v0.0.0-20180718160520-a2144134853f
 	golang.org/x/net v0.0.0-20180906233101-161cd47e91fd
 	golang.org/x/oauth2 v0.0.0-20180821212333-d2e6202438be
 	golang.org/x/sync v0.0.0-20181108010431-42b317875d0f
-	golang.org/x/sys v0.0.0-20181220182059-7c4c994c65f7
+	golang.org/x/sys v0.0.0-20200625212154-ddb9806d33ae
 	google.golang.org/appengine v1.1.0 // indirect
 	gopkg.in/fsnotify.v1 v1.4.7 // indirect
 	gopkg.in/tomb.v1 v1.0.0-20141024135613-dd632973f1e7 // indirect
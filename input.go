@@ -1,5 +1,7 @@
 package telex
 
+import "context"
+
 type Input interface {
 	// SampleConfig returns the default configuration of the Input
 	SampleConfig() string
@@ -12,6 +14,15 @@ type Input interface {
 	Gather(Accumulator) error
 }
 
+// ContextInput is an Input that can abandon a gather.  GatherContext is called
+// instead of Gather, ctx is done when the gather_timeout of the input expires.
+type ContextInput interface {
+	Input
+
+	// GatherContext is Gather, it should return soon after ctx is done.
+	GatherContext(ctx context.Context, acc Accumulator) error
+}
+
 type ServiceInput interface {
 	Input
 
@@ -0,0 +1,537 @@
+package config
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/lavaorg/telex/filter"
+	"github.com/lavaorg/telex/internal/toml"
+	"github.com/lavaorg/telex/internal/toml/ast"
+	"github.com/lavaorg/telex/internal/units"
+	"github.com/lavaorg/telex/plugins/aggregators"
+	"github.com/lavaorg/telex/plugins/inputs"
+	"github.com/lavaorg/telex/plugins/outputs"
+	"github.com/lavaorg/telex/plugins/parsers"
+	"github.com/lavaorg/telex/plugins/processors"
+	"github.com/lavaorg/telex/plugins/serializers"
+)
+
+// Diagnostic is a problem found in a configuration file.  Line is 0 if the
+// problem is not tied to a line.
+type Diagnostic struct {
+	File    string
+	Line    int
+	Message string
+}
+
+func (d Diagnostic) String() string {
+	if d.Line == 0 {
+		return fmt.Sprintf("%s: %s", d.File, d.Message)
+	}
+	return fmt.Sprintf("%s:%d: %s", d.File, d.Line, d.Message)
+}
+
+// formatOptions are the data format options not named after their format.
+var formatOptions = map[string]string{
+	"data_type": "value",
+	"tag_keys":  "json",
+	"separator": "graphite",
+	"template":  "graphite",
+	"templates": "graphite",
+	"prefix":    "graphite",
+}
+
+// optionFormat returns the data format using the option, or "" if it applies
+// to every format.
+func optionFormat(key string) string {
+	if format, ok := formatOptions[key]; ok {
+		return format
+	}
+	for _, format := range []string{"csv", "json", "grok", "influx", "graphite", "splunkmetric"} {
+		if strings.HasPrefix(key, format+"_") {
+			return format
+		}
+	}
+	return ""
+}
+
+var (
+	lineRe      = regexp.MustCompile(`(?s)^(?:toml: )?line (\d+): (.*)$`)
+	undefinedRe = regexp.MustCompile("^field corresponding to `(.*)' is not defined in `.*'$")
+)
+
+// Check checks the configuration file and the *.conf files of the directory
+// without creating the running plugins, the file may be empty to check the
+// default configuration file and the directory may be empty.  Unlike
+// LoadConfig it does not stop at the first problem, every problem found is
+// returned.
+func Check(path, directory string) []Diagnostic {
+	c := &checker{}
+
+	if path == "" {
+		var err error
+		if path, err = getDefaultConfigPath(); err != nil {
+			c.file = "telex.conf"
+			c.report(0, "%v", err)
+			return c.diags
+		}
+	}
+	c.checkFile(path)
+
+	if directory != "" {
+		err := filepath.Walk(directory, func(thispath string, info os.FileInfo, err error) error {
+			if info == nil {
+				c.file = thispath
+				c.unreadable = true
+				c.report(0, "not permitted to read")
+				return nil
+			}
+			if info.IsDir() {
+				if strings.HasPrefix(info.Name(), "..") {
+					return filepath.SkipDir
+				}
+				return nil
+			}
+			if strings.HasSuffix(info.Name(), ".conf") && len(info.Name()) > 5 {
+				c.checkFile(thispath)
+			}
+			return nil
+		})
+		if err != nil {
+			c.file = directory
+			c.report(0, "%v", err)
+		}
+	}
+
+	// Plugins of files which could not be read are not counted.
+	c.file = path
+	if c.unreadable {
+		return c.sorted()
+	}
+	if c.inputs == 0 {
+		c.report(0, "no inputs found")
+	}
+	if c.outputs == 0 {
+		c.report(0, "no outputs found")
+	}
+
+	return c.sorted()
+}
+
+type checker struct {
+	file            string
+	pluginDirectory string
+	diags           []Diagnostic
+	inputs          int
+	outputs         int
+	unreadable      bool
+}
+
+// sorted returns the diagnostics sorted by file and line.
+func (c *checker) sorted() []Diagnostic {
+	sort.SliceStable(c.diags, func(i, j int) bool {
+		if c.diags[i].File != c.diags[j].File {
+			return c.diags[i].File < c.diags[j].File
+		}
+		return c.diags[i].Line < c.diags[j].Line
+	})
+	return c.diags
+}
+
+func (c *checker) report(line int, format string, args ...interface{}) {
+	c.diags = append(c.diags, Diagnostic{
+		File:    c.file,
+		Line:    line,
+		Message: fmt.Sprintf(format, args...),
+	})
+}
+
+// reportErr reports an error unmarshaling the table of the section, using
+// the line number of the error message if it has one.
+func (c *checker) reportErr(line int, section string, err error) {
+	msg := err.Error()
+	if m := lineRe.FindStringSubmatch(msg); m != nil {
+		line, _ = strconv.Atoi(m[1])
+		msg = m[2]
+	}
+	if m := undefinedRe.FindStringSubmatch(msg); m != nil {
+		msg = fmt.Sprintf("unknown option %q in %s", m[1], section)
+	}
+	c.report(line, "%s", msg)
+}
+
+func (c *checker) checkFile(path string) {
+	c.file = path
+
+	data, err := loadConfig(path)
+	if err != nil {
+		c.unreadable = true
+		c.report(0, "%v", err)
+		return
+	}
+	tbl, err := parseConfig(data)
+	if err != nil {
+		c.unreadable = true
+		c.reportErr(0, "", err)
+		return
+	}
+
+	for _, name := range sortedKeys(tbl) {
+		val := tbl.Fields[name]
+		subTable, ok := val.(*ast.Table)
+		if !ok {
+			c.report(nodeLine(val), "invalid configuration, %q must be a table", name)
+			continue
+		}
+
+		switch name {
+		case "agent":
+			c.checkAgent(subTable)
+		case "global_tags", "tags":
+			c.checkOption("["+name+"]", subTable, optTable)
+		case "inputs", "plugins", "outputs", "processors", "aggregators":
+			kind := name
+			if kind == "plugins" {
+				kind = "inputs"
+			}
+			for _, pluginName := range sortedKeys(subTable) {
+				switch t := subTable.Fields[pluginName].(type) {
+				case *ast.Table:
+					if kind == "processors" || kind == "aggregators" {
+						c.report(t.Line, "%s.%s must be an array of tables, use [[%s.%s]]",
+							kind, pluginName, kind, pluginName)
+						continue
+					}
+					c.checkPlugin(kind, pluginName, t)
+				case []*ast.Table:
+					for _, t := range t {
+						c.checkPlugin(kind, pluginName, t)
+					}
+				default:
+					c.report(nodeLine(t), "unsupported config format: %s", pluginName)
+				}
+			}
+		default:
+			// Legacy input table without the inputs prefix.
+			c.checkPlugin("inputs", name, subTable)
+		}
+	}
+}
+
+func (c *checker) checkAgent(tbl *ast.Table) {
+	for _, key := range sortedKeys(tbl) {
+		err := toml.UnmarshalTable(keyTable(tbl, key), &AgentConfig{})
+		if err != nil {
+			c.reportErr(nodeLine(tbl.Fields[key]), "[agent]", err)
+		}
+	}
+
+	agent := NewConfig().Agent
+	if err := toml.UnmarshalTable(tbl, agent); err != nil {
+		return
+	}
+	c.pluginDirectory = agent.PluginDirectory
+	if agent.Interval.Duration <= 0 {
+		c.report(nodeLine(tbl.Fields["interval"]), "interval must be positive, found %s",
+			agent.Interval.Duration)
+	}
+	if agent.FlushInterval.Duration <= 0 {
+		c.report(nodeLine(tbl.Fields["flush_interval"]), "flush_interval must be positive, found %s",
+			agent.FlushInterval.Duration)
+	}
+	if !validCardinalityPolicy(agent.CardinalityPolicy) {
+		c.report(nodeLine(tbl.Fields["cardinality_policy"]), "invalid cardinality_policy %q",
+			agent.CardinalityPolicy)
+	}
+}
+
+func (c *checker) checkPlugin(kind, name string, tbl *ast.Table) {
+	var creator func() interface{}
+	var options map[string]string
+	switch kind {
+	case "inputs":
+		if f, ok := inputs.Inputs[name]; ok {
+			creator = func() interface{} { return f() }
+		}
+		options = inputOptions
+		c.inputs++
+	case "outputs":
+		if f, ok := outputs.Outputs[name]; ok {
+			creator = func() interface{} { return f() }
+		}
+		options = outputOptions
+		c.outputs++
+	case "processors":
+		if f, ok := processors.Processors[name]; ok {
+			creator = func() interface{} { return f() }
+		}
+		options = processorOptions
+	case "aggregators":
+		if f, ok := aggregators.Aggregators[name]; ok {
+			creator = func() interface{} { return f() }
+		}
+		options = aggregatorOptions
+	}
+	// The options of an external plugin not handled by the agent are
+	// checked by the plugin once started.
+	external := false
+	if creator == nil {
+		_, external = externalPlugin(c.pluginDirectory, strings.TrimSuffix(kind, "s"), name)
+		if !external || kind == "aggregators" {
+			c.report(tbl.Line, "unknown %s plugin %q", strings.TrimSuffix(kind, "s"), name)
+			return
+		}
+		creator = func() interface{} { return nil }
+	}
+
+	plugin := creator()
+	_, isParser := plugin.(parsers.ParserInput)
+	_, isParserFunc := plugin.(parsers.ParserFuncInput)
+	_, isSerializer := plugin.(serializers.SerializerOutput)
+	var dataOptions map[string]string
+	switch {
+	case isParser || isParserFunc:
+		dataOptions = parserOptions
+	case isSerializer:
+		dataOptions = serializerOptions
+	}
+
+	format := "influx"
+	if kv, ok := tbl.Fields["data_format"].(*ast.KeyValue); ok {
+		if str, ok := kv.Value.(*ast.String); ok {
+			format = str.Value
+		}
+	}
+
+	valid := true
+	for _, key := range sortedKeys(tbl) {
+		val := tbl.Fields[key]
+
+		opt, ok := options[key]
+		if !ok {
+			opt, ok = filterOptions[key]
+		}
+		if !ok && dataOptions != nil {
+			if opt, ok = dataOptions[key]; ok {
+				if f := optionFormat(key); f != "" && f != format {
+					c.report(nodeLine(val), "%s is unused with data_format %q", key, format)
+				}
+			}
+		}
+		if ok {
+			if !c.checkOption(key, val, opt) {
+				valid = false
+			}
+			continue
+		}
+		if external {
+			continue
+		}
+
+		if err := toml.UnmarshalTable(keyTable(tbl, key), creator()); err != nil {
+			c.reportErr(nodeLine(val), kind+"."+name, err)
+		}
+	}
+	if !valid {
+		return
+	}
+
+	// The options are well formed, build them to find invalid values.  The
+	// build functions remove the options they handle from the table.
+	tbl = copyTable(tbl)
+	var err error
+	switch kind {
+	case "inputs":
+		switch t := plugin.(type) {
+		case parsers.ParserInput:
+			var parser parsers.Parser
+			if parser, err = buildParser(name, tbl); err == nil {
+				t.SetParser(parser)
+			}
+		case parsers.ParserFuncInput:
+			var config *parsers.Config
+			if config, err = getParserConfig(name, tbl); err == nil {
+				_, err = parsers.NewParser(config)
+				t.SetParserFunc(func() (parsers.Parser, error) {
+					return parsers.NewParser(config)
+				})
+			}
+		}
+		if err == nil {
+			_, err = buildInput(name, tbl)
+		}
+	case "outputs":
+		if t, ok := plugin.(serializers.SerializerOutput); ok {
+			var serializer serializers.Serializer
+			if serializer, err = buildSerializer(name, tbl); err == nil {
+				t.SetSerializer(serializer)
+			}
+		}
+		if err == nil {
+			_, err = buildOutput(name, tbl)
+		}
+	case "processors":
+		_, err = buildProcessor(name, tbl)
+	case "aggregators":
+		_, err = buildAggregator(name, tbl)
+	}
+
+	// The plugin is initialized as it is when loaded, to find the invalid
+	// values it checks itself.
+	if err == nil && !external {
+		if err = toml.UnmarshalTable(tbl, plugin); err == nil {
+			err = initPlugin(plugin)
+		}
+	}
+	if err != nil {
+		c.report(tbl.Line, "%s.%s: %v", kind, name, err)
+	}
+}
+
+// checkOption checks the type of an option handled by the config package,
+// it returns false if it is invalid.
+func (c *checker) checkOption(key string, val interface{}, kind string) bool {
+	line := nodeLine(val)
+	invalid := func() bool {
+		c.report(line, "%s must be %s", key, kind)
+		return false
+	}
+
+	if kind == optTable || kind == optTagGlobs {
+		tbl, ok := val.(*ast.Table)
+		if !ok {
+			return invalid()
+		}
+		valid := true
+		for _, k := range sortedKeys(tbl) {
+			opt := optString
+			if kind == optTagGlobs {
+				opt = optGlobs
+			}
+			if !c.checkOption(key+"."+k, tbl.Fields[k], opt) {
+				valid = false
+			}
+		}
+		return valid
+	}
+
+	kv, ok := val.(*ast.KeyValue)
+	if !ok {
+		return invalid()
+	}
+
+	switch kind {
+	case optString:
+		if _, ok := kv.Value.(*ast.String); !ok {
+			return invalid()
+		}
+	case optInteger:
+		if _, ok := kv.Value.(*ast.Integer); !ok {
+			return invalid()
+		}
+	case optBoolean:
+		if _, ok := kv.Value.(*ast.Boolean); !ok {
+			return invalid()
+		}
+	case optDuration:
+		str, ok := kv.Value.(*ast.String)
+		if !ok {
+			return invalid()
+		}
+		if _, err := time.ParseDuration(str.Value); err != nil {
+			c.report(line, "invalid duration %q for %s", str.Value, key)
+			return false
+		}
+	case optExpr:
+		str, ok := kv.Value.(*ast.String)
+		if !ok {
+			return invalid()
+		}
+		if _, err := filter.CompileExpression(str.Value); err != nil {
+			c.report(line, "invalid expression %q for %s: %v", str.Value, key, err)
+			return false
+		}
+	case optSize:
+		switch v := kv.Value.(type) {
+		case *ast.Integer:
+		case *ast.String:
+			if _, err := units.ParseStrictBytes(v.Value); err != nil {
+				c.report(line, "invalid size %q for %s", v.Value, key)
+				return false
+			}
+		default:
+			return invalid()
+		}
+	case optArray, optGlobs:
+		ary, ok := kv.Value.(*ast.Array)
+		if !ok {
+			return invalid()
+		}
+		patterns := make([]string, 0, len(ary.Value))
+		for _, elem := range ary.Value {
+			str, ok := elem.(*ast.String)
+			if !ok {
+				return invalid()
+			}
+			patterns = append(patterns, str.Value)
+		}
+		if kind == optGlobs {
+			for _, pattern := range patterns {
+				if _, err := filter.Compile([]string{pattern}); err != nil {
+					c.report(line, "invalid glob pattern %q for %s: %v", pattern, key, err)
+					return false
+				}
+			}
+		}
+	}
+	return true
+}
+
+func sortedKeys(tbl *ast.Table) []string {
+	keys := make([]string, 0, len(tbl.Fields))
+	for k := range tbl.Fields {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+// keyTable returns a table holding only the key of the table.
+func keyTable(tbl *ast.Table, key string) *ast.Table {
+	t := *tbl
+	t.Fields = map[string]interface{}{key: tbl.Fields[key]}
+	t.Data = nil
+	return &t
+}
+
+// copyTable returns a copy of the table which can be changed without
+// changing the table.
+func copyTable(tbl *ast.Table) *ast.Table {
+	t := *tbl
+	t.Fields = make(map[string]interface{}, len(tbl.Fields))
+	for k, v := range tbl.Fields {
+		t.Fields[k] = v
+	}
+	return &t
+}
+
+// nodeLine returns the line of an ast node, or 0.
+func nodeLine(node interface{}) int {
+	switch n := node.(type) {
+	case *ast.KeyValue:
+		return n.Line
+	case *ast.Table:
+		return n.Line
+	case []*ast.Table:
+		if len(n) > 0 {
+			return n[0].Line
+		}
+	}
+	return 0
+}
@@ -0,0 +1,77 @@
+package config
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestCheck_Valid(t *testing.T) {
+	diags := Check("./testdata/reload/new.toml", "")
+	require.Len(t, diags, 0)
+}
+
+func TestCheck_Invalid(t *testing.T) {
+	file := "./testdata/check/invalid.toml"
+	diags := Check(file, "")
+
+	expected := []Diagnostic{
+		{file, 2, `config.AgentConfig.Interval: invalid duration "10x"`},
+		{file, 3, `unknown option "flush_intervall" in [agent]`},
+		{file, 6, "exec.Exec.Commands: `string' type is not assignable to `[]string' type"},
+		{file, 7, `invalid glob pattern "exec[" for namepass: unexpected end of input`},
+		{file, 8, "interval must be a duration string"},
+		{file, 11, "tagpass.timeout must be an array of glob patterns"},
+		{file, 13, `unknown input plugin "nosuch"`},
+		{file, 18, `csv_delimiter is unused with data_format "json"`},
+		{file, 19, "json_query must be a string"},
+		{file, 20, `invalid expression "usage_idle <" for metricpass: expected a value after '<' at offset 12, got end of expression`},
+		{file, 22, `outputs.file: invalid buffer_strategy "tape" for output file`},
+	}
+	require.Equal(t, expected, diags)
+}
+
+func TestCheck_ExternalPlugins(t *testing.T) {
+	diags := Check("./testdata/external.toml", "")
+	require.Len(t, diags, 0)
+}
+
+func TestCheck_Directory(t *testing.T) {
+	diags := Check("./testdata/check/invalid.toml", "./testdata/subconfig")
+	require.Len(t, diags, 11)
+
+	// Kubernetes mounts are skipped as they are by LoadDirectory.
+	for _, d := range diags {
+		require.NotContains(t, d.File, "..")
+	}
+}
+
+func TestCheck_NoPlugins(t *testing.T) {
+	file := "./testdata/check/empty.toml"
+	diags := Check(file, "")
+	require.Equal(t, []Diagnostic{
+		{file, 0, "no inputs found"},
+		{file, 0, "no outputs found"},
+	}, diags)
+}
+
+func TestCheck_ParseError(t *testing.T) {
+	file := "./testdata/check/parse_error.toml"
+	diags := Check(file, "")
+	require.Equal(t, Diagnostic{file, 3, "parse error"}, diags[0])
+}
+
+func TestCheck_InitPlugin(t *testing.T) {
+	file := "./testdata/init_error.toml"
+	diags := Check(file, "")
+	require.Equal(t, []Diagnostic{
+		{file, 0, "no outputs found"},
+		{file, 1, "inputs.init_test: invalid configuration"},
+	}, diags)
+
+	file = "./testdata/invalid_starlark.toml"
+	diags = Check(file, "")
+	require.Len(t, diags, 3)
+	require.Equal(t, 1, diags[2].Line)
+	require.Contains(t, diags[2].Message, "processors.starlark: ")
+}
@@ -23,6 +23,7 @@ import (
 	"github.com/lavaorg/telex/internal/models"
 	"github.com/lavaorg/telex/internal/toml"
 	"github.com/lavaorg/telex/internal/toml/ast"
+	"github.com/lavaorg/telex/internal/units"
 	"github.com/lavaorg/telex/plugins/aggregators"
 	"github.com/lavaorg/telex/plugins/inputs"
 	"github.com/lavaorg/telex/plugins/outputs"
@@ -62,6 +63,12 @@ type Config struct {
 	Aggregators []*models.RunningAggregator
 	// Processors have a slice wrapper type because they need to be sorted
 	Processors models.RunningProcessors
+
+	// ids holds the identity of every plugin, unused and reused track the
+	// plugins of the previous configuration during a reload.
+	ids    map[interface{}]string
+	unused map[string][]interface{}
+	reused map[interface{}]bool
 }
 
 func NewConfig() *Config {
@@ -79,6 +86,7 @@ func NewConfig() *Config {
 		Processors:    make([]*models.RunningProcessor, 0),
 		InputFilters:  make([]string, 0),
 		OutputFilters: make([]string, 0),
+		ids:           make(map[interface{}]string),
 	}
 	return c
 }
@@ -141,10 +149,79 @@ type AgentConfig struct {
 	// Logfile specifies the file to send logs to
 	Logfile string
 
+	// LogfileRotationInterval rotates the logfile after the time interval
+	// specified.  When set to 0 no time based rotation is performed.
+	LogfileRotationInterval internal.Duration
+
+	// LogfileRotationMaxSize rotates the logfile when it grows larger than
+	// the size specified.  When set to 0 no size based rotation is performed.
+	LogfileRotationMaxSize internal.Size
+
+	// LogfileRotationMaxArchives is the maximum number of rotated files to
+	// keep, older files are deleted.  When set to 0 all files are kept.
+	LogfileRotationMaxArchives int
+
+	// LogFormat is the format of log messages, "text" or "json".
+	LogFormat string
+
+	// LogLevels overrides the log level of individual plugins.
+	LogLevels map[string]string
+
 	// Quiet is the option for running in quiet mode
 	Quiet        bool
 	Hostname     string
 	OmitHostname bool
+
+	// APIAddress is the address serving the health and status API, the
+	// API is disabled if empty.
+	APIAddress string `toml:"api_address"`
+
+	// ControlSocket is the path of the unix socket accepting the commands
+	// of "telex ctl", the socket is disabled if empty.
+	ControlSocket string
+
+	// PluginDirectory is the directory holding the executables of the
+	// external plugins, named "telex-<kind>-<name>".
+	PluginDirectory string
+
+	// CardinalityLimit is the number of series allowed per measurement
+	// across all outputs, 0 disables the agent wide cardinality guard.
+	CardinalityLimit int
+
+	// CardinalityPolicy is applied to the new series of a measurement over
+	// the limit: "drop", "strip_tags" or "hash_tags".
+	CardinalityPolicy string
+
+	// CardinalityTagLimit is the number of values above which a tag is an
+	// offender, when 0 the tag with the most values is the offender.
+	CardinalityTagLimit int
+
+	// CardinalityHashBuckets is the number of values offending tags are
+	// hashed into with the hash_tags policy.
+	CardinalityHashBuckets int
+
+	// CardinalityCacheSize is the number of recent series remembered
+	// exactly, series not in the cache are new series.
+	CardinalityCacheSize int
+}
+
+// Cardinality returns the settings of the agent wide cardinality guard.
+func (a *AgentConfig) Cardinality() models.CardinalityConfig {
+	return models.CardinalityConfig{
+		Limit:       a.CardinalityLimit,
+		Policy:      a.CardinalityPolicy,
+		TagLimit:    a.CardinalityTagLimit,
+		HashBuckets: a.CardinalityHashBuckets,
+		CacheSize:   a.CardinalityCacheSize,
+	}
+}
+
+func validCardinalityPolicy(policy string) bool {
+	switch policy {
+	case "", models.CardinalityDrop, models.CardinalityStripTags, models.CardinalityHashTags:
+		return true
+	}
+	return false
 }
 
 // Inputs returns a list of strings of the configured inputs.
@@ -271,11 +348,61 @@ var header = `# telex Configuration
   ## Specify the log file name. The empty string means to log to stderr.
   logfile = ""
 
+  ## The logfile will be rotated after the time interval specified.  When set
+  ## to 0 no time based rotation is performed.
+  # logfile_rotation_interval = "0h"
+
+  ## The logfile will be rotated when it becomes larger than the specified
+  ## size.  When set to 0 no size based rotation is performed.
+  # logfile_rotation_max_size = "0MB"
+
+  ## Maximum number of rotated archives to keep, any older logs are deleted.
+  ## If set to 0, all archives are kept.  The logfile is also reopened on
+  ## SIGUSR1 for use with external tools such as logrotate.
+  # logfile_rotation_max_archives = 5
+
+  ## Log message format, "text" or "json".
+  # log_format = "text"
+
+  ## Override the log level, "error", "warn", "info" or "debug", of
+  ## individual plugins.
+  # [agent.log_levels]
+  #   "outputs.http" = "debug"
+
   ## Override default hostname, if empty use os.Hostname()
   hostname = ""
   ## If set to true, do no set the "host" tag in the telex agent.
   omit_hostname = false
 
+  ## Address of the HTTP API serving /health, /ready and /status, ie
+  ## "localhost:8888".  The API is disabled if empty.
+  # api_address = ""
+
+  ## Path of the unix socket used by "telex ctl" to pause and resume inputs,
+  ## flush outputs and change the log level of the running agent.  The socket
+  ## is disabled if empty.
+  # control_socket = "/var/run/telex/telex.sock"
+
+  ## Directory holding the external plugins, programs built with the shim
+  ## package.  A plugin table with no built-in plugin of its name runs the
+  ## program "telex-input-<name>", "telex-processor-<name>" or
+  ## "telex-output-<name>" of the directory.
+  # plugin_directory = "/usr/lib/telex/plugins"
+
+  ## Maximum number of series per measurement, across all outputs.  New
+  ## series of a measurement over the limit are handled according to the
+  ## cardinality_policy: "drop" them, "strip_tags" to remove the offending
+  ## tags or "hash_tags" to replace their values with one of
+  ## cardinality_hash_buckets hashes.  Tags with more than
+  ## cardinality_tag_limit values are offending, or when 0 the tag with the
+  ## most values.  The cardinality_cache_size most recent series are
+  ## remembered exactly and always allowed.
+  # cardinality_limit = 0
+  # cardinality_policy = "drop"
+  # cardinality_tag_limit = 0
+  # cardinality_hash_buckets = 100
+  # cardinality_cache_size = 100000
+
 
 ###############################################################################
 #                            OUTPUT PLUGINS                                   #
@@ -583,6 +710,48 @@ func getDefaultConfigPath() (string, error) {
 		" in $TELEGRAF_CONFIG_PATH, %s, or %s", homefile, etcfile)
 }
 
+// LoadAgentConfig loads only the [agent] table of the given config file into
+// c, without creating any plugin.
+func (c *Config) LoadAgentConfig(path string) error {
+	var err error
+	if path == "" {
+		if path, err = getDefaultConfigPath(); err != nil {
+			return err
+		}
+	}
+	data, err := loadConfig(path)
+	if err != nil {
+		return fmt.Errorf("Error loading %s, %s", path, err)
+	}
+
+	tbl, err := parseConfig(data)
+	if err != nil {
+		return fmt.Errorf("Error parsing %s, %s", path, err)
+	}
+	return c.parseAgent(path, tbl)
+}
+
+// parseAgent applies the [agent] table of the config file at path to c.
+func (c *Config) parseAgent(path string, tbl *ast.Table) error {
+	val, ok := tbl.Fields["agent"]
+	if !ok {
+		return nil
+	}
+	subTable, ok := val.(*ast.Table)
+	if !ok {
+		return fmt.Errorf("%s: invalid configuration", path)
+	}
+	if err := toml.UnmarshalTable(subTable, c.Agent); err != nil {
+		log.Printf("E! Could not parse [agent] config\n")
+		return fmt.Errorf("Error parsing %s, %s", path, err)
+	}
+	if !validCardinalityPolicy(c.Agent.CardinalityPolicy) {
+		return fmt.Errorf("Error parsing %s, invalid cardinality_policy %q",
+			path, c.Agent.CardinalityPolicy)
+	}
+	return nil
+}
+
 // LoadConfig loads the given config file and applies it to c
 func (c *Config) LoadConfig(path string) error {
 	var err error
@@ -616,15 +785,8 @@ func (c *Config) LoadConfig(path string) error {
 	}
 
 	// Parse agent table:
-	if val, ok := tbl.Fields["agent"]; ok {
-		subTable, ok := val.(*ast.Table)
-		if !ok {
-			return fmt.Errorf("%s: invalid configuration", path)
-		}
-		if err = toml.UnmarshalTable(subTable, c.Agent); err != nil {
-			log.Printf("E! Could not parse [agent] config\n")
-			return fmt.Errorf("Error parsing %s, %s", path, err)
-		}
+	if err = c.parseAgent(path, tbl); err != nil {
+		return err
 	}
 
 	if !c.Agent.OmitHostname {
@@ -799,6 +961,12 @@ func (c *Config) addAggregator(name string, table *ast.Table) error {
 	if !ok {
 		return fmt.Errorf("Undefined but requested aggregator: %s", name)
 	}
+
+	id := pluginID("aggregators", name, table)
+	if ra, ok := c.reuse(id).(*models.RunningAggregator); ok {
+		c.Aggregators = append(c.Aggregators, ra)
+		return nil
+	}
 	aggregator := creator()
 
 	conf, err := buildAggregator(name, table)
@@ -810,14 +978,40 @@ func (c *Config) addAggregator(name string, table *ast.Table) error {
 		return err
 	}
 
-	c.Aggregators = append(c.Aggregators, models.NewRunningAggregator(aggregator, conf))
+	if err := initPlugin(aggregator); err != nil {
+		return fmt.Errorf("Error initializing aggregator %s: %v", name, err)
+	}
+
+	ra := models.NewRunningAggregator(aggregator, conf)
+	c.ids[ra] = id
+	c.Aggregators = append(c.Aggregators, ra)
+	return nil
+}
+
+// initPlugin initializes the plugin if it is an Initializer.
+func initPlugin(plugin interface{}) error {
+	if p, ok := plugin.(telex.Initializer); ok {
+		return p.Init()
+	}
 	return nil
 }
 
 func (c *Config) addProcessor(name string, table *ast.Table) error {
 	creator, ok := processors.Processors[name]
+	path := ""
 	if !ok {
-		return fmt.Errorf("Undefined but requested processor: %s", name)
+		if path, ok = externalPlugin(c.Agent.PluginDirectory, "processor", name); !ok {
+			return fmt.Errorf("Undefined but requested processor: %s", name)
+		}
+	}
+
+	id := pluginID("processors", name, table)
+	if rf, ok := c.reuse(id).(*models.RunningProcessor); ok {
+		c.Processors = append(c.Processors, rf)
+		return nil
+	}
+	if path != "" {
+		return c.addExternalProcessor(name, path, id, table)
 	}
 	processor := creator()
 
@@ -830,12 +1024,17 @@ func (c *Config) addProcessor(name string, table *ast.Table) error {
 		return err
 	}
 
+	if err := initPlugin(processor); err != nil {
+		return fmt.Errorf("Error initializing processor %s: %v", name, err)
+	}
+
 	rf := &models.RunningProcessor{
 		Name:      name,
 		Processor: processor,
 		Config:    processorConfig,
 	}
 
+	c.ids[rf] = id
 	c.Processors = append(c.Processors, rf)
 	return nil
 }
@@ -845,8 +1044,23 @@ func (c *Config) addOutput(name string, table *ast.Table) error {
 		return nil
 	}
 	creator, ok := outputs.Outputs[name]
+	path := ""
 	if !ok {
-		return fmt.Errorf("Undefined but requested output: %s", name)
+		if path, ok = externalPlugin(c.Agent.PluginDirectory, "output", name); !ok {
+			return fmt.Errorf("Undefined but requested output: %s", name)
+		}
+	}
+
+	id := c.outputID(name, table)
+	if ro, ok := c.reuse(id).(*models.RunningOutput); ok {
+		if err := c.checkBufferDirectory(ro.Config); err != nil {
+			return err
+		}
+		c.Outputs = append(c.Outputs, ro)
+		return nil
+	}
+	if path != "" {
+		return c.addExternalOutput(name, path, id, table)
 	}
 	output := creator()
 
@@ -866,12 +1080,24 @@ func (c *Config) addOutput(name string, table *ast.Table) error {
 		return err
 	}
 
+	if err := c.checkBufferDirectory(outputConfig); err != nil {
+		return err
+	}
+
 	if err := toml.UnmarshalTable(table, output); err != nil {
 		return err
 	}
 
-	ro := models.NewRunningOutput(name, output, outputConfig,
+	if err := initPlugin(output); err != nil {
+		return fmt.Errorf("Error initializing output %s: %v", name, err)
+	}
+
+	ro, err := models.NewRunningOutput(name, output, outputConfig,
 		c.Agent.MetricBatchSize, c.Agent.MetricBufferLimit)
+	if err != nil {
+		return err
+	}
+	c.ids[ro] = id
 	c.Outputs = append(c.Outputs, ro)
 	return nil
 }
@@ -882,8 +1108,22 @@ func (c *Config) addInput(name string, table *ast.Table) error {
 	}
 
 	creator, ok := inputs.Inputs[name]
+	path := ""
 	if !ok {
-		return fmt.Errorf("Undefined but requested input: %s", name)
+		if path, ok = externalPlugin(c.Agent.PluginDirectory, "input", name); !ok {
+			return fmt.Errorf("Undefined but requested input: %s", name)
+		}
+	}
+
+	// The default tags of a reused input are updated by the agent, it may
+	// still be running.
+	id := pluginID("inputs", name, table)
+	if rp, ok := c.reuse(id).(*models.RunningInput); ok {
+		c.Inputs = append(c.Inputs, rp)
+		return nil
+	}
+	if path != "" {
+		return c.addExternalInput(name, path, id, table)
 	}
 	input := creator()
 
@@ -918,12 +1158,148 @@ func (c *Config) addInput(name string, table *ast.Table) error {
 		return err
 	}
 
+	if err := initPlugin(input); err != nil {
+		return fmt.Errorf("Error initializing input %s: %v", name, err)
+	}
+
 	rp := models.NewRunningInput(input, pluginConfig)
 	rp.SetDefaultTags(c.Tags)
+	c.ids[rp] = id
 	c.Inputs = append(c.Inputs, rp)
 	return nil
 }
 
+// Kinds of the options handled by the config package rather than by the
+// plugins, used by Check to validate them.
+const (
+	optString   = "a string"
+	optInteger  = "an integer"
+	optBoolean  = "a boolean"
+	optArray    = "an array of strings"
+	optTable    = "a table of strings"
+	optDuration = "a duration string"
+	optSize     = "a size"
+	optGlobs    = "an array of glob patterns"
+	optTagGlobs = "a table of glob pattern arrays"
+	optExpr     = "a filter expression string"
+)
+
+// The options handled by each build function, which removes them from the
+// table before the rest is unmarshaled into the plugin.  Check uses them to
+// tell these options from the options of the plugin.
+
+var filterOptions = map[string]string{
+	"namepass":   optGlobs,
+	"namedrop":   optGlobs,
+	"fieldpass":  optGlobs,
+	"fielddrop":  optGlobs,
+	"pass":       optGlobs,
+	"drop":       optGlobs,
+	"taginclude": optGlobs,
+	"tagexclude": optGlobs,
+	"tagpass":    optTagGlobs,
+	"tagdrop":    optTagGlobs,
+	"metricpass": optExpr,
+}
+
+var inputOptions = map[string]string{
+	"interval":       optDuration,
+	"gather_timeout": optDuration,
+	"name_prefix":    optString,
+	"name_suffix":    optString,
+	"name_override":  optString,
+	"tags":           optTable,
+}
+
+var aggregatorOptions = map[string]string{
+	"period":        optDuration,
+	"delay":         optDuration,
+	"drop_original": optBoolean,
+	"name_prefix":   optString,
+	"name_suffix":   optString,
+	"name_override": optString,
+	"tags":          optTable,
+}
+
+var processorOptions = map[string]string{
+	"order": optInteger,
+}
+
+var outputOptions = map[string]string{
+	"flush_interval":            optDuration,
+	"metric_buffer_limit":       optInteger,
+	"metric_batch_size":         optInteger,
+	"buffer_strategy":           optString,
+	"buffer_directory":          optString,
+	"buffer_max_size":           optSize,
+	"buffer_segment_size":       optSize,
+	"buffer_fsync":              optString,
+	"buffer_fsync_interval":     optDuration,
+	"retry_max_attempts":        optInteger,
+	"retry_initial_interval":    optDuration,
+	"retry_max_interval":        optDuration,
+	"circuit_breaker_threshold": optInteger,
+	"circuit_breaker_timeout":   optDuration,
+	"cardinality_limit":         optInteger,
+	"cardinality_policy":        optString,
+	"cardinality_tag_limit":     optInteger,
+	"cardinality_hash_buckets":  optInteger,
+	"cardinality_cache_size":    optInteger,
+}
+
+var parserOptions = map[string]string{
+	"data_format":               optString,
+	"data_type":                 optString,
+	"separator":                 optString,
+	"templates":                 optArray,
+	"tag_keys":                  optArray,
+	"json_string_fields":        optArray,
+	"json_name_key":             optString,
+	"json_query":                optString,
+	"json_time_key":             optString,
+	"json_time_format":          optString,
+	"grok_named_patterns":       optArray,
+	"grok_patterns":             optArray,
+	"grok_custom_patterns":      optString,
+	"grok_custom_pattern_files": optArray,
+	"grok_timezone":             optString,
+	"csv_column_names":          optArray,
+	"csv_column_types":          optArray,
+	"csv_field_columns":         optArray,
+	"csv_tag_columns":           optArray,
+	"csv_delimiter":             optString,
+	"csv_comment":               optString,
+	"csv_measurement_column":    optString,
+	"csv_timestamp_column":      optString,
+	"csv_timestamp_format":      optString,
+	"csv_header_row_count":      optInteger,
+	"csv_skip_rows":             optInteger,
+	"csv_skip_columns":          optInteger,
+	"csv_trim_space":            optBoolean,
+}
+
+var serializerOptions = map[string]string{
+	"data_format":                optString,
+	"prefix":                     optString,
+	"template":                   optString,
+	"templates":                  optArray,
+	"influx_max_line_bytes":      optInteger,
+	"influx_sort_fields":         optBoolean,
+	"influx_uint_support":        optBoolean,
+	"graphite_tag_support":       optBoolean,
+	"graphite_tag_sanitize_mode": optString,
+	"graphite_separator":         optString,
+	"json_timestamp_units":       optString,
+	"splunkmetric_hec_routing":   optBoolean,
+}
+
+// deleteOptions removes the options from the table.
+func deleteOptions(tbl *ast.Table, options map[string]string) {
+	for key := range options {
+		delete(tbl.Fields, key)
+	}
+}
+
 // buildAggregator parses Aggregator specific items from the ast.Table,
 // builds the filter and returns a
 // models.AggregatorConfig to be inserted into models.RunningAggregator
@@ -1005,13 +1381,7 @@ func buildAggregator(name string, tbl *ast.Table) (*models.AggregatorConfig, err
 		}
 	}
 
-	delete(tbl.Fields, "period")
-	delete(tbl.Fields, "delay")
-	delete(tbl.Fields, "drop_original")
-	delete(tbl.Fields, "name_prefix")
-	delete(tbl.Fields, "name_suffix")
-	delete(tbl.Fields, "name_override")
-	delete(tbl.Fields, "tags")
+	deleteOptions(tbl, aggregatorOptions)
 	var err error
 	conf.Filter, err = buildFilter(tbl)
 	if err != nil {
@@ -1038,7 +1408,7 @@ func buildProcessor(name string, tbl *ast.Table) (*models.ProcessorConfig, error
 		}
 	}
 
-	delete(tbl.Fields, "order")
+	deleteOptions(tbl, processorOptions)
 	var err error
 	conf.Filter, err = buildFilter(tbl)
 	if err != nil {
@@ -1048,7 +1418,7 @@ func buildProcessor(name string, tbl *ast.Table) (*models.ProcessorConfig, error
 }
 
 // buildFilter builds a Filter
-// (tagpass/tagdrop/namepass/namedrop/fieldpass/fielddrop) to
+// (tagpass/tagdrop/namepass/namedrop/fieldpass/fielddrop/metricpass) to
 // be inserted into the models.OutputConfig/models.InputConfig
 // to be used for glob filtering on tags and measurements
 func buildFilter(tbl *ast.Table) (models.Filter, error) {
@@ -1167,20 +1537,19 @@ func buildFilter(tbl *ast.Table) (models.Filter, error) {
 			}
 		}
 	}
+
+	if node, ok := tbl.Fields["metricpass"]; ok {
+		if kv, ok := node.(*ast.KeyValue); ok {
+			if str, ok := kv.Value.(*ast.String); ok {
+				f.MetricPass = str.Value
+			}
+		}
+	}
 	if err := f.Compile(); err != nil {
 		return f, err
 	}
 
-	delete(tbl.Fields, "namedrop")
-	delete(tbl.Fields, "namepass")
-	delete(tbl.Fields, "fielddrop")
-	delete(tbl.Fields, "fieldpass")
-	delete(tbl.Fields, "drop")
-	delete(tbl.Fields, "pass")
-	delete(tbl.Fields, "tagdrop")
-	delete(tbl.Fields, "tagpass")
-	delete(tbl.Fields, "tagexclude")
-	delete(tbl.Fields, "taginclude")
+	deleteOptions(tbl, filterOptions)
 	return f, nil
 }
 
@@ -1202,6 +1571,19 @@ func buildInput(name string, tbl *ast.Table) (*models.InputConfig, error) {
 		}
 	}
 
+	if node, ok := tbl.Fields["gather_timeout"]; ok {
+		if kv, ok := node.(*ast.KeyValue); ok {
+			if str, ok := kv.Value.(*ast.String); ok {
+				dur, err := time.ParseDuration(str.Value)
+				if err != nil {
+					return nil, err
+				}
+
+				cp.GatherTimeout = dur
+			}
+		}
+	}
+
 	if node, ok := tbl.Fields["name_prefix"]; ok {
 		if kv, ok := node.(*ast.KeyValue); ok {
 			if str, ok := kv.Value.(*ast.String); ok {
@@ -1235,11 +1617,7 @@ func buildInput(name string, tbl *ast.Table) (*models.InputConfig, error) {
 		}
 	}
 
-	delete(tbl.Fields, "name_prefix")
-	delete(tbl.Fields, "name_suffix")
-	delete(tbl.Fields, "name_override")
-	delete(tbl.Fields, "interval")
-	delete(tbl.Fields, "tags")
+	deleteOptions(tbl, inputOptions)
 	var err error
 	cp.Filter, err = buildFilter(tbl)
 	if err != nil {
@@ -1542,34 +1920,7 @@ func getParserConfig(name string, tbl *ast.Table) (*parsers.Config, error) {
 
 	c.MetricName = name
 
-	delete(tbl.Fields, "data_format")
-	delete(tbl.Fields, "separator")
-	delete(tbl.Fields, "templates")
-	delete(tbl.Fields, "tag_keys")
-	delete(tbl.Fields, "json_name_key")
-	delete(tbl.Fields, "json_query")
-	delete(tbl.Fields, "json_string_fields")
-	delete(tbl.Fields, "json_time_format")
-	delete(tbl.Fields, "json_time_key")
-	delete(tbl.Fields, "data_type")
-	delete(tbl.Fields, "grok_named_patterns")
-	delete(tbl.Fields, "grok_patterns")
-	delete(tbl.Fields, "grok_custom_patterns")
-	delete(tbl.Fields, "grok_custom_pattern_files")
-	delete(tbl.Fields, "grok_timezone")
-	delete(tbl.Fields, "csv_column_names")
-	delete(tbl.Fields, "csv_column_types")
-	delete(tbl.Fields, "csv_comment")
-	delete(tbl.Fields, "csv_delimiter")
-	delete(tbl.Fields, "csv_field_columns")
-	delete(tbl.Fields, "csv_header_row_count")
-	delete(tbl.Fields, "csv_measurement_column")
-	delete(tbl.Fields, "csv_skip_columns")
-	delete(tbl.Fields, "csv_skip_rows")
-	delete(tbl.Fields, "csv_tag_columns")
-	delete(tbl.Fields, "csv_timestamp_column")
-	delete(tbl.Fields, "csv_timestamp_format")
-	delete(tbl.Fields, "csv_trim_space")
+	deleteOptions(tbl, parserOptions)
 
 	return c, nil
 }
@@ -1608,6 +1959,18 @@ func buildSerializer(name string, tbl *ast.Table) (serializers.Serializer, error
 		}
 	}
 
+	if node, ok := tbl.Fields["templates"]; ok {
+		if kv, ok := node.(*ast.KeyValue); ok {
+			if ary, ok := kv.Value.(*ast.Array); ok {
+				for _, elem := range ary.Value {
+					if str, ok := elem.(*ast.String); ok {
+						c.Templates = append(c.Templates, str.Value)
+					}
+				}
+			}
+		}
+	}
+
 	if node, ok := tbl.Fields["influx_max_line_bytes"]; ok {
 		if kv, ok := node.(*ast.KeyValue); ok {
 			if integer, ok := kv.Value.(*ast.Integer); ok {
@@ -1656,6 +2019,22 @@ func buildSerializer(name string, tbl *ast.Table) (serializers.Serializer, error
 		}
 	}
 
+	if node, ok := tbl.Fields["graphite_tag_sanitize_mode"]; ok {
+		if kv, ok := node.(*ast.KeyValue); ok {
+			if str, ok := kv.Value.(*ast.String); ok {
+				c.GraphiteTagSanitizeMode = str.Value
+			}
+		}
+	}
+
+	if node, ok := tbl.Fields["graphite_separator"]; ok {
+		if kv, ok := node.(*ast.KeyValue); ok {
+			if str, ok := kv.Value.(*ast.String); ok {
+				c.GraphiteSeparator = str.Value
+			}
+		}
+	}
+
 	if node, ok := tbl.Fields["json_timestamp_units"]; ok {
 		if kv, ok := node.(*ast.KeyValue); ok {
 			if str, ok := kv.Value.(*ast.String); ok {
@@ -1684,15 +2063,7 @@ func buildSerializer(name string, tbl *ast.Table) (serializers.Serializer, error
 		}
 	}
 
-	delete(tbl.Fields, "influx_max_line_bytes")
-	delete(tbl.Fields, "influx_sort_fields")
-	delete(tbl.Fields, "influx_uint_support")
-	delete(tbl.Fields, "graphite_tag_support")
-	delete(tbl.Fields, "data_format")
-	delete(tbl.Fields, "prefix")
-	delete(tbl.Fields, "template")
-	delete(tbl.Fields, "json_timestamp_units")
-	delete(tbl.Fields, "splunkmetric_hec_routing")
+	deleteOptions(tbl, serializerOptions)
 	return serializers.NewSerializer(c)
 }
 
@@ -1756,9 +2127,150 @@ func buildOutput(name string, tbl *ast.Table) (*models.OutputConfig, error) {
 		}
 	}
 
-	delete(tbl.Fields, "flush_interval")
-	delete(tbl.Fields, "metric_buffer_limit")
-	delete(tbl.Fields, "metric_batch_size")
+	if node, ok := tbl.Fields["buffer_strategy"]; ok {
+		if kv, ok := node.(*ast.KeyValue); ok {
+			if str, ok := kv.Value.(*ast.String); ok {
+				oc.BufferStrategy = str.Value
+			}
+		}
+	}
+
+	switch oc.BufferStrategy {
+	case "", "memory", "disk":
+	default:
+		return nil, fmt.Errorf("invalid buffer_strategy %q for output %s",
+			oc.BufferStrategy, name)
+	}
+
+	if node, ok := tbl.Fields["buffer_directory"]; ok {
+		if kv, ok := node.(*ast.KeyValue); ok {
+			if str, ok := kv.Value.(*ast.String); ok {
+				oc.DiskBuffer.Directory = str.Value
+			}
+		}
+	}
+
+	if oc.BufferStrategy == "disk" && oc.DiskBuffer.Directory == "" {
+		return nil, fmt.Errorf("buffer_directory is required for the disk "+
+			"buffer_strategy of output %s", name)
+	}
+
+	for key, size := range map[string]*int64{
+		"buffer_max_size":     &oc.DiskBuffer.MaxSize,
+		"buffer_segment_size": &oc.DiskBuffer.SegmentSize,
+	} {
+		if node, ok := tbl.Fields[key]; ok {
+			if kv, ok := node.(*ast.KeyValue); ok {
+				switch v := kv.Value.(type) {
+				case *ast.Integer:
+					*size, err = v.Int()
+				case *ast.String:
+					*size, err = units.ParseStrictBytes(v.Value)
+				}
+				if err != nil {
+					return nil, fmt.Errorf("invalid %s: %s", key, err)
+				}
+			}
+		}
+	}
+
+	if node, ok := tbl.Fields["buffer_fsync"]; ok {
+		if kv, ok := node.(*ast.KeyValue); ok {
+			if str, ok := kv.Value.(*ast.String); ok {
+				oc.DiskBuffer.Fsync = str.Value
+			}
+		}
+	}
+
+	switch oc.DiskBuffer.Fsync {
+	case "", models.FsyncAlways, models.FsyncInterval, models.FsyncNever:
+	default:
+		return nil, fmt.Errorf("invalid buffer_fsync %q for output %s",
+			oc.DiskBuffer.Fsync, name)
+	}
+
+	if node, ok := tbl.Fields["buffer_fsync_interval"]; ok {
+		if kv, ok := node.(*ast.KeyValue); ok {
+			if str, ok := kv.Value.(*ast.String); ok {
+				dur, err := time.ParseDuration(str.Value)
+				if err != nil {
+					return nil, err
+				}
+
+				oc.DiskBuffer.FsyncInterval = dur
+			}
+		}
+	}
+
+	for key, count := range map[string]*int{
+		"retry_max_attempts":        &oc.Retry.MaxAttempts,
+		"circuit_breaker_threshold": &oc.Retry.BreakerThreshold,
+	} {
+		if node, ok := tbl.Fields[key]; ok {
+			if kv, ok := node.(*ast.KeyValue); ok {
+				if integer, ok := kv.Value.(*ast.Integer); ok {
+					v, err := integer.Int()
+					if err != nil {
+						return nil, err
+					}
+					*count = int(v)
+				}
+			}
+		}
+	}
+
+	for key, interval := range map[string]*time.Duration{
+		"retry_initial_interval":  &oc.Retry.InitialInterval,
+		"retry_max_interval":      &oc.Retry.MaxInterval,
+		"circuit_breaker_timeout": &oc.Retry.BreakerTimeout,
+	} {
+		if node, ok := tbl.Fields[key]; ok {
+			if kv, ok := node.(*ast.KeyValue); ok {
+				if str, ok := kv.Value.(*ast.String); ok {
+					dur, err := time.ParseDuration(str.Value)
+					if err != nil {
+						return nil, err
+					}
+
+					*interval = dur
+				}
+			}
+		}
+	}
+
+	for key, count := range map[string]*int{
+		"cardinality_limit":        &oc.Cardinality.Limit,
+		"cardinality_tag_limit":    &oc.Cardinality.TagLimit,
+		"cardinality_hash_buckets": &oc.Cardinality.HashBuckets,
+		"cardinality_cache_size":   &oc.Cardinality.CacheSize,
+	} {
+		if node, ok := tbl.Fields[key]; ok {
+			if kv, ok := node.(*ast.KeyValue); ok {
+				if integer, ok := kv.Value.(*ast.Integer); ok {
+					v, err := integer.Int()
+					if err != nil {
+						return nil, err
+					}
+					*count = int(v)
+				}
+			}
+		}
+	}
+
+	if node, ok := tbl.Fields["cardinality_policy"]; ok {
+		if kv, ok := node.(*ast.KeyValue); ok {
+			if str, ok := kv.Value.(*ast.String); ok {
+				oc.Cardinality.Policy = str.Value
+			}
+		}
+	}
+
+	if !validCardinalityPolicy(oc.Cardinality.Policy) {
+		return nil, fmt.Errorf("invalid cardinality_policy %q for output %s",
+			oc.Cardinality.Policy, name)
+	}
+
+	deleteOptions(tbl, outputOptions)
 
 	return oc, nil
 }
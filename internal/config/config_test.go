@@ -1,15 +1,24 @@
 package config
 
 import (
+	"errors"
 	"os"
 	"testing"
+	"time"
 
+	"github.com/lavaorg/telex"
 	"github.com/lavaorg/telex/internal/models"
 	"github.com/lavaorg/telex/plugins/inputs"
 	"github.com/lavaorg/telex/plugins/inputs/exec"
+	inputsexecd "github.com/lavaorg/telex/plugins/inputs/execd"
+	outputsexecd "github.com/lavaorg/telex/plugins/outputs/execd"
+	_ "github.com/lavaorg/telex/plugins/outputs/file"
 	"github.com/lavaorg/telex/plugins/parsers"
+	processorsexecd "github.com/lavaorg/telex/plugins/processors/execd"
+	_ "github.com/lavaorg/telex/plugins/processors/starlark"
 
 	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
 )
 
 func TestConfig_LoadSingleInputWithEnvVars(t *testing.T) {
@@ -119,3 +128,178 @@ func TestConfig_LoadDirectory(t *testing.T) {
 		"Merged Testdata did not produce correct exec metadata.")
 
 }
+
+func TestConfig_ReuseUnchangedPlugins(t *testing.T) {
+	old := NewConfig()
+	err := old.LoadConfig("./testdata/reload/old.toml")
+	require.NoError(t, err)
+	require.Len(t, old.Inputs, 2)
+	require.Len(t, old.Outputs, 1)
+
+	c := NewConfig()
+	c.SetPrevious(old)
+	err = c.LoadConfig("./testdata/reload/new.toml")
+	require.NoError(t, err)
+	require.Len(t, c.Inputs, 2)
+	require.Len(t, c.Outputs, 1)
+
+	require.True(t, c.Inputs[0] == old.Inputs[0])
+	require.True(t, c.Reused(c.Inputs[0]))
+	require.False(t, c.Inputs[1] == old.Inputs[1])
+	require.False(t, c.Reused(c.Inputs[1]))
+	require.True(t, c.Outputs[0] == old.Outputs[0])
+	require.True(t, c.Reused(c.Outputs[0]))
+
+	// Identities carry over to the following reload.
+	next := NewConfig()
+	next.SetPrevious(c)
+	err = next.LoadConfig("./testdata/reload/new.toml")
+	require.NoError(t, err)
+	require.True(t, next.Inputs[1] == c.Inputs[1])
+}
+
+func TestConfig_DuplicateBufferDirectory(t *testing.T) {
+	defer os.RemoveAll("/tmp/telex-buffer")
+
+	c := NewConfig()
+	err := c.LoadConfig("./testdata/reload/duplicate_buffer.toml")
+	require.Error(t, err)
+	c.Discard()
+}
+
+// initInput is an input whose Init fails when fail is set.
+type initInput struct {
+	Fail        bool `toml:"fail"`
+	initialized bool
+}
+
+func (i *initInput) SampleConfig() string           { return "" }
+func (i *initInput) Description() string            { return "" }
+func (i *initInput) Gather(telex.Accumulator) error { return nil }
+func (i *initInput) Init() error {
+	if i.Fail {
+		return errors.New("invalid configuration")
+	}
+	i.initialized = true
+	return nil
+}
+
+func init() {
+	inputs.Add("init_test", func() telex.Input { return &initInput{} })
+}
+
+func TestConfig_InitPlugin(t *testing.T) {
+	c := NewConfig()
+	require.NoError(t, c.LoadConfig("./testdata/init.toml"))
+	require.Len(t, c.Inputs, 1)
+	require.True(t, c.Inputs[0].Input.(*initInput).initialized)
+
+	c = NewConfig()
+	err := c.LoadConfig("./testdata/init_error.toml")
+	require.Error(t, err)
+	require.Contains(t, err.Error(), "Error initializing input init_test: invalid configuration")
+}
+
+func TestConfig_InitError(t *testing.T) {
+	c := NewConfig()
+	err := c.LoadConfig("./testdata/invalid_starlark.toml")
+	require.Error(t, err)
+	require.Contains(t, err.Error(), "Error initializing processor starlark")
+}
+
+func TestConfig_LoadMetricPass(t *testing.T) {
+	c := NewConfig()
+	require.NoError(t, c.LoadConfig("./testdata/metricpass.toml"))
+
+	require.Len(t, c.Inputs, 1)
+	require.Equal(t, "name = cpu and usage_idle < 10 or host = db*", c.Inputs[0].Config.Filter.MetricPass)
+	require.True(t, c.Inputs[0].Config.Filter.IsActive())
+
+	require.Len(t, c.Outputs, 1)
+	require.Equal(t, "not fields.debug", c.Outputs[0].Config.Filter.MetricPass)
+	require.True(t, c.Outputs[0].Config.Filter.IsActive())
+}
+
+func TestConfig_LoadGatherTimeout(t *testing.T) {
+	c := NewConfig()
+	require.NoError(t, c.LoadConfig("./testdata/gather_timeout.toml"))
+
+	require.Len(t, c.Inputs, 1)
+	require.Equal(t, 30*time.Second, c.Inputs[0].Config.Interval)
+	require.Equal(t, 10*time.Second, c.Inputs[0].Config.GatherTimeout)
+}
+
+func TestConfig_LoadCardinality(t *testing.T) {
+	c := NewConfig()
+	require.NoError(t, c.LoadConfig("./testdata/cardinality.toml"))
+
+	require.Equal(t, models.CardinalityConfig{
+		Limit:  10000,
+		Policy: "hash_tags",
+	}, c.Agent.Cardinality())
+
+	require.Len(t, c.Outputs, 1)
+	require.Equal(t, models.CardinalityConfig{
+		Limit:     1000,
+		Policy:    "strip_tags",
+		TagLimit:  100,
+		CacheSize: 50000,
+	}, c.Outputs[0].Config.Cardinality)
+}
+
+func TestConfig_LoadAgentConfig(t *testing.T) {
+	c := NewConfig()
+	require.NoError(t, c.LoadAgentConfig("./testdata/cardinality.toml"))
+
+	require.Equal(t, "hash_tags", c.Agent.CardinalityPolicy)
+	require.Empty(t, c.Inputs)
+	require.Empty(t, c.Outputs)
+}
+
+func TestConfig_LoadExternalPlugins(t *testing.T) {
+	c := NewConfig()
+	require.NoError(t, c.LoadConfig("./testdata/external.toml"))
+
+	require.Len(t, c.Inputs, 1)
+	require.Equal(t, "mycollector", c.Inputs[0].Config.Name)
+	require.Equal(t, 30*time.Second, c.Inputs[0].Config.Interval)
+	require.Equal(t, map[string]string{"dc": "east"}, c.Inputs[0].Config.Tags)
+	input, ok := c.Inputs[0].Input.(*inputsexecd.Execd)
+	require.True(t, ok)
+	require.Equal(t, []string{"testdata/plugins/telex-input-mycollector"}, input.Command)
+	require.Equal(t, "STDIN", input.Signal)
+	require.Equal(t, []string{"TELEX_PLUGIN_CONFIG=" +
+		`servers = ["a", "b"]` + "\n" +
+		`timeout = "5s"` + "\n" +
+		"[[device]]\n" +
+		`name = "sda"` + "\n" +
+		"[options]\n" +
+		`"key with spaces" = true` + "\n"}, input.Environment)
+
+	require.Len(t, c.Processors, 1)
+	require.Equal(t, int64(1), c.Processors[0].Config.Order)
+	processor, ok := c.Processors[0].Processor.(*processorsexecd.Execd)
+	require.True(t, ok)
+	require.Equal(t, []string{"TELEX_PLUGIN_CONFIG=factor = 2.5\n"}, processor.Environment)
+
+	require.Len(t, c.Outputs, 1)
+	output, ok := c.Outputs[0].Output.(*outputsexecd.Execd)
+	require.True(t, ok)
+	require.True(t, output.Acknowledge)
+	require.Equal(t, []string{"TELEX_PLUGIN_CONFIG=" +
+		`data_format = "json"` + "\n" +
+		`url = "http://localhost:8080"` + "\n"}, output.Environment)
+}
+
+func TestConfig_ExternalPlugin(t *testing.T) {
+	path, ok := externalPlugin("./testdata/plugins", "input", "mycollector")
+	require.True(t, ok)
+	require.Equal(t, "testdata/plugins/telex-input-mycollector", path)
+
+	_, ok = externalPlugin("./testdata/plugins", "output", "mycollector")
+	require.False(t, ok)
+	_, ok = externalPlugin("./testdata/plugins", "input", "../plugins/telex-input-mycollector")
+	require.False(t, ok)
+	_, ok = externalPlugin("", "input", "mycollector")
+	require.False(t, ok)
+}
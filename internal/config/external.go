@@ -0,0 +1,140 @@
+package config
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"github.com/lavaorg/telex/internal/models"
+	"github.com/lavaorg/telex/internal/toml/ast"
+	"github.com/lavaorg/telex/plugins/inputs"
+	"github.com/lavaorg/telex/plugins/outputs"
+	"github.com/lavaorg/telex/plugins/processors"
+)
+
+var bareKeyRe = regexp.MustCompile(`^[A-Za-z0-9_-]+$`)
+
+// externalPlugin returns the path of the executable of the external plugin,
+// "telex-<kind>-<name>" in the directory.
+func externalPlugin(directory, kind, name string) (string, bool) {
+	if directory == "" || strings.ContainsAny(name, `/\`) {
+		return "", false
+	}
+
+	path := filepath.Join(directory, "telex-"+kind+"-"+name)
+	for _, p := range []string{path, path + ".exe"} {
+		if fi, err := os.Stat(p); err == nil && fi.Mode().IsRegular() {
+			return p, true
+		}
+	}
+	return "", false
+}
+
+// The external plugins are run by the plugins registered with AddExternal,
+// the execd plugins, with the options of their table left once the options
+// of the agent are removed.
+
+func (c *Config) addExternalInput(name, path, id string, table *ast.Table) error {
+	pluginConfig, err := buildInput(name, table)
+	if err != nil {
+		return err
+	}
+	if inputs.External == nil {
+		return fmt.Errorf("Undefined but requested input: %s", name)
+	}
+	input := inputs.External(path, pluginTOML(table))
+
+	rp := models.NewRunningInput(input, pluginConfig)
+	rp.SetDefaultTags(c.Tags)
+	c.ids[rp] = id
+	c.Inputs = append(c.Inputs, rp)
+	return nil
+}
+
+func (c *Config) addExternalProcessor(name, path, id string, table *ast.Table) error {
+	processorConfig, err := buildProcessor(name, table)
+	if err != nil {
+		return err
+	}
+
+	if processors.External == nil {
+		return fmt.Errorf("Undefined but requested processor: %s", name)
+	}
+	processor := processors.External(path, pluginTOML(table))
+
+	rf := &models.RunningProcessor{
+		Name:      name,
+		Processor: processor,
+		Config:    processorConfig,
+	}
+	c.ids[rf] = id
+	c.Processors = append(c.Processors, rf)
+	return nil
+}
+
+func (c *Config) addExternalOutput(name, path, id string, table *ast.Table) error {
+	outputConfig, err := buildOutput(name, table)
+	if err != nil {
+		return err
+	}
+	if err := c.checkBufferDirectory(outputConfig); err != nil {
+		return err
+	}
+
+	if outputs.External == nil {
+		return fmt.Errorf("Undefined but requested output: %s", name)
+	}
+	output := outputs.External(path, pluginTOML(table))
+
+	ro, err := models.NewRunningOutput(name, output, outputConfig,
+		c.Agent.MetricBatchSize, c.Agent.MetricBufferLimit)
+	if err != nil {
+		return err
+	}
+	c.ids[ro] = id
+	c.Outputs = append(c.Outputs, ro)
+	return nil
+}
+
+// pluginTOML formats the table as TOML.
+func pluginTOML(tbl *ast.Table) string {
+	var b strings.Builder
+	writeTOML(&b, "", tbl)
+	return b.String()
+}
+
+func writeTOML(b *strings.Builder, prefix string, tbl *ast.Table) {
+	keys := sortedKeys(tbl)
+	for _, key := range keys {
+		if kv, ok := tbl.Fields[key].(*ast.KeyValue); ok {
+			fmt.Fprintf(b, "%s = %s\n", tomlKey(key), kv.Value.Source())
+		}
+	}
+
+	for _, key := range keys {
+		name := tomlKey(key)
+		if prefix != "" {
+			name = prefix + "." + name
+		}
+		switch t := tbl.Fields[key].(type) {
+		case *ast.Table:
+			fmt.Fprintf(b, "[%s]\n", name)
+			writeTOML(b, name, t)
+		case []*ast.Table:
+			for _, t := range t {
+				fmt.Fprintf(b, "[[%s]]\n", name)
+				writeTOML(b, name, t)
+			}
+		}
+	}
+}
+
+func tomlKey(key string) string {
+	if bareKeyRe.MatchString(key) {
+		return key
+	}
+	return strconv.Quote(key)
+}
@@ -0,0 +1,151 @@
+package config
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"log"
+	"path/filepath"
+	"sort"
+
+	"github.com/lavaorg/telex/internal/models"
+	"github.com/lavaorg/telex/internal/toml/ast"
+)
+
+// pluginID returns the identity of a plugin: a hash of its kind, name and
+// every setting of its table.  Two plugins with the same identity are
+// configured identically, regardless of formatting, comments or the order of
+// the settings.  Extra values which affect the plugin but are not part of its
+// table may be included.
+func pluginID(kind, name string, tbl *ast.Table, extra ...string) string {
+	h := sha256.New()
+	fmt.Fprintf(h, "%s.%s\n", kind, name)
+	writeTable(h, tbl)
+	for _, e := range extra {
+		fmt.Fprintf(h, "%s\n", e)
+	}
+	return hex.EncodeToString(h.Sum(nil))
+}
+
+// writeTable writes the settings of the table in a canonical order.
+func writeTable(w io.Writer, tbl *ast.Table) {
+	keys := make([]string, 0, len(tbl.Fields))
+	for k := range tbl.Fields {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+
+	for _, k := range keys {
+		switch v := tbl.Fields[k].(type) {
+		case *ast.KeyValue:
+			fmt.Fprintf(w, "%s=%s\n", k, v.Value.Source())
+		case *ast.Table:
+			fmt.Fprintf(w, "[%s]\n", k)
+			writeTable(w, v)
+			fmt.Fprintf(w, "[/%s]\n", k)
+		case []*ast.Table:
+			for _, t := range v {
+				fmt.Fprintf(w, "[[%s]]\n", k)
+				writeTable(w, t)
+				fmt.Fprintf(w, "[[/%s]]\n", k)
+			}
+		}
+	}
+}
+
+// SetPrevious sets the configuration being replaced by a reload.  Plugins
+// whose configuration is unchanged are taken from it instead of being created
+// again, keeping their state, connections and buffered metrics.  It must be
+// called before loading any configuration file.
+func (c *Config) SetPrevious(previous *Config) {
+	c.unused = make(map[string][]interface{})
+	c.reused = make(map[interface{}]bool)
+	if previous == nil {
+		return
+	}
+
+	for _, plugin := range previous.plugins() {
+		id, ok := previous.ids[plugin]
+		if !ok {
+			continue
+		}
+		c.unused[id] = append(c.unused[id], plugin)
+	}
+}
+
+// reuse returns an unused plugin of the previous configuration with the
+// given identity, or nil.
+func (c *Config) reuse(id string) interface{} {
+	plugins := c.unused[id]
+	if len(plugins) == 0 {
+		return nil
+	}
+	plugin := plugins[0]
+	c.unused[id] = plugins[1:]
+	c.ids[plugin] = id
+	c.reused[plugin] = true
+	return plugin
+}
+
+// Reused returns true if the plugin was taken from the previous
+// configuration.
+func (c *Config) Reused(plugin interface{}) bool {
+	return c.reused[plugin]
+}
+
+// Discard releases the resources of a configuration that will not be run,
+// such as the buffers of its outputs.  Plugins taken from the previous
+// configuration are left untouched.
+func (c *Config) Discard() {
+	for _, ro := range c.Outputs {
+		if c.reused[ro] {
+			continue
+		}
+		if err := ro.ReleaseBuffer(); err != nil {
+			log.Printf("E! [outputs.%s] Error releasing buffer: %v", ro.Name, err)
+		}
+	}
+}
+
+func (c *Config) plugins() []interface{} {
+	var plugins []interface{}
+	for _, p := range c.Inputs {
+		plugins = append(plugins, p)
+	}
+	for _, p := range c.Processors {
+		plugins = append(plugins, p)
+	}
+	for _, p := range c.Aggregators {
+		plugins = append(plugins, p)
+	}
+	for _, p := range c.Outputs {
+		plugins = append(plugins, p)
+	}
+	return plugins
+}
+
+// outputID returns the identity of an output, which also depends on the
+// agent batch settings.
+func (c *Config) outputID(name string, tbl *ast.Table) string {
+	return pluginID("outputs", name, tbl,
+		fmt.Sprintf("metric_batch_size=%d", c.Agent.MetricBatchSize),
+		fmt.Sprintf("metric_buffer_limit=%d", c.Agent.MetricBufferLimit))
+}
+
+// checkBufferDirectory returns an error if another output of the
+// configuration uses the same disk buffer directory.
+func (c *Config) checkBufferDirectory(conf *models.OutputConfig) error {
+	if conf.BufferStrategy != "disk" {
+		return nil
+	}
+	for _, ro := range c.Outputs {
+		if ro.Config.BufferStrategy == "disk" &&
+			filepath.Clean(ro.Config.DiskBuffer.Directory) ==
+				filepath.Clean(conf.DiskBuffer.Directory) {
+			return fmt.Errorf("buffer_directory %q is already used by outputs.%s",
+				conf.DiskBuffer.Directory, ro.Name)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,188 @@
+package config
+
+import (
+	"fmt"
+	"log"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/fsnotify/fsnotify"
+)
+
+// Watcher notifies when the configuration file or any file of the
+// configuration directory changes.  Changes are debounced, a burst of changes
+// results in a single notification once the files have been quiet for the
+// debounce period.
+//
+// Directories are watched rather than files so that files replaced by a
+// rename, as editors and Kubernetes ConfigMap volumes do, are noticed.  In a
+// ConfigMap volume the files are symlinks into a "..data" directory which is
+// swapped atomically on update.
+type Watcher struct {
+	// C receives a value after the configuration changed.
+	C <-chan struct{}
+
+	file      string
+	directory string
+	debounce  time.Duration
+
+	watcher *fsnotify.Watcher
+	notify  chan struct{}
+	wg      sync.WaitGroup
+}
+
+// NewWatcher watches the configuration file and the configuration directory,
+// which may be empty.  If the file is empty the default configuration file is
+// watched.
+func NewWatcher(file, directory string, debounce time.Duration) (*Watcher, error) {
+	var err error
+	if file == "" {
+		if file, err = getDefaultConfigPath(); err != nil {
+			return nil, err
+		}
+	}
+	if u, err := url.Parse(file); err == nil && (u.Scheme == "http" || u.Scheme == "https") {
+		return nil, fmt.Errorf("can not watch remote configuration %s", file)
+	}
+	if file, err = filepath.Abs(file); err != nil {
+		return nil, err
+	}
+	if directory != "" {
+		if directory, err = filepath.Abs(directory); err != nil {
+			return nil, err
+		}
+	}
+
+	watcher, err := fsnotify.NewWatcher()
+	if err != nil {
+		return nil, err
+	}
+
+	notify := make(chan struct{}, 1)
+	w := &Watcher{
+		C:         notify,
+		file:      file,
+		directory: directory,
+		debounce:  debounce,
+		watcher:   watcher,
+		notify:    notify,
+	}
+
+	if err := watcher.Add(filepath.Dir(file)); err != nil {
+		watcher.Close()
+		return nil, err
+	}
+	if directory != "" {
+		if err := w.addDirectory(); err != nil {
+			watcher.Close()
+			return nil, err
+		}
+	}
+
+	w.wg.Add(1)
+	go func() {
+		defer w.wg.Done()
+		w.run()
+	}()
+	return w, nil
+}
+
+// Close stops watching.
+func (w *Watcher) Close() error {
+	err := w.watcher.Close()
+	w.wg.Wait()
+	return err
+}
+
+// addDirectory watches the configuration directory and its subdirectories,
+// skipping Kubernetes mounts as LoadDirectory does.  It is called again after
+// every change so that new subdirectories are watched.
+func (w *Watcher) addDirectory() error {
+	return filepath.Walk(w.directory, func(path string, info os.FileInfo, err error) error {
+		if info == nil || !info.IsDir() {
+			return nil
+		}
+		if path != w.directory && strings.HasPrefix(info.Name(), "..") {
+			return filepath.SkipDir
+		}
+		return w.watcher.Add(path)
+	})
+}
+
+func (w *Watcher) run() {
+	var timer *time.Timer
+	var timerC <-chan time.Time
+	defer func() {
+		if timer != nil {
+			timer.Stop()
+		}
+	}()
+
+	for {
+		select {
+		case event, ok := <-w.watcher.Events:
+			if !ok {
+				return
+			}
+			if !w.relevant(event.Name) {
+				continue
+			}
+			log.Printf("D! [config] Configuration change: %s", event)
+
+			if w.directory != "" {
+				if err := w.addDirectory(); err != nil {
+					log.Printf("E! [config] Error watching %s: %v", w.directory, err)
+				}
+			}
+
+			if timer != nil {
+				timer.Stop()
+			}
+			timer = time.NewTimer(w.debounce)
+			timerC = timer.C
+		case err, ok := <-w.watcher.Errors:
+			if !ok {
+				return
+			}
+			log.Printf("E! [config] Error watching configuration: %v", err)
+		case <-timerC:
+			timer, timerC = nil, nil
+			select {
+			case w.notify <- struct{}{}:
+			default:
+			}
+		}
+	}
+}
+
+// relevant returns true if a change of the path may change the
+// configuration.
+func (w *Watcher) relevant(path string) bool {
+	if path == w.file {
+		return true
+	}
+
+	base := filepath.Base(path)
+	dir := filepath.Dir(path)
+	if dir == filepath.Dir(w.file) && strings.HasPrefix(base, "..") {
+		return true
+	}
+
+	if w.directory == "" {
+		return false
+	}
+	if path != w.directory && !strings.HasPrefix(path, w.directory+string(filepath.Separator)) {
+		return false
+	}
+	if strings.HasSuffix(base, ".conf") || strings.HasPrefix(base, "..") {
+		return true
+	}
+
+	// A removed directory can not be checked, new ones may hold files.
+	info, err := os.Stat(path)
+	return err != nil || info.IsDir()
+}
@@ -0,0 +1,119 @@
+package config
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+const testDebounce = 50 * time.Millisecond
+
+func requireNotified(t *testing.T, w *Watcher) {
+	select {
+	case <-w.C:
+	case <-time.After(5 * time.Second):
+		t.Fatal("no notification")
+	}
+}
+
+func requireNotNotified(t *testing.T, w *Watcher) {
+	select {
+	case <-w.C:
+		t.Fatal("unexpected notification")
+	case <-time.After(4 * testDebounce):
+	}
+}
+
+func TestWatcher_ConfigFile(t *testing.T) {
+	dir, err := ioutil.TempDir("", "watch")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	file := filepath.Join(dir, "telex.conf")
+	require.NoError(t, ioutil.WriteFile(file, []byte("[agent]\n"), 0640))
+
+	w, err := NewWatcher(file, "", testDebounce)
+	require.NoError(t, err)
+	defer w.Close()
+
+	// Other files next to the configuration are ignored.
+	require.NoError(t, ioutil.WriteFile(filepath.Join(dir, "notes.txt"), nil, 0640))
+	requireNotNotified(t, w)
+
+	// A burst of changes is a single notification.
+	for i := 0; i < 5; i++ {
+		require.NoError(t, ioutil.WriteFile(file, []byte("[agent]\n"), 0640))
+	}
+	requireNotified(t, w)
+	requireNotNotified(t, w)
+
+	// Editors replace the file by a rename.
+	tmp := filepath.Join(dir, "telex.conf.tmp")
+	require.NoError(t, ioutil.WriteFile(tmp, []byte("[agent]\n"), 0640))
+	require.NoError(t, os.Rename(tmp, file))
+	requireNotified(t, w)
+}
+
+func TestWatcher_ConfigDirectory(t *testing.T) {
+	dir, err := ioutil.TempDir("", "watch")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	file := filepath.Join(dir, "telex.conf")
+	require.NoError(t, ioutil.WriteFile(file, []byte("[agent]\n"), 0640))
+	confDir := filepath.Join(dir, "telex.d")
+	require.NoError(t, os.Mkdir(confDir, 0750))
+
+	w, err := NewWatcher(file, confDir, testDebounce)
+	require.NoError(t, err)
+	defer w.Close()
+
+	require.NoError(t, ioutil.WriteFile(filepath.Join(confDir, "cpu.conf"), nil, 0640))
+	requireNotified(t, w)
+
+	require.NoError(t, ioutil.WriteFile(filepath.Join(confDir, "README"), nil, 0640))
+	requireNotNotified(t, w)
+
+	// Files in new subdirectories are loaded too.
+	sub := filepath.Join(confDir, "sub")
+	require.NoError(t, os.Mkdir(sub, 0750))
+	requireNotified(t, w)
+	require.NoError(t, ioutil.WriteFile(filepath.Join(sub, "mem.conf"), nil, 0640))
+	requireNotified(t, w)
+}
+
+func TestWatcher_KubernetesSymlinkSwap(t *testing.T) {
+	dir, err := ioutil.TempDir("", "watch")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	file := filepath.Join(dir, "telex.conf")
+	require.NoError(t, ioutil.WriteFile(file, []byte("[agent]\n"), 0640))
+
+	// Lay out the directory as a ConfigMap volume does.
+	confDir := filepath.Join(dir, "telex.d")
+	require.NoError(t, os.Mkdir(confDir, 0750))
+	first := filepath.Join(confDir, "..2019_04_29_08_28_06.1")
+	require.NoError(t, os.Mkdir(first, 0750))
+	require.NoError(t, ioutil.WriteFile(filepath.Join(first, "cpu.conf"), nil, 0640))
+	require.NoError(t, os.Symlink(filepath.Base(first), filepath.Join(confDir, "..data")))
+	require.NoError(t, os.Symlink("..data/cpu.conf", filepath.Join(confDir, "cpu.conf")))
+
+	w, err := NewWatcher(file, confDir, testDebounce)
+	require.NoError(t, err)
+	defer w.Close()
+
+	// Updates write a new directory and swap the ..data symlink.
+	second := filepath.Join(confDir, "..2019_04_29_08_30_00.2")
+	require.NoError(t, os.Mkdir(second, 0750))
+	require.NoError(t, ioutil.WriteFile(filepath.Join(second, "cpu.conf"), []byte("#\n"), 0640))
+	tmp := filepath.Join(confDir, "..data_tmp")
+	require.NoError(t, os.Symlink(filepath.Base(second), tmp))
+	require.NoError(t, os.Rename(tmp, filepath.Join(confDir, "..data")))
+	require.NoError(t, os.RemoveAll(first))
+	requireNotified(t, w)
+}
@@ -97,7 +97,13 @@ func (d *Duration) UnmarshalTOML(b []byte) error {
 		return nil
 	}
 
-	return nil
+	// An empty string, like precision = "", is a zero duration.
+	if len(b) == 0 || string(b) == `""` {
+		d.Duration = 0
+		return nil
+	}
+
+	return fmt.Errorf("invalid duration %s", b)
 }
 
 func (s *Size) UnmarshalTOML(b []byte) error {
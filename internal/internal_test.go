@@ -165,6 +165,18 @@ func TestDuration(t *testing.T) {
 	d = Duration{}
 	d.UnmarshalTOML([]byte(`1.5`))
 	assert.Equal(t, time.Second, d.Duration)
+
+	d = Duration{}
+	assert.Error(t, d.UnmarshalTOML([]byte(`"10x"`)))
+	assert.Equal(t, time.Duration(0), d.Duration)
+
+	d = Duration{Duration: time.Second}
+	assert.NoError(t, d.UnmarshalTOML([]byte(`""`)))
+	assert.Equal(t, time.Duration(0), d.Duration)
+
+	d = Duration{Duration: time.Second}
+	assert.NoError(t, d.UnmarshalTOML([]byte(`''`)))
+	assert.Equal(t, time.Duration(0), d.Duration)
 }
 
 func TestSize(t *testing.T) {
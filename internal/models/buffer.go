@@ -12,6 +12,33 @@ var (
 	AgentMetricsDropped = selfstat.Register("agent", "metrics_dropped", map[string]string{})
 )
 
+// MetricBuffer holds the metrics of a RunningOutput until they have been
+// written.
+type MetricBuffer interface {
+	// Len returns the number of metrics currently in the buffer.
+	Len() int
+
+	// Add adds metrics to the buffer.
+	Add(metrics ...telex.Metric)
+
+	// Batch returns a slice containing up to batchSize of the oldest
+	// metrics.  The metrics remain in the buffer until Accept is called.
+	Batch(batchSize int) []telex.Metric
+
+	// Accept removes the metrics contained in the last batch.
+	Accept(batch []telex.Metric)
+
+	// Reject returns the metrics in the last batch to the buffer.
+	Reject(batch []telex.Metric)
+
+	// Peek returns up to n of the oldest metrics, without affecting the
+	// current batch.  The metrics must not be modified.
+	Peek(n int) []telex.Metric
+
+	// Close releases any resources held by the buffer.
+	Close() error
+}
+
 // Buffer stores metrics in a circular buffer.
 type Buffer struct {
 	sync.Mutex
@@ -201,6 +228,23 @@ func (b *Buffer) Reject(batch []telex.Metric) {
 	b.resetBatch()
 }
 
+// Peek returns up to n of the oldest metrics.
+func (b *Buffer) Peek(n int) []telex.Metric {
+	b.Lock()
+	defer b.Unlock()
+
+	out := make([]telex.Metric, min(b.size, n))
+	for i := range out {
+		out[i] = b.buf[(b.first+i)%b.cap]
+	}
+	return out
+}
+
+// Close is a no-op for the in memory buffer.
+func (b *Buffer) Close() error {
+	return nil
+}
+
 func (b *Buffer) resetBatch() {
 	b.batchFirst = 0
 	b.batchLast = 0
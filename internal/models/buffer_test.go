@@ -147,6 +147,17 @@ func TestBuffer_BatchWrap(t *testing.T) {
 	require.Len(t, batch, 5)
 }
 
+func TestBuffer_PeekLeavesMetrics(t *testing.T) {
+	m := Metric()
+	b := setup(NewBuffer("test", 5))
+	b.Add(m, m, m)
+
+	require.Len(t, b.Peek(2), 2)
+	require.Len(t, b.Peek(10), 3)
+	require.Equal(t, 3, b.Len())
+	require.Len(t, b.Batch(10), 3)
+}
+
 func TestBuffer_AddDropsOverwrittenMetrics(t *testing.T) {
 	m := Metric()
 	b := setup(NewBuffer("test", 5))
@@ -0,0 +1,317 @@
+package models
+
+import (
+	"container/list"
+	"hash/fnv"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/lavaorg/telex"
+	"github.com/lavaorg/telex/selfstat"
+)
+
+const (
+	// Default number of recent series remembered exactly.
+	DEFAULT_CARDINALITY_CACHE_SIZE = 100000
+
+	// Default number of values tag values are hashed into.
+	DEFAULT_CARDINALITY_HASH_BUCKETS = 100
+
+	// Default number of recent measurements whose series are counted.
+	DEFAULT_CARDINALITY_MEASUREMENTS = 10000
+
+	// Default interval between resets of the series counts.
+	DEFAULT_CARDINALITY_RESET_INTERVAL = time.Hour
+)
+
+// Policies applied to the new series of a measurement over its limit.
+const (
+	CardinalityDrop      = "drop"
+	CardinalityStripTags = "strip_tags"
+	CardinalityHashTags  = "hash_tags"
+)
+
+// CardinalityConfig limits the number of series of each measurement.
+type CardinalityConfig struct {
+	// Limit is the number of series allowed per measurement, 0 disables the
+	// guard.
+	Limit int
+
+	// Policy is applied to the new series of a measurement over the limit,
+	// one of "drop" (the default), "strip_tags" or "hash_tags".
+	Policy string
+
+	// TagLimit is the number of values above which a tag is an offender
+	// with the strip_tags and hash_tags policies.  When 0 the tag with the
+	// most values is the offender.
+	TagLimit int
+
+	// HashBuckets is the number of values offending tags are hashed into.
+	HashBuckets int
+
+	// CacheSize is the number of recent series remembered exactly, a
+	// series not in the cache is a new series.  It should be larger than
+	// the number of series expected.
+	CacheSize int
+
+	// Measurements is the number of recent measurements whose series are
+	// counted, the least recently seen measurement is forgotten past it.
+	Measurements int
+
+	// ResetInterval is the interval after which the series of a measurement
+	// are counted again from zero, so that it can get back under its limit.
+	ResetInterval time.Duration
+}
+
+// CardinalityGuard tracks the series of each measurement, estimating their
+// number with a HyperLogLog, and applies the policy to new series once a
+// measurement reaches the limit.
+type CardinalityGuard struct {
+	sync.Mutex
+	name   string
+	config CardinalityConfig
+
+	// cache holds the recent series from the most to the least recently
+	// seen, index maps the series to their element.
+	cache *list.List
+	index map[uint64]*list.Element
+
+	// recent holds the measurements from the most to the least recently
+	// seen.
+	recent       *list.List
+	measurements map[string]*measurementCardinality
+}
+
+// measurementCardinality tracks the series of a measurement, and the values
+// of each of its tags to find the offending tags.
+type measurementCardinality struct {
+	name   string
+	elem   *list.Element
+	reset  time.Time
+	series *hyperLogLog
+	tags   map[string]*hyperLogLog
+
+	// Stats are only registered once the measurement is over the limit,
+	// so that only the offenders are reported.
+	stats *cardinalityStats
+}
+
+type cardinalityStats struct {
+	Series   selfstat.Stat
+	Dropped  selfstat.Stat
+	Stripped selfstat.Stat
+	Hashed   selfstat.Stat
+	Values   map[string]selfstat.Stat
+}
+
+// NewCardinalityGuard creates a guard, name is the output it applies to and
+// is empty for the agent wide guard.
+func NewCardinalityGuard(name string, config CardinalityConfig) *CardinalityGuard {
+	if config.Policy == "" {
+		config.Policy = CardinalityDrop
+	}
+	if config.HashBuckets <= 0 {
+		config.HashBuckets = DEFAULT_CARDINALITY_HASH_BUCKETS
+	}
+	if config.CacheSize <= 0 {
+		config.CacheSize = DEFAULT_CARDINALITY_CACHE_SIZE
+	}
+	if config.Measurements <= 0 {
+		config.Measurements = DEFAULT_CARDINALITY_MEASUREMENTS
+	}
+	if config.ResetInterval <= 0 {
+		config.ResetInterval = DEFAULT_CARDINALITY_RESET_INTERVAL
+	}
+	return &CardinalityGuard{
+		name:         name,
+		config:       config,
+		cache:        list.New(),
+		index:        make(map[uint64]*list.Element),
+		recent:       list.New(),
+		measurements: make(map[string]*measurementCardinality),
+	}
+}
+
+// Apply checks the series of the metric, it returns false if the metric
+// must be dropped.  Offending tags of the metric are removed or hashed with
+// the strip_tags and hash_tags policies.
+func (g *CardinalityGuard) Apply(metric telex.Metric) bool {
+	g.Lock()
+	defer g.Unlock()
+
+	mc := g.measurement(metric.Name())
+
+	id := metric.HashID()
+	if g.touch(id) {
+		// Known series are counted again after a reset.
+		mc.series.Add(id)
+		return true
+	}
+
+	for _, tag := range metric.TagList() {
+		values, ok := mc.tags[tag.Key]
+		if !ok {
+			values = newHyperLogLog()
+			mc.tags[tag.Key] = values
+		}
+		values.Add(hashString(tag.Value))
+	}
+
+	if mc.series.Count() >= uint64(g.config.Limit) {
+		stats := g.stats(mc)
+		stats.Series.Set(int64(mc.series.Count()))
+
+		offenders := g.offenders(mc, metric)
+		if g.config.Policy == CardinalityDrop || len(offenders) == 0 {
+			stats.Dropped.Incr(1)
+			return false
+		}
+		for _, key := range offenders {
+			if g.config.Policy == CardinalityStripTags {
+				metric.RemoveTag(key)
+				stats.Stripped.Incr(1)
+			} else {
+				value, _ := metric.GetTag(key)
+				metric.AddTag(key, g.hashValue(value))
+				stats.Hashed.Incr(1)
+			}
+		}
+
+		id = metric.HashID()
+		if g.touch(id) {
+			return true
+		}
+	}
+
+	mc.series.Add(id)
+	g.index[id] = g.cache.PushFront(id)
+	for g.cache.Len() > g.config.CacheSize {
+		elem := g.cache.Back()
+		g.cache.Remove(elem)
+		delete(g.index, elem.Value.(uint64))
+	}
+	return true
+}
+
+// measurement returns the tracking of the measurement, marked as recently
+// seen.  The least recently seen measurement is forgotten when there are too
+// many, and the counts of the measurement are reset once they are too old.
+func (g *CardinalityGuard) measurement(name string) *measurementCardinality {
+	now := time.Now()
+	mc, ok := g.measurements[name]
+	if ok {
+		g.recent.MoveToFront(mc.elem)
+		if now.Sub(mc.reset) >= g.config.ResetInterval {
+			g.forget(mc)
+			mc.reset = now
+			mc.series = newHyperLogLog()
+			mc.tags = make(map[string]*hyperLogLog)
+		}
+		return mc
+	}
+
+	mc = &measurementCardinality{
+		name:   name,
+		reset:  now,
+		series: newHyperLogLog(),
+		tags:   make(map[string]*hyperLogLog),
+	}
+	mc.elem = g.recent.PushFront(mc)
+	g.measurements[name] = mc
+	for g.recent.Len() > g.config.Measurements {
+		oldest := g.recent.Remove(g.recent.Back()).(*measurementCardinality)
+		g.forget(oldest)
+		delete(g.measurements, oldest.name)
+	}
+	return mc
+}
+
+// forget unregisters the stats of the measurement, it is no longer reported
+// until it is over the limit again.
+func (g *CardinalityGuard) forget(mc *measurementCardinality) {
+	if mc.stats == nil {
+		return
+	}
+	for key := range mc.stats.Values {
+		selfstat.Unregister("cardinality", g.tags(mc, key))
+	}
+	selfstat.Unregister("cardinality", g.tags(mc, ""))
+	mc.stats = nil
+}
+
+// touch marks a series as recently seen, it returns false if the series is
+// not in the cache.
+func (g *CardinalityGuard) touch(id uint64) bool {
+	elem, ok := g.index[id]
+	if ok {
+		g.cache.MoveToFront(elem)
+	}
+	return ok
+}
+
+// offenders returns the offending tags of the metric.
+func (g *CardinalityGuard) offenders(mc *measurementCardinality, metric telex.Metric) []string {
+	var offenders []string
+	var worst string
+	var worstCount uint64
+	for _, tag := range metric.TagList() {
+		count := mc.tags[tag.Key].Count()
+		if g.config.TagLimit > 0 {
+			if count > uint64(g.config.TagLimit) {
+				offenders = append(offenders, tag.Key)
+			}
+		} else if count > worstCount {
+			worst, worstCount = tag.Key, count
+		}
+	}
+	if worst != "" {
+		offenders = append(offenders, worst)
+	}
+	stats := g.stats(mc)
+	for _, key := range offenders {
+		values, ok := stats.Values[key]
+		if !ok {
+			values = selfstat.Register("cardinality", "values", g.tags(mc, key))
+			stats.Values[key] = values
+		}
+		values.Set(int64(mc.tags[key].Count()))
+	}
+	return offenders
+}
+
+func (g *CardinalityGuard) hashValue(value string) string {
+	bucket := hashString(value) % uint64(g.config.HashBuckets)
+	return strconv.FormatUint(bucket, 16)
+}
+
+func (g *CardinalityGuard) tags(mc *measurementCardinality, tag string) map[string]string {
+	tags := map[string]string{"measurement": mc.name}
+	if tag != "" {
+		tags["tag"] = tag
+	}
+	if g.name != "" {
+		tags["output"] = g.name
+	}
+	return tags
+}
+
+func (g *CardinalityGuard) stats(mc *measurementCardinality) *cardinalityStats {
+	if mc.stats == nil {
+		tags := g.tags(mc, "")
+		mc.stats = &cardinalityStats{
+			Series:   selfstat.Register("cardinality", "series", tags),
+			Dropped:  selfstat.Register("cardinality", "dropped", tags),
+			Stripped: selfstat.Register("cardinality", "stripped", tags),
+			Hashed:   selfstat.Register("cardinality", "hashed", tags),
+			Values:   make(map[string]selfstat.Stat),
+		}
+	}
+	return mc.stats
+}
+
+func hashString(s string) uint64 {
+	h := fnv.New64a()
+	h.Write([]byte(s))
+	return h.Sum64()
+}
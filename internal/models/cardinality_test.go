@@ -0,0 +1,211 @@
+package models
+
+import (
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/lavaorg/telex"
+	"github.com/lavaorg/telex/selfstat"
+	"github.com/lavaorg/telex/testutil"
+)
+
+func requestMetric(path, id string) telex.Metric {
+	return testutil.MustMetric("http",
+		map[string]string{"path": path, "request_id": id},
+		map[string]interface{}{"time_ms": 10},
+		time.Unix(0, 0),
+	)
+}
+
+// guardOutput returns an output name unique to the test run, the stats are
+// global and would add up when a test runs again.
+func guardOutput(t *testing.T) string {
+	return fmt.Sprintf("%s-%d", t.Name(), time.Now().UnixNano())
+}
+
+func TestHyperLogLog(t *testing.T) {
+	for _, n := range []int{0, 1, 100, 10000, 1000000} {
+		h := newHyperLogLog()
+		for i := 0; i < n; i++ {
+			h.Add(hashString(fmt.Sprintf("series-%d", i)))
+			// Duplicates don't count.
+			h.Add(hashString(fmt.Sprintf("series-%d", i)))
+		}
+		count := float64(h.Count())
+		require.InDelta(t, float64(n), count, 0.05*float64(n)+1, "n=%d", n)
+	}
+}
+
+func TestCardinalityDrop(t *testing.T) {
+	output := guardOutput(t)
+	g := NewCardinalityGuard(output, CardinalityConfig{Limit: 10})
+
+	for i := 0; i < 10; i++ {
+		require.True(t, g.Apply(requestMetric("/", fmt.Sprint(i))))
+	}
+	require.False(t, g.Apply(requestMetric("/", "10")))
+	require.False(t, g.Apply(requestMetric("/", "11")))
+
+	// Known series and other measurements are not affected.
+	require.True(t, g.Apply(requestMetric("/", "5")))
+	require.True(t, g.Apply(testutil.TestMetric(1)))
+
+	stats := cardinalityStatValues(output)
+	require.Equal(t, int64(2), stats["http"]["dropped"])
+	require.Equal(t, int64(10), stats["http"]["series"])
+	require.Equal(t, int64(12), stats["http/request_id"]["values"])
+	require.NotContains(t, stats, "test1")
+}
+
+func TestCardinalityStripTags(t *testing.T) {
+	output := guardOutput(t)
+	g := NewCardinalityGuard(output, CardinalityConfig{
+		Limit:  10,
+		Policy: CardinalityStripTags,
+	})
+
+	for i := 0; i < 100; i++ {
+		m := requestMetric(fmt.Sprintf("/%d", i%2), fmt.Sprint(i))
+		require.True(t, g.Apply(m))
+		if i < 10 {
+			require.Len(t, m.TagList(), 2)
+		} else {
+			_, ok := m.GetTag("request_id")
+			require.False(t, ok)
+			require.Len(t, m.TagList(), 1)
+		}
+	}
+	// The stripped series are the new series.
+	require.Equal(t, 12, g.cache.Len())
+
+	stats := cardinalityStatValues(output)
+	require.Equal(t, int64(90), stats["http"]["stripped"])
+	require.Equal(t, int64(0), stats["http"]["dropped"])
+}
+
+func TestCardinalityHashTags(t *testing.T) {
+	output := guardOutput(t)
+	g := NewCardinalityGuard(output, CardinalityConfig{
+		Limit:       10,
+		Policy:      CardinalityHashTags,
+		TagLimit:    5,
+		HashBuckets: 4,
+	})
+
+	values := make(map[string]bool)
+	for i := 0; i < 100; i++ {
+		m := requestMetric("/", fmt.Sprint(i))
+		require.True(t, g.Apply(m))
+		if i >= 10 {
+			path, _ := m.GetTag("path")
+			require.Equal(t, "/", path)
+			id, _ := m.GetTag("request_id")
+			values[id] = true
+		}
+	}
+	require.Len(t, values, 4)
+
+	stats := cardinalityStatValues(output)
+	require.Equal(t, int64(90), stats["http"]["hashed"])
+	require.NotContains(t, stats, "http/path")
+}
+
+func TestCardinalityNoOffender(t *testing.T) {
+	g := NewCardinalityGuard("", CardinalityConfig{
+		Limit:    1,
+		Policy:   CardinalityStripTags,
+		TagLimit: 10,
+	})
+
+	require.True(t, g.Apply(requestMetric("/", "1")))
+	require.False(t, g.Apply(requestMetric("/", "2")))
+}
+
+func TestCardinalityCache(t *testing.T) {
+	g := NewCardinalityGuard("", CardinalityConfig{Limit: 100, CacheSize: 10})
+
+	for i := 0; i < 20; i++ {
+		require.True(t, g.Apply(requestMetric("/", fmt.Sprint(i))))
+	}
+	require.Equal(t, 10, g.cache.Len())
+	require.Len(t, g.index, 10)
+}
+
+func TestCardinalityMeasurements(t *testing.T) {
+	output := guardOutput(t)
+	g := NewCardinalityGuard(output, CardinalityConfig{Limit: 1, Measurements: 2})
+
+	require.True(t, g.Apply(requestMetric("/", "1")))
+	require.False(t, g.Apply(requestMetric("/", "2")))
+	require.Contains(t, cardinalityStatValues(output), "http")
+
+	require.True(t, g.Apply(testutil.TestMetric(1, "a")))
+	require.True(t, g.Apply(testutil.TestMetric(1, "b")))
+	require.Len(t, g.measurements, 2)
+	require.Equal(t, 2, g.recent.Len())
+
+	// The forgotten measurement is no longer reported.
+	require.NotContains(t, g.measurements, "http")
+	require.NotContains(t, cardinalityStatValues(output), "http")
+}
+
+func TestCardinalityReset(t *testing.T) {
+	output := guardOutput(t)
+	g := NewCardinalityGuard(output, CardinalityConfig{Limit: 2})
+
+	require.True(t, g.Apply(requestMetric("/", "1")))
+	require.True(t, g.Apply(requestMetric("/", "2")))
+	require.False(t, g.Apply(requestMetric("/", "3")))
+
+	// Once reset only the series seen since count.
+	g.measurements["http"].reset = time.Now().Add(-2 * DEFAULT_CARDINALITY_RESET_INTERVAL)
+	require.True(t, g.Apply(requestMetric("/", "1")))
+	require.NotContains(t, cardinalityStatValues(output), "http")
+	require.True(t, g.Apply(requestMetric("/", "3")))
+	require.False(t, g.Apply(requestMetric("/", "4")))
+}
+
+func TestRunningOutputCardinality(t *testing.T) {
+	conf := &OutputConfig{
+		Filter:      Filter{},
+		Cardinality: CardinalityConfig{Limit: 2},
+	}
+
+	m := &mockOutput{}
+	ro, err := NewRunningOutput("test", m, conf, 1000, 10000)
+	require.NoError(t, err)
+
+	for i := 0; i < 5; i++ {
+		ro.AddMetric(requestMetric("/", fmt.Sprint(i)))
+	}
+	require.NoError(t, ro.Write())
+	require.Len(t, m.Metrics(), 2)
+}
+
+// cardinalityStatValues returns the internal_cardinality stats of an output
+// by measurement, or measurement/tag for the values stats, and field.
+func cardinalityStatValues(output string) map[string]map[string]int64 {
+	values := make(map[string]map[string]int64)
+	for _, m := range selfstat.Metrics() {
+		if m.Name() != "internal_cardinality" {
+			continue
+		}
+		if o, _ := m.GetTag("output"); o != output {
+			continue
+		}
+		key, _ := m.GetTag("measurement")
+		if tag, ok := m.GetTag("tag"); ok {
+			key += "/" + tag
+		}
+		if values[key] == nil {
+			values[key] = make(map[string]int64)
+		}
+		for _, field := range m.FieldList() {
+			values[key][field.Key] = field.Value.(int64)
+		}
+	}
+	return values
+}
@@ -0,0 +1,828 @@
+package models
+
+import (
+	"bufio"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"hash/crc32"
+	"io"
+	"io/ioutil"
+	"log"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/lavaorg/telex"
+	"github.com/lavaorg/telex/metric"
+	"github.com/lavaorg/telex/plugins/parsers/influx"
+	serializer "github.com/lavaorg/telex/plugins/serializers/influx"
+	"github.com/lavaorg/telex/selfstat"
+)
+
+const (
+	// Default maximum size in bytes of all segments of a disk buffer.
+	DEFAULT_DISK_BUFFER_MAX_SIZE = 1024 * 1024 * 1024
+
+	// Default size in bytes at which a new segment file is started.
+	DEFAULT_DISK_BUFFER_SEGMENT_SIZE = 16 * 1024 * 1024
+
+	// Default time between fsync calls with the "interval" fsync policy.
+	DEFAULT_DISK_BUFFER_FSYNC_INTERVAL = time.Second
+)
+
+// Possible values of DiskBufferConfig.Fsync.
+const (
+	FsyncAlways   = "always"
+	FsyncInterval = "interval"
+	FsyncNever    = "never"
+)
+
+const (
+	segmentSuffix  = ".seg"
+	checkpointFile = "checkpoint"
+
+	// length + crc32 of the payload
+	recordHeaderLen = 8
+	// records larger than this are considered corrupt
+	maxRecordLen = 64 * 1024 * 1024
+)
+
+var errCorruptRecord = errors.New("corrupt record")
+
+// openDiskBuffers holds the open disk buffers by directory, so that an output
+// replaced during a reload shares the queue of the output it replaces.
+var (
+	openDiskBuffersMu sync.Mutex
+	openDiskBuffers   = make(map[string]*DiskBuffer)
+)
+
+// DiskBufferConfig contains the settings of a disk backed buffer.
+type DiskBufferConfig struct {
+	// Directory holds the segment files, it is created if it does not exist.
+	Directory string
+
+	// MaxSize is the maximum number of bytes used by the segment files.  When
+	// exceeded the oldest segment is removed.
+	MaxSize int64
+
+	// SegmentSize is the size at which a new segment file is started.
+	SegmentSize int64
+
+	// Fsync is the fsync policy: "always", "interval" or "never".
+	Fsync string
+
+	// FsyncInterval is the minimum time between fsync calls when using the
+	// "interval" policy.
+	FsyncInterval time.Duration
+}
+
+// diskSegment is a single append only file of records.
+type diskSegment struct {
+	path  string
+	first uint64 // sequence number of the first record
+	count int    // number of records in the segment
+	size  int64  // size of the segment file in bytes
+}
+
+// end returns one after the sequence number of the last record.
+func (s *diskSegment) end() uint64 {
+	return s.first + uint64(s.count)
+}
+
+// diskCursor is a position in the buffer.
+type diskCursor struct {
+	segment uint64 // first sequence number of the segment
+	offset  int64  // byte offset in the segment file
+	seq     uint64 // sequence number of the record at offset
+}
+
+// DiskBuffer stores metrics in a write-ahead queue of segment files so that
+// unsent metrics survive a restart of the agent.
+//
+// Each record is the influx line protocol serialization of a metric prefixed
+// by its length, a crc32 checksum and the metric value type.  Metrics are
+// accepted, in the tracking sense, once they are stored in the queue.
+type DiskBuffer struct {
+	sync.Mutex
+	name   string
+	config DiskBufferConfig
+	refs   int // number of NewDiskBuffer calls not yet closed
+
+	segments []*diskSegment
+	active   *os.File
+	writer   *bufio.Writer
+	lastSync time.Time
+
+	read  diskCursor // position of the oldest unsent metric
+	size  int        // number of unsent metrics
+	bytes int64      // total size of all segments
+
+	batchEnd  diskCursor // position after the outstanding batch
+	batchSize int        // number of metrics in the outstanding batch
+
+	serializer *serializer.Serializer
+	parser     *influx.Parser
+
+	MetricsAdded    selfstat.Stat
+	MetricsWritten  selfstat.Stat
+	MetricsDropped  selfstat.Stat
+	MetricsReplayed selfstat.Stat
+	BufferBytes     selfstat.Stat
+	BufferSegments  selfstat.Stat
+	Corruptions     selfstat.Stat
+}
+
+// NewDiskBuffer opens the disk buffer in the configured directory, replaying
+// any segments left by a previous run.  If the directory is already open the
+// existing buffer is returned, it is closed once every user has closed it.
+func NewDiskBuffer(name string, config DiskBufferConfig) (*DiskBuffer, error) {
+	if config.Directory == "" {
+		return nil, errors.New("disk buffer requires a directory")
+	}
+	dir, err := filepath.Abs(config.Directory)
+	if err != nil {
+		return nil, err
+	}
+	config.Directory = dir
+	if config.MaxSize <= 0 {
+		config.MaxSize = DEFAULT_DISK_BUFFER_MAX_SIZE
+	}
+	if config.SegmentSize <= 0 {
+		config.SegmentSize = DEFAULT_DISK_BUFFER_SEGMENT_SIZE
+	}
+	if config.FsyncInterval <= 0 {
+		config.FsyncInterval = DEFAULT_DISK_BUFFER_FSYNC_INTERVAL
+	}
+	switch config.Fsync {
+	case "":
+		config.Fsync = FsyncInterval
+	case FsyncAlways, FsyncInterval, FsyncNever:
+	default:
+		return nil, fmt.Errorf("invalid fsync policy %q", config.Fsync)
+	}
+
+	s := serializer.NewSerializer()
+	s.SetFieldTypeSupport(serializer.UintSupport)
+
+	tags := map[string]string{"output": name}
+	b := &DiskBuffer{
+		name:       name,
+		config:     config,
+		serializer: s,
+		parser:     influx.NewParser(influx.NewMetricHandler()),
+
+		MetricsAdded:    selfstat.Register("write", "metrics_added", tags),
+		MetricsWritten:  selfstat.Register("write", "metrics_written", tags),
+		MetricsDropped:  selfstat.Register("write", "metrics_dropped", tags),
+		MetricsReplayed: selfstat.Register("write", "metrics_replayed", tags),
+		BufferBytes:     selfstat.Register("write", "buffer_bytes", tags),
+		BufferSegments:  selfstat.Register("write", "buffer_segments", tags),
+		Corruptions:     selfstat.Register("write", "buffer_corruptions", tags),
+	}
+
+	openDiskBuffersMu.Lock()
+	defer openDiskBuffersMu.Unlock()
+
+	if open, ok := openDiskBuffers[dir]; ok {
+		open.Lock()
+		open.refs++
+		open.Unlock()
+		return open, nil
+	}
+
+	err = os.MkdirAll(config.Directory, 0750)
+	if err != nil {
+		return nil, err
+	}
+
+	err = b.replay()
+	if err != nil {
+		return nil, err
+	}
+	b.refs = 1
+	openDiskBuffers[dir] = b
+
+	if b.size > 0 {
+		log.Printf("I! [outputs.%s] replayed %d metrics from disk buffer %s",
+			name, b.size, config.Directory)
+	}
+	b.MetricsReplayed.Incr(int64(b.size))
+	b.updateStats()
+	return b, nil
+}
+
+// replay loads the segments and checkpoint found in the buffer directory.
+func (b *DiskBuffer) replay() error {
+	files, err := filepath.Glob(filepath.Join(b.config.Directory, "*"+segmentSuffix))
+	if err != nil {
+		return err
+	}
+
+	for _, path := range files {
+		base := strings.TrimSuffix(filepath.Base(path), segmentSuffix)
+		first, err := strconv.ParseUint(base, 10, 64)
+		if err != nil {
+			log.Printf("W! [outputs.%s] ignoring unknown file in disk buffer: %s",
+				b.name, path)
+			continue
+		}
+		b.segments = append(b.segments, &diskSegment{path: path, first: first})
+	}
+
+	sort.Slice(b.segments, func(i, j int) bool {
+		return b.segments[i].first < b.segments[j].first
+	})
+
+	for i, seg := range b.segments {
+		err := b.scanSegment(seg)
+		if err != nil {
+			return err
+		}
+		if i > 0 && seg.first < b.segments[i-1].end() {
+			return fmt.Errorf("overlapping segments in disk buffer: %s", seg.path)
+		}
+		b.bytes += seg.size
+	}
+
+	checkpoint, err := b.readCheckpoint()
+	if err != nil {
+		return err
+	}
+
+	if len(b.segments) == 0 {
+		return b.newSegment(checkpoint)
+	}
+
+	b.read = diskCursor{segment: b.segments[0].first, seq: b.segments[0].first}
+	for _, seg := range b.segments {
+		switch {
+		case checkpoint >= seg.end():
+			b.read = diskCursor{segment: seg.first, offset: seg.size, seq: seg.end()}
+		case checkpoint > seg.first:
+			offset, err := b.seek(seg, checkpoint)
+			if err != nil {
+				return err
+			}
+			b.read = diskCursor{segment: seg.first, offset: offset, seq: checkpoint}
+		}
+	}
+	b.read = b.advance(b.read)
+	b.size = b.between(b.read, b.tail())
+	b.removeConsumed()
+
+	return b.openActive()
+}
+
+// scanSegment counts the valid records of a segment, truncating it at the
+// first corrupt record.
+func (b *DiskBuffer) scanSegment(seg *diskSegment) error {
+	f, err := os.Open(seg.path)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	r := bufio.NewReader(f)
+	var offset int64
+	for {
+		n, _, err := readRecord(r)
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			log.Printf("W! [outputs.%s] truncating disk buffer segment %s at offset %d: %v",
+				b.name, seg.path, offset, err)
+			b.Corruptions.Incr(1)
+			f.Close()
+			if err := os.Truncate(seg.path, offset); err != nil {
+				return err
+			}
+			break
+		}
+		offset += n
+		seg.count++
+	}
+	seg.size = offset
+	return nil
+}
+
+// seek returns the offset of the record with the given sequence number.
+func (b *DiskBuffer) seek(seg *diskSegment, seq uint64) (int64, error) {
+	f, err := os.Open(seg.path)
+	if err != nil {
+		return 0, err
+	}
+	defer f.Close()
+
+	r := bufio.NewReader(f)
+	var offset int64
+	for i := seg.first; i < seq; i++ {
+		n, _, err := readRecord(r)
+		if err != nil {
+			return 0, err
+		}
+		offset += n
+	}
+	return offset, nil
+}
+
+func (b *DiskBuffer) readCheckpoint() (uint64, error) {
+	data, err := ioutil.ReadFile(filepath.Join(b.config.Directory, checkpointFile))
+	if os.IsNotExist(err) {
+		return 0, nil
+	}
+	if err != nil {
+		return 0, err
+	}
+	seq, err := strconv.ParseUint(strings.TrimSpace(string(data)), 10, 64)
+	if err != nil {
+		log.Printf("W! [outputs.%s] ignoring invalid disk buffer checkpoint: %v",
+			b.name, err)
+		b.Corruptions.Incr(1)
+		return 0, nil
+	}
+	return seq, nil
+}
+
+func (b *DiskBuffer) writeCheckpoint() error {
+	path := filepath.Join(b.config.Directory, checkpointFile)
+	tmp := path + ".tmp"
+	f, err := os.OpenFile(tmp, os.O_CREATE|os.O_WRONLY|os.O_TRUNC, 0640)
+	if err != nil {
+		return err
+	}
+	_, err = fmt.Fprintf(f, "%d\n", b.read.seq)
+	if err == nil && b.config.Fsync == FsyncAlways {
+		err = f.Sync()
+	}
+	if cerr := f.Close(); err == nil {
+		err = cerr
+	}
+	if err != nil {
+		return err
+	}
+	return os.Rename(tmp, path)
+}
+
+// tail returns the position after the newest record.
+func (b *DiskBuffer) tail() diskCursor {
+	last := b.segments[len(b.segments)-1]
+	return diskCursor{segment: last.first, offset: last.size, seq: last.end()}
+}
+
+// segment returns the index of the segment starting with first, or -1.
+func (b *DiskBuffer) segment(first uint64) int {
+	for i, seg := range b.segments {
+		if seg.first == first {
+			return i
+		}
+	}
+	return -1
+}
+
+// advance moves a cursor at the end of a segment to the start of the next
+// one.
+func (b *DiskBuffer) advance(c diskCursor) diskCursor {
+	i := b.segment(c.segment)
+	for i >= 0 && i < len(b.segments)-1 && c.seq >= b.segments[i].end() {
+		i++
+		c = diskCursor{segment: b.segments[i].first, seq: b.segments[i].first}
+	}
+	return c
+}
+
+// between returns the number of records from a up to b.
+func (b *DiskBuffer) between(from, to diskCursor) int {
+	n := 0
+	for _, seg := range b.segments {
+		start := seg.first
+		if from.seq > start {
+			start = from.seq
+		}
+		end := seg.end()
+		if to.seq < end {
+			end = to.seq
+		}
+		if end > start {
+			n += int(end - start)
+		}
+	}
+	return n
+}
+
+// removeConsumed deletes all segments before the read position.
+func (b *DiskBuffer) removeConsumed() {
+	for len(b.segments) > 1 && b.segments[0].first < b.read.segment {
+		b.removeOldest()
+	}
+}
+
+// removeOldest deletes the oldest segment, returning the number of unsent
+// metrics it contained.
+func (b *DiskBuffer) removeOldest() int {
+	seg := b.segments[0]
+	dropped := 0
+	if b.read.segment == seg.first {
+		dropped = int(seg.end() - b.read.seq)
+		next := b.segments[1]
+		b.read = diskCursor{segment: next.first, seq: next.first}
+	}
+
+	err := os.Remove(seg.path)
+	if err != nil && !os.IsNotExist(err) {
+		log.Printf("E! [outputs.%s] could not remove disk buffer segment: %v",
+			b.name, err)
+	}
+	b.bytes -= seg.size
+	b.segments = b.segments[1:]
+	return dropped
+}
+
+// newSegment starts a new segment with the given first sequence number.
+func (b *DiskBuffer) newSegment(first uint64) error {
+	path := filepath.Join(b.config.Directory, fmt.Sprintf("%020d%s", first, segmentSuffix))
+	b.segments = append(b.segments, &diskSegment{path: path, first: first})
+	if len(b.segments) == 1 {
+		b.read = diskCursor{segment: first, seq: first}
+	}
+	return b.openActive()
+}
+
+// openActive opens the newest segment for appending.
+func (b *DiskBuffer) openActive() error {
+	if b.active != nil {
+		if err := b.writer.Flush(); err != nil {
+			return err
+		}
+		if b.config.Fsync != FsyncNever {
+			b.active.Sync()
+		}
+		b.active.Close()
+	}
+
+	seg := b.segments[len(b.segments)-1]
+	f, err := os.OpenFile(seg.path, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0640)
+	if err != nil {
+		return err
+	}
+	b.active = f
+	b.writer = bufio.NewWriter(f)
+	return nil
+}
+
+func (b *DiskBuffer) updateStats() {
+	b.BufferBytes.Set(b.bytes)
+	b.BufferSegments.Set(int64(len(b.segments)))
+}
+
+// Len returns the number of metrics currently in the buffer.
+func (b *DiskBuffer) Len() int {
+	b.Lock()
+	defer b.Unlock()
+
+	return b.size
+}
+
+// Full returns true if the buffer drops its oldest segment once the active
+// one is complete.
+func (b *DiskBuffer) Full() bool {
+	b.Lock()
+	defer b.Unlock()
+
+	return b.bytes+b.config.SegmentSize > b.config.MaxSize
+}
+
+func (b *DiskBuffer) metricDropped(n int) {
+	AgentMetricsDropped.Incr(int64(n))
+	b.MetricsDropped.Incr(int64(n))
+}
+
+func (b *DiskBuffer) add(m telex.Metric) error {
+	octets, err := b.serializer.Serialize(m)
+	if err != nil {
+		return err
+	}
+
+	seg := b.segments[len(b.segments)-1]
+	if seg.size >= b.config.SegmentSize {
+		if err := b.newSegment(seg.end()); err != nil {
+			return err
+		}
+		seg = b.segments[len(b.segments)-1]
+	}
+
+	n, err := writeRecord(b.writer, byte(m.Type()), octets)
+	if err != nil {
+		return err
+	}
+	seg.count++
+	seg.size += n
+	b.bytes += n
+	b.size++
+
+	for b.bytes > b.config.MaxSize && len(b.segments) > 1 {
+		dropped := b.removeOldest()
+		b.size -= dropped
+		b.metricDropped(dropped)
+	}
+	return nil
+}
+
+// Add adds metrics to the buffer.
+func (b *DiskBuffer) Add(metrics ...telex.Metric) {
+	b.Lock()
+	defer b.Unlock()
+
+	added := make([]telex.Metric, 0, len(metrics))
+	for _, m := range metrics {
+		err := b.add(m)
+		if err != nil {
+			log.Printf("E! [outputs.%s] could not add metric to disk buffer: %v",
+				b.name, err)
+			b.metricDropped(1)
+			m.Reject()
+			continue
+		}
+		b.MetricsAdded.Incr(1)
+		added = append(added, m)
+	}
+
+	err := b.flush(false)
+	if err != nil {
+		log.Printf("E! [outputs.%s] could not write disk buffer: %v", b.name, err)
+	}
+
+	// Once stored the delivery of the metrics is the responsibility of the
+	// disk buffer.
+	for _, m := range added {
+		m.Accept()
+	}
+	b.updateStats()
+}
+
+// flush writes out buffered records and calls fsync according to the
+// configured policy.
+func (b *DiskBuffer) flush(force bool) error {
+	err := b.writer.Flush()
+	if err != nil {
+		return err
+	}
+
+	switch b.config.Fsync {
+	case FsyncAlways:
+	case FsyncInterval:
+		if !force && time.Since(b.lastSync) < b.config.FsyncInterval {
+			return nil
+		}
+	default:
+		return nil
+	}
+
+	b.lastSync = time.Now()
+	return b.active.Sync()
+}
+
+// Batch returns a slice containing up to batchSize of the oldest metrics.
+//
+// The metrics contained in the batch are not removed from the buffer, instead
+// the position after the batch is recorded and the metrics are removed only
+// if Accept is called.
+func (b *DiskBuffer) Batch(batchSize int) []telex.Metric {
+	b.Lock()
+	defer b.Unlock()
+
+	b.resetBatch()
+	out := make([]telex.Metric, 0, min(b.size, batchSize))
+	if b.size == 0 || batchSize == 0 {
+		return out
+	}
+
+	out, cursor := b.readMetrics(out, batchSize, true)
+	b.batchEnd = cursor
+	b.batchSize = len(out)
+	if len(out) == 0 {
+		// Nothing readable, skip over the unreadable records.
+		b.accept()
+	}
+	return out
+}
+
+// Peek returns up to n of the oldest metrics.
+func (b *DiskBuffer) Peek(n int) []telex.Metric {
+	b.Lock()
+	defer b.Unlock()
+
+	out := make([]telex.Metric, 0, min(b.size, n))
+	if b.size == 0 || n == 0 {
+		return out
+	}
+	out, _ = b.readMetrics(out, n, false)
+	return out
+}
+
+// readMetrics appends up to n metrics following the read position to out,
+// it returns them and the position of the last one.  Corrupt records are
+// counted if count is true.
+func (b *DiskBuffer) readMetrics(
+	out []telex.Metric,
+	n int,
+	count bool,
+) ([]telex.Metric, diskCursor) {
+	err := b.writer.Flush()
+	if err != nil {
+		log.Printf("E! [outputs.%s] could not write disk buffer: %v", b.name, err)
+	}
+
+	cursor := b.read
+	corrupt := 0
+	for len(out) < n {
+		cursor = b.advance(cursor)
+		i := b.segment(cursor.segment)
+		if i < 0 || cursor.seq >= b.segments[i].end() {
+			break
+		}
+		seg := b.segments[i]
+
+		var metrics []telex.Metric
+		metrics, cursor, corrupt, err = b.readSegment(seg, cursor, n-len(out))
+		if err != nil {
+			log.Printf("E! [outputs.%s] could not read disk buffer segment %s: %v",
+				b.name, seg.path, err)
+			cursor = diskCursor{segment: seg.first, offset: seg.size, seq: seg.end()}
+		}
+		out = append(out, metrics...)
+		if corrupt > 0 && count {
+			b.Corruptions.Incr(1)
+			b.metricDropped(corrupt)
+		}
+	}
+	return out, cursor
+}
+
+// readSegment reads up to n metrics from seg starting at cursor.
+func (b *DiskBuffer) readSegment(
+	seg *diskSegment,
+	cursor diskCursor,
+	n int,
+) ([]telex.Metric, diskCursor, int, error) {
+	f, err := os.Open(seg.path)
+	if err != nil {
+		return nil, cursor, 0, err
+	}
+	defer f.Close()
+
+	_, err = f.Seek(cursor.offset, io.SeekStart)
+	if err != nil {
+		return nil, cursor, 0, err
+	}
+
+	var metrics []telex.Metric
+	corrupt := 0
+	r := bufio.NewReader(f)
+	for len(metrics) < n && cursor.seq < seg.end() {
+		size, payload, err := readRecord(r)
+		if err != nil {
+			return metrics, cursor, corrupt, err
+		}
+		cursor.offset += size
+		cursor.seq++
+
+		m, err := b.parser.ParseLine(string(payload[1:]))
+		if err != nil {
+			corrupt++
+			continue
+		}
+		if tp := telex.ValueType(payload[0]); tp != m.Type() {
+			m, err = metric.New(m.Name(), m.Tags(), m.Fields(), m.Time(), tp)
+			if err != nil {
+				corrupt++
+				continue
+			}
+		}
+		metrics = append(metrics, m)
+	}
+	return metrics, cursor, corrupt, nil
+}
+
+// Accept removes the metrics contained in the last batch.
+func (b *DiskBuffer) Accept(batch []telex.Metric) {
+	b.Lock()
+	defer b.Unlock()
+
+	AgentMetricsWritten.Incr(int64(len(batch)))
+	b.MetricsWritten.Incr(int64(len(batch)))
+	b.accept()
+}
+
+// accept moves the read position past the outstanding batch.
+func (b *DiskBuffer) accept() {
+	if b.batchEnd.seq > b.read.seq && b.segment(b.batchEnd.segment) >= 0 {
+		b.size -= b.between(b.read, b.batchEnd)
+		b.read = b.advance(b.batchEnd)
+		b.removeConsumed()
+
+		err := b.writeCheckpoint()
+		if err != nil {
+			log.Printf("E! [outputs.%s] could not write disk buffer checkpoint: %v",
+				b.name, err)
+		}
+	}
+
+	b.resetBatch()
+	b.updateStats()
+}
+
+// Reject clears the current batch record so that the metrics are returned
+// by the next call to Batch.
+func (b *DiskBuffer) Reject(batch []telex.Metric) {
+	b.Lock()
+	defer b.Unlock()
+
+	b.resetBatch()
+}
+
+func (b *DiskBuffer) resetBatch() {
+	b.batchEnd = diskCursor{}
+	b.batchSize = 0
+}
+
+// Close flushes and syncs the active segment.
+func (b *DiskBuffer) Close() error {
+	openDiskBuffersMu.Lock()
+	defer openDiskBuffersMu.Unlock()
+
+	b.Lock()
+	defer b.Unlock()
+
+	if b.active == nil {
+		return nil
+	}
+
+	err := b.flush(true)
+
+	b.refs--
+	if b.refs > 0 {
+		return err
+	}
+
+	if cerr := b.active.Close(); err == nil {
+		err = cerr
+	}
+	b.active = nil
+	delete(openDiskBuffers, b.config.Directory)
+	return err
+}
+
+// writeRecord writes a single record, returning its size on disk.
+func writeRecord(w io.Writer, tp byte, octets []byte) (int64, error) {
+	payload := make([]byte, 0, len(octets)+1)
+	payload = append(payload, tp)
+	payload = append(payload, octets...)
+
+	var header [recordHeaderLen]byte
+	binary.BigEndian.PutUint32(header[0:4], uint32(len(payload)))
+	binary.BigEndian.PutUint32(header[4:8], crc32.ChecksumIEEE(payload))
+
+	if _, err := w.Write(header[:]); err != nil {
+		return 0, err
+	}
+	if _, err := w.Write(payload); err != nil {
+		return 0, err
+	}
+	return int64(recordHeaderLen + len(payload)), nil
+}
+
+// readRecord reads a single record, returning its size on disk and its
+// payload.  io.EOF is returned only at a clean record boundary.
+func readRecord(r io.Reader) (int64, []byte, error) {
+	var header [recordHeaderLen]byte
+	n, err := io.ReadFull(r, header[:])
+	if err == io.EOF {
+		return 0, nil, io.EOF
+	}
+	if err != nil {
+		return 0, nil, fmt.Errorf("%v: short header of %d bytes", errCorruptRecord, n)
+	}
+
+	length := binary.BigEndian.Uint32(header[0:4])
+	if length < 2 || length > maxRecordLen {
+		return 0, nil, fmt.Errorf("%v: invalid length %d", errCorruptRecord, length)
+	}
+
+	payload := make([]byte, length)
+	_, err = io.ReadFull(r, payload)
+	if err != nil {
+		return 0, nil, fmt.Errorf("%v: short payload", errCorruptRecord)
+	}
+
+	if crc32.ChecksumIEEE(payload) != binary.BigEndian.Uint32(header[4:8]) {
+		return 0, nil, fmt.Errorf("%v: checksum mismatch", errCorruptRecord)
+	}
+
+	return int64(recordHeaderLen) + int64(length), payload, nil
+}
@@ -0,0 +1,286 @@
+package models
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/lavaorg/telex"
+	"github.com/lavaorg/telex/metric"
+	"github.com/lavaorg/telex/testutil"
+	"github.com/stretchr/testify/require"
+)
+
+func newDiskBuffer(t *testing.T, dir string, config DiskBufferConfig) *DiskBuffer {
+	config.Directory = dir
+	b, err := NewDiskBuffer("test", config)
+	require.NoError(t, err)
+	b.MetricsAdded.Set(0)
+	b.MetricsWritten.Set(0)
+	b.MetricsDropped.Set(0)
+	b.MetricsReplayed.Set(0)
+	b.Corruptions.Set(0)
+	return b
+}
+
+func tempDir(t *testing.T) string {
+	dir, err := ioutil.TempDir("", "disk_buffer")
+	require.NoError(t, err)
+	return dir
+}
+
+func TestDiskBuffer_LenEmpty(t *testing.T) {
+	dir := tempDir(t)
+	defer os.RemoveAll(dir)
+
+	b := newDiskBuffer(t, dir, DiskBufferConfig{})
+	defer b.Close()
+
+	require.Equal(t, 0, b.Len())
+	require.Len(t, b.Batch(10), 0)
+}
+
+func TestDiskBuffer_BatchAccept(t *testing.T) {
+	dir := tempDir(t)
+	defer os.RemoveAll(dir)
+
+	b := newDiskBuffer(t, dir, DiskBufferConfig{})
+	defer b.Close()
+
+	b.Add(first5...)
+	require.Equal(t, 5, b.Len())
+
+	batch := b.Batch(3)
+	testutil.RequireMetricsEqual(t, first5[:3], batch)
+
+	b.Accept(batch)
+	require.Equal(t, 2, b.Len())
+	require.Equal(t, int64(3), b.MetricsWritten.Get())
+
+	batch = b.Batch(3)
+	testutil.RequireMetricsEqual(t, first5[3:], batch)
+}
+
+func TestDiskBuffer_BatchReject(t *testing.T) {
+	dir := tempDir(t)
+	defer os.RemoveAll(dir)
+
+	b := newDiskBuffer(t, dir, DiskBufferConfig{})
+	defer b.Close()
+
+	b.Add(first5...)
+	batch := b.Batch(2)
+	b.Reject(batch)
+	require.Equal(t, 5, b.Len())
+
+	batch = b.Batch(2)
+	testutil.RequireMetricsEqual(t, first5[:2], batch)
+}
+
+func TestDiskBuffer_PeekLeavesMetrics(t *testing.T) {
+	dir := tempDir(t)
+	defer os.RemoveAll(dir)
+
+	b := newDiskBuffer(t, dir, DiskBufferConfig{})
+	defer b.Close()
+
+	require.Len(t, b.Peek(2), 0)
+
+	b.Add(first5...)
+	testutil.RequireMetricsEqual(t, first5[:2], b.Peek(2))
+	testutil.RequireMetricsEqual(t, first5, b.Peek(10))
+	require.Equal(t, 5, b.Len())
+
+	batch := b.Batch(3)
+	testutil.RequireMetricsEqual(t, first5[:3], batch)
+	b.Accept(batch)
+	testutil.RequireMetricsEqual(t, first5[3:], b.Peek(10))
+}
+
+func TestDiskBuffer_AcceptsTrackingMetricOnAdd(t *testing.T) {
+	dir := tempDir(t)
+	defer os.RemoveAll(dir)
+
+	b := newDiskBuffer(t, dir, DiskBufferConfig{})
+	defer b.Close()
+
+	var accept int
+	mm := &MockMetric{
+		Metric:  Metric(),
+		AcceptF: func() { accept++ },
+	}
+	b.Add(mm)
+	require.Equal(t, 1, accept)
+}
+
+func TestDiskBuffer_PreservesValueType(t *testing.T) {
+	dir := tempDir(t)
+	defer os.RemoveAll(dir)
+
+	b := newDiskBuffer(t, dir, DiskBufferConfig{})
+	defer b.Close()
+
+	m, err := metric.New("cpu",
+		map[string]string{"host": "localhost"},
+		map[string]interface{}{"value": uint64(42)},
+		time.Unix(42, 0),
+		telex.Counter)
+	require.NoError(t, err)
+
+	b.Add(m)
+	batch := b.Batch(1)
+	require.Len(t, batch, 1)
+	require.Equal(t, telex.Counter, batch[0].Type())
+	testutil.RequireMetricEqual(t, m, batch[0])
+}
+
+func TestDiskBuffer_ReplayAfterReopen(t *testing.T) {
+	dir := tempDir(t)
+	defer os.RemoveAll(dir)
+
+	b := newDiskBuffer(t, dir, DiskBufferConfig{SegmentSize: 100})
+	b.Add(first5...)
+	b.Add(next5...)
+	b.Accept(b.Batch(3))
+	require.NoError(t, b.Close())
+
+	b = newDiskBuffer(t, dir, DiskBufferConfig{SegmentSize: 100})
+	defer b.Close()
+
+	require.Equal(t, 7, b.Len())
+	batch := b.Batch(10)
+	expected := append(append([]telex.Metric{}, first5[3:]...), next5...)
+	testutil.RequireMetricsEqual(t, expected, batch)
+}
+
+func TestDiskBuffer_SharedDirectory(t *testing.T) {
+	dir := tempDir(t)
+	defer os.RemoveAll(dir)
+
+	b := newDiskBuffer(t, dir, DiskBufferConfig{})
+	b.Add(first5...)
+
+	// A reloaded output opens the directory while the old one is running.
+	shared := newDiskBuffer(t, dir+"/", DiskBufferConfig{})
+	require.True(t, b == shared)
+	require.NoError(t, b.Close())
+
+	shared.Add(next5...)
+	require.Equal(t, 10, shared.Len())
+	require.NoError(t, shared.Close())
+
+	b = newDiskBuffer(t, dir, DiskBufferConfig{})
+	defer b.Close()
+	require.Equal(t, 10, b.Len())
+}
+
+func TestDiskBuffer_RemovesConsumedSegments(t *testing.T) {
+	dir := tempDir(t)
+	defer os.RemoveAll(dir)
+
+	b := newDiskBuffer(t, dir, DiskBufferConfig{SegmentSize: 1})
+	defer b.Close()
+
+	b.Add(first5...)
+	require.Equal(t, int64(5), b.BufferSegments.Get())
+
+	b.Accept(b.Batch(4))
+	require.Equal(t, int64(1), b.BufferSegments.Get())
+	require.Equal(t, 1, b.Len())
+}
+
+func TestDiskBuffer_MaxSizeDropsOldest(t *testing.T) {
+	dir := tempDir(t)
+	defer os.RemoveAll(dir)
+
+	b := newDiskBuffer(t, dir, DiskBufferConfig{SegmentSize: 1, MaxSize: 150})
+	defer b.Close()
+
+	b.Add(first5...)
+	require.True(t, b.Len() < 5)
+	require.Equal(t, int64(5-b.Len()), b.MetricsDropped.Get())
+
+	batch := b.Batch(5)
+	testutil.RequireMetricsEqual(t, first5[5-b.Len():], batch)
+}
+
+func TestDiskBuffer_TruncatesCorruptTail(t *testing.T) {
+	dir := tempDir(t)
+	defer os.RemoveAll(dir)
+
+	b := newDiskBuffer(t, dir, DiskBufferConfig{})
+	b.Add(first5...)
+	require.NoError(t, b.Close())
+
+	segments, err := filepath.Glob(filepath.Join(dir, "*.seg"))
+	require.NoError(t, err)
+	require.Len(t, segments, 1)
+
+	f, err := os.OpenFile(segments[0], os.O_WRONLY|os.O_APPEND, 0)
+	require.NoError(t, err)
+	_, err = f.Write([]byte{0, 0, 0, 42, 1, 2, 3})
+	require.NoError(t, err)
+	require.NoError(t, f.Close())
+
+	b = newDiskBuffer(t, dir, DiskBufferConfig{})
+	defer b.Close()
+
+	require.Equal(t, 5, b.Len())
+	b.Add(next5[0])
+	batch := b.Batch(10)
+	expected := append(append([]telex.Metric{}, first5...), next5[0])
+	testutil.RequireMetricsEqual(t, expected, batch)
+}
+
+func TestDiskBuffer_InvalidFsync(t *testing.T) {
+	_, err := NewDiskBuffer("test", DiskBufferConfig{Directory: "x", Fsync: "sometimes"})
+	require.Error(t, err)
+}
+
+func TestRunningOutput_DiskBuffer(t *testing.T) {
+	dir := tempDir(t)
+	defer os.RemoveAll(dir)
+
+	conf := &OutputConfig{
+		Filter:         Filter{},
+		BufferStrategy: "disk",
+		DiskBuffer:     DiskBufferConfig{Directory: dir},
+	}
+
+	m := &mockOutput{}
+	m.failWrite = true
+	ro, err := NewRunningOutput("test", m, conf, 5, 10)
+	require.NoError(t, err)
+	for _, metric := range first5 {
+		ro.AddMetric(metric)
+	}
+	require.Error(t, ro.Write())
+	require.NoError(t, ro.Close())
+
+	m.failWrite = false
+	ro, err = NewRunningOutput("test", m, conf, 5, 10)
+	require.NoError(t, err)
+	require.Equal(t, int64(5), ro.BufferSize.Get())
+	require.NoError(t, ro.Write())
+	require.Len(t, m.metrics, 5)
+	require.NoError(t, ro.Close())
+}
+
+func TestRunningOutput_DiskBufferError(t *testing.T) {
+	dir := tempDir(t)
+	defer os.RemoveAll(dir)
+
+	// The directory can not be created under a file.
+	file := filepath.Join(dir, "file")
+	require.NoError(t, ioutil.WriteFile(file, nil, 0644))
+
+	conf := &OutputConfig{
+		Filter:         Filter{},
+		BufferStrategy: "disk",
+		DiskBuffer:     DiskBufferConfig{Directory: filepath.Join(file, "buffer")},
+	}
+	_, err := NewRunningOutput("test", &mockOutput{}, conf, 5, 10)
+	require.Error(t, err)
+}
@@ -523,3 +523,54 @@ func BenchmarkFilter(b *testing.B) {
 		})
 	}
 }
+
+func TestFilter_MetricPass(t *testing.T) {
+	f := Filter{
+		MetricPass: `name = cpu and usage_idle < 10 or host = db*`,
+	}
+	require.NoError(t, f.Compile())
+	require.True(t, f.IsActive())
+
+	passes := []telex.Metric{
+		testutil.MustMetric("cpu", map[string]string{"host": "web01"},
+			map[string]interface{}{"usage_idle": float64(5)}, time.Now()),
+		testutil.MustMetric("mem", map[string]string{"host": "db01"},
+			map[string]interface{}{"used": int64(5)}, time.Now()),
+	}
+	drops := []telex.Metric{
+		testutil.MustMetric("cpu", map[string]string{"host": "web01"},
+			map[string]interface{}{"usage_idle": float64(50)}, time.Now()),
+		testutil.MustMetric("mem", map[string]string{"host": "web01"},
+			map[string]interface{}{"used": int64(5)}, time.Now()),
+	}
+
+	for _, m := range passes {
+		require.True(t, f.Select(m), "Should pass: %s", m.Name())
+	}
+	for _, m := range drops {
+		require.False(t, f.Select(m), "Should drop: %s", m.Name())
+	}
+}
+
+func TestFilter_MetricPassAndNamePass(t *testing.T) {
+	f := Filter{
+		NamePass:   []string{"cpu"},
+		MetricPass: `usage_idle < 10`,
+	}
+	require.NoError(t, f.Compile())
+
+	m := testutil.MustMetric("mem", map[string]string{},
+		map[string]interface{}{"usage_idle": float64(5)}, time.Now())
+	require.False(t, f.Select(m))
+	m.SetName("cpu")
+	require.True(t, f.Select(m))
+	m.AddField("usage_idle", float64(50))
+	require.False(t, f.Select(m))
+}
+
+func TestFilter_MetricPassInvalid(t *testing.T) {
+	f := Filter{
+		MetricPass: `usage_idle <`,
+	}
+	require.Error(t, f.Compile())
+}
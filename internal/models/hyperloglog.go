@@ -0,0 +1,70 @@
+package models
+
+import (
+	"math"
+	"math/bits"
+)
+
+// hllPrecision is the number of bits of the hash selecting a register, the
+// standard error of the estimates is 1.04/sqrt(2^hllPrecision), about 1.6%.
+const hllPrecision = 12
+
+// hyperLogLog estimates the number of distinct 64 bit hashes added to it.
+type hyperLogLog struct {
+	registers []uint8
+
+	// sum is the sum of 2^-register and zeros the number of registers at
+	// zero, both are updated as registers change so that the estimate does
+	// not have to scan the registers.
+	sum   float64
+	zeros int
+}
+
+func newHyperLogLog() *hyperLogLog {
+	m := 1 << hllPrecision
+	return &hyperLogLog{
+		registers: make([]uint8, m),
+		sum:       float64(m),
+		zeros:     m,
+	}
+}
+
+// Add adds a hash, it is mixed first so that hashes with poorly distributed
+// bits, such as FNV of short strings, can be used.
+func (h *hyperLogLog) Add(hash uint64) {
+	hash = mix64(hash)
+	index := hash >> (64 - hllPrecision)
+	rank := uint8(bits.LeadingZeros64(hash<<hllPrecision|1<<(hllPrecision-1)) + 1)
+
+	old := h.registers[index]
+	if rank <= old {
+		return
+	}
+	if old == 0 {
+		h.zeros--
+	}
+	h.sum += math.Ldexp(1, -int(rank)) - math.Ldexp(1, -int(old))
+	h.registers[index] = rank
+}
+
+// Count returns the estimated number of distinct hashes.
+func (h *hyperLogLog) Count() uint64 {
+	m := float64(len(h.registers))
+	alpha := 0.7213 / (1 + 1.079/m)
+	estimate := alpha * m * m / h.sum
+	if estimate <= 2.5*m && h.zeros > 0 {
+		// Linear counting is more accurate for small cardinalities.
+		estimate = m * math.Log(m/float64(h.zeros))
+	}
+	return uint64(estimate + 0.5)
+}
+
+// mix64 is the finalizer of splitmix64.
+func mix64(x uint64) uint64 {
+	x ^= x >> 30
+	x *= 0xbf58476d1ce4e5b9
+	x ^= x >> 27
+	x *= 0x94d049bb133111eb
+	x ^= x >> 31
+	return x
+}
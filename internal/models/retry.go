@@ -0,0 +1,156 @@
+package models
+
+import (
+	"errors"
+	"math"
+	"math/rand"
+	"sync"
+	"time"
+)
+
+const (
+	// Default delay before the first retry of a failed write or connect.
+	DEFAULT_RETRY_INITIAL_INTERVAL = time.Second
+
+	// Default maximum delay between retries.
+	DEFAULT_RETRY_MAX_INTERVAL = time.Minute
+
+	// Default time the circuit breaker stays open before allowing a write.
+	DEFAULT_CIRCUIT_BREAKER_TIMEOUT = time.Minute
+
+	retryMultiplier = 2.0
+)
+
+// ErrCircuitOpen is returned by writes while the circuit breaker of an output
+// is open.
+var ErrCircuitOpen = errors.New("circuit breaker open")
+
+// Circuit breaker states as reported by the breaker_state stat.
+const (
+	BreakerClosed = iota
+	BreakerOpen
+	BreakerHalfOpen
+)
+
+// RetryConfig is the retry and circuit breaker policy of an output.
+type RetryConfig struct {
+	// MaxAttempts is the number of write attempts per flush, including the
+	// first one.  Values below 2 disable retries.
+	MaxAttempts int
+
+	// InitialInterval is the delay before the first retry, it is doubled
+	// for each consecutive failure up to MaxInterval.
+	InitialInterval time.Duration
+	MaxInterval     time.Duration
+
+	// BreakerThreshold is the number of consecutive failures that opens the
+	// circuit breaker, 0 disables the breaker.
+	BreakerThreshold int
+
+	// BreakerTimeout is how long the breaker stays open before a single
+	// write is allowed through to test the output.
+	BreakerTimeout time.Duration
+}
+
+// retryState tracks consecutive failures of an output.
+type retryState struct {
+	sync.Mutex
+	config RetryConfig
+
+	attempts int // failed attempts during the current flush
+	failures int // consecutive failed attempts
+	state    int
+	openedAt time.Time
+}
+
+func newRetryState(config RetryConfig) *retryState {
+	if config.InitialInterval <= 0 {
+		config.InitialInterval = DEFAULT_RETRY_INITIAL_INTERVAL
+	}
+	if config.MaxInterval <= 0 {
+		config.MaxInterval = DEFAULT_RETRY_MAX_INTERVAL
+	}
+	if config.MaxInterval < config.InitialInterval {
+		config.MaxInterval = config.InitialInterval
+	}
+	if config.BreakerTimeout <= 0 {
+		config.BreakerTimeout = DEFAULT_CIRCUIT_BREAKER_TIMEOUT
+	}
+	return &retryState{config: config}
+}
+
+// allow returns ErrCircuitOpen if the breaker is open, moving it to half-open
+// once the breaker timeout has passed.
+func (r *retryState) allow(now time.Time) error {
+	r.Lock()
+	defer r.Unlock()
+
+	if r.state == BreakerOpen {
+		if now.Sub(r.openedAt) < r.config.BreakerTimeout {
+			return ErrCircuitOpen
+		}
+		r.state = BreakerHalfOpen
+	}
+	return nil
+}
+
+// success resets the failure counts and closes the breaker.
+func (r *retryState) success() {
+	r.Lock()
+	defer r.Unlock()
+
+	r.attempts = 0
+	r.failures = 0
+	r.state = BreakerClosed
+}
+
+// failure records a failed attempt, returning true if it opened the breaker.
+func (r *retryState) failure(now time.Time) bool {
+	r.Lock()
+	defer r.Unlock()
+
+	r.attempts++
+	r.failures++
+
+	threshold := r.config.BreakerThreshold
+	if r.state == BreakerHalfOpen ||
+		(r.state == BreakerClosed && threshold > 0 && r.failures >= threshold) {
+		r.state = BreakerOpen
+		r.openedAt = now
+		return true
+	}
+	return false
+}
+
+// next returns the delay before the next retry, or false if no retry should
+// be made before the next flush.
+func (r *retryState) next() (time.Duration, bool) {
+	r.Lock()
+	defer r.Unlock()
+
+	if r.state == BreakerOpen || r.attempts == 0 || r.attempts >= r.config.MaxAttempts {
+		r.attempts = 0
+		return 0, false
+	}
+	return backoff(r.config, r.failures), true
+}
+
+func (r *retryState) breakerState() int {
+	r.Lock()
+	defer r.Unlock()
+
+	return r.state
+}
+
+// backoff returns the jittered delay before retry number n.  The delay is
+// chosen randomly between half and all of the exponential backoff.
+func backoff(config RetryConfig, n int) time.Duration {
+	if n < 1 {
+		n = 1
+	}
+	d := float64(config.InitialInterval) * math.Pow(retryMultiplier, float64(n-1))
+	if d > float64(config.MaxInterval) {
+		d = float64(config.MaxInterval)
+	}
+	return time.Duration(d/2 + rand.Float64()*d/2)
+}
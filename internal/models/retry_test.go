@@ -0,0 +1,131 @@
+package models
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestRetry_NoRetriesByDefault(t *testing.T) {
+	r := newRetryState(RetryConfig{})
+	r.failure(time.Now())
+
+	_, ok := r.next()
+	require.False(t, ok)
+}
+
+func TestRetry_MaxAttempts(t *testing.T) {
+	r := newRetryState(RetryConfig{MaxAttempts: 3})
+
+	r.failure(time.Now())
+	_, ok := r.next()
+	require.True(t, ok)
+
+	r.failure(time.Now())
+	_, ok = r.next()
+	require.True(t, ok)
+
+	r.failure(time.Now())
+	_, ok = r.next()
+	require.False(t, ok)
+
+	// the attempts start over on the next flush
+	r.failure(time.Now())
+	_, ok = r.next()
+	require.True(t, ok)
+}
+
+func TestRetry_BackoffIsBounded(t *testing.T) {
+	config := RetryConfig{
+		InitialInterval: time.Second,
+		MaxInterval:     10 * time.Second,
+	}
+
+	for n := 1; n < 10; n++ {
+		d := backoff(config, n)
+		max := time.Second << uint(n-1)
+		if max > config.MaxInterval {
+			max = config.MaxInterval
+		}
+		require.True(t, d >= max/2, "backoff %s below %s", d, max/2)
+		require.True(t, d <= max, "backoff %s above %s", d, max)
+	}
+}
+
+func TestRetry_BreakerOpensAndHalfOpens(t *testing.T) {
+	r := newRetryState(RetryConfig{
+		MaxAttempts:      5,
+		BreakerThreshold: 2,
+		BreakerTimeout:   time.Minute,
+	})
+
+	now := time.Now()
+	require.False(t, r.failure(now))
+	require.True(t, r.failure(now))
+	require.Equal(t, BreakerOpen, r.breakerState())
+	require.Equal(t, ErrCircuitOpen, r.allow(now))
+
+	_, ok := r.next()
+	require.False(t, ok)
+
+	later := now.Add(time.Minute)
+	require.NoError(t, r.allow(later))
+	require.Equal(t, BreakerHalfOpen, r.breakerState())
+
+	// a failure while half-open opens the breaker again
+	require.True(t, r.failure(later))
+	require.Equal(t, ErrCircuitOpen, r.allow(later))
+
+	require.NoError(t, r.allow(later.Add(time.Minute)))
+	r.success()
+	require.Equal(t, BreakerClosed, r.breakerState())
+}
+
+func TestRunningOutput_CircuitBreaker(t *testing.T) {
+	conf := &OutputConfig{
+		Filter: Filter{},
+		Retry: RetryConfig{
+			BreakerThreshold: 1,
+			BreakerTimeout:   time.Hour,
+		},
+	}
+
+	m := &mockOutput{failWrite: true}
+	ro, err := NewRunningOutput("test", m, conf, 1000, 10000)
+	require.NoError(t, err)
+	ro.BreakerTrips.Set(0)
+
+	for _, metric := range first5 {
+		ro.AddMetric(metric)
+	}
+	require.Error(t, ro.Write())
+	require.Equal(t, int64(BreakerOpen), ro.BreakerState.Get())
+	require.Equal(t, int64(1), ro.BreakerTrips.Get())
+
+	m.failWrite = false
+	require.Equal(t, ErrCircuitOpen, ro.Write())
+	require.Len(t, m.Metrics(), 0)
+}
+
+func TestRunningOutput_WriteRefusedUntilConnected(t *testing.T) {
+	conf := &OutputConfig{
+		Filter: Filter{},
+	}
+
+	m := &mockOutput{}
+	ro, err := NewRunningOutput("test", m, conf, 1000, 10000)
+	require.NoError(t, err)
+
+	ro.connectErr = errors.New("connection refused")
+	for _, metric := range first5 {
+		ro.AddMetric(metric)
+	}
+	require.Error(t, ro.Write())
+	require.Len(t, m.Metrics(), 0)
+
+	require.NoError(t, ro.Connect())
+	require.NoError(t, ro.Write())
+	require.Len(t, m.Metrics(), 5)
+}
@@ -1,6 +1,11 @@
 package models
 
 import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"sync/atomic"
 	"time"
 
 	"github.com/lavaorg/telex"
@@ -9,6 +14,10 @@ import (
 
 var GlobalMetricsGathered = selfstat.Register("agent", "metrics_gathered", map[string]string{})
 
+// ErrGatherRunning is returned by Gather while a previous gather of the input
+// is still running, after it timed out.
+var ErrGatherRunning = errors.New("a previous gather is still running")
+
 type RunningInput struct {
 	Input  telex.Input
 	Config *InputConfig
@@ -17,6 +26,16 @@ type RunningInput struct {
 
 	MetricsGathered selfstat.Stat
 	GatherTime      selfstat.Stat
+	GatherTimeouts  selfstat.Stat
+
+	status statusTracker
+	paused int32
+
+	// gatherMu protects the state of the running gather.
+	gatherMu  sync.Mutex
+	gathering bool
+	hung      bool
+	timedOut  bool
 }
 
 func NewRunningInput(input telex.Input, config *InputConfig) *RunningInput {
@@ -33,13 +52,19 @@ func NewRunningInput(input telex.Input, config *InputConfig) *RunningInput {
 			"gather_time_ns",
 			map[string]string{"input": config.Name},
 		),
+		GatherTimeouts: selfstat.Register(
+			"gather",
+			"gather_timeouts",
+			map[string]string{"input": config.Name},
+		),
 	}
 }
 
 // InputConfig is the common config for all inputs.
 type InputConfig struct {
-	Name     string
-	Interval time.Duration
+	Name          string
+	Interval      time.Duration
+	GatherTimeout time.Duration
 
 	NameOverride      string
 	MeasurementPrefix string
@@ -57,6 +82,12 @@ func (r *RunningInput) metricFiltered(metric telex.Metric) {
 }
 
 func (r *RunningInput) MakeMetric(metric telex.Metric) telex.Metric {
+	// Service inputs are not scheduled, their metrics are dropped instead.
+	if _, ok := r.Input.(telex.ServiceInput); ok && r.Paused() {
+		r.metricFiltered(metric)
+		return nil
+	}
+
 	if ok := r.Config.Filter.Select(metric); !ok {
 		r.metricFiltered(metric)
 		return nil
@@ -81,14 +112,91 @@ func (r *RunningInput) MakeMetric(metric telex.Metric) telex.Metric {
 	return m
 }
 
-func (r *RunningInput) Gather(acc telex.Accumulator) error {
+// Gather gathers from the input once, ctx is passed to a ContextInput.  Only
+// one gather runs at a time, ErrGatherRunning is returned otherwise.
+func (r *RunningInput) Gather(ctx context.Context, acc telex.Accumulator) error {
+	r.gatherMu.Lock()
+	if r.gathering {
+		r.gatherMu.Unlock()
+		return ErrGatherRunning
+	}
+	r.gathering = true
+	r.gatherMu.Unlock()
+
 	start := time.Now()
-	err := r.Input.Gather(acc)
+	var err error
+	if input, ok := r.Input.(telex.ContextInput); ok {
+		err = input.GatherContext(ctx, acc)
+	} else {
+		err = r.Input.Gather(acc)
+	}
 	elapsed := time.Since(start)
 	r.GatherTime.Incr(elapsed.Nanoseconds())
+
+	r.gatherMu.Lock()
+	// A gather abandoned after its timeout keeps the timeout as its outcome.
+	if !r.hung {
+		r.timedOut = false
+		if err != nil {
+			r.status.failure(err, time.Now())
+		} else {
+			r.status.success(time.Now())
+		}
+	}
+	r.gathering = false
+	r.hung = false
+	r.gatherMu.Unlock()
 	return err
 }
 
+// GatherTimedOut records that a gather did not complete within timeout.  The
+// gather is hung until it returns.
+func (r *RunningInput) GatherTimedOut(timeout time.Duration) error {
+	err := fmt.Errorf("gather timed out after %s", timeout)
+	r.GatherTimeouts.Incr(1)
+
+	r.gatherMu.Lock()
+	defer r.gatherMu.Unlock()
+	r.hung = r.gathering
+	r.timedOut = true
+	r.status.failure(err, time.Now())
+	return err
+}
+
+// TimedOut returns true if the last gather timed out, and true for hung if
+// it is still running.
+func (r *RunningInput) TimedOut() (timedOut bool, hung bool) {
+	r.gatherMu.Lock()
+	defer r.gatherMu.Unlock()
+	return r.timedOut, r.hung
+}
+
+// Pause stops the scheduled gathers of the input, or drops the metrics of a
+// service input, until Resume is called.
+func (r *RunningInput) Pause() {
+	atomic.StoreInt32(&r.paused, 1)
+}
+
+// Resume undoes Pause.
+func (r *RunningInput) Resume() {
+	atomic.StoreInt32(&r.paused, 0)
+}
+
+// Paused returns true if the input is paused.
+func (r *RunningInput) Paused() bool {
+	return atomic.LoadInt32(&r.paused) == 1
+}
+
+// RecordError records an error reported by the input to its accumulator.
+func (r *RunningInput) RecordError(err error) {
+	r.status.failure(err, time.Now())
+}
+
+// Status returns the outcome of the last gathers of the input.
+func (r *RunningInput) Status() Status {
+	return r.status.get()
+}
+
 func (r *RunningInput) SetDefaultTags(tags map[string]string) {
 	r.defaultTags = tags
 }
@@ -1,6 +1,8 @@
 package models
 
 import (
+	"context"
+	"errors"
 	"testing"
 	"time"
 
@@ -256,6 +258,93 @@ func TestMakeMetricNameSuffix(t *testing.T) {
 	require.Equal(t, expected, m)
 }
 
+func TestRunningInputStatus(t *testing.T) {
+	ri := NewRunningInput(&testInput{}, &InputConfig{Name: "test"})
+	assert.Equal(t, Status{}, ri.Status())
+
+	require.NoError(t, ri.Gather(context.Background(), &testutil.Accumulator{}))
+	status := ri.Status()
+	assert.False(t, status.LastSuccess.IsZero())
+	assert.False(t, status.Failing())
+
+	ri.RecordError(errors.New("gather failed"))
+	status = ri.Status()
+	assert.True(t, status.Failing())
+	assert.Equal(t, "gather failed", status.LastError)
+}
+
+func TestRunningInputGatherTimedOut(t *testing.T) {
+	input := &blockingInput{release: make(chan struct{})}
+	ri := NewRunningInput(input, &InputConfig{Name: "test"})
+	ri.GatherTimeouts.Set(0)
+
+	done := make(chan error)
+	go func() {
+		done <- ri.Gather(context.Background(), &testutil.Accumulator{})
+	}()
+	for {
+		ri.gatherMu.Lock()
+		gathering := ri.gathering
+		ri.gatherMu.Unlock()
+		if gathering {
+			break
+		}
+		time.Sleep(time.Millisecond)
+	}
+
+	err := ri.GatherTimedOut(time.Second)
+	require.EqualError(t, err, "gather timed out after 1s")
+	assert.Equal(t, int64(1), ri.GatherTimeouts.Get())
+	timedOut, hung := ri.TimedOut()
+	assert.True(t, timedOut)
+	assert.True(t, hung)
+
+	err = ri.Gather(context.Background(), &testutil.Accumulator{})
+	require.Equal(t, ErrGatherRunning, err)
+
+	// The hung gather returning does not clear the timeout.
+	close(input.release)
+	require.NoError(t, <-done)
+	timedOut, hung = ri.TimedOut()
+	assert.True(t, timedOut)
+	assert.False(t, hung)
+	assert.Equal(t, "gather timed out after 1s", ri.Status().LastError)
+
+	require.NoError(t, ri.Gather(context.Background(), &testutil.Accumulator{}))
+	timedOut, _ = ri.TimedOut()
+	assert.False(t, timedOut)
+	assert.False(t, ri.Status().Failing())
+}
+
+func TestRunningInputGatherContext(t *testing.T) {
+	ri := NewRunningInput(&contextInput{}, &InputConfig{Name: "test"})
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	err := ri.Gather(ctx, &testutil.Accumulator{})
+	require.Equal(t, context.Canceled, err)
+	assert.Equal(t, "context canceled", ri.Status().LastError)
+}
+
+type blockingInput struct {
+	testInput
+	release chan struct{}
+}
+
+func (i *blockingInput) Gather(acc telex.Accumulator) error {
+	<-i.release
+	return nil
+}
+
+type contextInput struct {
+	testInput
+}
+
+func (i *contextInput) GatherContext(ctx context.Context, acc telex.Accumulator) error {
+	<-ctx.Done()
+	return ctx.Err()
+}
+
 type testInput struct{}
 
 func (t *testInput) Description() string                { return "" }
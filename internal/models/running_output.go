@@ -1,6 +1,7 @@
 package models
 
 import (
+	"fmt"
 	"log"
 	"sync"
 	"time"
@@ -25,6 +26,17 @@ type OutputConfig struct {
 	FlushInterval     time.Duration
 	MetricBufferLimit int
 	MetricBatchSize   int
+
+	// BufferStrategy selects where unsent metrics are kept, either "memory"
+	// or "disk".
+	BufferStrategy string
+	DiskBuffer     DiskBufferConfig
+
+	Retry RetryConfig
+
+	// Cardinality limits the number of series of each measurement written
+	// to the output.
+	Cardinality CardinalityConfig
 }
 
 // RunningOutput contains the output configuration
@@ -39,11 +51,29 @@ type RunningOutput struct {
 	BufferSize      selfstat.Stat
 	BufferLimit     selfstat.Stat
 	WriteTime       selfstat.Stat
+	WriteErrors     selfstat.Stat
+	WriteRetries    selfstat.Stat
+	RetryDelay      selfstat.Stat
+	BreakerState    selfstat.Stat
+	BreakerTrips    selfstat.Stat
+	ConnectErrors   selfstat.Stat
 
 	batch      []telex.Metric
-	buffer     *Buffer
+	buffer     MetricBuffer
 	BatchReady chan time.Time
 
+	// FlushRequests receives requests to write the buffer outside of the
+	// flush interval, the result of the write is sent on the request.
+	FlushRequests chan chan error
+
+	cardinality *CardinalityGuard
+	status      statusTracker
+
+	retry      *retryState
+	connected  bool
+	connectErr error
+	connMutex  sync.Mutex
+
 	aggMutex   sync.Mutex
 	batchMutex sync.Mutex
 }
@@ -54,7 +84,7 @@ func NewRunningOutput(
 	conf *OutputConfig,
 	batchSize int,
 	bufferLimit int,
-) *RunningOutput {
+) (*RunningOutput, error) {
 	if conf.MetricBufferLimit > 0 {
 		bufferLimit = conf.MetricBufferLimit
 	}
@@ -67,11 +97,17 @@ func NewRunningOutput(
 	if batchSize == 0 {
 		batchSize = DEFAULT_METRIC_BATCH_SIZE
 	}
+	buffer, err := newBuffer(name, conf, bufferLimit)
+	if err != nil {
+		return nil, err
+	}
 	ro := &RunningOutput{
 		Name:              name,
 		batch:             make([]telex.Metric, 0, batchSize),
-		buffer:            NewBuffer(name, bufferLimit),
+		buffer:            buffer,
 		BatchReady:        make(chan time.Time, 1),
+		FlushRequests:     make(chan chan error),
+		retry:             newRetryState(conf.Retry),
 		Output:            output,
 		Config:            conf,
 		MetricBufferLimit: bufferLimit,
@@ -96,10 +132,57 @@ func NewRunningOutput(
 			"write_time_ns",
 			map[string]string{"output": name},
 		),
+		WriteErrors: selfstat.Register(
+			"write",
+			"write_errors",
+			map[string]string{"output": name},
+		),
+		WriteRetries: selfstat.Register(
+			"write",
+			"write_retries",
+			map[string]string{"output": name},
+		),
+		RetryDelay: selfstat.Register(
+			"write",
+			"retry_backoff_ns",
+			map[string]string{"output": name},
+		),
+		BreakerState: selfstat.Register(
+			"write",
+			"breaker_state",
+			map[string]string{"output": name},
+		),
+		BreakerTrips: selfstat.Register(
+			"write",
+			"breaker_trips",
+			map[string]string{"output": name},
+		),
+		ConnectErrors: selfstat.Register(
+			"write",
+			"connect_errors",
+			map[string]string{"output": name},
+		),
 	}
 
+	if conf.Cardinality.Limit > 0 {
+		ro.cardinality = NewCardinalityGuard(name, conf.Cardinality)
+	}
 	ro.BufferLimit.Set(int64(ro.MetricBufferLimit))
-	return ro
+	ro.BufferSize.Set(int64(ro.buffer.Len()))
+	return ro, nil
+}
+
+// newBuffer creates the buffer selected by the output's buffer strategy.
+func newBuffer(name string, conf *OutputConfig, bufferLimit int) (MetricBuffer, error) {
+	if conf.BufferStrategy == "disk" {
+		buffer, err := NewDiskBuffer(name, conf.DiskBuffer)
+		if err != nil {
+			return nil, fmt.Errorf("could not open disk buffer of output %s: %v",
+				name, err)
+		}
+		return buffer, nil
+	}
+	return NewBuffer(name, bufferLimit), nil
 }
 
 func (ro *RunningOutput) metricFiltered(metric telex.Metric) {
@@ -122,6 +205,11 @@ func (ro *RunningOutput) AddMetric(metric telex.Metric) {
 		return
 	}
 
+	if ro.cardinality != nil && !ro.cardinality.Apply(metric) {
+		metric.Drop()
+		return
+	}
+
 	if output, ok := ro.Output.(telex.AggregatingOutput); ok {
 		ro.aggMutex.Lock()
 		output.Add(metric)
@@ -168,6 +256,10 @@ func (ro *RunningOutput) Write() error {
 	ro.addBatchToBuffer()
 	ro.batchMutex.Unlock()
 
+	if err := ro.allowWrite(); err != nil {
+		return err
+	}
+
 	nBuffer := ro.buffer.Len()
 
 	// Only process the metrics in the buffer now.  Metrics added while we are
@@ -191,6 +283,10 @@ func (ro *RunningOutput) Write() error {
 
 // WriteBatch writes only the batch metrics to the output.
 func (ro *RunningOutput) WriteBatch() error {
+	if err := ro.allowWrite(); err != nil {
+		return err
+	}
+
 	batch := ro.buffer.Batch(ro.MetricBatchSize)
 	if len(batch) == 0 {
 		return nil
@@ -215,10 +311,128 @@ func (ro *RunningOutput) write(metrics []telex.Metric) error {
 	if err == nil {
 		log.Printf("D! [outputs.%s] wrote batch of %d metrics in %s\n",
 			ro.Name, len(metrics), elapsed)
+		ro.retry.success()
+		ro.status.success(time.Now())
+	} else {
+		ro.WriteErrors.Incr(1)
+		ro.status.failure(err, time.Now())
+		if ro.retry.failure(time.Now()) {
+			log.Printf("W! [outputs.%s] circuit breaker opened for %s",
+				ro.Name, ro.retry.config.BreakerTimeout)
+			ro.BreakerTrips.Incr(1)
+		}
+	}
+	ro.BreakerState.Set(int64(ro.retry.breakerState()))
+	return err
+}
+
+// allowWrite returns an error if the output can not currently be written.
+func (ro *RunningOutput) allowWrite() error {
+	ro.connMutex.Lock()
+	err := ro.connectErr
+	ro.connMutex.Unlock()
+	if err != nil {
+		return fmt.Errorf("not connected: %v", err)
+	}
+
+	err = ro.retry.allow(time.Now())
+	ro.BreakerState.Set(int64(ro.retry.breakerState()))
+	return err
+}
+
+// RetryBackoff returns the delay before the failed write should be retried,
+// or false if the write should wait for the next flush.
+func (ro *RunningOutput) RetryBackoff() (time.Duration, bool) {
+	d, ok := ro.retry.next()
+	if ok {
+		ro.WriteRetries.Incr(1)
+		ro.RetryDelay.Set(d.Nanoseconds())
+	}
+	return d, ok
+}
+
+// ConnectBackoff returns the delay before reconnect attempt n.
+func (ro *RunningOutput) ConnectBackoff(n int) time.Duration {
+	return backoff(ro.retry.config, n)
+}
+
+// Connect connects the output, writes are refused until it succeeds.
+func (ro *RunningOutput) Connect() error {
+	err := ro.Output.Connect()
+	if err != nil {
+		ro.ConnectErrors.Incr(1)
+		ro.status.failure(err, time.Now())
 	}
+
+	ro.connMutex.Lock()
+	ro.connected = err == nil
+	ro.connectErr = err
+	ro.connMutex.Unlock()
 	return err
 }
 
+// Connected returns true if the last call to Connect succeeded.
+func (ro *RunningOutput) Connected() bool {
+	ro.connMutex.Lock()
+	defer ro.connMutex.Unlock()
+	return ro.connected
+}
+
+// Status returns the outcome of the last writes of the output.
+func (ro *RunningOutput) Status() Status {
+	return ro.status.get()
+}
+
+// BufferLen returns the number of metrics in the buffer.
+func (ro *RunningOutput) BufferLen() int {
+	return ro.buffer.Len()
+}
+
+// BufferedMetrics returns up to n of the oldest metrics not yet written,
+// from the buffer then the current batch.  They must not be modified.
+func (ro *RunningOutput) BufferedMetrics(n int) []telex.Metric {
+	metrics := ro.buffer.Peek(n)
+
+	ro.batchMutex.Lock()
+	defer ro.batchMutex.Unlock()
+	for _, m := range ro.batch {
+		if len(metrics) >= n {
+			break
+		}
+		metrics = append(metrics, m)
+	}
+	return metrics
+}
+
+// BufferFull returns true if the buffer is full, new metrics then replace
+// the oldest ones.
+func (ro *RunningOutput) BufferFull() bool {
+	if buffer, ok := ro.buffer.(*DiskBuffer); ok {
+		return buffer.Full()
+	}
+	return ro.buffer.Len() >= ro.MetricBufferLimit
+}
+
+// Close closes the output and its buffer.
+func (ro *RunningOutput) Close() error {
+	err := ro.Output.Close()
+
+	// Metrics still in the batch would otherwise be lost by a disk buffer.
+	ro.batchMutex.Lock()
+	ro.addBatchToBuffer()
+	ro.batchMutex.Unlock()
+
+	if berr := ro.buffer.Close(); err == nil {
+		err = berr
+	}
+	return err
+}
+
+// ReleaseBuffer closes the buffer of an output which was never connected.
+func (ro *RunningOutput) ReleaseBuffer() error {
+	return ro.buffer.Close()
+}
+
 func (ro *RunningOutput) LogBufferStatus() {
 	nBuffer := ro.buffer.Len()
 	log.Printf("D! [outputs.%s] buffer fullness: %d / %d metrics. ",
@@ -35,7 +35,8 @@ func BenchmarkRunningOutputAddWrite(b *testing.B) {
 	}
 
 	m := &perfOutput{}
-	ro := NewRunningOutput("test", m, conf, 1000, 10000)
+	ro, err := NewRunningOutput("test", m, conf, 1000, 10000)
+	require.NoError(b, err)
 
 	for n := 0; n < b.N; n++ {
 		ro.AddMetric(testutil.TestMetric(101, "metric1"))
@@ -50,7 +51,8 @@ func BenchmarkRunningOutputAddWriteEvery100(b *testing.B) {
 	}
 
 	m := &perfOutput{}
-	ro := NewRunningOutput("test", m, conf, 1000, 10000)
+	ro, err := NewRunningOutput("test", m, conf, 1000, 10000)
+	require.NoError(b, err)
 
 	for n := 0; n < b.N; n++ {
 		ro.AddMetric(testutil.TestMetric(101, "metric1"))
@@ -68,7 +70,8 @@ func BenchmarkRunningOutputAddFailWrites(b *testing.B) {
 
 	m := &perfOutput{}
 	m.failWrite = true
-	ro := NewRunningOutput("test", m, conf, 1000, 10000)
+	ro, err := NewRunningOutput("test", m, conf, 1000, 10000)
+	require.NoError(b, err)
 
 	for n := 0; n < b.N; n++ {
 		ro.AddMetric(testutil.TestMetric(101, "metric1"))
@@ -85,7 +88,8 @@ func TestRunningOutput_DropFilter(t *testing.T) {
 	assert.NoError(t, conf.Filter.Compile())
 
 	m := &mockOutput{}
-	ro := NewRunningOutput("test", m, conf, 1000, 10000)
+	ro, err := NewRunningOutput("test", m, conf, 1000, 10000)
+	require.NoError(t, err)
 
 	for _, metric := range first5 {
 		ro.AddMetric(metric)
@@ -95,7 +99,7 @@ func TestRunningOutput_DropFilter(t *testing.T) {
 	}
 	assert.Len(t, m.Metrics(), 0)
 
-	err := ro.Write()
+	err = ro.Write()
 	assert.NoError(t, err)
 	assert.Len(t, m.Metrics(), 8)
 }
@@ -110,7 +114,8 @@ func TestRunningOutput_PassFilter(t *testing.T) {
 	assert.NoError(t, conf.Filter.Compile())
 
 	m := &mockOutput{}
-	ro := NewRunningOutput("test", m, conf, 1000, 10000)
+	ro, err := NewRunningOutput("test", m, conf, 1000, 10000)
+	require.NoError(t, err)
 
 	for _, metric := range first5 {
 		ro.AddMetric(metric)
@@ -120,7 +125,7 @@ func TestRunningOutput_PassFilter(t *testing.T) {
 	}
 	assert.Len(t, m.Metrics(), 0)
 
-	err := ro.Write()
+	err = ro.Write()
 	assert.NoError(t, err)
 	assert.Len(t, m.Metrics(), 10)
 }
@@ -135,12 +140,13 @@ func TestRunningOutput_TagIncludeNoMatch(t *testing.T) {
 	assert.NoError(t, conf.Filter.Compile())
 
 	m := &mockOutput{}
-	ro := NewRunningOutput("test", m, conf, 1000, 10000)
+	ro, err := NewRunningOutput("test", m, conf, 1000, 10000)
+	require.NoError(t, err)
 
 	ro.AddMetric(testutil.TestMetric(101, "metric1"))
 	assert.Len(t, m.Metrics(), 0)
 
-	err := ro.Write()
+	err = ro.Write()
 	assert.NoError(t, err)
 	assert.Len(t, m.Metrics(), 1)
 	assert.Empty(t, m.Metrics()[0].Tags())
@@ -156,12 +162,13 @@ func TestRunningOutput_TagExcludeMatch(t *testing.T) {
 	assert.NoError(t, conf.Filter.Compile())
 
 	m := &mockOutput{}
-	ro := NewRunningOutput("test", m, conf, 1000, 10000)
+	ro, err := NewRunningOutput("test", m, conf, 1000, 10000)
+	require.NoError(t, err)
 
 	ro.AddMetric(testutil.TestMetric(101, "metric1"))
 	assert.Len(t, m.Metrics(), 0)
 
-	err := ro.Write()
+	err = ro.Write()
 	assert.NoError(t, err)
 	assert.Len(t, m.Metrics(), 1)
 	assert.Len(t, m.Metrics()[0].Tags(), 0)
@@ -177,12 +184,13 @@ func TestRunningOutput_TagExcludeNoMatch(t *testing.T) {
 	assert.NoError(t, conf.Filter.Compile())
 
 	m := &mockOutput{}
-	ro := NewRunningOutput("test", m, conf, 1000, 10000)
+	ro, err := NewRunningOutput("test", m, conf, 1000, 10000)
+	require.NoError(t, err)
 
 	ro.AddMetric(testutil.TestMetric(101, "metric1"))
 	assert.Len(t, m.Metrics(), 0)
 
-	err := ro.Write()
+	err = ro.Write()
 	assert.NoError(t, err)
 	assert.Len(t, m.Metrics(), 1)
 	assert.Len(t, m.Metrics()[0].Tags(), 1)
@@ -198,12 +206,13 @@ func TestRunningOutput_TagIncludeMatch(t *testing.T) {
 	assert.NoError(t, conf.Filter.Compile())
 
 	m := &mockOutput{}
-	ro := NewRunningOutput("test", m, conf, 1000, 10000)
+	ro, err := NewRunningOutput("test", m, conf, 1000, 10000)
+	require.NoError(t, err)
 
 	ro.AddMetric(testutil.TestMetric(101, "metric1"))
 	assert.Len(t, m.Metrics(), 0)
 
-	err := ro.Write()
+	err = ro.Write()
 	assert.NoError(t, err)
 	assert.Len(t, m.Metrics(), 1)
 	assert.Len(t, m.Metrics()[0].Tags(), 1)
@@ -216,7 +225,8 @@ func TestRunningOutputDefault(t *testing.T) {
 	}
 
 	m := &mockOutput{}
-	ro := NewRunningOutput("test", m, conf, 1000, 10000)
+	ro, err := NewRunningOutput("test", m, conf, 1000, 10000)
+	require.NoError(t, err)
 
 	for _, metric := range first5 {
 		ro.AddMetric(metric)
@@ -226,7 +236,7 @@ func TestRunningOutputDefault(t *testing.T) {
 	}
 	assert.Len(t, m.Metrics(), 0)
 
-	err := ro.Write()
+	err = ro.Write()
 	assert.NoError(t, err)
 	assert.Len(t, m.Metrics(), 10)
 }
@@ -238,7 +248,8 @@ func TestRunningOutputWriteFail(t *testing.T) {
 
 	m := &mockOutput{}
 	m.failWrite = true
-	ro := NewRunningOutput("test", m, conf, 4, 12)
+	ro, err := NewRunningOutput("test", m, conf, 4, 12)
+	require.NoError(t, err)
 
 	// Fill buffer to limit twice
 	for _, metric := range first5 {
@@ -251,7 +262,7 @@ func TestRunningOutputWriteFail(t *testing.T) {
 	assert.Len(t, m.Metrics(), 0)
 
 	// manual write fails
-	err := ro.Write()
+	err = ro.Write()
 	require.Error(t, err)
 	// no successful flush yet
 	assert.Len(t, m.Metrics(), 0)
@@ -263,6 +274,40 @@ func TestRunningOutputWriteFail(t *testing.T) {
 	assert.Len(t, m.Metrics(), 10)
 }
 
+func TestRunningOutputStatus(t *testing.T) {
+	conf := &OutputConfig{
+		Filter: Filter{},
+	}
+
+	m := &mockOutput{}
+	m.failWrite = true
+	ro, err := NewRunningOutput("test", m, conf, 5, 10)
+	require.NoError(t, err)
+	assert.Equal(t, Status{}, ro.Status())
+
+	for _, metric := range first5 {
+		ro.AddMetric(metric)
+	}
+	for _, metric := range next5 {
+		ro.AddMetric(metric)
+	}
+	require.Error(t, ro.Write())
+	status := ro.Status()
+	assert.True(t, status.Failing())
+	assert.Equal(t, "Failed Write!", status.LastError)
+	assert.True(t, status.LastSuccess.IsZero())
+	assert.Equal(t, 10, ro.BufferLen())
+	assert.True(t, ro.BufferFull())
+
+	m.failWrite = false
+	require.NoError(t, ro.Write())
+	status = ro.Status()
+	assert.False(t, status.Failing())
+	assert.Equal(t, "Failed Write!", status.LastError)
+	assert.False(t, status.LastSuccess.IsZero())
+	assert.False(t, ro.BufferFull())
+}
+
 // Verify that the order of points is preserved during a write failure.
 func TestRunningOutputWriteFailOrder(t *testing.T) {
 	conf := &OutputConfig{
@@ -271,7 +316,8 @@ func TestRunningOutputWriteFailOrder(t *testing.T) {
 
 	m := &mockOutput{}
 	m.failWrite = true
-	ro := NewRunningOutput("test", m, conf, 100, 1000)
+	ro, err := NewRunningOutput("test", m, conf, 100, 1000)
+	require.NoError(t, err)
 
 	// add 5 metrics
 	for _, metric := range first5 {
@@ -281,7 +327,7 @@ func TestRunningOutputWriteFailOrder(t *testing.T) {
 	assert.Len(t, m.Metrics(), 0)
 
 	// Write fails
-	err := ro.Write()
+	err = ro.Write()
 	require.Error(t, err)
 	// no successful flush yet
 	assert.Len(t, m.Metrics(), 0)
@@ -309,14 +355,15 @@ func TestRunningOutputWriteFailOrder2(t *testing.T) {
 
 	m := &mockOutput{}
 	m.failWrite = true
-	ro := NewRunningOutput("test", m, conf, 5, 100)
+	ro, err := NewRunningOutput("test", m, conf, 5, 100)
+	require.NoError(t, err)
 
 	// add 5 metrics
 	for _, metric := range first5 {
 		ro.AddMetric(metric)
 	}
 	// Write fails
-	err := ro.Write()
+	err = ro.Write()
 	require.Error(t, err)
 	// no successful flush yet
 	assert.Len(t, m.Metrics(), 0)
@@ -380,7 +427,8 @@ func TestRunningOutputWriteFailOrder3(t *testing.T) {
 
 	m := &mockOutput{}
 	m.failWrite = true
-	ro := NewRunningOutput("test", m, conf, 5, 1000)
+	ro, err := NewRunningOutput("test", m, conf, 5, 1000)
+	require.NoError(t, err)
 
 	// add 5 metrics
 	for _, metric := range first5 {
@@ -390,7 +438,7 @@ func TestRunningOutputWriteFailOrder3(t *testing.T) {
 	assert.Len(t, m.Metrics(), 0)
 
 	// Write fails
-	err := ro.Write()
+	err = ro.Write()
 	require.Error(t, err)
 	// no successful flush yet
 	assert.Len(t, m.Metrics(), 0)
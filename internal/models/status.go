@@ -0,0 +1,46 @@
+package models
+
+import (
+	"sync"
+	"time"
+)
+
+// Status is the outcome of the last gathers of an input or writes of an
+// output.
+type Status struct {
+	// LastSuccess is the time of the last successful gather or write.
+	LastSuccess time.Time
+
+	// LastError is the last error reported and LastErrorTime its time.
+	LastError     string
+	LastErrorTime time.Time
+}
+
+// Failing returns true if an error was reported since the last success.
+func (s Status) Failing() bool {
+	return s.LastErrorTime.After(s.LastSuccess)
+}
+
+type statusTracker struct {
+	sync.Mutex
+	status Status
+}
+
+func (t *statusTracker) success(now time.Time) {
+	t.Lock()
+	t.status.LastSuccess = now
+	t.Unlock()
+}
+
+func (t *statusTracker) failure(err error, now time.Time) {
+	t.Lock()
+	t.status.LastError = err.Error()
+	t.status.LastErrorTime = now
+	t.Unlock()
+}
+
+func (t *statusTracker) get() Status {
+	t.Lock()
+	defer t.Unlock()
+	return t.status
+}
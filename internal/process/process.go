@@ -0,0 +1,322 @@
+// Package process runs the long running programs of the execd plugins.
+package process
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"log"
+	"os"
+	"os/exec"
+	"sync"
+	"time"
+
+	"github.com/lavaorg/telex/internal"
+)
+
+// maxLineSize is the size of the longest line read from stderr.
+const maxLineSize = 1024 * 1024
+
+// ErrNotRunning is returned when writing to a program which is not running,
+// while it is restarted or once it is stopped.
+var ErrNotRunning = errors.New("program is not running")
+
+// Process runs a program, and restarts it with a backoff when it exits.
+type Process struct {
+	// Name is the name of the plugin used in the log messages, like
+	// "inputs.execd".
+	Name string
+	// Command is the program and its arguments.
+	Command []string
+	// Env holds the variables added to the environment of the program, in
+	// the form "key=value".
+	Env []string
+	// Stdin opens a pipe to the stdin of the program, used by Write.
+	Stdin bool
+
+	// RestartDelay is the delay before the program is restarted, doubled on
+	// each restart up to MaxRestartDelay.  The delay is reset once the
+	// program ran for MaxRestartDelay.
+	RestartDelay    time.Duration
+	MaxRestartDelay time.Duration
+	// StopTimeout is the time the program has to exit once its stdin is
+	// closed by Stop, it is killed after.
+	StopTimeout time.Duration
+
+	// ReadStdout reads the stdout of each run of the program until EOF, it
+	// is discarded if nil.
+	ReadStdout func(io.Reader)
+	// ReadStderr reads the stderr of each run of the program until EOF, its
+	// lines are logged if nil, see logStderr.
+	ReadStderr func(io.Reader)
+	// OnError is called with the errors starting the program and its exit
+	// status when it fails.
+	OnError func(error)
+
+	// mu protects the running program, nil while it is restarted.
+	mu       sync.Mutex
+	cmd      *exec.Cmd
+	stdin    io.WriteCloser
+	stopping bool
+
+	cancel context.CancelFunc
+	done   chan struct{}
+}
+
+// New returns a Process running command, with the default delays.
+func New(name string, command []string) *Process {
+	return &Process{
+		Name:            name,
+		Command:         command,
+		RestartDelay:    10 * time.Second,
+		MaxRestartDelay: 5 * time.Minute,
+		StopTimeout:     5 * time.Second,
+	}
+}
+
+// Start starts the program, it returns once the program is running.  The
+// errors restarting it are passed to OnError.
+func (p *Process) Start() error {
+	if len(p.Command) == 0 {
+		return errors.New("command is required")
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	run, err := p.start(ctx)
+	if err != nil {
+		cancel()
+		return err
+	}
+
+	p.cancel = cancel
+	p.done = make(chan struct{})
+	go func() {
+		defer close(p.done)
+		p.run(ctx, run)
+	}()
+	return nil
+}
+
+// Stop closes the stdin of the program and waits for it to exit, it is
+// killed if it does not exit within StopTimeout or has no stdin.
+func (p *Process) Stop() {
+	if p.cancel == nil {
+		return
+	}
+
+	p.mu.Lock()
+	p.stopping = true
+	stdin := p.stdin
+	p.mu.Unlock()
+
+	if stdin != nil {
+		stdin.Close()
+		select {
+		case <-p.done:
+		case <-time.After(p.StopTimeout):
+			log.Printf("W! [%s] %s did not exit within %s, killing it", p.Name,
+				p.Command[0], p.StopTimeout)
+		}
+	}
+	p.cancel()
+	<-p.done
+}
+
+// Running returns true if the program is running.
+func (p *Process) Running() bool {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return p.cmd != nil
+}
+
+// Signal sends sig to the program, it does nothing if the program is not
+// running.
+func (p *Process) Signal(sig os.Signal) error {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if p.cmd == nil {
+		return nil
+	}
+	err := p.cmd.Process.Signal(sig)
+	if err == os.ErrProcessDone {
+		return nil
+	}
+	return err
+}
+
+// Write writes b to the stdin of the program, it blocks until the program
+// reads it.
+func (p *Process) Write(b []byte) error {
+	p.mu.Lock()
+	stdin := p.stdin
+	p.mu.Unlock()
+
+	if stdin == nil {
+		return ErrNotRunning
+	}
+	_, err := stdin.Write(b)
+	return err
+}
+
+// run waits for the program to exit and restarts it, until ctx is done or
+// Stop is called.
+func (p *Process) run(ctx context.Context, run func() error) {
+	delay := p.RestartDelay
+	for {
+		start := time.Now()
+		err := run()
+
+		p.mu.Lock()
+		stopping := p.stopping
+		p.mu.Unlock()
+		if ctx.Err() != nil || stopping {
+			return
+		}
+
+		if err != nil {
+			p.onError(fmt.Errorf("%s exited: %v", p.Command[0], err))
+		} else {
+			log.Printf("W! [%s] %s exited", p.Name, p.Command[0])
+		}
+
+		if time.Since(start) >= p.MaxRestartDelay {
+			delay = p.RestartDelay
+		}
+		for {
+			log.Printf("I! [%s] Restarting %s in %s", p.Name, p.Command[0], delay)
+			if err := internal.SleepContext(ctx, delay); err != nil {
+				return
+			}
+
+			delay *= 2
+			if delay > p.MaxRestartDelay {
+				delay = p.MaxRestartDelay
+			}
+
+			run, err = p.start(ctx)
+			if err == nil {
+				break
+			}
+			p.onError(fmt.Errorf("error starting %s: %v", p.Command[0], err))
+		}
+	}
+}
+
+// start starts the program, it returns a function waiting for it to exit
+// once its output is read.
+func (p *Process) start(ctx context.Context) (func() error, error) {
+	cmd := exec.CommandContext(ctx, p.Command[0], p.Command[1:]...)
+	if len(p.Env) > 0 {
+		cmd.Env = append(os.Environ(), p.Env...)
+	}
+	stdout, err := cmd.StdoutPipe()
+	if err != nil {
+		return nil, err
+	}
+	stderr, err := cmd.StderrPipe()
+	if err != nil {
+		return nil, err
+	}
+	var stdin io.WriteCloser
+	if p.Stdin {
+		stdin, err = cmd.StdinPipe()
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	if err := cmd.Start(); err != nil {
+		return nil, err
+	}
+	log.Printf("D! [%s] Started %s with pid %d", p.Name, p.Command[0],
+		cmd.Process.Pid)
+
+	p.mu.Lock()
+	p.cmd = cmd
+	p.stdin = stdin
+	if p.stopping && stdin != nil {
+		stdin.Close()
+	}
+	p.mu.Unlock()
+
+	// Children of the program may keep its output open once it is killed.
+	exited := make(chan struct{})
+	go func() {
+		select {
+		case <-ctx.Done():
+			stdout.Close()
+			stderr.Close()
+		case <-exited:
+		}
+	}()
+
+	var wg sync.WaitGroup
+	wg.Add(2)
+	go func() {
+		defer wg.Done()
+		if p.ReadStdout != nil {
+			p.ReadStdout(stdout)
+		}
+		// The program could block writing to a full pipe.
+		io.Copy(ioutil.Discard, stdout)
+	}()
+	go func() {
+		defer wg.Done()
+		if p.ReadStderr != nil {
+			p.ReadStderr(stderr)
+		} else {
+			p.logStderr(stderr)
+		}
+		io.Copy(ioutil.Discard, stderr)
+	}()
+
+	return func() error {
+		wg.Wait()
+		close(exited)
+
+		p.mu.Lock()
+		p.cmd = nil
+		p.stdin = nil
+		p.mu.Unlock()
+
+		return cmd.Wait()
+	}, nil
+}
+
+// logStderr logs the lines the program writes to stderr at the level of
+// their prefix, "E! ", "W! ", "I! " or "D! ", and as errors without one.
+func (p *Process) logStderr(r io.Reader) {
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(make([]byte, 64*1024), maxLineSize)
+	for scanner.Scan() {
+		level, line := splitLevel(scanner.Text())
+		log.Printf("%s! [%s] %s: %s", level, p.Name, p.Command[0], line)
+	}
+	if err := scanner.Err(); err != nil {
+		log.Printf("E! [%s] %s: error reading stderr: %v", p.Name, p.Command[0], err)
+	}
+}
+
+// splitLevel returns the level of the log line and the line without it, the
+// level is "E" if the line has no level prefix.
+func splitLevel(line string) (string, string) {
+	if len(line) >= 3 && line[1:3] == "! " {
+		switch line[0] {
+		case 'E', 'W', 'I', 'D':
+			return line[:1], line[3:]
+		}
+	}
+	return "E", line
+}
+
+func (p *Process) onError(err error) {
+	if p.OnError != nil {
+		p.OnError(err)
+		return
+	}
+	log.Printf("E! [%s] %v", p.Name, err)
+}
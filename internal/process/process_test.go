@@ -0,0 +1,167 @@
+// +build !windows
+
+package process
+
+import (
+	"bufio"
+	"errors"
+	"io"
+	"sync"
+	"syscall"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+type lines struct {
+	sync.Mutex
+	lines []string
+}
+
+func (l *lines) read(r io.Reader) {
+	scanner := bufio.NewScanner(r)
+	for scanner.Scan() {
+		l.Lock()
+		l.lines = append(l.lines, scanner.Text())
+		l.Unlock()
+	}
+}
+
+func (l *lines) get() []string {
+	l.Lock()
+	defer l.Unlock()
+	return append([]string(nil), l.lines...)
+}
+
+func newProcess(script string) *Process {
+	p := New("test", []string{"sh", "-c", script})
+	p.RestartDelay = 10 * time.Millisecond
+	p.MaxRestartDelay = 40 * time.Millisecond
+	return p
+}
+
+func waitFor(t *testing.T, condition func() bool) {
+	deadline := time.Now().Add(5 * time.Second)
+	for !condition() {
+		if time.Now().After(deadline) {
+			t.Fatal("timed out waiting for condition")
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
+
+func TestProcess_WriteAndStop(t *testing.T) {
+	p := newProcess("while read -r line; do echo \"got $line\"; done; echo done")
+	p.Stdin = true
+	out := &lines{}
+	p.ReadStdout = out.read
+	require.NoError(t, p.Start())
+
+	waitFor(t, p.Running)
+	require.NoError(t, p.Write([]byte("a\nb\n")))
+	waitFor(t, func() bool { return len(out.get()) == 2 })
+
+	// Stop lets the program finish once its stdin is closed.
+	p.Stop()
+	require.Equal(t, []string{"got a", "got b", "done"}, out.get())
+	require.False(t, p.Running())
+	require.Equal(t, ErrNotRunning, p.Write([]byte("c\n")))
+}
+
+func TestProcess_Restarts(t *testing.T) {
+	var mu sync.Mutex
+	var errs []error
+	p := newProcess("echo run; exit 2")
+	out := &lines{}
+	p.ReadStdout = out.read
+	p.OnError = func(err error) {
+		mu.Lock()
+		errs = append(errs, err)
+		mu.Unlock()
+	}
+	require.NoError(t, p.Start())
+	defer p.Stop()
+
+	waitFor(t, func() bool { return len(out.get()) >= 3 })
+	mu.Lock()
+	defer mu.Unlock()
+	require.Equal(t, errors.New("sh exited: exit status 2"), errs[0])
+}
+
+func TestProcess_StopKills(t *testing.T) {
+	p := newProcess("trap '' TERM; exec sleep 10")
+	p.Stdin = true
+	p.StopTimeout = 10 * time.Millisecond
+	require.NoError(t, p.Start())
+	waitFor(t, p.Running)
+
+	start := time.Now()
+	p.Stop()
+	require.True(t, time.Since(start) < 5*time.Second)
+}
+
+func TestProcess_Signal(t *testing.T) {
+	p := newProcess("trap 'echo hup' HUP; echo ready; while true; do sleep 0.01; done")
+	out := &lines{}
+	p.ReadStdout = out.read
+	require.NoError(t, p.Start())
+	defer p.Stop()
+
+	waitFor(t, func() bool { return len(out.get()) == 1 })
+	require.NoError(t, p.Signal(syscall.SIGHUP))
+	waitFor(t, func() bool { return len(out.get()) == 2 })
+	require.Equal(t, []string{"ready", "hup"}, out.get())
+}
+
+func TestProcess_CommandRequired(t *testing.T) {
+	p := New("test", nil)
+	require.EqualError(t, p.Start(), "command is required")
+	p.Stop()
+}
+
+func TestProcess_Env(t *testing.T) {
+	p := newProcess("echo \"$TEST_VALUE\"; sleep 10")
+	p.Env = []string{"TEST_VALUE=multi\nline"}
+	out := &lines{}
+	p.ReadStdout = out.read
+	require.NoError(t, p.Start())
+	defer p.Stop()
+
+	waitFor(t, func() bool { return len(out.get()) == 2 })
+	require.Equal(t, []string{"multi", "line"}, out.get())
+}
+
+func TestProcess_LongStderrLine(t *testing.T) {
+	// The rest of stderr is read once a line is too long, the program does
+	// not block writing to it.
+	p := newProcess("head -c 3000000 /dev/zero | tr '\\0' a >&2; echo >&2; echo done; sleep 10")
+	out := &lines{}
+	p.ReadStdout = out.read
+	require.NoError(t, p.Start())
+	defer p.Stop()
+
+	waitFor(t, func() bool { return len(out.get()) == 1 })
+	require.Equal(t, []string{"done"}, out.get())
+}
+
+func TestSplitLevel(t *testing.T) {
+	tests := []struct {
+		line  string
+		level string
+		text  string
+	}{
+		{"D! [inputs.test] gathered", "D", "[inputs.test] gathered"},
+		{"W! slow", "W", "slow"},
+		{"I! started", "I", "started"},
+		{"E! failed", "E", "failed"},
+		{"failed", "E", "failed"},
+		{"X! failed", "E", "X! failed"},
+		{"D!", "E", "D!"},
+	}
+	for _, tt := range tests {
+		level, text := splitLevel(tt.line)
+		require.Equal(t, tt.level, level, tt.line)
+		require.Equal(t, tt.text, text, tt.line)
+	}
+}
@@ -11,11 +11,15 @@ Usage:
 The commands & flags are:
 
   config              print out full sample configuration to stdout
+  config check        check the configuration for errors and exit
+  ctl <command>       send a command to the running agent, see 'telex ctl'
   version             print the version to stdout
 
   --aggregator-filter <filter>   filter the aggregators to enable, separator is :
   --config <file>                configuration file to load
   --config-directory <directory> directory containing additional *.conf files
+  --control-socket <path>        control socket used by ctl, defaults to the
+                                 control_socket of the [agent] section
   --debug                        turn on debug logging
   --input-filter <filter>        filter the inputs to enable, separator is :
   --input-list                   print available input plugins.
@@ -29,7 +33,10 @@ The commands & flags are:
   --test                         gather metrics, print them out, and exit;
                                  processors, aggregators, and outputs are not run
   --usage <plugin>               print usage for a plugin, ie, 'telex --usage mysql'
+  --validate                     check the configuration for errors and exit
   --version                      display the version and exit
+  --watch-config                 reload the configuration when the config file or
+                                 directory changes
 
 Examples:
 
@@ -42,12 +49,18 @@ Examples:
   # run a single telex collection, outputing metrics to stdout
   telex --config telex.conf --test
 
+  # check a telex config file for errors
+  telex --config telex.conf config check
+
   # run telex with all plugins defined in config file
   telex --config telex.conf
 
   # run telex, enabling the cpu & memory input, and influxdb output plugins
   telex --config telex.conf --input-filter cpu:mem --output-filter influxdb
 
+  # pause the cpu input of the running agent
+  telex --config telex.conf ctl pause cpu
+
   # run telex with pprof
   telex --config telex.conf --pprof-addr localhost:6060
 `
@@ -1,20 +1,276 @@
 package logger
 
 import (
-	"github.com/lavaorg/lrt/mlog"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"strings"
+	"sync"
+	"time"
 )
 
-// force mlog package; which installs into go log
-// currently telex uses standard go logging; it will now pass through mlog
+// Level is the severity of a log message.  Messages are given a level by
+// prefixing them with "E!", "W!", "I!" or "D!".
+type Level int
+
+// Possible log levels, from the most to the least severe.
+const (
+	Error Level = iota
+	Warn
+	Info
+	Debug
+)
+
+var levelNames = []string{"error", "warn", "info", "debug"}
+
+func (l Level) String() string {
+	return levelNames[l]
+}
+
+// ParseLevel parses a level name such as "debug" or "warn".
+func ParseLevel(name string) (Level, error) {
+	for i, n := range levelNames {
+		if strings.EqualFold(n, name) {
+			return Level(i), nil
+		}
+	}
+	return Info, fmt.Errorf("unknown log level %q", name)
+}
+
+// LogConfig contains the logging settings of the agent.
+type LogConfig struct {
+	// Debug sets the log level to debug.
+	Debug bool
+	// Quiet sets the log level to error.
+	Quiet bool
+
+	// Logfile directs the logging output to a file, the empty string is
+	// interpreted as stderr.
+	Logfile string
+
+	// Format is either "text" or "json".
+	Format string
+
+	// The logfile is rotated when it is older than RotationInterval or
+	// larger than RotationMaxSize, zero disables each check.  At most
+	// RotationMaxArchives rotated files are kept, zero keeps all of them.
+	RotationInterval    time.Duration
+	RotationMaxSize     int64
+	RotationMaxArchives int
+
+	// Levels overrides the log level for individual plugins, keyed by the
+	// plugin prefix such as "inputs.cpu" or "agent".
+	Levels map[string]string
+}
+
+var (
+	mu      sync.Mutex
+	logfile *rotatingFile
+	current *telexWriter
+)
 
 // SetupLogging configures the logging output.
-//   debug   will set the log level to DEBUG
-//   quiet   will set the log level to ERROR
-//   logfile will direct the logging output to a file. Empty string is
+//   Debug   will set the log level to DEBUG
+//   Quiet   will set the log level to ERROR
+//   Logfile will direct the logging output to a file. Empty string is
 //           interpreted as stderr. If there is an error opening the file the
 //           logger will fallback to stderr.
-func SetupLogging(debug, quiet bool, logfile string) {
+func SetupLogging(config LogConfig) {
+	w, f, err := newWriter(config)
+	log.SetFlags(0)
+	log.SetOutput(w)
+
+	// The previous logfile is closed once the standard logger no longer
+	// writes to it.
+	mu.Lock()
+	previous := logfile
+	logfile = f
+	current = w
+	mu.Unlock()
+	if previous != nil {
+		previous.Close()
+	}
+	if f != nil {
+		handleReopen()
+	}
+
+	if err != nil {
+		log.Printf("E! Unable to configure logging: %v", err)
+	}
+}
+
+// newWriter returns the writer for the standard logger and the logfile it
+// writes to, falling back to stderr if the logfile can not be opened.
+func newWriter(config LogConfig) (*telexWriter, *rotatingFile, error) {
+	var err error
+	w := &telexWriter{
+		w:      os.Stderr,
+		json:   config.Format == "json",
+		level:  Info,
+		levels: make(map[string]Level),
+	}
+	if config.Format != "" && config.Format != "text" && config.Format != "json" {
+		err = fmt.Errorf("unknown log format %q", config.Format)
+	}
+
+	if config.Debug {
+		w.level = Debug
+	} else if config.Quiet {
+		w.level = Error
+	}
+
+	for plugin, name := range config.Levels {
+		level, lerr := ParseLevel(name)
+		if lerr != nil {
+			err = fmt.Errorf("plugin %s: %v", plugin, lerr)
+			continue
+		}
+		w.levels[plugin] = level
+	}
+
+	if config.Logfile == "" {
+		return w, nil, err
+	}
+	f, ferr := openRotatingFile(config.Logfile, config.RotationInterval,
+		config.RotationMaxSize, config.RotationMaxArchives)
+	if ferr != nil {
+		return w, nil, ferr
+	}
+	w.w = f
+	return w, f, err
+}
+
+// SetLevel changes the log level of a plugin, or the default level if plugin
+// is empty, until logging is set up again.
+func SetLevel(plugin string, level Level) {
+	mu.Lock()
+	w := current
+	mu.Unlock()
+
+	if w != nil {
+		w.setLevel(plugin, level)
+	}
+}
+
+// Reopen closes and reopens the logfile, for use after it has been moved by
+// an external tool such as logrotate.
+func Reopen() error {
+	mu.Lock()
+	defer mu.Unlock()
+
+	if logfile == nil {
+		return nil
+	}
+	return logfile.Reopen()
+}
+
+// entry is a parsed log message.
+type entry struct {
+	level  Level
+	plugin string
+	msg    string
+}
+
+// parseEntry extracts the level and plugin from a message such as
+// "E! [inputs.cpu] error gathering".  Messages without a level are info.
+func parseEntry(line string) entry {
+	e := entry{level: Info, msg: strings.TrimRight(line, "\n")}
+
+	if len(e.msg) >= 2 && e.msg[1] == '!' {
+		switch e.msg[0] {
+		case 'E':
+			e.level = Error
+		case 'W':
+			e.level = Warn
+		case 'I':
+			e.level = Info
+		case 'D':
+			e.level = Debug
+		default:
+			return e
+		}
+		e.msg = strings.TrimLeft(e.msg[2:], ": ")
+	}
+
+	if strings.HasPrefix(e.msg, "[") {
+		if end := strings.Index(e.msg, "]"); end > 0 {
+			e.plugin = e.msg[1:end]
+			e.msg = strings.TrimLeft(e.msg[end+1:], " ")
+		}
+	}
+	return e
+}
+
+// telexWriter filters and formats the output of the standard logger.
+type telexWriter struct {
+	w    io.Writer
+	json bool
+
+	// levelMu protects the levels, which can be changed while logging.
+	levelMu sync.RWMutex
+	level   Level
+	levels  map[string]Level
+}
+
+func (t *telexWriter) enabled(e entry) bool {
+	t.levelMu.RLock()
+	defer t.levelMu.RUnlock()
+
+	level := t.level
+	if l, ok := t.levels[e.plugin]; ok {
+		level = l
+	}
+	return e.level <= level
+}
+
+func (t *telexWriter) setLevel(plugin string, level Level) {
+	t.levelMu.Lock()
+	defer t.levelMu.Unlock()
+
+	if plugin == "" {
+		t.level = level
+		return
+	}
+	if t.levels == nil {
+		t.levels = make(map[string]Level)
+	}
+	t.levels[plugin] = level
+}
+
+func (t *telexWriter) Write(b []byte) (int, error) {
+	e := parseEntry(string(b))
+	if !t.enabled(e) {
+		return len(b), nil
+	}
+
+	ts := time.Now().UTC().Format(time.RFC3339)
+
+	var line []byte
+	if t.json {
+		var err error
+		line, err = json.Marshal(struct {
+			Time   string `json:"time"`
+			Level  string `json:"level"`
+			Plugin string `json:"plugin,omitempty"`
+			Msg    string `json:"msg"`
+		}{ts, e.level.String(), e.plugin, e.msg})
+		if err != nil {
+			return 0, err
+		}
+		line = append(line, '\n')
+	} else {
+		prefix := ts + " " + strings.ToUpper(e.level.String()[:1]) + "! "
+		if e.plugin != "" {
+			prefix += "[" + e.plugin + "] "
+		}
+		line = []byte(prefix + e.msg + "\n")
+	}
 
-	mlog.EnableDebug(debug)
-	mlog.EnableDebug(!quiet)
+	_, err := t.w.Write(line)
+	if err != nil {
+		return 0, err
+	}
+	return len(b), nil
 }
@@ -0,0 +1,217 @@
+package logger
+
+import (
+	"bytes"
+	"encoding/json"
+	"io/ioutil"
+	"log"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestParseEntry(t *testing.T) {
+	tests := []struct {
+		line     string
+		expected entry
+	}{
+		{"E! [inputs.cpu] failed\n", entry{Error, "inputs.cpu", "failed"}},
+		{"W!: [agent] skipping\n", entry{Warn, "agent", "skipping"}},
+		{"D! debug message", entry{Debug, "", "debug message"}},
+		{"no level", entry{Info, "", "no level"}},
+		{"X! unknown", entry{Info, "", "X! unknown"}},
+	}
+	for _, tt := range tests {
+		require.Equal(t, tt.expected, parseEntry(tt.line), tt.line)
+	}
+}
+
+func TestWriter_FiltersLevels(t *testing.T) {
+	var buf bytes.Buffer
+	w := &telexWriter{
+		w:      &buf,
+		level:  Info,
+		levels: map[string]Level{"outputs.http": Debug, "inputs.cpu": Error},
+	}
+
+	w.Write([]byte("D! [agent] hidden\n"))
+	w.Write([]byte("W! [inputs.cpu] hidden\n"))
+	w.Write([]byte("D! [outputs.http] shown\n"))
+	w.Write([]byte("I! shown\n"))
+
+	lines := strings.Split(strings.TrimSpace(buf.String()), "\n")
+	require.Len(t, lines, 2)
+	require.True(t, strings.HasSuffix(lines[0], " D! [outputs.http] shown"))
+	require.True(t, strings.HasSuffix(lines[1], " I! shown"))
+}
+
+func TestWriter_SetLevel(t *testing.T) {
+	var buf bytes.Buffer
+	w := &telexWriter{w: &buf, level: Info}
+
+	w.setLevel("inputs.cpu", Debug)
+	w.Write([]byte("D! [inputs.cpu] shown\n"))
+	w.Write([]byte("D! [agent] hidden\n"))
+
+	w.setLevel("", Error)
+	w.Write([]byte("I! hidden\n"))
+	w.Write([]byte("D! [inputs.cpu] shown\n"))
+
+	lines := strings.Split(strings.TrimSpace(buf.String()), "\n")
+	require.Len(t, lines, 2)
+	require.True(t, strings.HasSuffix(lines[0], " D! [inputs.cpu] shown"))
+	require.True(t, strings.HasSuffix(lines[1], " D! [inputs.cpu] shown"))
+}
+
+func TestWriter_JSON(t *testing.T) {
+	var buf bytes.Buffer
+	w := &telexWriter{w: &buf, json: true, level: Info}
+
+	w.Write([]byte("E! [inputs.cpu] failed\n"))
+
+	var e map[string]string
+	require.NoError(t, json.Unmarshal(buf.Bytes(), &e))
+	require.Equal(t, "error", e["level"])
+	require.Equal(t, "inputs.cpu", e["plugin"])
+	require.Equal(t, "failed", e["msg"])
+	_, err := time.Parse(time.RFC3339, e["time"])
+	require.NoError(t, err)
+}
+
+func TestNewWriter_InvalidLevel(t *testing.T) {
+	_, _, err := newWriter(LogConfig{Levels: map[string]string{"agent": "loud"}})
+	require.Error(t, err)
+}
+
+func TestSetupLogging_Reload(t *testing.T) {
+	dir, err := ioutil.TempDir("", "logger")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+	defer SetupLogging(LogConfig{})
+
+	first := filepath.Join(dir, "first.log")
+	second := filepath.Join(dir, "second.log")
+	SetupLogging(LogConfig{Logfile: first})
+	log.Printf("I! before")
+	SetupLogging(LogConfig{Logfile: second})
+	log.Printf("I! after")
+
+	data, err := ioutil.ReadFile(first)
+	require.NoError(t, err)
+	require.Contains(t, string(data), "before")
+	require.NotContains(t, string(data), "after")
+	data, err = ioutil.ReadFile(second)
+	require.NoError(t, err)
+	require.Contains(t, string(data), "after")
+}
+
+func TestRotatingFile_MaxSize(t *testing.T) {
+	dir, err := ioutil.TempDir("", "logger")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	path := filepath.Join(dir, "telex.log")
+	r, err := openRotatingFile(path, 0, 10, 2)
+	require.NoError(t, err)
+	defer r.Close()
+
+	for i := 0; i < 4; i++ {
+		_, err = r.Write([]byte("0123456789"))
+		require.NoError(t, err)
+		time.Sleep(2 * time.Millisecond)
+	}
+
+	archives, err := filepath.Glob(path + ".*")
+	require.NoError(t, err)
+	require.Len(t, archives, 2)
+
+	data, err := ioutil.ReadFile(path)
+	require.NoError(t, err)
+	require.Equal(t, "0123456789", string(data))
+}
+
+func TestRotatingFile_Reopen(t *testing.T) {
+	dir, err := ioutil.TempDir("", "logger")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	path := filepath.Join(dir, "telex.log")
+	r, err := openRotatingFile(path, 0, 0, 0)
+	require.NoError(t, err)
+	defer r.Close()
+
+	_, err = r.Write([]byte("before\n"))
+	require.NoError(t, err)
+	require.NoError(t, os.Rename(path, path+".1"))
+
+	require.NoError(t, r.Reopen())
+	_, err = r.Write([]byte("after\n"))
+	require.NoError(t, err)
+
+	data, err := ioutil.ReadFile(path)
+	require.NoError(t, err)
+	require.Equal(t, "after\n", string(data))
+}
+
+func TestRotatingFile_ReopenFails(t *testing.T) {
+	dir, err := ioutil.TempDir("", "logger")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	path := filepath.Join(dir, "logs", "telex.log")
+	require.NoError(t, os.Mkdir(filepath.Dir(path), 0755))
+	r, err := openRotatingFile(path, 0, 0, 0)
+	require.NoError(t, err)
+	defer r.Close()
+
+	// The logfile cannot be opened again once its directory is moved, the
+	// logs are kept in the current logfile.
+	moved := filepath.Join(dir, "moved")
+	require.NoError(t, os.Rename(filepath.Dir(path), moved))
+	require.Error(t, r.Reopen())
+	_, err = r.Write([]byte("after\n"))
+	require.NoError(t, err)
+
+	data, err := ioutil.ReadFile(filepath.Join(moved, "telex.log"))
+	require.NoError(t, err)
+	require.Equal(t, "after\n", string(data))
+}
+
+func TestRotatingFile_RenameFails(t *testing.T) {
+	dir, err := ioutil.TempDir("", "logger")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	defer func() { rename = os.Rename }()
+	rename = func(from, to string) error {
+		return &os.LinkError{Op: "rename", Old: from, New: to, Err: os.ErrPermission}
+	}
+
+	path := filepath.Join(dir, "telex.log")
+	r, err := openRotatingFile(path, 0, 10, 2)
+	require.NoError(t, err)
+	defer r.Close()
+
+	for i := 0; i < 3; i++ {
+		_, err = r.Write([]byte("0123456789"))
+		require.NoError(t, err)
+	}
+
+	// The logs are kept in the logfile, and the rotation is retried later.
+	data, err := ioutil.ReadFile(path)
+	require.NoError(t, err)
+	require.Equal(t, strings.Repeat("0123456789", 3), string(data))
+	require.False(t, r.retry.IsZero())
+
+	rename = os.Rename
+	r.retry = time.Time{}
+	_, err = r.Write([]byte("0123456789"))
+	require.NoError(t, err)
+	data, err = ioutil.ReadFile(path)
+	require.NoError(t, err)
+	require.Equal(t, "0123456789", string(data))
+}
@@ -0,0 +1,30 @@
+// +build !windows
+
+package logger
+
+import (
+	"log"
+	"os"
+	"os/signal"
+	"sync"
+	"syscall"
+)
+
+var reopenOnce sync.Once
+
+// handleReopen reopens the logfile when SIGUSR1 is received.
+func handleReopen() {
+	reopenOnce.Do(func() {
+		signals := make(chan os.Signal, 1)
+		signal.Notify(signals, syscall.SIGUSR1)
+		go func() {
+			for range signals {
+				if err := Reopen(); err != nil {
+					log.Printf("E! Unable to reopen logfile: %v", err)
+					continue
+				}
+				log.Printf("I! Reopened logfile")
+			}
+		}()
+	})
+}
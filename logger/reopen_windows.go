@@ -0,0 +1,7 @@
+// +build windows
+
+package logger
+
+// handleReopen does nothing, there is no SIGUSR1 on Windows.
+func handleReopen() {
+}
@@ -0,0 +1,206 @@
+package logger
+
+import (
+	"os"
+	"path/filepath"
+	"runtime"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// archiveTimeFormat is appended to the name of rotated logfiles.
+const archiveTimeFormat = "2006-01-02T15-04-05.000"
+
+// rotateRetry is the delay before rotating again once a rotation failed.
+const rotateRetry = time.Minute
+
+// rename moves the logfile aside, replaced by the tests.
+var rename = os.Rename
+
+// rotatingFile is a logfile which is moved aside when it gets too old or too
+// large.
+type rotatingFile struct {
+	sync.Mutex
+	path        string
+	interval    time.Duration
+	maxSize     int64
+	maxArchives int
+
+	file   *os.File
+	size   int64
+	opened time.Time
+	// retry is the time before which a failed rotation is not retried.
+	retry time.Time
+}
+
+func openRotatingFile(
+	path string,
+	interval time.Duration,
+	maxSize int64,
+	maxArchives int,
+) (*rotatingFile, error) {
+	r := &rotatingFile{
+		path:        path,
+		interval:    interval,
+		maxSize:     maxSize,
+		maxArchives: maxArchives,
+	}
+	if err := r.open(); err != nil {
+		return nil, err
+	}
+	return r, nil
+}
+
+func (r *rotatingFile) open() error {
+	return r.openPath(r.path)
+}
+
+// openPath opens the file at path as the logfile, the current logfile is
+// kept if it fails.
+func (r *rotatingFile) openPath(path string) error {
+	f, err := os.OpenFile(path, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0644)
+	if err != nil {
+		return err
+	}
+	info, err := f.Stat()
+	if err != nil {
+		f.Close()
+		return err
+	}
+	r.file = f
+	r.size = info.Size()
+	r.opened = time.Now()
+	return nil
+}
+
+// Write writes to the logfile, rotating it first if needed.
+func (r *rotatingFile) Write(b []byte) (int, error) {
+	r.Lock()
+	defer r.Unlock()
+
+	if r.file == nil {
+		return 0, os.ErrClosed
+	}
+
+	// The logfile is kept when it cannot be rotated, to not lose the logs.
+	if r.shouldRotate(int64(len(b))) {
+		if err := r.rotate(); err != nil {
+			r.retry = time.Now().Add(rotateRetry)
+			if r.file == nil {
+				return 0, err
+			}
+		}
+	}
+
+	n, err := r.file.Write(b)
+	r.size += int64(n)
+	return n, err
+}
+
+func (r *rotatingFile) shouldRotate(n int64) bool {
+	if r.size == 0 || time.Now().Before(r.retry) {
+		return false
+	}
+	if r.maxSize > 0 && r.size+n > r.maxSize {
+		return true
+	}
+	if r.interval > 0 && time.Since(r.opened) >= r.interval {
+		return true
+	}
+	return false
+}
+
+// rotate moves the logfile aside, opens a new one and removes the oldest
+// archives.  The current logfile is kept if it cannot be moved or the new
+// one cannot be opened.
+func (r *rotatingFile) rotate() error {
+	archive := r.path + "." + time.Now().UTC().Format(archiveTimeFormat)
+
+	// Open files cannot be moved on Windows, the logfile is reopened where
+	// it is on failure.
+	if runtime.GOOS == "windows" {
+		r.file.Close()
+		if err := rename(r.path, archive); err != nil {
+			r.file = nil
+			r.open()
+			return err
+		}
+		if err := r.open(); err != nil {
+			r.file = nil
+			r.openPath(archive)
+			return err
+		}
+		return r.purge()
+	}
+
+	if err := rename(r.path, archive); err != nil {
+		return err
+	}
+	old := r.file
+	if err := r.open(); err != nil {
+		// The moved logfile is still open.
+		return err
+	}
+	old.Close()
+	return r.purge()
+}
+
+// purge removes the oldest archives beyond maxArchives.
+func (r *rotatingFile) purge() error {
+	if r.maxArchives <= 0 {
+		return nil
+	}
+
+	archives, err := filepath.Glob(r.path + ".*")
+	if err != nil {
+		return err
+	}
+	// Skip files not created by rotate, such as compressed logrotate copies.
+	valid := archives[:0]
+	for _, archive := range archives {
+		suffix := strings.TrimPrefix(archive, r.path+".")
+		if _, err := time.Parse(archiveTimeFormat, suffix); err == nil {
+			valid = append(valid, archive)
+		}
+	}
+	sort.Strings(valid)
+
+	for len(valid) > r.maxArchives {
+		if err := os.Remove(valid[0]); err != nil {
+			return err
+		}
+		valid = valid[1:]
+	}
+	return nil
+}
+
+// Reopen closes and reopens the logfile without rotating it.  The current
+// logfile is kept if the new one cannot be opened.
+func (r *rotatingFile) Reopen() error {
+	r.Lock()
+	defer r.Unlock()
+
+	old := r.file
+	if err := r.open(); err != nil {
+		return err
+	}
+	if old != nil {
+		old.Close()
+	}
+	return nil
+}
+
+// Close closes the logfile.
+func (r *rotatingFile) Close() error {
+	r.Lock()
+	defer r.Unlock()
+
+	if r.file == nil {
+		return nil
+	}
+	err := r.file.Close()
+	r.file = nil
+	return err
+}
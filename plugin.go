@@ -0,0 +1,9 @@
+package telex
+
+// Initializer is a plugin checking and preparing its configuration, once
+// loaded, before it is used.
+type Initializer interface {
+	// Init is called once the configuration of the plugin is loaded, an
+	// error fails the loading of the configuration.
+	Init() error
+}
@@ -2,7 +2,9 @@ package all
 
 import (
 	_ "github.com/lavaorg/telex/plugins/aggregators/basicstats"
+	_ "github.com/lavaorg/telex/plugins/aggregators/derivative"
 	_ "github.com/lavaorg/telex/plugins/aggregators/histogram"
 	_ "github.com/lavaorg/telex/plugins/aggregators/minmax"
+	_ "github.com/lavaorg/telex/plugins/aggregators/quantile"
 	_ "github.com/lavaorg/telex/plugins/aggregators/valuecounter"
 )
@@ -0,0 +1,214 @@
+package derivative
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/lavaorg/telex"
+	"github.com/lavaorg/telex/filter"
+	"github.com/lavaorg/telex/internal"
+	"github.com/lavaorg/telex/plugins/aggregators"
+)
+
+const (
+	modeRate  = "rate"
+	modeDelta = "delta"
+)
+
+// Derivative computes the rate or the increase of monotonic counters.
+type Derivative struct {
+	Fields       []string          `toml:"fields"`
+	Mode         string            `toml:"mode"`
+	CounterMax   uint64            `toml:"counter_max"`
+	StaleTimeout internal.Duration `toml:"stale_timeout"`
+
+	// cache holds the state of every series across periods, it is only
+	// emptied of the stale series on Reset.
+	cache       map[uint64]*series
+	fieldFilter filter.Filter
+	now         func() time.Time
+}
+
+type series struct {
+	name     string
+	tags     map[string]string
+	fields   map[string]*counter
+	lastSeen time.Time
+}
+
+// counter is the state of a field: the last value read, and the increase
+// since the start of the period.
+type counter struct {
+	value    float64
+	time     time.Time
+	start    time.Time
+	increase float64
+	updated  bool
+}
+
+// NewDerivative creates a derivative aggregator with the default settings.
+func NewDerivative() *Derivative {
+	return &Derivative{
+		Mode:         modeRate,
+		StaleTimeout: internal.Duration{Duration: 10 * time.Minute},
+		cache:        make(map[uint64]*series),
+		now:          time.Now,
+	}
+}
+
+var sampleConfig = `
+  ## General Aggregator Arguments:
+  ## The period on which to flush & clear the aggregator.
+  period = "30s"
+  ## If true, the original metric will be dropped by the
+  ## aggregator and will not get sent to the output plugins.
+  drop_original = false
+
+  ## Fields to compute the derivative of, globs are supported.
+  ## If empty, all the numeric fields are used.
+  # fields = ["bytes_*", "packets_*"]
+
+  ## Either "rate" to push the per second rate as <field>_rate,
+  ## or "delta" to push the increase over the period as <field>_delta.
+  # mode = "rate"
+
+  ## Maximum value of the counters before they wrap around to 0, eg.
+  ## 4294967295 for 32 bits counters.  A decreasing counter is a wraparound
+  ## if it is set, otherwise the counter was reset and its increase is the
+  ## new value.
+  # counter_max = 0
+
+  ## Series not seen for this long are forgotten, 0 keeps them forever.
+  # stale_timeout = "10m"
+`
+
+func (d *Derivative) SampleConfig() string {
+	return sampleConfig
+}
+
+func (d *Derivative) Description() string {
+	return "Compute the rate or the increase of monotonic counters."
+}
+
+// Init compiles the fields filter and checks the mode, so that an invalid
+// setting fails the configuration.
+func (d *Derivative) Init() error {
+	var err error
+	if d.fieldFilter, err = filter.Compile(d.Fields); err != nil {
+		return fmt.Errorf("invalid fields: %v", err)
+	}
+	if d.Mode != modeRate && d.Mode != modeDelta {
+		return fmt.Errorf("unknown mode %q, must be %q or %q", d.Mode, modeRate, modeDelta)
+	}
+	return nil
+}
+
+func (d *Derivative) Add(in telex.Metric) {
+	id := in.HashID()
+	s, ok := d.cache[id]
+	if !ok {
+		s = &series{
+			name:   in.Name(),
+			tags:   in.Tags(),
+			fields: make(map[string]*counter),
+		}
+		d.cache[id] = s
+	}
+	s.lastSeen = d.now()
+
+	t := in.Time()
+	for _, field := range in.FieldList() {
+		if d.fieldFilter != nil && !d.fieldFilter.Match(field.Key) {
+			continue
+		}
+		fv, ok := convert(field.Value)
+		if !ok {
+			continue
+		}
+
+		c, ok := s.fields[field.Key]
+		if !ok {
+			// The first value is the reference of the next ones.
+			s.fields[field.Key] = &counter{value: fv, time: t, start: t}
+			continue
+		}
+		if !t.After(c.time) {
+			// Out of order or duplicate value.
+			continue
+		}
+		c.increase += d.increase(c.value, fv)
+		c.value = fv
+		c.time = t
+		c.updated = true
+	}
+}
+
+// increase returns the increase of a counter from prev to cur.
+func (d *Derivative) increase(prev, cur float64) float64 {
+	if cur >= prev {
+		return cur - prev
+	}
+	if d.CounterMax > 0 && prev <= float64(d.CounterMax) {
+		return float64(d.CounterMax) - prev + cur + 1
+	}
+	return cur
+}
+
+func (d *Derivative) Push(acc telex.Accumulator) {
+	for _, s := range d.cache {
+		fields := map[string]interface{}{}
+		for k, c := range s.fields {
+			if !c.updated {
+				continue
+			}
+			switch d.Mode {
+			case modeDelta:
+				fields[k+"_delta"] = c.increase
+			default:
+				elapsed := c.time.Sub(c.start).Seconds()
+				fields[k+"_rate"] = c.increase / elapsed
+			}
+			// The last value is the start of the next period.
+			c.start = c.time
+			c.increase = 0
+			c.updated = false
+		}
+
+		if len(fields) > 0 {
+			acc.AddFields(s.name, fields, s.tags)
+		}
+	}
+}
+
+// Reset keeps the last value of the counters for the next period and
+// forgets the stale series.
+func (d *Derivative) Reset() {
+	if d.StaleTimeout.Duration <= 0 {
+		return
+	}
+	now := d.now()
+	for id, s := range d.cache {
+		if now.Sub(s.lastSeen) >= d.StaleTimeout.Duration {
+			delete(d.cache, id)
+		}
+	}
+}
+
+func convert(in interface{}) (float64, bool) {
+	switch v := in.(type) {
+	case float64:
+		return v, true
+	case int64:
+		return float64(v), true
+	case uint64:
+		return float64(v), true
+	default:
+		return 0, false
+	}
+}
+
+func init() {
+	aggregators.Add("derivative", func() telex.Aggregator {
+		return NewDerivative()
+	})
+}
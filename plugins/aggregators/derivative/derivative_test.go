@@ -0,0 +1,165 @@
+package derivative
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/lavaorg/telex/internal"
+	"github.com/lavaorg/telex/testutil"
+)
+
+var start = time.Date(2019, time.May, 1, 12, 0, 0, 0, time.UTC)
+
+func add(d *Derivative, seconds int, fields map[string]interface{}) {
+	d.Add(testutil.MustMetric("net",
+		map[string]string{"interface": "eth0"},
+		fields,
+		start.Add(time.Duration(seconds)*time.Second),
+	))
+}
+
+func TestRate(t *testing.T) {
+	acc := testutil.Accumulator{}
+	d := NewDerivative()
+
+	add(d, 0, map[string]interface{}{"bytes_recv": uint64(100), "packets_recv": int64(10), "name": "eth0"})
+	add(d, 5, map[string]interface{}{"bytes_recv": uint64(600), "packets_recv": int64(15)})
+	add(d, 10, map[string]interface{}{"bytes_recv": uint64(1100), "packets_recv": int64(30)})
+	d.Push(&acc)
+
+	acc.AssertContainsTaggedFields(t, "net",
+		map[string]interface{}{
+			"bytes_recv_rate":   float64(100),
+			"packets_recv_rate": float64(2),
+		},
+		map[string]string{"interface": "eth0"},
+	)
+}
+
+func TestRateAcrossPeriods(t *testing.T) {
+	acc := testutil.Accumulator{}
+	d := NewDerivative()
+
+	// A single value is only the reference of the next period.
+	add(d, 0, map[string]interface{}{"bytes_recv": uint64(100)})
+	d.Push(&acc)
+	d.Reset()
+	require.Equal(t, uint64(0), acc.NMetrics())
+
+	add(d, 10, map[string]interface{}{"bytes_recv": uint64(300)})
+	d.Push(&acc)
+	d.Reset()
+	add(d, 20, map[string]interface{}{"bytes_recv": uint64(350)})
+	d.Push(&acc)
+	d.Reset()
+
+	// No new value, nothing to push.
+	d.Push(&acc)
+
+	require.Equal(t, uint64(2), acc.NMetrics())
+	require.Equal(t, float64(20), acc.Metrics[0].Fields["bytes_recv_rate"])
+	require.Equal(t, float64(5), acc.Metrics[1].Fields["bytes_recv_rate"])
+}
+
+func TestDelta(t *testing.T) {
+	acc := testutil.Accumulator{}
+	d := NewDerivative()
+	d.Mode = "delta"
+	require.NoError(t, d.Init())
+
+	add(d, 0, map[string]interface{}{"bytes_recv": uint64(100)})
+	add(d, 10, map[string]interface{}{"bytes_recv": uint64(250)})
+	d.Push(&acc)
+
+	acc.AssertContainsFields(t, "net", map[string]interface{}{"bytes_recv_delta": float64(150)})
+}
+
+func TestFields(t *testing.T) {
+	acc := testutil.Accumulator{}
+	d := NewDerivative()
+	d.Fields = []string{"bytes_*"}
+	require.NoError(t, d.Init())
+
+	add(d, 0, map[string]interface{}{"bytes_recv": uint64(100), "packets_recv": int64(10)})
+	add(d, 10, map[string]interface{}{"bytes_recv": uint64(200), "packets_recv": int64(20)})
+	d.Push(&acc)
+
+	acc.AssertContainsFields(t, "net", map[string]interface{}{"bytes_recv_rate": float64(10)})
+}
+
+func TestInvalidConfig(t *testing.T) {
+	d := NewDerivative()
+	d.Fields = []string{"bytes_["}
+	require.Error(t, d.Init())
+
+	d = NewDerivative()
+	d.Mode = "ratio"
+	require.Error(t, d.Init())
+}
+
+func TestCounterReset(t *testing.T) {
+	acc := testutil.Accumulator{}
+	d := NewDerivative()
+	d.Mode = "delta"
+	require.NoError(t, d.Init())
+
+	// The counter restarts from 0 and the new value is its increase.
+	add(d, 0, map[string]interface{}{"bytes_recv": uint64(1000)})
+	add(d, 10, map[string]interface{}{"bytes_recv": uint64(1200)})
+	add(d, 20, map[string]interface{}{"bytes_recv": uint64(50)})
+	add(d, 30, map[string]interface{}{"bytes_recv": uint64(100)})
+	d.Push(&acc)
+
+	acc.AssertContainsFields(t, "net", map[string]interface{}{"bytes_recv_delta": float64(300)})
+}
+
+func TestCounterWraparound(t *testing.T) {
+	acc := testutil.Accumulator{}
+	d := NewDerivative()
+	d.Mode = "delta"
+	d.CounterMax = 4294967295
+	require.NoError(t, d.Init())
+
+	add(d, 0, map[string]interface{}{"bytes_recv": uint64(4294967200)})
+	add(d, 10, map[string]interface{}{"bytes_recv": uint64(100)})
+	d.Push(&acc)
+
+	acc.AssertContainsFields(t, "net", map[string]interface{}{"bytes_recv_delta": float64(196)})
+}
+
+func TestOutOfOrder(t *testing.T) {
+	acc := testutil.Accumulator{}
+	d := NewDerivative()
+
+	add(d, 0, map[string]interface{}{"bytes_recv": uint64(100)})
+	add(d, 10, map[string]interface{}{"bytes_recv": uint64(200)})
+	add(d, 5, map[string]interface{}{"bytes_recv": uint64(150)})
+	add(d, 10, map[string]interface{}{"bytes_recv": uint64(200)})
+	d.Push(&acc)
+
+	acc.AssertContainsFields(t, "net", map[string]interface{}{"bytes_recv_rate": float64(10)})
+}
+
+func TestStaleSeries(t *testing.T) {
+	acc := testutil.Accumulator{}
+	now := start
+	d := NewDerivative()
+	d.StaleTimeout = internal.Duration{Duration: time.Minute}
+	d.now = func() time.Time { return now }
+
+	add(d, 0, map[string]interface{}{"bytes_recv": uint64(100)})
+	d.Push(&acc)
+	d.Reset()
+	require.Len(t, d.cache, 1)
+
+	now = now.Add(time.Minute)
+	d.Reset()
+	require.Len(t, d.cache, 0)
+
+	// The series starts again without the forgotten value.
+	add(d, 60, map[string]interface{}{"bytes_recv": uint64(200)})
+	d.Push(&acc)
+	require.Equal(t, uint64(0), acc.NMetrics())
+}
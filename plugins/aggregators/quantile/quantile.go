@@ -0,0 +1,175 @@
+package quantile
+
+import (
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"log"
+	"math"
+	"strconv"
+	"strings"
+
+	"github.com/lavaorg/telex"
+	"github.com/lavaorg/telex/plugins/aggregators"
+)
+
+// Quantile estimates the quantiles of each field with a t-digest.
+type Quantile struct {
+	Quantiles   []float64 `toml:"quantiles"`
+	Compression float64   `toml:"compression"`
+	EmitSketch  bool      `toml:"emit_sketch"`
+
+	cache    map[uint64]aggregate
+	suffixes []string
+}
+
+type aggregate struct {
+	name   string
+	tags   map[string]string
+	fields map[string]*tdigest
+}
+
+// NewQuantile creates a quantile aggregator with the default settings.
+func NewQuantile() *Quantile {
+	q := &Quantile{
+		Quantiles:   []float64{0.5, 0.95, 0.99},
+		Compression: 100,
+	}
+	q.Reset()
+	return q
+}
+
+var sampleConfig = `
+  ## General Aggregator Arguments:
+  ## The period on which to flush & clear the aggregator.
+  period = "30s"
+  ## If true, the original metric will be dropped by the
+  ## aggregator and will not get sent to the output plugins.
+  drop_original = false
+
+  ## Quantiles to output in the range [0,1]
+  ## Each one is pushed as the field <field>_p<percentile>, eg. load1_p99_9
+  ## for the quantile 0.999.
+  # quantiles = [0.5, 0.95, 0.99]
+
+  ## Compression of the t-digest, larger values are more accurate and use
+  ## more memory.  The digest keeps about 2 * compression centroids.
+  # compression = 100.0
+
+  ## If true, the serialized t-digest of each field is pushed as the base64
+  ## string field <field>_sketch so it can be merged downstream.
+  # emit_sketch = false
+`
+
+func (q *Quantile) SampleConfig() string {
+	return sampleConfig
+}
+
+func (q *Quantile) Description() string {
+	return "Keep the aggregate quantiles of each metric passing through."
+}
+
+func (q *Quantile) Add(in telex.Metric) {
+	id := in.HashID()
+	a, ok := q.cache[id]
+	if !ok {
+		a = aggregate{
+			name:   in.Name(),
+			tags:   in.Tags(),
+			fields: make(map[string]*tdigest),
+		}
+		q.cache[id] = a
+	}
+
+	for _, field := range in.FieldList() {
+		fv, ok := convert(field.Value)
+		if !ok {
+			continue
+		}
+		digest, ok := a.fields[field.Key]
+		if !ok {
+			digest = newTDigest(q.compression())
+			a.fields[field.Key] = digest
+		}
+		digest.Add(fv)
+	}
+}
+
+func (q *Quantile) Push(acc telex.Accumulator) {
+	for _, aggregate := range q.cache {
+		fields := map[string]interface{}{}
+		for k, digest := range aggregate.fields {
+			if digest.Count() == 0 {
+				continue
+			}
+			for i, quantile := range q.Quantiles {
+				fields[k+"_"+q.suffixes[i]] = digest.Quantile(quantile)
+			}
+			if q.EmitSketch {
+				data, err := digest.MarshalBinary()
+				if err != nil {
+					log.Printf("E! [aggregators.quantile] Unable to serialize %s: %v", k, err)
+					continue
+				}
+				fields[k+"_sketch"] = base64.StdEncoding.EncodeToString(data)
+			}
+		}
+
+		if len(fields) > 0 {
+			acc.AddFields(aggregate.name, fields, aggregate.tags)
+		}
+	}
+}
+
+func (q *Quantile) Reset() {
+	q.cache = make(map[uint64]aggregate)
+}
+
+func (q *Quantile) compression() float64 {
+	if q.Compression < 1 {
+		return 100
+	}
+	return q.Compression
+}
+
+// Init checks the quantiles and names their fields, so that an invalid
+// quantile fails the configuration.
+func (q *Quantile) Init() error {
+	if len(q.Quantiles) == 0 {
+		return errors.New("no quantiles set")
+	}
+	q.suffixes = make([]string, 0, len(q.Quantiles))
+	for _, quantile := range q.Quantiles {
+		if quantile < 0 || quantile > 1 || math.IsNaN(quantile) {
+			return fmt.Errorf("quantile %v is not in the range [0,1]", quantile)
+		}
+		q.suffixes = append(q.suffixes, suffix(quantile))
+	}
+	return nil
+}
+
+// suffix returns the field suffix of a quantile, the percentile with the
+// decimal point replaced by an underscore.
+func suffix(quantile float64) string {
+	percentile := math.Round(quantile*100*1e6) / 1e6
+	return "p" + strings.Replace(strconv.FormatFloat(percentile, 'f', -1, 64), ".", "_", 1)
+}
+
+func convert(in interface{}) (float64, bool) {
+	switch v := in.(type) {
+	case float64:
+		return v, true
+	case int64:
+		return float64(v), true
+	case uint64:
+		return float64(v), true
+	default:
+		return 0, false
+	}
+}
+
+func init() {
+	aggregators.Add("quantile", func() telex.Aggregator {
+		return NewQuantile()
+	})
+}
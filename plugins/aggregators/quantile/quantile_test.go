@@ -0,0 +1,185 @@
+package quantile
+
+import (
+	"encoding/base64"
+	"math"
+	"math/rand"
+	"sort"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/lavaorg/telex/testutil"
+)
+
+func TestQuantileDefault(t *testing.T) {
+	acc := testutil.Accumulator{}
+	q := NewQuantile()
+	require.NoError(t, q.Init())
+
+	for i := 1; i <= 20; i++ {
+		q.Add(testutil.MustMetric("m1",
+			map[string]string{"foo": "bar"},
+			map[string]interface{}{
+				"a":        int64(i),
+				"b":        uint64(2 * i),
+				"ignoreme": "string",
+			},
+			time.Now(),
+		))
+	}
+	q.Push(&acc)
+
+	// With few values every value is a centroid and the quantiles are
+	// interpolated between them.
+	acc.AssertContainsTaggedFields(t, "m1",
+		map[string]interface{}{
+			"a_p50": float64(10.5),
+			"a_p95": float64(19.5),
+			"a_p99": float64(20),
+			"b_p50": float64(21),
+			"b_p95": float64(39),
+			"b_p99": float64(40),
+		},
+		map[string]string{"foo": "bar"},
+	)
+}
+
+func TestQuantileConfigured(t *testing.T) {
+	acc := testutil.Accumulator{}
+	q := NewQuantile()
+	q.Quantiles = []float64{0, 0.75, 0.999, 1}
+	require.NoError(t, q.Init())
+
+	for _, v := range []float64{3, 1, 2} {
+		q.Add(testutil.MustMetric("m1", nil, map[string]interface{}{"a": v}, time.Now()))
+	}
+	q.Push(&acc)
+
+	acc.AssertContainsFields(t, "m1",
+		map[string]interface{}{
+			"a_p0":    float64(1),
+			"a_p75":   float64(2.75),
+			"a_p99_9": float64(3),
+			"a_p100":  float64(3),
+		},
+	)
+}
+
+func TestQuantileInvalid(t *testing.T) {
+	for _, quantiles := range [][]float64{nil, {0.5, 1.5}, {-0.1}, {math.NaN()}} {
+		q := NewQuantile()
+		q.Quantiles = quantiles
+		require.Error(t, q.Init(), "%v", quantiles)
+	}
+}
+
+func TestQuantileReset(t *testing.T) {
+	acc := testutil.Accumulator{}
+	q := NewQuantile()
+	require.NoError(t, q.Init())
+
+	q.Add(testutil.MustMetric("m1", nil, map[string]interface{}{"a": int64(1)}, time.Now()))
+	q.Push(&acc)
+	require.Equal(t, uint64(1), acc.NMetrics())
+
+	q.Reset()
+	q.Push(&acc)
+	require.Equal(t, uint64(1), acc.NMetrics())
+
+	q.Add(testutil.MustMetric("m1", nil, map[string]interface{}{"a": int64(4)}, time.Now()))
+	q.Push(&acc)
+	require.Equal(t, uint64(2), acc.NMetrics())
+	require.Equal(t, float64(4), acc.Metrics[1].Fields["a_p50"])
+}
+
+func TestQuantileEmitSketch(t *testing.T) {
+	acc := testutil.Accumulator{}
+	q := NewQuantile()
+	q.EmitSketch = true
+	require.NoError(t, q.Init())
+
+	for i := 0; i < 1000; i++ {
+		q.Add(testutil.MustMetric("m1", nil, map[string]interface{}{"a": float64(i)}, time.Now()))
+	}
+	q.Push(&acc)
+
+	require.Len(t, acc.Metrics, 1)
+	sketch, ok := acc.Metrics[0].Fields["a_sketch"].(string)
+	require.True(t, ok)
+	data, err := base64.StdEncoding.DecodeString(sketch)
+	require.NoError(t, err)
+
+	digest := &tdigest{}
+	require.NoError(t, digest.UnmarshalBinary(data))
+	require.Equal(t, float64(1000), digest.Count())
+	require.Equal(t, acc.Metrics[0].Fields["a_p50"], digest.Quantile(0.5))
+	require.Equal(t, acc.Metrics[0].Fields["a_p99"], digest.Quantile(0.99))
+}
+
+// TestTDigestAccuracy checks the estimated quantiles of a large uniform
+// sample are within the expected error, tighter at the tails.
+func TestTDigestAccuracy(t *testing.T) {
+	r := rand.New(rand.NewSource(1))
+	digest := newTDigest(100)
+	values := make([]float64, 100000)
+	for i := range values {
+		values[i] = r.Float64() * 1000
+		digest.Add(values[i])
+	}
+	sort.Float64s(values)
+
+	require.True(t, len(digest.centroids) < 300, "%d centroids", len(digest.centroids))
+	for _, q := range []float64{0.001, 0.01, 0.25, 0.5, 0.75, 0.99, 0.999} {
+		exact := values[int(q*float64(len(values)))]
+		tolerance := 1000 * (q*(1-q)/100 + 1e-3)
+		require.InDelta(t, exact, digest.Quantile(q), tolerance, "quantile %v", q)
+	}
+	require.Equal(t, values[0], digest.Quantile(0))
+	require.Equal(t, values[len(values)-1], digest.Quantile(1))
+}
+
+func TestTDigestMerge(t *testing.T) {
+	r := rand.New(rand.NewSource(2))
+	a, b, all := newTDigest(100), newTDigest(100), newTDigest(100)
+	for i := 0; i < 10000; i++ {
+		x := r.NormFloat64()
+		all.Add(x)
+		if i%2 == 0 {
+			a.Add(x)
+		} else {
+			b.Add(x)
+		}
+	}
+
+	data, err := b.MarshalBinary()
+	require.NoError(t, err)
+	decoded := &tdigest{}
+	require.NoError(t, decoded.UnmarshalBinary(data))
+	a.Merge(decoded)
+
+	require.Equal(t, all.Count(), a.Count())
+	for _, q := range []float64{0.01, 0.5, 0.99} {
+		require.InDelta(t, all.Quantile(q), a.Quantile(q), 0.02, "quantile %v", q)
+	}
+}
+
+func TestTDigestUnmarshalInvalid(t *testing.T) {
+	digest := &tdigest{}
+	require.Error(t, digest.UnmarshalBinary(nil))
+	require.Error(t, digest.UnmarshalBinary([]byte{2}))
+
+	data, err := newTDigest(100).MarshalBinary()
+	require.NoError(t, err)
+	require.NoError(t, digest.UnmarshalBinary(data))
+	require.Error(t, digest.UnmarshalBinary(append(data, 0)))
+}
+
+func BenchmarkAdd(b *testing.B) {
+	q := NewQuantile()
+	m := testutil.MustMetric("m1", nil, map[string]interface{}{"a": float64(1)}, time.Now())
+	for n := 0; n < b.N; n++ {
+		q.Add(m)
+	}
+}
@@ -0,0 +1,220 @@
+package quantile
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"math"
+	"sort"
+)
+
+// tdigestVersion is the first byte of a serialized digest.
+const tdigestVersion = 1
+
+// centroid is the mean of weight values close to each other.
+type centroid struct {
+	mean   float64
+	weight float64
+}
+
+// tdigest is a merging t-digest (Dunning, "Computing extremely accurate
+// quantiles using t-digests").  Values are buffered and merged into the
+// centroids when the buffer is full or a quantile is requested.  Two digests
+// with the same compression are merged by adding the centroids of one to the
+// other.
+type tdigest struct {
+	compression float64
+	centroids   []centroid
+	buffer      []centroid
+	min         float64
+	max         float64
+	total       float64
+}
+
+func newTDigest(compression float64) *tdigest {
+	return &tdigest{
+		compression: compression,
+		min:         math.Inf(1),
+		max:         math.Inf(-1),
+	}
+}
+
+// Add adds a single value to the digest.
+func (t *tdigest) Add(x float64) {
+	t.addCentroid(centroid{mean: x, weight: 1})
+}
+
+// Merge adds all the values summarized by other to the digest.
+func (t *tdigest) Merge(other *tdigest) {
+	other.compress()
+	for _, c := range other.centroids {
+		t.addCentroid(c)
+	}
+}
+
+func (t *tdigest) addCentroid(c centroid) {
+	if math.IsNaN(c.mean) || math.IsInf(c.mean, 0) || c.weight <= 0 {
+		return
+	}
+	if c.mean < t.min {
+		t.min = c.mean
+	}
+	if c.mean > t.max {
+		t.max = c.mean
+	}
+	t.buffer = append(t.buffer, c)
+	t.total += c.weight
+	if len(t.buffer) >= t.bufferSize() {
+		t.compress()
+	}
+}
+
+func (t *tdigest) bufferSize() int {
+	return int(5*t.compression) + 1
+}
+
+// Count returns the number of values added to the digest.
+func (t *tdigest) Count() float64 {
+	return t.total
+}
+
+// scale is the k1 scale function, which keeps the centroids small near the
+// tails so the extreme quantiles are the most accurate.
+func (t *tdigest) scale(q float64) float64 {
+	return t.compression / (2 * math.Pi) * math.Asin(2*q-1)
+}
+
+// compress merges the buffered values into the centroids.
+func (t *tdigest) compress() {
+	if len(t.buffer) == 0 {
+		return
+	}
+	all := append(t.centroids, t.buffer...)
+	sort.Slice(all, func(i, j int) bool { return all[i].mean < all[j].mean })
+
+	merged := make([]centroid, 0, len(t.centroids)+1)
+	cur := all[0]
+	cumulative := 0.0
+	kLow := t.scale(0)
+	for _, c := range all[1:] {
+		q := (cumulative + cur.weight + c.weight) / t.total
+		if t.scale(q)-kLow <= 1 {
+			cur.weight += c.weight
+			cur.mean += (c.mean - cur.mean) * c.weight / cur.weight
+			continue
+		}
+		cumulative += cur.weight
+		kLow = t.scale(cumulative / t.total)
+		merged = append(merged, cur)
+		cur = c
+	}
+	merged = append(merged, cur)
+
+	t.centroids = merged
+	t.buffer = t.buffer[:0]
+}
+
+// Quantile returns the estimated value at quantile q, between 0 and 1.
+func (t *tdigest) Quantile(q float64) float64 {
+	t.compress()
+	if len(t.centroids) == 0 || q < 0 || q > 1 {
+		return math.NaN()
+	}
+	if len(t.centroids) == 1 {
+		return t.centroids[0].mean
+	}
+
+	// Each centroid is centered on the middle of its weight, the minimum
+	// and maximum are at both ends.
+	index := q * t.total
+	first := t.centroids[0]
+	if index <= first.weight/2 {
+		return interpolate(index, 0, t.min, first.weight/2, first.mean)
+	}
+	last := t.centroids[len(t.centroids)-1]
+	if index >= t.total-last.weight/2 {
+		return interpolate(index, t.total-last.weight/2, last.mean, t.total, t.max)
+	}
+
+	cumulative := first.weight / 2
+	for i := 1; i < len(t.centroids); i++ {
+		prev, cur := t.centroids[i-1], t.centroids[i]
+		next := cumulative + (prev.weight+cur.weight)/2
+		if index <= next {
+			return interpolate(index, cumulative, prev.mean, next, cur.mean)
+		}
+		cumulative = next
+	}
+	return t.max
+}
+
+func interpolate(x, x0, y0, x1, y1 float64) float64 {
+	if x1 == x0 {
+		return y0
+	}
+	return y0 + (x-x0)*(y1-y0)/(x1-x0)
+}
+
+// MarshalBinary encodes the digest as the version byte, the compression,
+// the minimum, the maximum, the number of centroids and the mean and weight
+// of every centroid, all numbers little endian.
+func (t *tdigest) MarshalBinary() ([]byte, error) {
+	t.compress()
+	var buf bytes.Buffer
+	buf.WriteByte(tdigestVersion)
+	for _, v := range []float64{t.compression, t.min, t.max} {
+		binary.Write(&buf, binary.LittleEndian, v)
+	}
+	binary.Write(&buf, binary.LittleEndian, uint32(len(t.centroids)))
+	for _, c := range t.centroids {
+		binary.Write(&buf, binary.LittleEndian, c.mean)
+		binary.Write(&buf, binary.LittleEndian, c.weight)
+	}
+	return buf.Bytes(), nil
+}
+
+// UnmarshalBinary decodes a digest encoded by MarshalBinary.
+func (t *tdigest) UnmarshalBinary(data []byte) error {
+	r := bytes.NewReader(data)
+	version, err := r.ReadByte()
+	if err != nil {
+		return err
+	}
+	if version != tdigestVersion {
+		return errors.New("unsupported t-digest version")
+	}
+
+	var header struct {
+		Compression float64
+		Min         float64
+		Max         float64
+		Count       uint32
+	}
+	if err := binary.Read(r, binary.LittleEndian, &header); err != nil {
+		return err
+	}
+	// Each centroid is two float64.
+	if int64(header.Count)*16 != int64(r.Len()) {
+		return errors.New("invalid t-digest length")
+	}
+
+	centroids := make([]centroid, header.Count)
+	total := 0.0
+	for i := range centroids {
+		var c struct{ Mean, Weight float64 }
+		if err := binary.Read(r, binary.LittleEndian, &c); err != nil {
+			return err
+		}
+		centroids[i] = centroid{mean: c.Mean, weight: c.Weight}
+		total += c.Weight
+	}
+
+	*t = tdigest{
+		compression: header.Compression,
+		centroids:   centroids,
+		min:         header.Min,
+		max:         header.Max,
+		total:       total,
+	}
+	return nil
+}
@@ -9,6 +9,7 @@ import (
 	_ "github.com/lavaorg/telex/plugins/inputs/diskio"
 	_ "github.com/lavaorg/telex/plugins/inputs/dns_query"
 	_ "github.com/lavaorg/telex/plugins/inputs/exec"
+	_ "github.com/lavaorg/telex/plugins/inputs/execd"
 	_ "github.com/lavaorg/telex/plugins/inputs/file"
 	_ "github.com/lavaorg/telex/plugins/inputs/filecount"
 	_ "github.com/lavaorg/telex/plugins/inputs/filestat"
@@ -23,10 +24,12 @@ import (
 	_ "github.com/lavaorg/telex/plugins/inputs/linux_sysctl_fs"
 	_ "github.com/lavaorg/telex/plugins/inputs/logparser"
 	_ "github.com/lavaorg/telex/plugins/inputs/mem"
+	_ "github.com/lavaorg/telex/plugins/inputs/nats_consumer"
 	_ "github.com/lavaorg/telex/plugins/inputs/net"
 	_ "github.com/lavaorg/telex/plugins/inputs/net_response"
 	_ "github.com/lavaorg/telex/plugins/inputs/nstat"
 	//_ "github.com/lavaorg/telex/plugins/inputs/ping"
+	_ "github.com/lavaorg/telex/plugins/inputs/pressure"
 	_ "github.com/lavaorg/telex/plugins/inputs/processes"
 	_ "github.com/lavaorg/telex/plugins/inputs/procstat"
 	//_ "github.com/lavaorg/telex/plugins/inputs/sensors"
@@ -5,9 +5,17 @@ import (
 	"github.com/lavaorg/telex/plugins/inputs"
 )
 
+// Versions of the cgroup interface.
+const (
+	versionAuto = "auto"
+	versionV1   = "v1"
+	versionV2   = "v2"
+)
+
 type CGroup struct {
-	Paths []string `toml:"paths"`
-	Files []string `toml:"files"`
+	Paths   []string `toml:"paths"`
+	Files   []string `toml:"files"`
+	Version string   `toml:"version"`
 }
 
 var sampleConfig = `
@@ -23,6 +31,11 @@ var sampleConfig = `
   ## cgroup stat fields, as file names, globs are supported.
   ## these file names are appended to each path from above.
   # files = ["memory.*usage*", "memory.limit_in_bytes"]
+
+  ## Version of the cgroup interface of the files, "v1" or "v2" for the
+  ## unified hierarchy.  With "auto" the directories holding a
+  ## cgroup.controllers file are read as v2.
+  # version = "auto"
 `
 
 func (g *CGroup) SampleConfig() string {
@@ -34,5 +47,5 @@ func (g *CGroup) Description() string {
 }
 
 func init() {
-	inputs.Add("cgroup", func() telex.Input { return &CGroup{} })
+	inputs.Add("cgroup", func() telex.Input { return &CGroup{Version: versionAuto} })
 }
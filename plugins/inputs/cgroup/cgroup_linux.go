@@ -17,6 +17,12 @@ import (
 const metricName = "cgroup"
 
 func (g *CGroup) Gather(acc telex.Accumulator) error {
+	switch g.Version {
+	case "", versionAuto, versionV1, versionV2:
+	default:
+		return fmt.Errorf("invalid version %q", g.Version)
+	}
+
 	list := make(chan pathInfo)
 	go g.generateDirs(list)
 
@@ -35,6 +41,10 @@ func (g *CGroup) Gather(acc telex.Accumulator) error {
 
 func (g *CGroup) gatherDir(dir string, acc telex.Accumulator) error {
 	fields := make(map[string]interface{})
+	// devices holds the fields of the nested keyed files per device, like
+	// io.stat, of cgroup v2.
+	devices := make(map[string]map[string]interface{})
+	v2 := g.Version == versionV2 || g.Version != versionV1 && isUnified(dir)
 
 	list := make(chan pathInfo)
 	go g.generateFiles(dir, list)
@@ -52,6 +62,14 @@ func (g *CGroup) gatherDir(dir string, acc telex.Accumulator) error {
 			continue
 		}
 
+		if v2 {
+			err = parseV2(filepath.Base(file.path), raw, fields, devices)
+			if err != nil {
+				return fmt.Errorf("%v: %v", file.path, err)
+			}
+			continue
+		}
+
 		fd := fileData{data: raw, path: file.path}
 		if err := fd.parse(fields); err != nil {
 			return err
@@ -62,6 +80,13 @@ func (g *CGroup) gatherDir(dir string, acc telex.Accumulator) error {
 
 	acc.AddFields(metricName, fields, tags)
 
+	for device, fields := range devices {
+		acc.AddFields(metricName, fields, map[string]string{
+			"path":   dir,
+			"device": device,
+		})
+	}
+
 	return nil
 }
 
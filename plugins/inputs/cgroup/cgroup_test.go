@@ -3,6 +3,7 @@
 package cgroup
 
 import (
+	"math"
 	"testing"
 
 	"github.com/lavaorg/telex/testutil"
@@ -180,3 +181,213 @@ func TestCgroupStatistics_6(t *testing.T) {
 	}
 	acc.AssertContainsTaggedFields(t, "cgroup", fields, tags)
 }
+
+// ======================================================================
+
+func TestCgroupV2(t *testing.T) {
+	cg := &CGroup{
+		Paths: []string{"testdata/v2/system.slice/nginx.service"},
+		Files: []string{
+			"cpu.stat",
+			"cpu.max",
+			"memory.stat",
+			"memory.current",
+			"memory.max",
+			"io.stat",
+			"pids.current",
+			"*.pressure",
+		},
+		Version: "auto",
+	}
+
+	var acc testutil.Accumulator
+	require.NoError(t, acc.GatherError(cg.Gather))
+
+	path := "testdata/v2/system.slice/nginx.service"
+	acc.AssertContainsTaggedFields(t, "cgroup", map[string]interface{}{
+		"cpu.stat.usage_usec":                 int64(182937000),
+		"cpu.stat.user_usec":                  int64(120004000),
+		"cpu.stat.system_usec":                int64(62933000),
+		"cpu.stat.nr_periods":                 int64(1200),
+		"cpu.stat.nr_throttled":               int64(15),
+		"cpu.stat.throttled_usec":             int64(830000),
+		"cpu.max.0":                           int64(math.MaxInt64),
+		"cpu.max.1":                           int64(100000),
+		"memory.stat.anon":                    int64(10854400),
+		"memory.stat.file":                    int64(52379648),
+		"memory.stat.kernel_stack":            int64(98304),
+		"memory.stat.sock":                    int64(0),
+		"memory.stat.shmem":                   int64(0),
+		"memory.stat.file_mapped":             int64(8245248),
+		"memory.stat.file_dirty":              int64(4096),
+		"memory.stat.file_writeback":          int64(0),
+		"memory.stat.pgfault":                 int64(114597),
+		"memory.stat.pgmajfault":              int64(21),
+		"memory.stat.workingset_refault_anon": int64(0),
+		"memory.stat.workingset_refault_file": int64(42),
+		"memory.current":                      int64(67108864),
+		"memory.max":                          int64(math.MaxInt64),
+		"pids.current":                        int64(5),
+		"cpu.pressure.some.avg10":             2.04,
+		"cpu.pressure.some.avg60":             0.75,
+		"cpu.pressure.some.avg300":            0.40,
+		"cpu.pressure.some.total":             int64(157656722),
+		"cpu.pressure.full.avg10":             0.0,
+		"cpu.pressure.full.avg60":             0.0,
+		"cpu.pressure.full.avg300":            0.0,
+		"cpu.pressure.full.total":             int64(0),
+		"memory.pressure.some.avg10":          0.0,
+		"memory.pressure.some.avg60":          0.0,
+		"memory.pressure.some.avg300":         0.0,
+		"memory.pressure.some.total":          int64(0),
+		"memory.pressure.full.avg10":          0.0,
+		"memory.pressure.full.avg60":          0.0,
+		"memory.pressure.full.avg300":         0.0,
+		"memory.pressure.full.total":          int64(0),
+	}, map[string]string{"path": path})
+
+	for _, device := range []string{"8:0", "253:0"} {
+		acc.AssertContainsTaggedFields(t, "cgroup", map[string]interface{}{
+			"io.stat.rbytes": int64(5431296),
+			"io.stat.wbytes": int64(20480),
+			"io.stat.rios":   int64(312),
+			"io.stat.wios":   int64(5),
+			"io.stat.dbytes": int64(0),
+			"io.stat.dios":   int64(0),
+		}, map[string]string{"path": path, "device": device})
+	}
+	require.Len(t, acc.Metrics, 3)
+}
+
+func TestCgroupV2_Root(t *testing.T) {
+	cg := &CGroup{
+		Paths:   []string{"testdata/v2", "testdata/v2/system.slice/*"},
+		Files:   []string{"cpu.stat", "io.pressure", "memory.current", "pids.current"},
+		Version: "auto",
+	}
+
+	var acc testutil.Accumulator
+	require.NoError(t, acc.GatherError(cg.Gather))
+
+	acc.AssertContainsTaggedFields(t, "cgroup", map[string]interface{}{
+		"cpu.stat.usage_usec":     int64(4352717000),
+		"cpu.stat.user_usec":      int64(2763118000),
+		"cpu.stat.system_usec":    int64(1589599000),
+		"cpu.stat.nr_periods":     int64(0),
+		"cpu.stat.nr_throttled":   int64(0),
+		"cpu.stat.throttled_usec": int64(0),
+		"io.pressure.some.avg10":  0.10,
+		"io.pressure.some.avg60":  0.05,
+		"io.pressure.some.avg300": 0.01,
+		"io.pressure.some.total":  int64(98765),
+		"io.pressure.full.avg10":  0.0,
+		"io.pressure.full.avg60":  0.01,
+		"io.pressure.full.avg300": 0.0,
+		"io.pressure.full.total":  int64(4321),
+	}, map[string]string{"path": "testdata/v2"})
+
+	acc.AssertContainsTaggedFields(t, "cgroup", map[string]interface{}{
+		"memory.current": int64(4063232),
+		"pids.current":   int64(1),
+	}, map[string]string{"path": "testdata/v2/system.slice/sshd.service"})
+}
+
+func TestCgroupV2_Version(t *testing.T) {
+	// Read as v1 the flat keyed files parse, the pressure files do not.
+	cg := &CGroup{
+		Paths:   []string{"testdata/v2/system.slice/nginx.service"},
+		Files:   []string{"cpu.pressure"},
+		Version: "v1",
+	}
+	var acc testutil.Accumulator
+	require.Error(t, acc.GatherError(cg.Gather))
+
+	// The v1 fixtures have no cgroup.controllers file.
+	cg = &CGroup{
+		Paths:   []string{"testdata/memory"},
+		Files:   []string{"memory.limit_in_bytes"},
+		Version: "v2",
+	}
+	acc = testutil.Accumulator{}
+	require.NoError(t, acc.GatherError(cg.Gather))
+	acc.AssertContainsTaggedFields(t, "cgroup", map[string]interface{}{
+		"memory.limit_in_bytes": int64(223372036854771712),
+	}, map[string]string{"path": "testdata/memory"})
+
+	cg.Version = "v3"
+	require.Error(t, acc.GatherError(cg.Gather))
+}
+
+func TestParseV2(t *testing.T) {
+	tests := []struct {
+		name    string
+		file    string
+		data    string
+		fields  map[string]interface{}
+		devices map[string]map[string]interface{}
+	}{
+		{
+			name:   "single value",
+			file:   "memory.high",
+			data:   "268435456\n",
+			fields: map[string]interface{}{"memory.high": int64(268435456)},
+		},
+		{
+			name: "newline separated values",
+			file: "cgroup.procs",
+			data: "1234\n5678\n",
+			fields: map[string]interface{}{
+				"cgroup.procs.0": int64(1234),
+				"cgroup.procs.1": int64(5678),
+			},
+		},
+		{
+			name:   "single flat key",
+			file:   "memory.events.local",
+			data:   "oom_kill 2\n",
+			fields: map[string]interface{}{"memory.events.local.oom_kill": int64(2)},
+		},
+		{
+			name:   "string",
+			file:   "cpuset.cpus.effective",
+			data:   "0-3\n",
+			fields: map[string]interface{}{"cpuset.cpus.effective": "0-3"},
+		},
+		{
+			name:   "empty",
+			file:   "memory.empty",
+			data:   "",
+			fields: map[string]interface{}{},
+		},
+		{
+			name:   "nested keyed single device",
+			file:   "io.max",
+			data:   "8:16 rbps=2097152 wbps=max riops=max wiops=120\n",
+			fields: map[string]interface{}{},
+			devices: map[string]map[string]interface{}{
+				"8:16": {
+					"io.max.rbps":  int64(2097152),
+					"io.max.wbps":  int64(math.MaxInt64),
+					"io.max.riops": int64(math.MaxInt64),
+					"io.max.wiops": int64(120),
+				},
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			fields := map[string]interface{}{}
+			devices := map[string]map[string]interface{}{}
+			require.NoError(t, parseV2(tt.file, []byte(tt.data), fields, devices))
+			require.Equal(t, tt.fields, fields)
+			if tt.devices == nil {
+				tt.devices = map[string]map[string]interface{}{}
+			}
+			require.Equal(t, tt.devices, devices)
+		})
+	}
+
+	err := parseV2("cgroup.events", []byte("populated 1\nfrozen\n"), map[string]interface{}{},
+		map[string]map[string]interface{}{})
+	require.Error(t, err)
+}
@@ -0,0 +1,140 @@
+// +build linux
+
+package cgroup
+
+import (
+	"errors"
+	"math"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// deviceRe matches the "MAJ:MIN" device numbers keying the lines of files
+// like io.stat.
+var deviceRe = regexp.MustCompile(`^\d+:\d+$`)
+
+// isUnified returns true if the directory is a cgroup of the v2 unified
+// hierarchy, which has a cgroup.controllers file.
+func isUnified(dir string) bool {
+	_, err := os.Stat(filepath.Join(dir, "cgroup.controllers"))
+	return err == nil
+}
+
+// parseV2 parses a file of the cgroup v2 interface, in one of the formats of
+// the kernel documentation:
+//
+//	VAL\n                                     single value
+//	VAL0 VAL1 ...\n                           space separated values
+//	VAL0\n VAL1\n ...                         newline separated values
+//	KEY0 VAL0\n KEY1 VAL1\n ...               flat keyed, like cpu.stat
+//	KEY0 SUB0=VAL00 SUB1=VAL01 ...\n ...      nested keyed, like io.stat
+//
+// The lines of nested keyed files keyed by a device are added to the fields
+// of the device, the other keys are part of the field names like with
+// cpu.pressure.  The "max" values of limits are the largest int64.
+func parseV2(name string, data []byte, fields map[string]interface{},
+	devices map[string]map[string]interface{}) error {
+	var lines [][]string
+	for _, line := range strings.Split(string(data), "\n") {
+		if words := strings.Fields(line); len(words) > 0 {
+			lines = append(lines, words)
+		}
+	}
+	if len(lines) == 0 {
+		return nil
+	}
+
+	switch {
+	case len(lines) == 1:
+		words := lines[0]
+		if len(words) == 1 {
+			fields[name] = v2Value(words[0])
+			return nil
+		}
+		if len(words) == 2 && isKey(words[0]) && !isNested(lines) {
+			fields[name+"."+words[0]] = v2Value(words[1])
+			return nil
+		}
+		if !isNested(lines) {
+			for i, word := range words {
+				fields[name+"."+strconv.Itoa(i)] = v2Value(word)
+			}
+			return nil
+		}
+	case allLen(lines, 1):
+		for i, words := range lines {
+			fields[name+"."+strconv.Itoa(i)] = v2Value(words[0])
+		}
+		return nil
+	case allLen(lines, 2) && !isNested(lines):
+		for _, words := range lines {
+			fields[name+"."+words[0]] = v2Value(words[1])
+		}
+		return nil
+	}
+
+	if !isNested(lines) {
+		return errors.New("unknown file format")
+	}
+	for _, words := range lines {
+		key := words[0]
+		target, prefix := fields, name+"."+key+"."
+		if deviceRe.MatchString(key) {
+			if devices[key] == nil {
+				devices[key] = make(map[string]interface{})
+			}
+			target, prefix = devices[key], name+"."
+		}
+		for _, word := range words[1:] {
+			kv := strings.SplitN(word, "=", 2)
+			target[prefix+kv[0]] = v2Value(kv[1])
+		}
+	}
+	return nil
+}
+
+// isNested returns true if the values of the lines are SUB=VAL pairs.
+func isNested(lines [][]string) bool {
+	for _, words := range lines {
+		if len(words) < 2 {
+			return false
+		}
+		for _, word := range words[1:] {
+			if !strings.Contains(word, "=") {
+				return false
+			}
+		}
+	}
+	return true
+}
+
+// isKey returns true if the word is a key rather than a value.
+func isKey(word string) bool {
+	_, ok := v2Value(word).(string)
+	return ok
+}
+
+func allLen(lines [][]string, n int) bool {
+	for _, words := range lines {
+		if len(words) != n {
+			return false
+		}
+	}
+	return true
+}
+
+func v2Value(s string) interface{} {
+	if s == "max" {
+		return int64(math.MaxInt64)
+	}
+	if i, err := strconv.ParseInt(s, 10, 64); err == nil {
+		return i
+	}
+	if f, err := strconv.ParseFloat(s, 64); err == nil {
+		return f
+	}
+	return s
+}
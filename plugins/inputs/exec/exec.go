@@ -2,6 +2,7 @@ package exec
 
 import (
 	"bytes"
+	"context"
 	"fmt"
 	"os/exec"
 	"path/filepath"
@@ -56,13 +57,15 @@ func NewExec() *Exec {
 	}
 }
 
+// Runner runs a command, it is killed once ctx is done.
 type Runner interface {
-	Run(*Exec, string, telex.Accumulator) ([]byte, error)
+	Run(context.Context, *Exec, string, telex.Accumulator) ([]byte, error)
 }
 
 type CommandRunner struct{}
 
 func (c CommandRunner) Run(
+	ctx context.Context,
 	e *Exec,
 	command string,
 	acc telex.Accumulator,
@@ -72,7 +75,7 @@ func (c CommandRunner) Run(
 		return nil, fmt.Errorf("exec: unable to parse command, %s", err)
 	}
 
-	cmd := exec.Command(split_cmd[0], split_cmd[1:]...)
+	cmd := exec.CommandContext(ctx, split_cmd[0], split_cmd[1:]...)
 
 	var (
 		out    bytes.Buffer
@@ -82,6 +85,9 @@ func (c CommandRunner) Run(
 	cmd.Stderr = &stderr
 
 	if err := internal.RunTimeout(cmd, e.Timeout.Duration); err != nil {
+		if ctx.Err() != nil {
+			err = ctx.Err()
+		}
 		var errMessage = ""
 		if stderr.Len() > 0 {
 			stderr = removeCarriageReturns(stderr)
@@ -137,10 +143,10 @@ func removeCarriageReturns(b bytes.Buffer) bytes.Buffer {
 
 }
 
-func (e *Exec) ProcessCommand(command string, acc telex.Accumulator, wg *sync.WaitGroup) {
+func (e *Exec) ProcessCommand(ctx context.Context, command string, acc telex.Accumulator, wg *sync.WaitGroup) {
 	defer wg.Done()
 
-	out, err := e.runner.Run(e, command, acc)
+	out, err := e.runner.Run(ctx, e, command, acc)
 	if err != nil {
 		acc.AddError(err)
 		return
@@ -169,6 +175,11 @@ func (e *Exec) SetParser(parser parsers.Parser) {
 }
 
 func (e *Exec) Gather(acc telex.Accumulator) error {
+	return e.GatherContext(context.Background(), acc)
+}
+
+// GatherContext runs the commands, they are killed once ctx is done.
+func (e *Exec) GatherContext(ctx context.Context, acc telex.Accumulator) error {
 	var wg sync.WaitGroup
 	// Legacy single command support
 	if e.Command != "" {
@@ -209,7 +220,7 @@ func (e *Exec) Gather(acc telex.Accumulator) error {
 
 	wg.Add(len(commands))
 	for _, command := range commands {
-		go e.ProcessCommand(command, acc, &wg)
+		go e.ProcessCommand(ctx, command, acc, &wg)
 	}
 	wg.Wait()
 	return nil
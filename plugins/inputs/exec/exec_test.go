@@ -2,9 +2,11 @@ package exec
 
 import (
 	"bytes"
+	"context"
 	"fmt"
 	"runtime"
 	"testing"
+	"time"
 
 	"github.com/lavaorg/telex"
 	"github.com/lavaorg/telex/plugins/parsers"
@@ -85,7 +87,7 @@ func newRunnerMock(out []byte, err error) Runner {
 	}
 }
 
-func (r runnerMock) Run(e *Exec, command string, acc telex.Accumulator) ([]byte, error) {
+func (r runnerMock) Run(ctx context.Context, e *Exec, command string, acc telex.Accumulator) ([]byte, error) {
 	if r.err != nil {
 		return nil, r.err
 	}
@@ -201,6 +203,26 @@ func TestExecCommandWithoutGlobAndPath(t *testing.T) {
 	acc.AssertContainsFields(t, "metric", fields)
 }
 
+func TestExecGatherContext(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("sleep is not available")
+	}
+	parser, _ := parsers.NewValueParser("metric", "string", nil)
+	e := NewExec()
+	e.Commands = []string{"sleep 10"}
+	e.SetParser(parser)
+
+	// The command is killed once the context is done, before its timeout.
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	start := time.Now()
+	var acc testutil.Accumulator
+	require.NoError(t, e.GatherContext(ctx, &acc))
+	require.True(t, time.Since(start) < 5*time.Second)
+	require.Len(t, acc.Errors, 1)
+	require.Contains(t, acc.Errors[0].Error(), context.DeadlineExceeded.Error())
+}
+
 func TestRemoveCarriageReturns(t *testing.T) {
 	if runtime.GOOS == "windows" {
 		// Test that all carriage returns are removed
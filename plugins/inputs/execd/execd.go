@@ -0,0 +1,206 @@
+package execd
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"io"
+	"time"
+
+	"github.com/lavaorg/telex"
+	"github.com/lavaorg/telex/internal"
+	"github.com/lavaorg/telex/internal/process"
+	"github.com/lavaorg/telex/plugins/inputs"
+	"github.com/lavaorg/telex/plugins/parsers"
+	"github.com/lavaorg/telex/plugins/parsers/influx"
+	"github.com/lavaorg/telex/shim"
+)
+
+const sampleConfig = `
+  ## Program to run, and its arguments.
+  command = ["/usr/bin/mycollector", "--foo=bar"]
+
+  ## Environment variables added to the environment of the program, in the
+  ## form "key=value".
+  # environment = ["LD_LIBRARY_PATH=/opt/lib"]
+
+  ## How the program is asked for a sample every interval:
+  ##   "none"    - the program writes samples on its own
+  ##   "STDIN"   - a newline is written to its stdin
+  ##   "SIGHUP", "SIGUSR1" or "SIGUSR2" - the signal is sent to it
+  signal = "none"
+
+  ## How the output of the program is split before parsing:
+  ##   "line"  - every line is parsed on its own
+  ##   "chunk" - blocks of lines ended by an empty line are parsed, for
+  ##             data formats spanning several lines like json
+  # parse_mode = "line"
+
+  ## Delay before the program is restarted once it exits, doubled on each
+  ## restart up to max_restart_delay.  The delay is reset once the program
+  ## ran for max_restart_delay.
+  # restart_delay = "10s"
+  # max_restart_delay = "5m"
+
+  ## Data format to consume.
+  ## Each data format has its own unique set of configuration options, read
+  ## more about them here:
+  ## https://github.com/lavaorg/telex/blob/master/docs/DATA_FORMATS_INPUT.md
+  data_format = "influx"
+`
+
+const (
+	signalNone  = "none"
+	signalStdin = "STDIN"
+
+	parseModeLine  = "line"
+	parseModeChunk = "chunk"
+
+	// maxChunkSize is the size of the longest line or chunk read.
+	maxChunkSize = 1024 * 1024
+)
+
+type Execd struct {
+	Command         []string          `toml:"command"`
+	Environment     []string          `toml:"environment"`
+	Signal          string            `toml:"signal"`
+	ParseMode       string            `toml:"parse_mode"`
+	RestartDelay    internal.Duration `toml:"restart_delay"`
+	MaxRestartDelay internal.Duration `toml:"max_restart_delay"`
+
+	parser  parsers.Parser
+	acc     telex.Accumulator
+	process *process.Process
+}
+
+func NewExecd() *Execd {
+	return &Execd{
+		Signal:          signalNone,
+		ParseMode:       parseModeLine,
+		RestartDelay:    internal.Duration{Duration: 10 * time.Second},
+		MaxRestartDelay: internal.Duration{Duration: 5 * time.Minute},
+	}
+}
+
+func (e *Execd) SampleConfig() string {
+	return sampleConfig
+}
+
+func (e *Execd) Description() string {
+	return "Run a long running program, and parse the metrics it writes to stdout"
+}
+
+func (e *Execd) SetParser(parser parsers.Parser) {
+	e.parser = parser
+}
+
+func (e *Execd) Start(acc telex.Accumulator) error {
+	if len(e.Command) == 0 {
+		return fmt.Errorf("command is required")
+	}
+	if e.Signal != signalNone && e.Signal != signalStdin {
+		if _, ok := signals[e.Signal]; !ok {
+			return fmt.Errorf("invalid signal %q", e.Signal)
+		}
+	}
+	if e.ParseMode != parseModeLine && e.ParseMode != parseModeChunk {
+		return fmt.Errorf("invalid parse_mode %q", e.ParseMode)
+	}
+	if e.parser == nil {
+		return fmt.Errorf("no parser, set data_format")
+	}
+
+	e.acc = acc
+	e.process = process.New("inputs.execd", e.Command)
+	e.process.Stdin = e.Signal == signalStdin
+	e.process.Env = e.Environment
+	e.process.RestartDelay = e.RestartDelay.Duration
+	e.process.MaxRestartDelay = e.MaxRestartDelay.Duration
+	e.process.ReadStdout = e.readStdout
+	e.process.OnError = acc.AddError
+	return e.process.Start()
+}
+
+// Gather asks the program for a sample, it does nothing if signal is "none"
+// or the program is being restarted.
+func (e *Execd) Gather(acc telex.Accumulator) error {
+	switch e.Signal {
+	case signalNone:
+		return nil
+	case signalStdin:
+		err := e.process.Write([]byte("\n"))
+		if err == process.ErrNotRunning {
+			return nil
+		}
+		return err
+	default:
+		return e.process.Signal(signals[e.Signal])
+	}
+}
+
+func (e *Execd) Stop() {
+	e.process.Stop()
+}
+
+func (e *Execd) readStdout(r io.Reader) {
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(make([]byte, 64*1024), maxChunkSize)
+	if e.ParseMode == parseModeChunk {
+		scanner.Split(scanChunks)
+	}
+
+	for scanner.Scan() {
+		data := bytes.TrimRight(scanner.Bytes(), "\r\n")
+		if len(data) == 0 {
+			continue
+		}
+
+		metrics, err := e.parser.Parse(data)
+		if err != nil {
+			e.acc.AddError(fmt.Errorf("parse error: %v", err))
+			continue
+		}
+		for _, m := range metrics {
+			e.acc.AddMetric(m)
+		}
+	}
+	if err := scanner.Err(); err != nil && err != io.EOF {
+		e.acc.AddError(fmt.Errorf("error reading stdout: %v", err))
+	}
+}
+
+// scanChunks is a bufio.SplitFunc returning blocks of lines separated by an
+// empty line.
+func scanChunks(data []byte, atEOF bool) (advance int, token []byte, err error) {
+	for i := range data {
+		if data[i] != '\n' {
+			continue
+		}
+		j := i + 1
+		if j < len(data) && data[j] == '\r' {
+			j++
+		}
+		if j < len(data) && data[j] == '\n' {
+			return j + 1, data[:i+1], nil
+		}
+	}
+	if atEOF && len(data) > 0 {
+		return len(data), data, nil
+	}
+	return 0, nil, nil
+}
+
+func init() {
+	inputs.Add("execd", func() telex.Input {
+		return NewExecd()
+	})
+	// An external input gathers each time a line is written to its stdin.
+	inputs.AddExternal(func(path, config string) telex.Input {
+		e := NewExecd()
+		e.Command = []string{path}
+		e.Environment = []string{shim.ConfigEnv + "=" + config}
+		e.Signal = signalStdin
+		e.SetParser(influx.NewParser(influx.NewMetricHandler()))
+		return e
+	})
+}
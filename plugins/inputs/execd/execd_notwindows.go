@@ -0,0 +1,15 @@
+// +build !windows
+
+package execd
+
+import (
+	"os"
+	"syscall"
+)
+
+// signals are the signals that can be sent to the program.
+var signals = map[string]os.Signal{
+	"SIGHUP":  syscall.SIGHUP,
+	"SIGUSR1": syscall.SIGUSR1,
+	"SIGUSR2": syscall.SIGUSR2,
+}
@@ -0,0 +1,213 @@
+// +build !windows
+
+package execd
+
+import (
+	"bytes"
+	"log"
+	"os"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/lavaorg/telex/internal"
+	"github.com/lavaorg/telex/plugins/parsers"
+	"github.com/lavaorg/telex/testutil"
+	"github.com/stretchr/testify/require"
+)
+
+func newTestExecd(t *testing.T, format string, script string) *Execd {
+	parser, err := parsers.NewParser(&parsers.Config{
+		DataFormat: format,
+		MetricName: "execd",
+	})
+	require.NoError(t, err)
+
+	e := NewExecd()
+	e.Command = []string{"sh", "-c", script}
+	e.RestartDelay = internal.Duration{Duration: 10 * time.Millisecond}
+	e.MaxRestartDelay = internal.Duration{Duration: 40 * time.Millisecond}
+	e.SetParser(parser)
+	return e
+}
+
+func values(acc *testutil.Accumulator) []int64 {
+	acc.Lock()
+	defer acc.Unlock()
+	var values []int64
+	for _, m := range acc.Metrics {
+		values = append(values, m.Fields["value"].(int64))
+	}
+	return values
+}
+
+func TestExecd_Streams(t *testing.T) {
+	e := newTestExecd(t, "influx",
+		"echo 'cpu value=1i'; echo 'cpu value=2i'; exec sleep 10")
+
+	acc := &testutil.Accumulator{}
+	require.NoError(t, e.Start(acc))
+	defer e.Stop()
+
+	acc.Wait(2)
+	require.Equal(t, []int64{1, 2}, values(acc))
+	require.Empty(t, acc.Errors)
+}
+
+func TestExecd_SignalStdin(t *testing.T) {
+	e := newTestExecd(t, "influx",
+		"i=0; while read line; do i=$((i+1)); echo \"cpu value=${i}i\"; done")
+	e.Signal = "STDIN"
+
+	acc := &testutil.Accumulator{}
+	require.NoError(t, e.Start(acc))
+	defer e.Stop()
+
+	waitRunning(t, e)
+	require.NoError(t, e.Gather(acc))
+	acc.Wait(1)
+	require.NoError(t, e.Gather(acc))
+	acc.Wait(2)
+	require.Equal(t, []int64{1, 2}, values(acc))
+}
+
+func TestExecd_SignalUSR1(t *testing.T) {
+	e := newTestExecd(t, "influx",
+		"trap 'echo cpu value=1i' USR1; echo 'cpu value=0i'; "+
+			"while true; do sleep 0.01; done")
+	e.Signal = "SIGUSR1"
+
+	acc := &testutil.Accumulator{}
+	require.NoError(t, e.Start(acc))
+	defer e.Stop()
+
+	// The trap is set once the first sample is written.
+	acc.Wait(1)
+	require.NoError(t, e.Gather(acc))
+	acc.Wait(2)
+	require.Equal(t, []int64{0, 1}, values(acc))
+}
+
+func TestExecd_Restarts(t *testing.T) {
+	e := newTestExecd(t, "influx", "echo 'cpu value=1i'; exit 3")
+
+	acc := &testutil.Accumulator{}
+	require.NoError(t, e.Start(acc))
+	defer e.Stop()
+
+	acc.Wait(3)
+	acc.WaitError(1)
+	require.EqualError(t, acc.FirstError(), "sh exited: exit status 3")
+}
+
+func TestExecd_ParseModeChunk(t *testing.T) {
+	e := newTestExecd(t, "json",
+		"printf '{\"value\": 1,\\n \"other\": 2}\\n\\n{\"value\": 3}\\n\\n'; exec sleep 10")
+	e.ParseMode = "chunk"
+
+	acc := &testutil.Accumulator{}
+	require.NoError(t, e.Start(acc))
+	defer e.Stop()
+
+	acc.Wait(2)
+	require.Equal(t, map[string]interface{}{
+		"value": float64(1),
+		"other": float64(2),
+	}, acc.Metrics[0].Fields)
+	require.Equal(t, map[string]interface{}{
+		"value": float64(3),
+	}, acc.Metrics[1].Fields)
+}
+
+func TestExecd_ParseError(t *testing.T) {
+	e := newTestExecd(t, "influx", "echo 'not line protocol'; exec sleep 10")
+
+	acc := &testutil.Accumulator{}
+	require.NoError(t, e.Start(acc))
+	defer e.Stop()
+
+	acc.WaitError(1)
+	require.Contains(t, acc.FirstError().Error(), "parse error")
+}
+
+type syncBuffer struct {
+	sync.Mutex
+	bytes.Buffer
+}
+
+func (b *syncBuffer) Write(p []byte) (int, error) {
+	b.Lock()
+	defer b.Unlock()
+	return b.Buffer.Write(p)
+}
+
+func (b *syncBuffer) String() string {
+	b.Lock()
+	defer b.Unlock()
+	return b.Buffer.String()
+}
+
+func TestExecd_LogsStderr(t *testing.T) {
+	buf := &syncBuffer{}
+	log.SetOutput(buf)
+	defer log.SetOutput(os.Stderr)
+
+	e := newTestExecd(t, "influx", "echo 'warming up' >&2; exec sleep 10")
+
+	acc := &testutil.Accumulator{}
+	require.NoError(t, e.Start(acc))
+	defer e.Stop()
+
+	deadline := time.Now().Add(5 * time.Second)
+	for !bytes.Contains([]byte(buf.String()), []byte("E! [inputs.execd] sh: warming up")) {
+		if time.Now().After(deadline) {
+			t.Fatalf("stderr not logged: %q", buf.String())
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
+
+func TestExecd_InvalidConfig(t *testing.T) {
+	e := newTestExecd(t, "influx", "true")
+	e.Signal = "SIGKILL"
+	require.EqualError(t, e.Start(&testutil.Accumulator{}), `invalid signal "SIGKILL"`)
+
+	e = newTestExecd(t, "influx", "true")
+	e.ParseMode = "word"
+	require.EqualError(t, e.Start(&testutil.Accumulator{}), `invalid parse_mode "word"`)
+
+	e = NewExecd()
+	require.EqualError(t, e.Start(&testutil.Accumulator{}), "command is required")
+}
+
+func TestScanChunks(t *testing.T) {
+	advance, token, err := scanChunks([]byte("a\nb\n\nc"), false)
+	require.NoError(t, err)
+	require.Equal(t, 5, advance)
+	require.Equal(t, "a\nb\n", string(token))
+
+	advance, token, err = scanChunks([]byte("a\r\n\r\nb"), false)
+	require.NoError(t, err)
+	require.Equal(t, 5, advance)
+	require.Equal(t, "a\r\n", string(token))
+
+	advance, token, err = scanChunks([]byte("c"), false)
+	require.NoError(t, err)
+	require.Equal(t, 0, advance)
+	require.Nil(t, token)
+
+	advance, token, err = scanChunks([]byte("c"), true)
+	require.NoError(t, err)
+	require.Equal(t, 1, advance)
+	require.Equal(t, "c", string(token))
+}
+
+func waitRunning(t *testing.T, e *Execd) {
+	deadline := time.Now().Add(5 * time.Second)
+	for !e.process.Running() {
+		if time.Now().After(deadline) {
+			t.Fatal("program not started")
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
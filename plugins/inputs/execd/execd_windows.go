@@ -0,0 +1,9 @@
+// +build windows
+
+package execd
+
+import "os"
+
+// signals are the signals that can be sent to the program, only "STDIN" is
+// supported on Windows.
+var signals = map[string]os.Signal{}
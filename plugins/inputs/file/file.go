@@ -54,7 +54,7 @@ func (f *File) Gather(acc telex.Accumulator) error {
 		}
 
 		for _, m := range metrics {
-			acc.AddFields(m.Name(), m.Fields(), m.Tags(), m.Time())
+			acc.AddMetric(m)
 		}
 	}
 	return nil
@@ -196,7 +196,7 @@ func (h *HTTP) gatherURL(
 		if !metric.HasTag("url") {
 			metric.AddTag("url", url)
 		}
-		acc.AddFields(metric.Name(), metric.Fields(), metric.Tags(), metric.Time())
+		acc.AddMetric(metric)
 	}
 
 	return nil
@@ -49,6 +49,32 @@ func TestHTTPwithJSONFormat(t *testing.T) {
 	require.Equal(t, acc.Metrics[0].Tags["url"], url)
 }
 
+func TestHTTPwithPrometheusFormat(t *testing.T) {
+	fakeServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_, _ = w.Write([]byte("# TYPE http_requests_total counter\n" +
+			"http_requests_total{code=\"200\"} 1027\n"))
+	}))
+	defer fakeServer.Close()
+
+	url := fakeServer.URL + "/metrics"
+	plugin := &plugin.HTTP{
+		URLs: []string{url},
+	}
+
+	p, err := parsers.NewParser(&parsers.Config{
+		DataFormat: "prometheus",
+	})
+	require.NoError(t, err)
+	plugin.SetParser(p)
+
+	var acc testutil.Accumulator
+	require.NoError(t, acc.GatherError(plugin.Gather))
+
+	acc.AssertContainsTaggedFields(t, "http_requests_total",
+		map[string]interface{}{"value": 1027.0},
+		map[string]string{"code": "200", "url": url})
+}
+
 func TestHTTPHeaders(t *testing.T) {
 	header := "X-Special-Header"
 	headerValue := "Special-Value"
@@ -0,0 +1,291 @@
+package nats_consumer
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"sync"
+
+	nats "github.com/nats-io/go-nats"
+
+	"github.com/lavaorg/telex"
+	"github.com/lavaorg/telex/internal/tls"
+	"github.com/lavaorg/telex/plugins/inputs"
+	"github.com/lavaorg/telex/plugins/parsers"
+)
+
+const defaultMaxUndeliveredMessages = 1000
+
+type empty struct{}
+type semaphore chan empty
+
+type natsError struct {
+	conn *nats.Conn
+	sub  *nats.Subscription
+	err  error
+}
+
+func (e natsError) Error() string {
+	if e.sub == nil {
+		return fmt.Sprintf("%s url:%s id:%s",
+			e.err.Error(), e.conn.ConnectedUrl(), e.conn.ConnectedServerId())
+	}
+	return fmt.Sprintf("%s url:%s id:%s sub:%s queue:%s",
+		e.err.Error(), e.conn.ConnectedUrl(), e.conn.ConnectedServerId(), e.sub.Subject, e.sub.Queue)
+}
+
+type natsConsumer struct {
+	QueueGroup string   `toml:"queue_group"`
+	Subjects   []string `toml:"subjects"`
+	Servers    []string `toml:"servers"`
+	Username   string   `toml:"username"`
+	Password   string   `toml:"password"`
+	tls.ClientConfig
+
+	// Client pending limits:
+	PendingMessageLimit int `toml:"pending_message_limit"`
+	PendingBytesLimit   int `toml:"pending_bytes_limit"`
+
+	MaxUndeliveredMessages int `toml:"max_undelivered_messages"`
+
+	conn *nats.Conn
+	subs []*nats.Subscription
+
+	parser parsers.Parser
+	// channel for all incoming NATS messages
+	in chan *nats.Msg
+	// channel for all NATS read errors
+	errs chan error
+	// closed when stopping to release the subscription handlers
+	done   chan struct{}
+	acc    telex.TrackingAccumulator
+	wg     sync.WaitGroup
+	cancel context.CancelFunc
+}
+
+var sampleConfig = `
+  ## urls of NATS servers
+  servers = ["nats://localhost:4222"]
+  ## Optional credentials
+  # username = ""
+  # password = ""
+  ## subject(s) to consume
+  subjects = ["telex"]
+  ## name a queue group
+  queue_group = "telex_consumers"
+
+  ## Optional TLS Config
+  # tls_ca = "/etc/telex/ca.pem"
+  # tls_cert = "/etc/telex/cert.pem"
+  # tls_key = "/etc/telex/key.pem"
+  ## Use TLS but skip chain & host verification
+  # insecure_skip_verify = false
+
+  ## Sets the limits for pending msgs and bytes for each subscription
+  ## These shouldn't need to be adjusted except in very high throughput scenarios
+  # pending_message_limit = 65536
+  # pending_bytes_limit = 67108864
+
+  ## Maximum messages to read from the broker that have not been written by an
+  ## output.  For best throughput set based on the number of metrics within
+  ## each message and the size of the output's metric_batch_size.
+  ##
+  ## For example, if each message from the queue contains 10 metrics and the
+  ## output metric_batch_size is 1000, setting this to 100 will ensure that a
+  ## full batch is collected and the write is triggered immediately without
+  ## waiting until the next flush_interval.
+  # max_undelivered_messages = 1000
+
+  ## Data format to consume.
+  ## Each data format has its own unique set of configuration options, read
+  ## more about them here:
+  ## https://github.com/lavaorg/telex/blob/master/docs/DATA_FORMATS_INPUT.md
+  data_format = "influx"
+`
+
+func (n *natsConsumer) SampleConfig() string {
+	return sampleConfig
+}
+
+func (n *natsConsumer) Description() string {
+	return "Read metrics from NATS subject(s)"
+}
+
+func (n *natsConsumer) SetParser(parser parsers.Parser) {
+	n.parser = parser
+}
+
+func (n *natsConsumer) natsErrHandler(c *nats.Conn, s *nats.Subscription, e error) {
+	select {
+	case n.errs <- natsError{conn: c, sub: s, err: e}:
+	default:
+		return
+	}
+}
+
+// Start the nats consumer. Caller must call *natsConsumer.Stop() to clean up.
+func (n *natsConsumer) Start(acc telex.Accumulator) error {
+	n.acc = acc.WithTracking(n.MaxUndeliveredMessages)
+
+	// set default NATS connection options
+	opts := nats.DefaultOptions
+
+	// override max reconnection tries
+	opts.MaxReconnect = -1
+
+	// override servers if any were specified
+	opts.Servers = n.Servers
+
+	// override authentication, if any was specified
+	if n.Username != "" {
+		opts.User = n.Username
+		opts.Password = n.Password
+	}
+
+	// override TLS, if it was specified
+	tlsConfig, err := n.ClientConfig.TLSConfig()
+	if err != nil {
+		return err
+	}
+	if tlsConfig != nil {
+		opts.Secure = true
+		opts.TLSConfig = tlsConfig
+	}
+
+	opts.AsyncErrorCB = n.natsErrHandler
+
+	// Setup message and error channels
+	n.errs = make(chan error)
+	n.in = make(chan *nats.Msg, 1000)
+	n.done = make(chan struct{})
+
+	n.conn, err = opts.Connect()
+	if err != nil {
+		return err
+	}
+
+	for _, subj := range n.Subjects {
+		sub, err := n.conn.QueueSubscribe(subj, n.QueueGroup, n.handle)
+		if err != nil {
+			n.clean()
+			return err
+		}
+		n.subs = append(n.subs, sub)
+
+		// set the subscription pending limits
+		if err = sub.SetPendingLimits(n.PendingMessageLimit, n.PendingBytesLimit); err != nil {
+			n.clean()
+			return err
+		}
+	}
+
+	// ensure that the subscriptions have been processed by the server
+	if err = n.conn.Flush(); err != nil {
+		n.clean()
+		return err
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	n.cancel = cancel
+
+	// Start the message reader
+	n.wg.Add(1)
+	go func() {
+		defer n.wg.Done()
+		n.receiver(ctx)
+	}()
+
+	log.Printf("I! [inputs.nats_consumer] Started the NATS consumer service, nats: %v, subjects: %v, queue: %v",
+		n.conn.ConnectedUrl(), n.Subjects, n.QueueGroup)
+
+	return nil
+}
+
+// handle passes a message to the receiver; messages wait in the pending
+// queue of the subscription while the receiver is busy.
+func (n *natsConsumer) handle(msg *nats.Msg) {
+	select {
+	case n.in <- msg:
+	case <-n.done:
+	}
+}
+
+// receiver() reads all incoming messages from NATS, and parses them into
+// telex metrics.  At most max_undelivered_messages are read before waiting
+// for the outputs to write some of them.
+func (n *natsConsumer) receiver(ctx context.Context) {
+	sem := make(semaphore, n.MaxUndeliveredMessages)
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-n.acc.Delivered():
+			<-sem
+		case err := <-n.errs:
+			n.acc.AddError(err)
+		case sem <- empty{}:
+			select {
+			case <-ctx.Done():
+				return
+			case err := <-n.errs:
+				<-sem
+				n.acc.AddError(err)
+			case <-n.acc.Delivered():
+				<-sem
+				<-sem
+			case msg := <-n.in:
+				metrics, err := n.parser.Parse(msg.Data)
+				if err != nil {
+					n.acc.AddError(fmt.Errorf("subject: %s, error: %s", msg.Subject, err.Error()))
+					<-sem
+					continue
+				}
+				if len(metrics) == 0 {
+					<-sem
+					continue
+				}
+
+				n.acc.AddTrackingMetricGroup(metrics)
+			}
+		}
+	}
+}
+
+func (n *natsConsumer) clean() {
+	for _, sub := range n.subs {
+		if err := sub.Unsubscribe(); err != nil {
+			n.acc.AddError(fmt.Errorf("error unsubscribing from subject %s in queue %s: %s",
+				sub.Subject, sub.Queue, err.Error()))
+		}
+	}
+	n.subs = nil
+
+	if n.conn != nil && !n.conn.IsClosed() {
+		n.conn.Close()
+	}
+}
+
+func (n *natsConsumer) Stop() {
+	close(n.done)
+	n.cancel()
+	n.wg.Wait()
+	n.clean()
+}
+
+func (n *natsConsumer) Gather(acc telex.Accumulator) error {
+	return nil
+}
+
+func init() {
+	inputs.Add("nats_consumer", func() telex.Input {
+		return &natsConsumer{
+			Servers:                []string{"nats://localhost:4222"},
+			Subjects:               []string{"telex"},
+			QueueGroup:             "telex_consumers",
+			PendingBytesLimit:      nats.DefaultSubPendingBytesLimit,
+			PendingMessageLimit:    nats.DefaultSubPendingMsgsLimit,
+			MaxUndeliveredMessages: defaultMaxUndeliveredMessages,
+		}
+	})
+}
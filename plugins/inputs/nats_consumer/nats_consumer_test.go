@@ -0,0 +1,181 @@
+package nats_consumer
+
+import (
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/nats-io/gnatsd/server"
+	"github.com/nats-io/gnatsd/test"
+	nats "github.com/nats-io/go-nats"
+	"github.com/stretchr/testify/require"
+
+	"github.com/lavaorg/telex"
+	"github.com/lavaorg/telex/plugins/parsers"
+	"github.com/lavaorg/telex/testutil"
+)
+
+func runServer(t *testing.T) *server.Server {
+	opts := test.DefaultTestOptions
+	opts.Host = "127.0.0.1"
+	opts.Port = server.RANDOM_PORT
+	return test.RunServer(&opts)
+}
+
+func serverURL(s *server.Server) string {
+	return fmt.Sprintf("nats://%s", s.Addr().String())
+}
+
+func newConsumer(t *testing.T, s *server.Server) *natsConsumer {
+	parser, err := parsers.NewInfluxParser()
+	require.NoError(t, err)
+	return &natsConsumer{
+		Servers:                []string{serverURL(s)},
+		Subjects:               []string{"telex"},
+		QueueGroup:             "telex_consumers",
+		PendingBytesLimit:      nats.DefaultSubPendingBytesLimit,
+		PendingMessageLimit:    nats.DefaultSubPendingMsgsLimit,
+		MaxUndeliveredMessages: defaultMaxUndeliveredMessages,
+		parser:                 parser,
+	}
+}
+
+func publish(t *testing.T, s *server.Server, subject string, messages ...string) {
+	conn, err := nats.Connect(serverURL(s))
+	require.NoError(t, err)
+	defer conn.Close()
+	for _, m := range messages {
+		require.NoError(t, conn.Publish(subject, []byte(m)))
+	}
+	require.NoError(t, conn.Flush())
+}
+
+// trackingAccumulator reports a delivery for every value sent to deliver.
+type trackingAccumulator struct {
+	*testutil.Accumulator
+	delivered chan telex.DeliveryInfo
+}
+
+func (a *trackingAccumulator) WithTracking(maxTracked int) telex.TrackingAccumulator {
+	return a
+}
+
+func (a *trackingAccumulator) Delivered() <-chan telex.DeliveryInfo {
+	return a.delivered
+}
+
+type deliveryInfo struct{}
+
+func (deliveryInfo) ID() telex.TrackingID {
+	return 0
+}
+
+func (deliveryInfo) Delivered() bool {
+	return true
+}
+
+func TestReceive(t *testing.T) {
+	s := runServer(t)
+	defer s.Shutdown()
+
+	n := newConsumer(t, s)
+	n.Subjects = []string{"telex", "other"}
+	var acc testutil.Accumulator
+	require.NoError(t, n.Start(&acc))
+	defer n.Stop()
+
+	publish(t, s, "telex", "cpu,host=a value=42i 1500000000000000000\n")
+	publish(t, s, "other", "mem,host=a used=1i 1500000000000000000\nmem,host=b used=2i 1500000000000000000\n")
+	publish(t, s, "ignored", "disk,host=a used=1i 1500000000000000000\n")
+	acc.Wait(3)
+
+	acc.AssertContainsTaggedFields(t, "cpu",
+		map[string]interface{}{"value": int64(42)}, map[string]string{"host": "a"})
+	acc.AssertContainsTaggedFields(t, "mem",
+		map[string]interface{}{"used": int64(2)}, map[string]string{"host": "b"})
+	require.False(t, acc.HasMeasurement("disk"))
+}
+
+func TestParseError(t *testing.T) {
+	s := runServer(t)
+	defer s.Shutdown()
+
+	n := newConsumer(t, s)
+	var acc testutil.Accumulator
+	require.NoError(t, n.Start(&acc))
+	defer n.Stop()
+
+	publish(t, s, "telex", "not line protocol\n")
+	acc.WaitError(1)
+	require.Contains(t, acc.Errors[0].Error(), "subject: telex")
+}
+
+func TestQueueGroup(t *testing.T) {
+	s := runServer(t)
+	defer s.Shutdown()
+
+	var acc1, acc2 testutil.Accumulator
+	n1 := newConsumer(t, s)
+	require.NoError(t, n1.Start(&acc1))
+	defer n1.Stop()
+	n2 := newConsumer(t, s)
+	require.NoError(t, n2.Start(&acc2))
+	defer n2.Stop()
+
+	var messages []string
+	for i := 0; i < 20; i++ {
+		messages = append(messages, fmt.Sprintf("cpu value=%di 1500000000000000000\n", i))
+	}
+	publish(t, s, "telex", messages...)
+
+	// Each message is delivered to a single member of the group.
+	deadline := time.Now().Add(5 * time.Second)
+	for acc1.NMetrics()+acc2.NMetrics() < 20 && time.Now().Before(deadline) {
+		time.Sleep(10 * time.Millisecond)
+	}
+	time.Sleep(50 * time.Millisecond)
+	require.Equal(t, uint64(20), acc1.NMetrics()+acc2.NMetrics())
+}
+
+func TestMaxUndeliveredMessages(t *testing.T) {
+	s := runServer(t)
+	defer s.Shutdown()
+
+	n := newConsumer(t, s)
+	n.MaxUndeliveredMessages = 2
+	acc := &trackingAccumulator{
+		Accumulator: &testutil.Accumulator{},
+		delivered:   make(chan telex.DeliveryInfo),
+	}
+	require.NoError(t, n.Start(acc))
+	defer n.Stop()
+
+	var messages []string
+	for i := 0; i < 5; i++ {
+		messages = append(messages, fmt.Sprintf("cpu value=%di 1500000000000000000\n", i))
+	}
+	publish(t, s, "telex", messages...)
+
+	// No more messages are read until the outputs deliver some.
+	acc.Wait(2)
+	time.Sleep(100 * time.Millisecond)
+	require.Equal(t, uint64(2), acc.NMetrics())
+
+	acc.delivered <- deliveryInfo{}
+	acc.Wait(3)
+	time.Sleep(100 * time.Millisecond)
+	require.Equal(t, uint64(3), acc.NMetrics())
+
+	acc.delivered <- deliveryInfo{}
+	acc.delivered <- deliveryInfo{}
+	acc.Wait(5)
+}
+
+func TestStartNoServer(t *testing.T) {
+	s := runServer(t)
+	n := newConsumer(t, s)
+	s.Shutdown()
+
+	var acc testutil.Accumulator
+	require.Error(t, n.Start(&acc))
+}
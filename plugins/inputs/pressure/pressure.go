@@ -0,0 +1,128 @@
+package pressure
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/lavaorg/telex"
+	"github.com/lavaorg/telex/plugins/inputs"
+)
+
+// envRoot is the environment variable overriding the default proc root.
+const envRoot = "PROC_ROOT"
+
+type Pressure struct {
+	ProcRoot  string   `toml:"proc_root"`
+	Resources []string `toml:"resources"`
+}
+
+var sampleConfig = `
+  ## Root of the proc filesystem, the files are read from its pressure
+  ## directory.  If empty the PROC_ROOT environment variable is used, or
+  ## "/proc".
+  # proc_root = "/proc"
+
+  ## Resources to read the pressure of, "cpu", "memory", "io" or "irq".
+  # resources = ["cpu", "memory", "io"]
+`
+
+func (p *Pressure) Description() string {
+	return "Read the pressure stall information of the cpu, memory and io"
+}
+
+func (p *Pressure) SampleConfig() string {
+	return sampleConfig
+}
+
+func (p *Pressure) Gather(acc telex.Accumulator) error {
+	root := p.ProcRoot
+	if root == "" {
+		root = os.Getenv(envRoot)
+	}
+	if root == "" {
+		root = "/proc"
+	}
+
+	// The metrics of a gather share their timestamp, the fields of a line
+	// can be merged downstream.
+	now := time.Now()
+	for _, resource := range p.Resources {
+		path := filepath.Join(root, "pressure", resource)
+		data, err := ioutil.ReadFile(path)
+		if err != nil {
+			acc.AddError(err)
+			continue
+		}
+		if err := gatherFile(resource, data, now, acc); err != nil {
+			acc.AddError(fmt.Errorf("%s: %v", path, err))
+		}
+	}
+	return nil
+}
+
+// gatherFile parses the lines of a pressure file:
+//
+//	some avg10=0.00 avg60=0.00 avg300=0.00 total=0
+//	full avg10=0.00 avg60=0.00 avg300=0.00 total=0
+//
+// The averages are percentages of the time stalled, the total is the time
+// stalled in microseconds.  A metric has a single value type, the averages of
+// a line are added as a gauge and its total as a counter.
+func gatherFile(resource string, data []byte, now time.Time, acc telex.Accumulator) error {
+	scanner := bufio.NewScanner(bytes.NewReader(data))
+	for scanner.Scan() {
+		words := strings.Fields(scanner.Text())
+		if len(words) == 0 {
+			continue
+		}
+
+		gauges := make(map[string]interface{})
+		counters := make(map[string]interface{})
+		for _, word := range words[1:] {
+			kv := strings.SplitN(word, "=", 2)
+			if len(kv) != 2 {
+				return fmt.Errorf("invalid value %q", word)
+			}
+			if kv[0] == "total" {
+				total, err := strconv.ParseInt(kv[1], 10, 64)
+				if err != nil {
+					return fmt.Errorf("invalid total %q", kv[1])
+				}
+				counters[kv[0]] = total
+				continue
+			}
+			avg, err := strconv.ParseFloat(kv[1], 64)
+			if err != nil {
+				return fmt.Errorf("invalid %s %q", kv[0], kv[1])
+			}
+			gauges[kv[0]] = avg
+		}
+
+		tags := map[string]string{
+			"resource": resource,
+			"type":     words[0],
+		}
+		if len(gauges) > 0 {
+			acc.AddGauge("pressure", gauges, tags, now)
+		}
+		if len(counters) > 0 {
+			acc.AddCounter("pressure", counters, tags, now)
+		}
+	}
+	return scanner.Err()
+}
+
+func init() {
+	inputs.Add("pressure", func() telex.Input {
+		return &Pressure{
+			Resources: []string{"cpu", "memory", "io"},
+		}
+	})
+}
@@ -0,0 +1,108 @@
+package pressure
+
+import (
+	"testing"
+	"time"
+
+	"github.com/lavaorg/telex/testutil"
+	"github.com/stretchr/testify/require"
+)
+
+// typeAccumulator records the fields added as counters.
+type typeAccumulator struct {
+	testutil.Accumulator
+	counters []map[string]interface{}
+}
+
+func (a *typeAccumulator) AddCounter(
+	measurement string,
+	fields map[string]interface{},
+	tags map[string]string,
+	t ...time.Time,
+) {
+	a.counters = append(a.counters, fields)
+	a.Accumulator.AddCounter(measurement, fields, tags, t...)
+}
+
+func TestPressure_Gather(t *testing.T) {
+	p := &Pressure{
+		ProcRoot:  "testdata",
+		Resources: []string{"cpu", "memory", "io"},
+	}
+
+	var acc typeAccumulator
+	require.NoError(t, p.Gather(&acc))
+	require.Empty(t, acc.Errors)
+
+	tests := []struct {
+		resource string
+		typ      string
+		avgs     [3]float64
+		total    int64
+	}{
+		{"cpu", "some", [3]float64{1.53, 0.87, 0.34}, 26431562},
+		{"cpu", "full", [3]float64{0, 0, 0}, 0},
+		{"memory", "some", [3]float64{0.25, 0.10, 0.03}, 873410},
+		{"memory", "full", [3]float64{0.12, 0.04, 0.01}, 412093},
+		{"io", "some", [3]float64{4.70, 2.31, 1.05}, 158327912},
+		{"io", "full", [3]float64{3.86, 1.92, 0.88}, 131784105},
+	}
+	require.Len(t, acc.Metrics, 2*len(tests))
+	for i, tt := range tests {
+		tags := map[string]string{"resource": tt.resource, "type": tt.typ}
+		gauge, counter := acc.Metrics[2*i], acc.Metrics[2*i+1]
+		require.Equal(t, "pressure", gauge.Measurement)
+		require.Equal(t, tags, gauge.Tags)
+		require.Equal(t, map[string]interface{}{
+			"avg10":  tt.avgs[0],
+			"avg60":  tt.avgs[1],
+			"avg300": tt.avgs[2],
+		}, gauge.Fields)
+		require.Equal(t, "pressure", counter.Measurement)
+		require.Equal(t, tags, counter.Tags)
+		require.Equal(t, map[string]interface{}{"total": tt.total}, counter.Fields)
+		require.Equal(t, acc.Metrics[0].Time, gauge.Time)
+		require.Equal(t, acc.Metrics[0].Time, counter.Time)
+	}
+
+	// The totals are counters.
+	require.Len(t, acc.counters, 6)
+	for _, fields := range acc.counters {
+		require.Len(t, fields, 1)
+		require.Contains(t, fields, "total")
+	}
+}
+
+func TestPressure_ProcRootEnv(t *testing.T) {
+	t.Setenv("PROC_ROOT", "testdata")
+	p := &Pressure{Resources: []string{"cpu"}}
+
+	var acc testutil.Accumulator
+	require.NoError(t, p.Gather(&acc))
+	require.Empty(t, acc.Errors)
+	require.Len(t, acc.Metrics, 4)
+}
+
+func TestPressure_MissingResource(t *testing.T) {
+	p := &Pressure{
+		ProcRoot:  "testdata",
+		Resources: []string{"irq", "cpu"},
+	}
+
+	var acc testutil.Accumulator
+	require.NoError(t, p.Gather(&acc))
+	require.Len(t, acc.Errors, 1)
+	require.Len(t, acc.Metrics, 4)
+}
+
+func TestGatherFile_Invalid(t *testing.T) {
+	tests := []string{
+		"some avg10=0.00 avg60 avg300=0.00 total=0\n",
+		"some avg10=x avg60=0.00 avg300=0.00 total=0\n",
+		"some avg10=0.00 avg60=0.00 avg300=0.00 total=1.5\n",
+	}
+	for _, data := range tests {
+		var acc testutil.Accumulator
+		require.Error(t, gatherFile("cpu", []byte(data), time.Now(), &acc), data)
+	}
+}
@@ -4,9 +4,11 @@ import (
 	"bytes"
 	"fmt"
 	"io/ioutil"
+	"os"
 	"os/exec"
 	"path/filepath"
 	"strconv"
+	"strings"
 	"time"
 
 	"github.com/lavaorg/telex"
@@ -51,7 +53,9 @@ var sampleConfig = `
   # user = "nginx"
   ## Systemd unit name
   # systemd_unit = "nginx.service"
-  ## CGroup name or path
+  ## CGroup name or path, names are relative to /sys/fs/cgroup.  With
+  ## cgroup v2 the hierarchy of a cgroup v1 name, like "systemd/", is
+  ## dropped.
   # cgroup = "systemd/system.slice/nginx.service"
 
   ## override for process_name
@@ -373,14 +377,36 @@ func (p *Procstat) systemdUnitPIDs() ([]PID, error) {
 	return pids, nil
 }
 
+// cgroupRoot is the mount point of the cgroup hierarchies.
+var cgroupRoot = "/sys/fs/cgroup"
+
+// cgroupPath returns the directory of the cgroup, relative cgroups are under
+// cgroupRoot.  With cgroup v1 they start with their hierarchy, like
+// "systemd/system.slice", which is dropped on the unified hierarchy of
+// cgroup v2 mounted at cgroupRoot.
+func (p *Procstat) cgroupPath() string {
+	if filepath.IsAbs(p.CGroup) {
+		return p.CGroup
+	}
+
+	path := filepath.Join(cgroupRoot, p.CGroup)
+	if _, err := os.Stat(filepath.Join(cgroupRoot, "cgroup.controllers")); err != nil {
+		return path
+	}
+	if _, err := os.Stat(path); err == nil {
+		return path
+	}
+	parts := strings.SplitN(filepath.ToSlash(p.CGroup), "/", 2)
+	if len(parts) == 2 {
+		return filepath.Join(cgroupRoot, parts[1])
+	}
+	return path
+}
+
 func (p *Procstat) cgroupPIDs() ([]PID, error) {
 	var pids []PID
 
-	procsPath := p.CGroup
-	if procsPath[0] != '/' {
-		procsPath = "/sys/fs/cgroup/" + procsPath
-	}
-	procsPath = filepath.Join(procsPath, "cgroup.procs")
+	procsPath := filepath.Join(p.cgroupPath(), "cgroup.procs")
 	out, err := ioutil.ReadFile(procsPath)
 	if err != nil {
 		return nil, err
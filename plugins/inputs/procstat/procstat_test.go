@@ -376,6 +376,33 @@ func TestGather_cgroupPIDs(t *testing.T) {
 	assert.Equal(t, td, tags["cgroup"])
 }
 
+func TestGather_cgroupPIDsUnified(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("no cgroups in windows")
+	}
+	defer func(root string) { cgroupRoot = root }(cgroupRoot)
+	cgroupRoot = "testdata/cgroup"
+
+	tests := []struct {
+		cgroup string
+		pids   []PID
+	}{
+		{"system.slice/sshd.service", []PID{987}},
+		{"systemd/system.slice/nginx.service", []PID{1234, 5678}},
+	}
+	for _, tt := range tests {
+		p := Procstat{
+			createPIDFinder: pidFinder([]PID{}, nil),
+			CGroup:          tt.cgroup,
+		}
+		var acc testutil.Accumulator
+		pids, tags, err := p.findPids(&acc)
+		require.NoError(t, err)
+		assert.Equal(t, tt.pids, pids)
+		assert.Equal(t, tt.cgroup, tags["cgroup"])
+	}
+}
+
 func TestProcstatLookupMetric(t *testing.T) {
 	p := Procstat{
 		createPIDFinder: pidFinder([]PID{543}, nil),
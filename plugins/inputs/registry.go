@@ -9,3 +9,15 @@ var Inputs = map[string]Creator{}
 func Add(name string, creator Creator) {
 	Inputs[name] = creator
 }
+
+// ExternalCreator creates the input running the program of an external
+// plugin at path, configured with the options of its table in TOML.
+type ExternalCreator func(path, config string) telex.Input
+
+// External creates the inputs of the external plugins, it is nil if no
+// plugin is able to run them.
+var External ExternalCreator
+
+func AddExternal(creator ExternalCreator) {
+	External = creator
+}
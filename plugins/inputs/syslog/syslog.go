@@ -18,6 +18,7 @@ import (
 	"github.com/influxdata/go-syslog/rfc5424"
 	"github.com/lavaorg/telex"
 	"github.com/lavaorg/telex/internal"
+	framing "github.com/lavaorg/telex/internal/syslog"
 	telextls "github.com/lavaorg/telex/internal/tls"
 	"github.com/lavaorg/telex/plugins/inputs"
 )
@@ -32,7 +33,7 @@ type Syslog struct {
 	KeepAlivePeriod *internal.Duration
 	MaxConnections  int
 	ReadTimeout     *internal.Duration
-	Framing         Framing
+	Framing         framing.Framing
 	Trailer         nontransparent.TrailerType
 	BestEffort      bool
 	Separator       string `toml:"sdparam_separator"`
@@ -313,7 +314,7 @@ func (s *Syslog) handle(conn net.Conn, acc telex.Accumulator) {
 	}
 
 	// Select the parser to use depeding on transport framing
-	if s.Framing == OctetCounting {
+	if s.Framing == framing.OctetCounting {
 		// Octet counting transparent framing
 		p = octetcounting.NewParser(opts...)
 	} else {
@@ -444,7 +445,7 @@ func init() {
 		ReadTimeout: &internal.Duration{
 			Duration: defaultReadTimeout,
 		},
-		Framing:   OctetCounting,
+		Framing:   framing.OctetCounting,
 		Trailer:   nontransparent.LF,
 		Separator: "_",
 	}
@@ -1,9 +1,12 @@
 package all
 
 import (
+	_ "github.com/lavaorg/telex/plugins/outputs/execd"
 	_ "github.com/lavaorg/telex/plugins/outputs/file"
 	//	_ "github.com/lavaorg/telex/plugins/outputs/http"
-	//	_ "github.com/lavaorg/telex/plugins/outputs/kafka"
+	_ "github.com/lavaorg/telex/plugins/outputs/kafka"
 	//	_ "github.com/lavaorg/telex/plugins/outputs/nats"
+	_ "github.com/lavaorg/telex/plugins/outputs/prometheus_client"
 	//	_ "github.com/lavaorg/telex/plugins/outputs/socket_writer"
+	_ "github.com/lavaorg/telex/plugins/outputs/syslog"
 )
@@ -0,0 +1,233 @@
+package execd
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"io"
+	"log"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/lavaorg/telex"
+	"github.com/lavaorg/telex/internal"
+	"github.com/lavaorg/telex/internal/process"
+	"github.com/lavaorg/telex/plugins/outputs"
+	"github.com/lavaorg/telex/plugins/serializers"
+	"github.com/lavaorg/telex/plugins/serializers/influx"
+	"github.com/lavaorg/telex/shim"
+)
+
+var sampleConfig = `
+  ## Program to run, and its arguments.  Metrics are written to its stdin one
+  ## per line.
+  command = ["/usr/bin/mywriter", "--foo=bar"]
+
+  ## Environment variables added to the environment of the program, in the
+  ## form "key=value".
+  # environment = ["LD_LIBRARY_PATH=/opt/lib"]
+
+  ## Wait for the program to acknowledge each batch, which is then ended by
+  ## the line "#batch <id>".  The program writes a line to stdout for each
+  ## batch, starting with its id: "<id> ok" accepts the batch, "<id> <error>"
+  ## is an error and the batch is written again later.  Without
+  ## acknowledgements a batch is accepted once written to the program.
+  # acknowledge = false
+
+  ## Time to wait for the acknowledgement of a batch.
+  # acknowledge_timeout = "10s"
+
+  ## Delay before the program is restarted once it exits, doubled on each
+  ## restart up to max_restart_delay.  The delay is reset once the program
+  ## ran for max_restart_delay.
+  # restart_delay = "10s"
+  # max_restart_delay = "5m"
+
+  ## Data format to output.
+  ## Each data format has its own unique set of configuration options, read
+  ## more about them here:
+  ## https://github.com/lavaorg/telex/blob/master/docs/DATA_FORMATS_OUTPUT.md
+  data_format = "influx"
+`
+
+// Execd writes the metrics to a long running program.
+type Execd struct {
+	Command            []string          `toml:"command"`
+	Environment        []string          `toml:"environment"`
+	Acknowledge        bool              `toml:"acknowledge"`
+	AcknowledgeTimeout internal.Duration `toml:"acknowledge_timeout"`
+	RestartDelay       internal.Duration `toml:"restart_delay"`
+	MaxRestartDelay    internal.Duration `toml:"max_restart_delay"`
+
+	serializer serializers.Serializer
+	process    *process.Process
+	acks       chan string
+
+	mu      sync.Mutex
+	batch   uint64 // id of the last batch written
+	pending uint64 // id of the batch waiting for its acknowledgement
+}
+
+func NewExecd() *Execd {
+	return &Execd{
+		AcknowledgeTimeout: internal.Duration{Duration: 10 * time.Second},
+		RestartDelay:       internal.Duration{Duration: 10 * time.Second},
+		MaxRestartDelay:    internal.Duration{Duration: 5 * time.Minute},
+	}
+}
+
+func (e *Execd) SetSerializer(serializer serializers.Serializer) {
+	e.serializer = serializer
+}
+
+func (e *Execd) SampleConfig() string {
+	return sampleConfig
+}
+
+func (e *Execd) Description() string {
+	return "Write metrics to a long running program"
+}
+
+// Connect starts the program, errors running it are logged.
+func (e *Execd) Connect() error {
+	if len(e.Command) == 0 {
+		return fmt.Errorf("command is required")
+	}
+
+	e.acks = make(chan string, 1)
+	e.process = process.New("outputs.execd", e.Command)
+	e.process.Stdin = true
+	e.process.Env = e.Environment
+	e.process.RestartDelay = e.RestartDelay.Duration
+	e.process.MaxRestartDelay = e.MaxRestartDelay.Duration
+	e.process.ReadStdout = e.readStdout
+	return e.process.Start()
+}
+
+// Close closes the stdin of the program, and waits for it to exit.
+func (e *Execd) Close() error {
+	if e.process != nil {
+		e.process.Stop()
+	}
+	return nil
+}
+
+// Write writes the metrics to the program, it blocks while the program does
+// not read them.  An error is returned if the program is not running, or
+// does not acknowledge the batch.
+func (e *Execd) Write(metrics []telex.Metric) error {
+	var buf bytes.Buffer
+	for _, m := range metrics {
+		octets, err := e.serializer.Serialize(m)
+		if err != nil {
+			log.Printf("D! [outputs.execd] Could not serialize metric: %v", err)
+			continue
+		}
+		buf.Write(octets)
+	}
+
+	if !e.Acknowledge {
+		return e.process.Write(buf.Bytes())
+	}
+
+	// The batch is numbered, so that the late acknowledgement of a batch
+	// which timed out is not taken for the acknowledgement of this one.
+	e.mu.Lock()
+	e.batch++
+	id := e.batch
+	e.pending = id
+	e.mu.Unlock()
+	defer e.setPending(0)
+
+	select {
+	case <-e.acks:
+	default:
+	}
+
+	fmt.Fprintf(&buf, "#batch %d\n", id)
+	if err := e.process.Write(buf.Bytes()); err != nil {
+		return err
+	}
+
+	timer := time.NewTimer(e.AcknowledgeTimeout.Duration)
+	defer timer.Stop()
+	select {
+	case ack := <-e.acks:
+		if ack != "" && ack != "ok" {
+			return fmt.Errorf("batch not acknowledged: %s", ack)
+		}
+		return nil
+	case <-timer.C:
+		return fmt.Errorf("batch not acknowledged within %s",
+			e.AcknowledgeTimeout.Duration)
+	}
+}
+
+// readStdout passes the acknowledgements to Write, or logs the output of the
+// program if batches are not acknowledged.
+func (e *Execd) readStdout(r io.Reader) {
+	scanner := bufio.NewScanner(r)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if !e.Acknowledge {
+			log.Printf("D! [outputs.execd] %s: %s", e.Command[0], line)
+			continue
+		}
+
+		id, ack, err := parseAck(line)
+		if err != nil {
+			log.Printf("W! [outputs.execd] Unexpected acknowledgement: %s", line)
+			continue
+		}
+
+		e.mu.Lock()
+		pending := e.pending
+		e.mu.Unlock()
+		if id != pending {
+			log.Printf("D! [outputs.execd] Dropped acknowledgement of batch %d: %s", id, ack)
+			continue
+		}
+
+		select {
+		case e.acks <- ack:
+		default:
+			log.Printf("W! [outputs.execd] Unexpected acknowledgement: %s", line)
+		}
+	}
+}
+
+func (e *Execd) setPending(id uint64) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	e.pending = id
+}
+
+// parseAck parses the acknowledgement "<id> <result>".
+func parseAck(line string) (uint64, string, error) {
+	fields := strings.SplitN(line, " ", 2)
+	id, err := strconv.ParseUint(fields[0], 10, 64)
+	if err != nil {
+		return 0, "", err
+	}
+	if len(fields) == 1 {
+		return id, "", nil
+	}
+	return id, strings.TrimSpace(fields[1]), nil
+}
+
+func init() {
+	outputs.Add("execd", func() telex.Output {
+		return NewExecd()
+	})
+	// An external output acknowledges each batch once it is written.
+	outputs.AddExternal(func(path, config string) telex.Output {
+		e := NewExecd()
+		e.Command = []string{path}
+		e.Environment = []string{shim.ConfigEnv + "=" + config}
+		e.Acknowledge = true
+		e.SetSerializer(influx.NewSerializer())
+		return e
+	})
+}
@@ -0,0 +1,130 @@
+// +build !windows
+
+package execd
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/lavaorg/telex"
+	"github.com/lavaorg/telex/internal"
+	"github.com/lavaorg/telex/internal/process"
+	"github.com/lavaorg/telex/metric"
+	"github.com/lavaorg/telex/plugins/serializers/influx"
+	"github.com/stretchr/testify/require"
+)
+
+func newTestExecd(script string) *Execd {
+	e := NewExecd()
+	e.Command = []string{"sh", "-c", script}
+	e.RestartDelay = internal.Duration{Duration: time.Hour}
+	e.MaxRestartDelay = internal.Duration{Duration: time.Hour}
+	e.SetSerializer(influx.NewSerializer())
+	return e
+}
+
+func newMetrics() []telex.Metric {
+	m1, _ := metric.New("cpu", map[string]string{"host": "a"},
+		map[string]interface{}{"value": int64(1)}, time.Unix(1, 0))
+	m2, _ := metric.New("cpu", map[string]string{"host": "b"},
+		map[string]interface{}{"value": int64(2)}, time.Unix(1, 0))
+	return []telex.Metric{m1, m2}
+}
+
+func tempFile(t *testing.T) (string, func()) {
+	dir, err := ioutil.TempDir("", "execd")
+	require.NoError(t, err)
+	return filepath.Join(dir, "out"), func() { os.RemoveAll(dir) }
+}
+
+func TestExecd_Write(t *testing.T) {
+	path, cleanup := tempFile(t)
+	defer cleanup()
+
+	e := newTestExecd("cat > " + path)
+	require.NoError(t, e.Connect())
+	require.NoError(t, e.Write(newMetrics()))
+
+	// Close waits for the program to exit once its stdin is closed.
+	require.NoError(t, e.Close())
+	out, err := ioutil.ReadFile(path)
+	require.NoError(t, err)
+	require.Equal(t, "cpu,host=a value=1i 1000000000\n"+
+		"cpu,host=b value=2i 1000000000\n", string(out))
+}
+
+func TestExecd_Acknowledge(t *testing.T) {
+	path, cleanup := tempFile(t)
+	defer cleanup()
+
+	e := newTestExecd(`n=0
+while read -r line; do
+  case "$line" in
+  "#batch "*) ;;
+  *) echo "$line" >> ` + path + `; continue ;;
+  esac
+  n=$((n+1))
+  if [ $n -eq 1 ]; then echo "${line#\#batch } ok"; else echo "${line#\#batch } disk full"; fi
+done`)
+	e.Acknowledge = true
+	require.NoError(t, e.Connect())
+	defer e.Close()
+
+	require.NoError(t, e.Write(newMetrics()))
+	require.EqualError(t, e.Write(newMetrics()), "batch not acknowledged: disk full")
+
+	out, err := ioutil.ReadFile(path)
+	require.NoError(t, err)
+	require.Equal(t, 4, strings.Count(string(out), "\n"))
+}
+
+func TestExecd_AcknowledgeTimeout(t *testing.T) {
+	e := newTestExecd("exec cat > /dev/null")
+	e.Acknowledge = true
+	e.AcknowledgeTimeout = internal.Duration{Duration: 10 * time.Millisecond}
+	require.NoError(t, e.Connect())
+	defer e.Close()
+
+	require.EqualError(t, e.Write(newMetrics()), "batch not acknowledged within 10ms")
+}
+
+func TestExecd_AcknowledgeLate(t *testing.T) {
+	// The first batch is acknowledged after its timeout, while the second
+	// batch is waiting for its acknowledgement.
+	e := newTestExecd(`n=0
+while read -r line; do
+  case "$line" in
+  "#batch "*) ;;
+  *) continue ;;
+  esac
+  n=$((n+1))
+  if [ $n -eq 2 ]; then echo "1 ok"; sleep 0.2; echo "2 disk full"; fi
+done`)
+	e.Acknowledge = true
+	e.AcknowledgeTimeout = internal.Duration{Duration: 100 * time.Millisecond}
+	require.NoError(t, e.Connect())
+	defer e.Close()
+
+	require.EqualError(t, e.Write(newMetrics()), "batch not acknowledged within 100ms")
+	e.AcknowledgeTimeout = internal.Duration{Duration: 5 * time.Second}
+	require.EqualError(t, e.Write(newMetrics()), "batch not acknowledged: disk full")
+}
+
+func TestExecd_WriteNotRunning(t *testing.T) {
+	e := newTestExecd("exit 1")
+	require.NoError(t, e.Connect())
+	defer e.Close()
+
+	deadline := time.Now().Add(5 * time.Second)
+	for e.process.Running() {
+		if time.Now().After(deadline) {
+			t.Fatal("program did not exit")
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	require.Equal(t, process.ErrNotRunning, e.Write(newMetrics()))
+}
@@ -0,0 +1,292 @@
+package kafka
+
+import (
+	"crypto/tls"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"time"
+)
+
+// conn is a connection to a single broker.
+type conn struct {
+	net.Conn
+	clientID      string
+	timeout       time.Duration
+	correlationID int32
+	// versions of the requests supported by the broker
+	versions apiVersions
+}
+
+func dial(addr string, c *client) (*conn, error) {
+	dialer := &net.Dialer{Timeout: c.timeout}
+	var nc net.Conn
+	var err error
+	if c.tlsConfig != nil {
+		nc, err = tls.DialWithDialer(dialer, "tcp", addr, c.tlsConfig)
+	} else {
+		nc, err = dialer.Dial("tcp", addr)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	bc := &conn{Conn: nc, clientID: c.clientID, timeout: c.timeout}
+	if err := bc.negotiate(); err != nil {
+		nc.Close()
+		return nil, err
+	}
+	if c.username != "" {
+		if err := bc.authenticate(c.username, c.password); err != nil {
+			nc.Close()
+			return nil, err
+		}
+	}
+	return bc, nil
+}
+
+// negotiate asks the broker for the versions of the requests it supports,
+// the request is answered before the authentication.
+func (c *conn) negotiate() error {
+	resp, err := c.roundTrip(apiApiVersions, 0, nil, true)
+	if err != nil {
+		return err
+	}
+	code, versions, err := decodeApiVersionsResponse(resp)
+	if err != nil {
+		return err
+	}
+	if code != errNone {
+		return code
+	}
+	c.versions = versions
+	return nil
+}
+
+// version returns the version of the request to send to the broker.
+func (c *conn) version(apiKey int16) (int16, error) {
+	return c.versions.version(apiKey)
+}
+
+// authenticate runs the SASL PLAIN authentication.
+func (c *conn) authenticate(username, password string) error {
+	version, err := c.version(apiSaslHandshake)
+	if err != nil {
+		return err
+	}
+	resp, err := c.roundTrip(apiSaslHandshake, version, encodeSaslHandshakeRequest("PLAIN"), true)
+	if err != nil {
+		return err
+	}
+	code, mechanisms, err := decodeSaslHandshakeResponse(resp)
+	if err != nil {
+		return err
+	}
+	if code != errNone {
+		return fmt.Errorf("%s, broker supports %v", code, mechanisms)
+	}
+
+	token := []byte("\x00" + username + "\x00" + password)
+	if version >= 1 {
+		return c.saslAuthenticate(token)
+	}
+
+	// With the v0 handshake the token is sent without the request header.
+	e := &encoder{}
+	e.bytes(token)
+	c.SetDeadline(time.Now().Add(c.timeout))
+	if _, err := c.Write(e.buf); err != nil {
+		return err
+	}
+	if _, err := c.readResponse(); err != nil {
+		return fmt.Errorf("kafka: SASL authentication failed: %s", err)
+	}
+	return nil
+}
+
+// saslAuthenticate sends the token in a SaslAuthenticate request, which
+// follows the v1 handshake.
+func (c *conn) saslAuthenticate(token []byte) error {
+	version, err := c.version(apiSaslAuthenticate)
+	if err != nil {
+		return err
+	}
+	resp, err := c.roundTrip(apiSaslAuthenticate, version, encodeSaslAuthenticateRequest(token), true)
+	if err != nil {
+		return err
+	}
+	code, message, err := decodeSaslAuthenticateResponse(resp)
+	if err != nil {
+		return err
+	}
+	if code != errNone {
+		if message != "" {
+			return fmt.Errorf("%s: %s", code, message)
+		}
+		return code
+	}
+	return nil
+}
+
+// roundTrip sends a request and returns the response body after the
+// correlation id.  When wait is false the response is not read.
+func (c *conn) roundTrip(apiKey, version int16, body []byte, wait bool) ([]byte, error) {
+	c.correlationID++
+	req := encodeRequest(apiKey, version, c.correlationID, c.clientID, body)
+
+	c.SetDeadline(time.Now().Add(c.timeout))
+	if _, err := c.Write(req); err != nil {
+		return nil, err
+	}
+	if !wait {
+		return nil, nil
+	}
+
+	resp, err := c.readResponse()
+	if err != nil {
+		return nil, err
+	}
+	if len(resp) < 4 {
+		return nil, errMalformed
+	}
+	if id := int32(binary.BigEndian.Uint32(resp)); id != c.correlationID {
+		return nil, fmt.Errorf("kafka: correlation id %d does not match request %d", id, c.correlationID)
+	}
+	return resp[4:], nil
+}
+
+func (c *conn) readResponse() ([]byte, error) {
+	var size [4]byte
+	if _, err := io.ReadFull(c, size[:]); err != nil {
+		return nil, err
+	}
+	resp := make([]byte, binary.BigEndian.Uint32(size[:]))
+	if _, err := io.ReadFull(c, resp); err != nil {
+		return nil, err
+	}
+	return resp, nil
+}
+
+// client keeps the connections to the brokers and the partition leaders of
+// the topics written to.
+type client struct {
+	seeds     []string
+	clientID  string
+	timeout   time.Duration
+	tlsConfig *tls.Config
+	username  string
+	password  string
+
+	addrs  map[int32]string
+	conns  map[int32]*conn
+	topics map[string][]partitionMetadata
+}
+
+var errNoBrokers = errors.New("kafka: no brokers available")
+
+// refreshMetadata requests the metadata of the topics from the first broker
+// to answer, the topics are created if the cluster allows it.
+func (c *client) refreshMetadata(topics []string) error {
+	var addrs []string
+	for _, addr := range c.addrs {
+		addrs = append(addrs, addr)
+	}
+	addrs = append(addrs, c.seeds...)
+
+	err := errNoBrokers
+	for _, addr := range addrs {
+		var bc *conn
+		bc, err = dial(addr, c)
+		if err != nil {
+			continue
+		}
+		var version int16
+		var resp []byte
+		version, err = bc.version(apiMetadata)
+		if err == nil {
+			resp, err = bc.roundTrip(apiMetadata, version, encodeMetadataRequest(version, topics), true)
+		}
+		bc.Close()
+		if err != nil {
+			continue
+		}
+		var md *metadataResponse
+		md, err = decodeMetadataResponse(version, resp)
+		if err != nil {
+			continue
+		}
+		c.update(md)
+		return nil
+	}
+	return fmt.Errorf("kafka: could not fetch metadata: %s", err)
+}
+
+func (c *client) update(md *metadataResponse) {
+	addrs := make(map[int32]string, len(md.brokers))
+	for _, b := range md.brokers {
+		addrs[b.id] = b.addr
+	}
+	// Drop the connections to brokers which moved or left the cluster.
+	for id, bc := range c.conns {
+		if addrs[id] != c.addrs[id] || addrs[id] == "" {
+			bc.Close()
+			delete(c.conns, id)
+		}
+	}
+	c.addrs = addrs
+
+	for _, topic := range md.topics {
+		if topic.err != errNone || len(topic.partitions) == 0 {
+			delete(c.topics, topic.name)
+			continue
+		}
+		c.topics[topic.name] = topic.partitions
+	}
+}
+
+// leader returns the connection to the leader of the partition.
+func (c *client) leader(topic string, partition int32) (int32, *conn, error) {
+	var id int32 = -1
+	for _, p := range c.topics[topic] {
+		if p.id == partition {
+			if p.err != errNone && p.err != errLeaderNotAvailable {
+				return 0, nil, p.err
+			}
+			id = p.leader
+			break
+		}
+	}
+	if id < 0 {
+		return 0, nil, errLeaderNotAvailable
+	}
+
+	if bc, ok := c.conns[id]; ok {
+		return id, bc, nil
+	}
+	addr, ok := c.addrs[id]
+	if !ok {
+		return 0, nil, errLeaderNotAvailable
+	}
+	bc, err := dial(addr, c)
+	if err != nil {
+		return 0, nil, err
+	}
+	c.conns[id] = bc
+	return id, bc, nil
+}
+
+// drop closes the connection to a broker after a network error.
+func (c *client) drop(id int32) {
+	if bc, ok := c.conns[id]; ok {
+		bc.Close()
+		delete(c.conns, id)
+	}
+}
+
+func (c *client) close() {
+	for id := range c.conns {
+		c.drop(id)
+	}
+}
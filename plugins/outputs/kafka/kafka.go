@@ -0,0 +1,492 @@
+package kafka
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"fmt"
+	"hash/fnv"
+	"log"
+	"strings"
+	"time"
+
+	"github.com/lavaorg/telex"
+	"github.com/lavaorg/telex/internal"
+	"github.com/lavaorg/telex/internal/tls"
+	"github.com/lavaorg/telex/plugins/outputs"
+	"github.com/lavaorg/telex/plugins/serializers"
+)
+
+// TopicSuffix appends the measurement name or tag values to the topic.
+type TopicSuffix struct {
+	Method    string   `toml:"method"`
+	Keys      []string `toml:"keys"`
+	Separator string   `toml:"separator"`
+}
+
+type Kafka struct {
+	Brokers          []string
+	Topic            string
+	ClientID         string      `toml:"client_id"`
+	TopicSuffix      TopicSuffix `toml:"topic_suffix"`
+	RoutingTag       string      `toml:"routing_tag"`
+	RoutingKey       string      `toml:"routing_key"`
+	CompressionCodec int         `toml:"compression_codec"`
+	RequiredAcks     int         `toml:"required_acks"`
+	MaxRetry         int         `toml:"max_retry"`
+	MaxMessageBytes  int         `toml:"max_message_bytes"`
+	Timeout          internal.Duration
+
+	SASLUsername string `toml:"sasl_username"`
+	SASLPassword string `toml:"sasl_password"`
+	tls.ClientConfig
+
+	client       *client
+	serializer   serializers.Serializer
+	retryBackoff time.Duration
+	// next partition of the messages without a key, by topic
+	next map[string]int
+}
+
+var sampleConfig = `
+  ## URLs of kafka brokers
+  brokers = ["localhost:9092"]
+  ## Kafka topic for producer messages
+  topic = "telex"
+
+  ## Optional Client id
+  # client_id = "telex"
+
+  ## Optional topic suffix configuration.
+  ## If the section is omitted, no suffix is used.
+  ## Following topic suffix methods are supported:
+  ##   measurement - suffix equals to separator + measurement's name
+  ##   tags        - suffix equals to separator + specified tags' values
+  ##                 interleaved with separator
+
+  ## Suffix equals to "_" + measurement name
+  # [outputs.kafka.topic_suffix]
+  #   method = "measurement"
+  #   separator = "_"
+
+  ## Suffix equals to "__" + measurement's "foo" tag value.
+  ##   If there's no such a tag, suffix equals to an empty string
+  # [outputs.kafka.topic_suffix]
+  #   method = "tags"
+  #   keys = ["foo"]
+  #   separator = "__"
+
+  ## The routing tag specifies a tagkey on the metric whose value is used as
+  ## the message key.  The message key is used to determine which partition to
+  ## send the message to.  This tag is prefered over the routing_key option.
+  # routing_tag = "host"
+
+  ## The routing key is set as the message key and used to determine which
+  ## partition to send the message to.  This value is only used when no
+  ## routing_tag is set or as a fallback when the tag specified in routing tag
+  ## is not found.
+  ##
+  ## If set to "random", a random value will be generated for each message.
+  ##
+  ## When unset, no message key is added and each message is routed to a
+  ## partition in round-robin fashion.
+  # routing_key = "telex"
+
+  ## CompressionCodec represents the various compression codecs recognized by
+  ## Kafka in messages.
+  ##  0 : No compression
+  ##  1 : Gzip compression
+  ##  2 : Snappy compression
+  ##  3 : LZ4 compression
+  # compression_codec = 0
+
+  ##  RequiredAcks is used in Produce Requests to tell the broker how many
+  ##  replica acknowledgements it must see before responding
+  ##   0 : the producer never waits for an acknowledgement from the broker.
+  ##       This option provides the lowest latency but the weakest durability
+  ##       guarantees (some data will be lost when a server fails).
+  ##   1 : the producer gets an acknowledgement after the leader replica has
+  ##       received the data. This option provides better durability as the
+  ##       client waits until the server acknowledges the request as successful
+  ##       (only messages that were written to the now-dead leader but not yet
+  ##       replicated will be lost).
+  ##   -1: the producer gets an acknowledgement after all in-sync replicas have
+  ##       received the data. This option provides the best durability, we
+  ##       guarantee that no messages will be lost as long as at least one in
+  ##       sync replica remains.
+  # required_acks = -1
+
+  ## The maximum number of times to retry sending a metric before failing
+  ## until the next flush.
+  # max_retry = 3
+
+  ## The maximum permitted size of a message. Should be set equal to or
+  ## smaller than the broker's 'message.max.bytes'.
+  # max_message_bytes = 1000000
+
+  ## Timeout for connecting to and waiting on the brokers.
+  # timeout = "5s"
+
+  ## Optional TLS Config
+  # tls_ca = "/etc/telex/ca.pem"
+  # tls_cert = "/etc/telex/cert.pem"
+  # tls_key = "/etc/telex/key.pem"
+  ## Use TLS but skip chain & host verification
+  # insecure_skip_verify = false
+
+  ## Optional SASL PLAIN Config
+  # sasl_username = "kafka"
+  # sasl_password = "secret"
+
+  ## Data format to output.
+  ## Each data format has its own unique set of configuration options, read
+  ## more about them here:
+  ## https://github.com/lavaorg/telex/blob/master/docs/DATA_FORMATS_OUTPUT.md
+  # data_format = "influx"
+`
+
+func (k *Kafka) SetSerializer(serializer serializers.Serializer) {
+	k.serializer = serializer
+}
+
+func (k *Kafka) Connect() error {
+	if len(k.Brokers) == 0 {
+		return fmt.Errorf("no brokers configured")
+	}
+	if k.Topic == "" {
+		return fmt.Errorf("no topic configured")
+	}
+	switch k.TopicSuffix.Method {
+	case "", "measurement", "tags":
+	default:
+		return fmt.Errorf("unknown topic_suffix method %q", k.TopicSuffix.Method)
+	}
+	if k.CompressionCodec < codecNone || k.CompressionCodec > codecLZ4 {
+		return fmt.Errorf("unsupported compression_codec %d", k.CompressionCodec)
+	}
+	if k.RequiredAcks < -1 || k.RequiredAcks > 1 {
+		return fmt.Errorf("unsupported required_acks %d", k.RequiredAcks)
+	}
+
+	tlsConfig, err := k.ClientConfig.TLSConfig()
+	if err != nil {
+		return err
+	}
+
+	k.client = &client{
+		seeds:     k.Brokers,
+		clientID:  k.ClientID,
+		timeout:   k.Timeout.Duration,
+		tlsConfig: tlsConfig,
+		username:  k.SASLUsername,
+		password:  k.SASLPassword,
+		conns:     make(map[int32]*conn),
+		topics:    make(map[string][]partitionMetadata),
+	}
+	k.next = make(map[string]int)
+
+	// Check that the cluster is reachable without creating any topic.
+	return k.client.refreshMetadata([]string{})
+}
+
+func (k *Kafka) Close() error {
+	if k.client != nil {
+		k.client.close()
+	}
+	return nil
+}
+
+func (k *Kafka) SampleConfig() string {
+	return sampleConfig
+}
+
+func (k *Kafka) Description() string {
+	return "Configuration for the Kafka server to send metrics to"
+}
+
+// topic returns the topic of the metric.
+func (k *Kafka) topic(metric telex.Metric) string {
+	switch k.TopicSuffix.Method {
+	case "measurement":
+		return k.Topic + k.TopicSuffix.Separator + metric.Name()
+	case "tags":
+		parts := []string{k.Topic}
+		for _, key := range k.TopicSuffix.Keys {
+			if value, ok := metric.GetTag(key); ok && value != "" {
+				parts = append(parts, value)
+			}
+		}
+		return strings.Join(parts, k.TopicSuffix.Separator)
+	}
+	return k.Topic
+}
+
+// key returns the message key of the metric, nil if the message has no key.
+func (k *Kafka) key(metric telex.Metric) []byte {
+	if k.RoutingTag != "" {
+		if value, ok := metric.GetTag(k.RoutingTag); ok {
+			return []byte(value)
+		}
+	}
+	switch k.RoutingKey {
+	case "":
+		return nil
+	case "random":
+		b := make([]byte, 16)
+		if _, err := rand.Read(b); err != nil {
+			return nil
+		}
+		return []byte(hex.EncodeToString(b))
+	}
+	return []byte(k.RoutingKey)
+}
+
+// partition selects the partition of the message, by hash of the key or in
+// round-robin order if there is none.
+func (k *Kafka) partition(topic string, m *message, count int) int32 {
+	if m.key != nil {
+		h := fnv.New32a()
+		h.Write(m.key)
+		return int32(h.Sum32() % uint32(count))
+	}
+	p := k.next[topic] % count
+	k.next[topic] = p + 1
+	return int32(p)
+}
+
+// chunk is a message set for a single partition.
+type chunk struct {
+	topic     string
+	partition int32
+	messages  []*message
+}
+
+type topicPartition struct {
+	topic     string
+	partition int32
+}
+
+func (k *Kafka) Write(metrics []telex.Metric) error {
+	// Messages waiting for the metadata of their topic.
+	unassigned := make(map[string][]*message)
+	for _, metric := range metrics {
+		buf, err := k.serializer.Serialize(metric)
+		if err != nil {
+			log.Printf("D! [outputs.kafka] Could not serialize metric: %v", err)
+			continue
+		}
+
+		m := &message{key: k.key(metric), value: buf, timestamp: metric.Time()}
+		if m.size() > k.MaxMessageBytes {
+			log.Printf("E! [outputs.kafka] Dropping message of %d bytes, larger than max_message_bytes",
+				m.size())
+			continue
+		}
+
+		topic := k.topic(metric)
+		unassigned[topic] = append(unassigned[topic], m)
+	}
+
+	// Messages by topic and partition.
+	assigned := make(map[string]map[int32][]*message)
+
+	var lastErr error
+	for attempt := 0; attempt <= k.MaxRetry; attempt++ {
+		if attempt > 0 {
+			time.Sleep(k.retryBackoff)
+		}
+
+		var refresh []string
+		for topic := range unassigned {
+			if _, ok := k.client.topics[topic]; !ok || attempt > 0 {
+				refresh = append(refresh, topic)
+			}
+		}
+		if attempt > 0 {
+			for topic := range assigned {
+				if _, ok := unassigned[topic]; !ok {
+					refresh = append(refresh, topic)
+				}
+			}
+		}
+		if len(refresh) > 0 {
+			if err := k.client.refreshMetadata(refresh); err != nil {
+				lastErr = err
+				continue
+			}
+		}
+
+		for topic, messages := range unassigned {
+			partitions := k.client.topics[topic]
+			if len(partitions) == 0 {
+				lastErr = fmt.Errorf("no partitions for topic %q", topic)
+				continue
+			}
+			if assigned[topic] == nil {
+				assigned[topic] = make(map[int32][]*message)
+			}
+			for _, m := range messages {
+				p := partitions[k.partition(topic, m, len(partitions))].id
+				assigned[topic][p] = append(assigned[topic][p], m)
+			}
+			delete(unassigned, topic)
+		}
+
+		err := k.produce(assigned)
+		if err != nil {
+			if kerr, ok := err.(kafkaError); ok && !kerr.retriable() {
+				return err
+			}
+			lastErr = err
+		}
+		if len(assigned) == 0 && len(unassigned) == 0 {
+			return nil
+		}
+	}
+	return fmt.Errorf("could not write to kafka after %d retries: %v", k.MaxRetry, lastErr)
+}
+
+// produce sends the messages to the leaders of their partitions, messages
+// written are removed from the map.  It returns the last error met, the
+// messages which failed are kept for a retry.
+func (k *Kafka) produce(assigned map[string]map[int32][]*message) error {
+	var lastErr error
+
+	// Chunks by leader.
+	chunks := make(map[int32][]*chunk)
+	for topic, partitions := range assigned {
+		for partition, messages := range partitions {
+			id, _, err := k.client.leader(topic, partition)
+			if err != nil {
+				if kerr, ok := err.(kafkaError); ok && !kerr.retriable() {
+					return err
+				}
+				lastErr = err
+				continue
+			}
+			chunks[id] = append(chunks[id], k.split(topic, partition, messages)...)
+		}
+	}
+
+	for id, list := range chunks {
+		bc, ok := k.client.conns[id]
+		if !ok {
+			lastErr = errNoBrokers
+			continue
+		}
+		version, err := bc.version(apiProduce)
+		if err != nil {
+			return err
+		}
+
+		// Once a chunk failed, the next ones of the partition wait for the
+		// retry to keep the messages in order.
+		failed := make(map[topicPartition]bool)
+		for len(list) > 0 {
+			// A request has at most one message set per partition.
+			req := make(produceRequest)
+			sent := make(map[string]map[int32]*chunk)
+			var rest []*chunk
+			for _, c := range list {
+				if failed[topicPartition{c.topic, c.partition}] {
+					continue
+				}
+				if _, ok := req[c.topic][c.partition]; ok {
+					rest = append(rest, c)
+					continue
+				}
+				set, err := encodeRecords(version, c.messages, k.CompressionCodec)
+				if err != nil {
+					return err
+				}
+				if req[c.topic] == nil {
+					req[c.topic] = make(map[int32][]byte)
+					sent[c.topic] = make(map[int32]*chunk)
+				}
+				req[c.topic][c.partition] = set
+				sent[c.topic][c.partition] = c
+			}
+			list = rest
+
+			errs, err := k.send(bc, version, req)
+			if err != nil {
+				k.client.drop(id)
+				lastErr = err
+				break
+			}
+			for topic, partitions := range sent {
+				for partition, c := range partitions {
+					if perr := errs[topic][partition]; perr != errNone {
+						if !perr.retriable() {
+							return perr
+						}
+						lastErr = perr
+						failed[topicPartition{topic, partition}] = true
+						continue
+					}
+					k.done(assigned, topic, partition, len(c.messages))
+				}
+			}
+		}
+	}
+	return lastErr
+}
+
+// split divides the messages of a partition in chunks smaller than
+// max_message_bytes.
+func (k *Kafka) split(topic string, partition int32, messages []*message) []*chunk {
+	var chunks []*chunk
+	c := &chunk{topic: topic, partition: partition}
+	size := 0
+	for _, m := range messages {
+		if size+m.size() > k.MaxMessageBytes && len(c.messages) > 0 {
+			chunks = append(chunks, c)
+			c = &chunk{topic: topic, partition: partition}
+			size = 0
+		}
+		c.messages = append(c.messages, m)
+		size += m.size()
+	}
+	return append(chunks, c)
+}
+
+// done removes the first n messages of a partition after they were written,
+// the chunks of a partition are sent in order.
+func (k *Kafka) done(assigned map[string]map[int32][]*message, topic string, partition int32, n int) {
+	messages := assigned[topic][partition][n:]
+	if len(messages) > 0 {
+		assigned[topic][partition] = messages
+		return
+	}
+	delete(assigned[topic], partition)
+	if len(assigned[topic]) == 0 {
+		delete(assigned, topic)
+	}
+}
+
+// send writes a produce request to a broker, returning the error of every
+// partition.
+func (k *Kafka) send(bc *conn, version int16, req produceRequest) (produceResponse, error) {
+	body := encodeProduceRequest(version, int16(k.RequiredAcks), k.Timeout.Duration, req)
+	wait := k.RequiredAcks != 0
+	resp, err := bc.roundTrip(apiProduce, version, body, wait)
+	if err != nil {
+		return nil, err
+	}
+	if !wait {
+		return produceResponse{}, nil
+	}
+	return decodeProduceResponse(resp)
+}
+
+func init() {
+	outputs.Add("kafka", func() telex.Output {
+		return &Kafka{
+			ClientID:        "telex",
+			RequiredAcks:    -1,
+			MaxRetry:        3,
+			MaxMessageBytes: 1000000,
+			Timeout:         internal.Duration{Duration: 5 * time.Second},
+			retryBackoff:    100 * time.Millisecond,
+		}
+	})
+}
@@ -0,0 +1,949 @@
+package kafka
+
+import (
+	"bytes"
+	"compress/gzip"
+	ctls "crypto/tls"
+	"encoding/binary"
+	"hash/crc32"
+	"io"
+	"io/ioutil"
+	"net"
+	"strconv"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/golang/snappy"
+	"github.com/pierrec/lz4"
+	"github.com/stretchr/testify/require"
+
+	"github.com/lavaorg/telex"
+	"github.com/lavaorg/telex/plugins/outputs"
+	"github.com/lavaorg/telex/plugins/serializers"
+	"github.com/lavaorg/telex/testutil"
+)
+
+var pki = testutil.NewPKI("../../../testutil/pki")
+
+// Versions of the requests supported by Kafka 0.10.0, and by a recent
+// broker which no longer accepts the older versions.
+var (
+	kafka0100 = apiVersions{
+		apiProduce:       {0, 2},
+		apiMetadata:      {0, 1},
+		apiSaslHandshake: {0, 0},
+		apiApiVersions:   {0, 0},
+	}
+	kafkaRecent = apiVersions{
+		apiProduce:          {3, 11},
+		apiMetadata:         {4, 12},
+		apiSaslHandshake:    {1, 1},
+		apiApiVersions:      {0, 4},
+		apiSaslAuthenticate: {0, 2},
+	}
+)
+
+// fakeBroker is a single node Kafka cluster which keeps the messages it
+// receives.
+type fakeBroker struct {
+	t          *testing.T
+	listener   net.Listener
+	partitions int
+	username   string
+	password   string
+	// versions of the requests accepted by the broker
+	versions apiVersions
+
+	mu       sync.Mutex
+	messages map[string]map[int32][]*message
+	acks     []int16
+	metadata int
+	// versions of the requests received, by api key
+	requests map[int16][]int16
+	// errors returned for the next produce requests, one per request
+	errors []kafkaError
+}
+
+func newFakeBroker(t *testing.T, tlsConfig *ctls.Config) *fakeBroker {
+	var listener net.Listener
+	var err error
+	if tlsConfig != nil {
+		listener, err = ctls.Listen("tcp", "127.0.0.1:0", tlsConfig)
+	} else {
+		listener, err = net.Listen("tcp", "127.0.0.1:0")
+	}
+	require.NoError(t, err)
+
+	b := &fakeBroker{
+		t:          t,
+		listener:   listener,
+		partitions: 3,
+		versions:   kafkaRecent,
+		messages:   make(map[string]map[int32][]*message),
+		requests:   make(map[int16][]int16),
+	}
+	go b.serve()
+	return b
+}
+
+func (b *fakeBroker) addr() string {
+	return b.listener.Addr().String()
+}
+
+// setVersions sets the versions of the requests accepted by the broker.
+func (b *fakeBroker) setVersions(versions apiVersions) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.versions = versions
+}
+
+func (b *fakeBroker) close() {
+	b.listener.Close()
+}
+
+func (b *fakeBroker) serve() {
+	for {
+		c, err := b.listener.Accept()
+		if err != nil {
+			return
+		}
+		go b.handle(c)
+	}
+}
+
+func readFrame(r io.Reader) ([]byte, error) {
+	var size [4]byte
+	if _, err := io.ReadFull(r, size[:]); err != nil {
+		return nil, err
+	}
+	buf := make([]byte, binary.BigEndian.Uint32(size[:]))
+	_, err := io.ReadFull(r, buf)
+	return buf, err
+}
+
+func writeFrame(w io.Writer, correlationID int32, body []byte) error {
+	e := &encoder{}
+	e.int32(int32(4 + len(body)))
+	e.int32(correlationID)
+	e.buf = append(e.buf, body...)
+	_, err := w.Write(e.buf)
+	return err
+}
+
+func (b *fakeBroker) handle(c net.Conn) {
+	defer c.Close()
+	b.mu.Lock()
+	username, password := b.username, b.password
+	versions := b.versions
+	b.mu.Unlock()
+	authenticated := username == ""
+	token := "\x00" + username + "\x00" + password
+	for {
+		req, err := readFrame(c)
+		if err != nil {
+			return
+		}
+		d := &decoder{buf: req}
+		apiKey := d.int16()
+		version := d.int16()
+		correlationID := d.int32()
+		d.string() // client id
+		if d.err != nil {
+			return
+		}
+
+		b.mu.Lock()
+		b.requests[apiKey] = append(b.requests[apiKey], version)
+		b.mu.Unlock()
+		if r, ok := versions[apiKey]; !ok || version < r.min || version > r.max {
+			b.t.Errorf("unsupported version %d of api key %d", version, apiKey)
+			return
+		}
+
+		var resp []byte
+		switch apiKey {
+		case apiApiVersions:
+			e := &encoder{}
+			e.int16(int16(errNone))
+			e.int32(int32(len(versions)))
+			for key, r := range versions {
+				e.int16(key)
+				e.int16(r.min)
+				e.int16(r.max)
+			}
+			resp = e.buf
+		case apiSaslHandshake:
+			e := &encoder{}
+			if d.string() != "PLAIN" {
+				e.int16(int16(errUnsupportedSaslMech))
+			} else {
+				e.int16(int16(errNone))
+			}
+			e.int32(1)
+			e.string("PLAIN")
+			if writeFrame(c, correlationID, e.buf) != nil {
+				return
+			}
+			if version >= 1 {
+				continue
+			}
+			// The v0 token is sent without header, and its response has
+			// no correlation id.
+			frame, err := readFrame(c)
+			if err != nil || string(frame) != token {
+				return
+			}
+			if _, err := c.Write([]byte{0, 0, 0, 0}); err != nil {
+				return
+			}
+			authenticated = true
+			continue
+		case apiSaslAuthenticate:
+			e := &encoder{}
+			if string(d.bytes()) != token {
+				e.int16(int16(errSaslAuthentication))
+				e.string("invalid credentials")
+			} else {
+				e.int16(int16(errNone))
+				e.nullString()
+				authenticated = true
+			}
+			e.bytes([]byte{})
+			if version >= 1 {
+				e.int64(0) // session lifetime
+			}
+			resp = e.buf
+		case apiMetadata:
+			if !authenticated {
+				return
+			}
+			resp = b.handleMetadata(version, d)
+		case apiProduce:
+			if !authenticated {
+				return
+			}
+			var acks int16
+			acks, resp = b.handleProduce(version, d)
+			if acks == 0 {
+				continue
+			}
+		default:
+			b.t.Errorf("unexpected api key %d", apiKey)
+			return
+		}
+		if writeFrame(c, correlationID, resp) != nil {
+			return
+		}
+	}
+}
+
+func (b *fakeBroker) handleMetadata(version int16, d *decoder) []byte {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.metadata++
+
+	var topics []string
+	n := int(d.int32())
+	for i := 0; i < n; i++ {
+		topic := d.string()
+		topics = append(topics, topic)
+		if _, ok := b.messages[topic]; !ok {
+			b.messages[topic] = make(map[int32][]*message)
+		}
+	}
+	if version >= 4 {
+		d.bool() // allow auto topic creation
+	}
+	require.NoError(b.t, d.err)
+	// An empty list asks for every topic before v1, a null list after.
+	if (version == 0 && n == 0) || n == -1 {
+		for topic := range b.messages {
+			topics = append(topics, topic)
+		}
+	}
+
+	host, port, _ := net.SplitHostPort(b.addr())
+	portN, _ := strconv.Atoi(port)
+	e := &encoder{}
+	if version >= 3 {
+		e.int32(0) // throttle time
+	}
+	e.int32(1)
+	e.int32(1)
+	e.string(host)
+	e.int32(int32(portN))
+	if version >= 1 {
+		e.nullString() // rack
+	}
+	if version >= 2 {
+		e.string("cluster")
+	}
+	if version >= 1 {
+		e.int32(1) // controller
+	}
+	e.int32(int32(len(topics)))
+	for _, topic := range topics {
+		e.int16(int16(errNone))
+		e.string(topic)
+		if version >= 1 {
+			e.bool(false) // internal
+		}
+		e.int32(int32(b.partitions))
+		for p := 0; p < b.partitions; p++ {
+			e.int16(int16(errNone))
+			e.int32(int32(p))
+			e.int32(1) // leader
+			e.int32(1)
+			e.int32(1) // replicas
+			e.int32(1)
+			e.int32(1) // in sync replicas
+		}
+	}
+	return e.buf
+}
+
+func (b *fakeBroker) handleProduce(version int16, d *decoder) (int16, []byte) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if version >= 3 {
+		d.string() // transactional id
+	}
+	acks := d.int16()
+	d.int32() // timeout
+	b.acks = append(b.acks, acks)
+
+	code := errNone
+	if len(b.errors) > 0 {
+		code, b.errors = b.errors[0], b.errors[1:]
+	}
+
+	e := &encoder{}
+	n := d.arrayLen()
+	e.int32(int32(n))
+	for i := 0; i < n; i++ {
+		topic := d.string()
+		e.string(topic)
+		np := d.arrayLen()
+		e.int32(int32(np))
+		for j := 0; j < np; j++ {
+			partition := d.int32()
+			set := d.bytes()
+			if code == errNone {
+				var messages []*message
+				var err error
+				if version >= 3 {
+					messages, err = decodeRecordBatch(set)
+				} else {
+					messages, err = decodeMessageSet(set)
+				}
+				require.NoError(b.t, err)
+				b.messages[topic][partition] = append(b.messages[topic][partition], messages...)
+			}
+			e.int32(partition)
+			e.int16(int16(code))
+			e.int64(0)
+			e.int64(-1)
+		}
+	}
+	e.int32(0)
+	require.NoError(b.t, d.err)
+	return acks, e.buf
+}
+
+// versionsReceived returns the versions of the requests of the api key
+// received by the broker.
+func (b *fakeBroker) versionsReceived(apiKey int16) []int16 {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.requests[apiKey]
+}
+
+func decodeMessageSet(set []byte) ([]*message, error) {
+	var messages []*message
+	d := &decoder{buf: set}
+	for len(d.buf) > 0 {
+		d.int64() // offset
+		m := &decoder{buf: d.bytes()}
+		if d.err != nil {
+			return nil, d.err
+		}
+		crc := uint32(m.int32())
+		if crc != crc32.ChecksumIEEE(m.buf) {
+			return nil, errMalformed
+		}
+		if m.int8() != messageMagic {
+			return nil, errMalformed
+		}
+		codec := int(m.int8() & 0x07)
+		timestamp := m.int64()
+		key := m.bytes()
+		value := m.bytes()
+		if m.err != nil {
+			return nil, m.err
+		}
+
+		if codec == codecNone {
+			messages = append(messages, &message{
+				key:       key,
+				value:     value,
+				timestamp: time.Unix(0, timestamp*int64(time.Millisecond)),
+			})
+			continue
+		}
+
+		inner, err := decompress(codec, value)
+		if err != nil {
+			return nil, err
+		}
+		innerMessages, err := decodeMessageSet(inner)
+		if err != nil {
+			return nil, err
+		}
+		messages = append(messages, innerMessages...)
+	}
+	return messages, nil
+}
+
+func decodeRecordBatch(batch []byte) ([]*message, error) {
+	d := &decoder{buf: batch}
+	d.int64() // base offset
+	b := &decoder{buf: d.bytes()}
+	b.int32() // partition leader epoch
+	if b.int8() != recordMagic {
+		return nil, errMalformed
+	}
+	crc := uint32(b.int32())
+	if b.err != nil || crc != crc32.Checksum(b.buf, castagnoli) {
+		return nil, errMalformed
+	}
+	codec := int(b.int16() & 0x07)
+	b.int32() // last offset delta
+	first := b.int64()
+	b.int64() // max timestamp
+	b.int64() // producer id
+	b.int16() // producer epoch
+	b.int32() // base sequence
+	n := int(b.int32())
+	if b.err != nil || len(d.buf) > 0 {
+		return nil, errMalformed
+	}
+
+	data := b.buf
+	if codec != codecNone {
+		var err error
+		if data, err = decompress(codec, data); err != nil {
+			return nil, err
+		}
+	}
+
+	var messages []*message
+	r := &decoder{buf: data}
+	for i := 0; i < n; i++ {
+		record := &decoder{buf: r.next(int(varint(r)))}
+		record.int8() // attributes
+		timestamp := first + varint(record)
+		varint(record) // offset delta
+		var key []byte
+		if size := varint(record); size >= 0 {
+			key = record.next(int(size))
+		}
+		value := record.next(int(varint(record)))
+		if varint(record) != 0 || record.err != nil || len(record.buf) > 0 {
+			return nil, errMalformed
+		}
+		messages = append(messages, &message{
+			key:       key,
+			value:     value,
+			timestamp: time.Unix(0, timestamp*int64(time.Millisecond)),
+		})
+	}
+	if r.err != nil || len(r.buf) > 0 {
+		return nil, errMalformed
+	}
+	return messages, nil
+}
+
+// varint reads a zigzag variable length integer.
+func varint(d *decoder) int64 {
+	if d.err != nil {
+		return 0
+	}
+	v, n := binary.Varint(d.buf)
+	if n <= 0 {
+		d.err = errMalformed
+		return 0
+	}
+	d.buf = d.buf[n:]
+	return v
+}
+
+func decompress(codec int, data []byte) ([]byte, error) {
+	switch codec {
+	case codecGzip:
+		r, err := gzip.NewReader(bytes.NewReader(data))
+		if err != nil {
+			return nil, err
+		}
+		return ioutil.ReadAll(r)
+	case codecSnappy:
+		return snappy.Decode(nil, data)
+	case codecLZ4:
+		return ioutil.ReadAll(lz4.NewReader(bytes.NewReader(data)))
+	}
+	return nil, errMalformed
+}
+
+// received returns the messages of a topic in every partition.
+func (b *fakeBroker) received(topic string) []*message {
+	var messages []*message
+	for p := 0; p < b.partitions; p++ {
+		messages = append(messages, b.partition(topic, int32(p))...)
+	}
+	return messages
+}
+
+func (b *fakeBroker) partition(topic string, partition int32) []*message {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.messages[topic][partition]
+}
+
+func (b *fakeBroker) topics() []string {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	var topics []string
+	for topic, partitions := range b.messages {
+		if len(partitions) > 0 {
+			topics = append(topics, topic)
+		}
+	}
+	return topics
+}
+
+func newKafka(t *testing.T, b *fakeBroker) *Kafka {
+	k := outputs.Outputs["kafka"]().(*Kafka)
+	k.Brokers = []string{b.addr()}
+	k.Topic = "telex"
+	k.retryBackoff = 0
+	s, err := serializers.NewInfluxSerializer()
+	require.NoError(t, err)
+	k.SetSerializer(s)
+	return k
+}
+
+func cpu(host string) telex.Metric {
+	return testutil.MustMetric("cpu",
+		map[string]string{"host": host},
+		map[string]interface{}{"usage": 42.0},
+		time.Unix(1500000000, 0))
+}
+
+func TestWrite_TopicSuffix(t *testing.T) {
+	tests := []struct {
+		name     string
+		suffix   TopicSuffix
+		expected []string
+	}{
+		{
+			name:     "no suffix",
+			expected: []string{"telex"},
+		},
+		{
+			name:     "measurement",
+			suffix:   TopicSuffix{Method: "measurement", Separator: "_"},
+			expected: []string{"telex_cpu"},
+		},
+		{
+			name:     "tags",
+			suffix:   TopicSuffix{Method: "tags", Keys: []string{"host", "missing"}, Separator: "__"},
+			expected: []string{"telex__a", "telex__b"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			b := newFakeBroker(t, nil)
+			defer b.close()
+
+			k := newKafka(t, b)
+			k.TopicSuffix = tt.suffix
+			require.NoError(t, k.Connect())
+			defer k.Close()
+
+			require.NoError(t, k.Write([]telex.Metric{cpu("a"), cpu("b")}))
+			require.ElementsMatch(t, tt.expected, b.topics())
+		})
+	}
+}
+
+func TestWrite_Key(t *testing.T) {
+	tests := []struct {
+		name       string
+		routingTag string
+		routingKey string
+		check      func(t *testing.T, messages []*message)
+	}{
+		{
+			name: "no key",
+			check: func(t *testing.T, messages []*message) {
+				for _, m := range messages {
+					require.Nil(t, m.key)
+				}
+			},
+		},
+		{
+			name:       "routing tag",
+			routingTag: "host",
+			routingKey: "fallback",
+			check: func(t *testing.T, messages []*message) {
+				var keys []string
+				for _, m := range messages {
+					keys = append(keys, string(m.key))
+				}
+				require.ElementsMatch(t, []string{"a", "b", "fallback"}, keys)
+			},
+		},
+		{
+			name:       "random",
+			routingKey: "random",
+			check: func(t *testing.T, messages []*message) {
+				require.Len(t, messages[0].key, 32)
+				require.NotEqual(t, messages[0].key, messages[1].key)
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			b := newFakeBroker(t, nil)
+			defer b.close()
+
+			k := newKafka(t, b)
+			k.RoutingTag = tt.routingTag
+			k.RoutingKey = tt.routingKey
+			require.NoError(t, k.Connect())
+			defer k.Close()
+
+			noHost := testutil.MustMetric("cpu", map[string]string{},
+				map[string]interface{}{"usage": 42.0}, time.Unix(1500000000, 0))
+			require.NoError(t, k.Write([]telex.Metric{cpu("a"), cpu("b"), noHost}))
+
+			messages := b.received("telex")
+			require.Len(t, messages, 3)
+			tt.check(t, messages)
+		})
+	}
+}
+
+func TestWrite_Partitioning(t *testing.T) {
+	b := newFakeBroker(t, nil)
+	defer b.close()
+
+	k := newKafka(t, b)
+	k.RoutingTag = "host"
+	require.NoError(t, k.Connect())
+	defer k.Close()
+
+	var metrics []telex.Metric
+	for i := 0; i < 6; i++ {
+		metrics = append(metrics, cpu("a"))
+	}
+	require.NoError(t, k.Write(metrics))
+
+	// Messages with the same key land in the same partition.
+	used := 0
+	for p := 0; p < b.partitions; p++ {
+		if messages := b.partition("telex", int32(p)); len(messages) > 0 {
+			require.Len(t, messages, 6)
+			used++
+		}
+	}
+	require.Equal(t, 1, used)
+
+	// Messages without a key are spread over the partitions.
+	k.RoutingTag = ""
+	require.NoError(t, k.Write(metrics))
+	for p := 0; p < b.partitions; p++ {
+		require.NotEmpty(t, b.partition("telex", int32(p)))
+	}
+}
+
+var brokerVersions = map[string]apiVersions{
+	"0.10.0": kafka0100,
+	"recent": kafkaRecent,
+}
+
+func TestWrite_Compression(t *testing.T) {
+	for name, versions := range brokerVersions {
+		for _, codec := range []int{codecNone, codecGzip, codecSnappy, codecLZ4} {
+			t.Run(name+"/"+strconv.Itoa(codec), func(t *testing.T) {
+				b := newFakeBroker(t, nil)
+				b.setVersions(versions)
+				defer b.close()
+
+				k := newKafka(t, b)
+				k.CompressionCodec = codec
+				require.NoError(t, k.Connect())
+				defer k.Close()
+
+				metric := cpu("a")
+				require.NoError(t, k.Write([]telex.Metric{metric, metric}))
+
+				expected, err := k.serializer.Serialize(metric)
+				require.NoError(t, err)
+				messages := b.received("telex")
+				require.Len(t, messages, 2)
+				for _, m := range messages {
+					require.Equal(t, expected, m.value)
+					require.Equal(t, metric.Time(), m.timestamp)
+				}
+			})
+		}
+	}
+}
+
+func TestConnect_Versions(t *testing.T) {
+	tests := []struct {
+		versions apiVersions
+		produce  []int16
+		metadata int16
+	}{
+		{versions: kafka0100, produce: []int16{2}, metadata: 1},
+		{versions: kafkaRecent, produce: []int16{3}, metadata: 4},
+	}
+	for _, tt := range tests {
+		b := newFakeBroker(t, nil)
+		b.setVersions(tt.versions)
+		defer b.close()
+
+		k := newKafka(t, b)
+		k.RoutingKey = "same"
+		require.NoError(t, k.Connect())
+		defer k.Close()
+		require.NoError(t, k.Write([]telex.Metric{cpu("a")}))
+
+		require.Equal(t, tt.produce, b.versionsReceived(apiProduce))
+		for _, v := range b.versionsReceived(apiMetadata) {
+			require.Equal(t, tt.metadata, v)
+		}
+	}
+}
+
+func TestConnect_UnsupportedVersions(t *testing.T) {
+	b := newFakeBroker(t, nil)
+	b.setVersions(apiVersions{
+		apiProduce:     {0, 1},
+		apiMetadata:    {0, 1},
+		apiApiVersions: {0, 0},
+	})
+	defer b.close()
+
+	k := newKafka(t, b)
+	require.NoError(t, k.Connect())
+	defer k.Close()
+
+	require.Error(t, k.Write([]telex.Metric{cpu("a")}))
+	require.Empty(t, b.versionsReceived(apiProduce))
+}
+
+func TestWrite_RequiredAcks(t *testing.T) {
+	for _, acks := range []int{-1, 0, 1} {
+		t.Run(strconv.Itoa(acks), func(t *testing.T) {
+			b := newFakeBroker(t, nil)
+			defer b.close()
+
+			k := newKafka(t, b)
+			k.RequiredAcks = acks
+			require.NoError(t, k.Connect())
+			defer k.Close()
+
+			require.NoError(t, k.Write([]telex.Metric{cpu("a")}))
+			require.NoError(t, k.Write([]telex.Metric{cpu("b")}))
+
+			// Without acknowledgement, the broker may still be reading.
+			deadline := time.Now().Add(5 * time.Second)
+			for len(b.received("telex")) < 2 && time.Now().Before(deadline) {
+				time.Sleep(10 * time.Millisecond)
+			}
+			require.Len(t, b.received("telex"), 2)
+			b.mu.Lock()
+			require.Equal(t, []int16{int16(acks), int16(acks)}, b.acks)
+			b.mu.Unlock()
+		})
+	}
+}
+
+func TestWrite_MaxMessageBytes(t *testing.T) {
+	b := newFakeBroker(t, nil)
+	defer b.close()
+
+	k := newKafka(t, b)
+	k.RoutingKey = "same"
+	require.NoError(t, k.Connect())
+	defer k.Close()
+
+	metric := cpu("a")
+	buf, err := k.serializer.Serialize(metric)
+	require.NoError(t, err)
+	size := (&message{key: []byte("same"), value: buf}).size()
+
+	// Two messages fit a request, the third one is sent in another one.
+	k.MaxMessageBytes = 2 * size
+	require.NoError(t, k.Write([]telex.Metric{metric, metric, metric}))
+	require.Len(t, b.received("telex"), 3)
+	b.mu.Lock()
+	require.Len(t, b.acks, 2)
+	b.mu.Unlock()
+
+	// Messages larger than the limit are dropped.
+	k.MaxMessageBytes = size - 1
+	require.NoError(t, k.Write([]telex.Metric{metric}))
+	require.Len(t, b.received("telex"), 3)
+}
+
+func TestWrite_Retry(t *testing.T) {
+	b := newFakeBroker(t, nil)
+	defer b.close()
+
+	k := newKafka(t, b)
+	require.NoError(t, k.Connect())
+	defer k.Close()
+
+	b.mu.Lock()
+	b.errors = []kafkaError{errNotLeaderForPartition, errLeaderNotAvailable}
+	metadata := b.metadata
+	b.mu.Unlock()
+
+	require.NoError(t, k.Write([]telex.Metric{cpu("a")}))
+	require.Len(t, b.received("telex"), 1)
+
+	// The metadata is refreshed before every retry.
+	b.mu.Lock()
+	require.Equal(t, metadata+3, b.metadata)
+	b.mu.Unlock()
+}
+
+func TestWrite_RetryExhausted(t *testing.T) {
+	b := newFakeBroker(t, nil)
+	defer b.close()
+
+	k := newKafka(t, b)
+	k.MaxRetry = 1
+	require.NoError(t, k.Connect())
+	defer k.Close()
+
+	b.mu.Lock()
+	b.errors = []kafkaError{errNotLeaderForPartition, errNotLeaderForPartition}
+	b.mu.Unlock()
+
+	require.Error(t, k.Write([]telex.Metric{cpu("a")}))
+	require.Empty(t, b.received("telex"))
+
+	// The metrics are written at the next flush.
+	require.NoError(t, k.Write([]telex.Metric{cpu("a")}))
+	require.Len(t, b.received("telex"), 1)
+}
+
+func TestWrite_NotRetriable(t *testing.T) {
+	b := newFakeBroker(t, nil)
+	defer b.close()
+
+	k := newKafka(t, b)
+	require.NoError(t, k.Connect())
+	defer k.Close()
+
+	b.mu.Lock()
+	b.errors = []kafkaError{errTopicAuthorization}
+	b.mu.Unlock()
+
+	err := k.Write([]telex.Metric{cpu("a")})
+	require.Equal(t, errTopicAuthorization, err)
+	b.mu.Lock()
+	require.Len(t, b.acks, 1)
+	b.mu.Unlock()
+}
+
+func TestWrite_Reconnect(t *testing.T) {
+	b := newFakeBroker(t, nil)
+	defer b.close()
+
+	k := newKafka(t, b)
+	require.NoError(t, k.Connect())
+	defer k.Close()
+
+	require.NoError(t, k.Write([]telex.Metric{cpu("a")}))
+
+	// A connection closed by the broker is opened again on retry.
+	for _, c := range k.client.conns {
+		c.Conn.Close()
+	}
+	require.NoError(t, k.Write([]telex.Metric{cpu("b")}))
+	require.Len(t, b.received("telex"), 2)
+}
+
+func TestConnect_NoBroker(t *testing.T) {
+	b := newFakeBroker(t, nil)
+	b.close()
+
+	k := newKafka(t, b)
+	k.Timeout.Duration = time.Second
+	require.Error(t, k.Connect())
+}
+
+func TestConnect_SASL(t *testing.T) {
+	for name, versions := range brokerVersions {
+		t.Run(name, func(t *testing.T) {
+			b := newFakeBroker(t, nil)
+			defer b.close()
+			b.mu.Lock()
+			b.username = "telex"
+			b.password = "secret"
+			b.versions = versions
+			b.mu.Unlock()
+
+			k := newKafka(t, b)
+			k.SASLUsername = "telex"
+			k.SASLPassword = "secret"
+			require.NoError(t, k.Connect())
+			defer k.Close()
+			require.NoError(t, k.Write([]telex.Metric{cpu("a")}))
+			require.Len(t, b.received("telex"), 1)
+
+			k = newKafka(t, b)
+			k.SASLUsername = "telex"
+			k.SASLPassword = "wrong"
+			require.Error(t, k.Connect())
+		})
+	}
+}
+
+func TestConnect_TLS(t *testing.T) {
+	serverConfig, err := pki.TLSServerConfig().TLSConfig()
+	require.NoError(t, err)
+	b := newFakeBroker(t, serverConfig)
+	defer b.close()
+
+	k := newKafka(t, b)
+	k.ClientConfig = *pki.TLSClientConfig()
+	require.NoError(t, k.Connect())
+	defer k.Close()
+	require.NoError(t, k.Write([]telex.Metric{cpu("a")}))
+	require.Len(t, b.received("telex"), 1)
+}
+
+func TestConnect_InvalidOptions(t *testing.T) {
+	b := newFakeBroker(t, nil)
+	defer b.close()
+
+	k := newKafka(t, b)
+	k.CompressionCodec = 4
+	require.Error(t, k.Connect())
+
+	k = newKafka(t, b)
+	k.RequiredAcks = 2
+	require.Error(t, k.Connect())
+
+	k = newKafka(t, b)
+	k.TopicSuffix.Method = "field"
+	require.Error(t, k.Connect())
+}
@@ -0,0 +1,621 @@
+package kafka
+
+import (
+	"bytes"
+	"compress/gzip"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"hash/crc32"
+	"time"
+
+	"github.com/golang/snappy"
+	"github.com/pierrec/lz4"
+)
+
+// This file implements the subset of the Kafka protocol needed to produce
+// messages.  The version of each request is negotiated with the broker from
+// its ApiVersions response: produce v3 with record batches (message format
+// v2) or produce v2 with message format v1, metadata v0 to v4, and the SASL
+// handshake v1 followed by SaslAuthenticate or the v0 handshake followed by
+// the raw token.  Kafka 0.10.0 and later answer ApiVersions, the newest
+// brokers no longer accept the older versions.
+
+// API keys of the requests.
+const (
+	apiProduce          int16 = 0
+	apiMetadata         int16 = 3
+	apiSaslHandshake    int16 = 17
+	apiApiVersions      int16 = 18
+	apiSaslAuthenticate int16 = 36
+)
+
+// Compression codecs, stored in the message attributes.
+const (
+	codecNone   = 0
+	codecGzip   = 1
+	codecSnappy = 2
+	codecLZ4    = 3
+)
+
+// Magic bytes of the message formats.
+const (
+	messageMagic = 1
+	recordMagic  = 2
+)
+
+// versionRange is the range of versions of a request supported by the
+// client, or by a broker.
+type versionRange struct {
+	min, max int16
+}
+
+// Versions of the requests supported by the client.
+var clientVersions = map[int16]versionRange{
+	apiProduce:          {2, 3},
+	apiMetadata:         {0, 4},
+	apiSaslHandshake:    {0, 1},
+	apiSaslAuthenticate: {0, 1},
+}
+
+// apiVersions holds the versions of the requests supported by a broker.
+type apiVersions map[int16]versionRange
+
+// version returns the highest version of the request supported by both the
+// client and the broker.
+func (v apiVersions) version(apiKey int16) (int16, error) {
+	client := clientVersions[apiKey]
+	broker, ok := v[apiKey]
+	if ok && broker.max >= client.min && broker.min <= client.max {
+		if broker.max < client.max {
+			return broker.max, nil
+		}
+		return client.max, nil
+	}
+	return 0, fmt.Errorf("kafka: broker does not support versions %d to %d of request %d",
+		client.min, client.max, apiKey)
+}
+
+// kafkaError is an error code returned by a broker.
+type kafkaError int16
+
+// Error codes handled by the producer.
+const (
+	errNone                    kafkaError = 0
+	errUnknownTopicOrPartition kafkaError = 3
+	errLeaderNotAvailable      kafkaError = 5
+	errNotLeaderForPartition   kafkaError = 6
+	errRequestTimedOut         kafkaError = 7
+	errMessageTooLarge         kafkaError = 10
+	errNetworkException        kafkaError = 13
+	errNotEnoughReplicas       kafkaError = 19
+	errNotEnoughReplicasAfter  kafkaError = 20
+	errTopicAuthorization      kafkaError = 29
+	errUnsupportedSaslMech     kafkaError = 33
+	errIllegalSaslState        kafkaError = 34
+	errUnsupportedVersion      kafkaError = 35
+	errSaslAuthentication      kafkaError = 58
+)
+
+var kafkaErrorNames = map[kafkaError]string{
+	errUnknownTopicOrPartition: "unknown topic or partition",
+	errLeaderNotAvailable:      "leader not available",
+	errNotLeaderForPartition:   "not leader for partition",
+	errRequestTimedOut:         "request timed out",
+	errMessageTooLarge:         "message too large",
+	errNetworkException:        "network exception",
+	errNotEnoughReplicas:       "not enough replicas",
+	errNotEnoughReplicasAfter:  "not enough replicas after append",
+	errTopicAuthorization:      "topic authorization failed",
+	errUnsupportedSaslMech:     "unsupported SASL mechanism",
+	errIllegalSaslState:        "illegal SASL state",
+	errUnsupportedVersion:      "unsupported version",
+	errSaslAuthentication:      "SASL authentication failed",
+}
+
+func (e kafkaError) Error() string {
+	if name, ok := kafkaErrorNames[e]; ok {
+		return fmt.Sprintf("kafka: %s", name)
+	}
+	return fmt.Sprintf("kafka: error code %d", int16(e))
+}
+
+// retriable returns true if the request may succeed after refreshing the
+// metadata.
+func (e kafkaError) retriable() bool {
+	switch e {
+	case errUnknownTopicOrPartition, errLeaderNotAvailable,
+		errNotLeaderForPartition, errRequestTimedOut, errNetworkException,
+		errNotEnoughReplicas, errNotEnoughReplicasAfter:
+		return true
+	}
+	return false
+}
+
+var errMalformed = errors.New("kafka: malformed response")
+
+// encoder appends big-endian protocol primitives to a buffer.
+type encoder struct {
+	buf []byte
+}
+
+func (e *encoder) int8(v int8) {
+	e.buf = append(e.buf, byte(v))
+}
+
+func (e *encoder) int16(v int16) {
+	e.buf = append(e.buf, 0, 0)
+	binary.BigEndian.PutUint16(e.buf[len(e.buf)-2:], uint16(v))
+}
+
+func (e *encoder) int32(v int32) {
+	e.buf = append(e.buf, 0, 0, 0, 0)
+	binary.BigEndian.PutUint32(e.buf[len(e.buf)-4:], uint32(v))
+}
+
+func (e *encoder) int64(v int64) {
+	e.buf = append(e.buf, 0, 0, 0, 0, 0, 0, 0, 0)
+	binary.BigEndian.PutUint64(e.buf[len(e.buf)-8:], uint64(v))
+}
+
+// varint encodes a zigzag variable length integer, used by the records.
+func (e *encoder) varint(v int64) {
+	var b [binary.MaxVarintLen64]byte
+	e.buf = append(e.buf, b[:binary.PutVarint(b[:], v)]...)
+}
+
+func (e *encoder) bool(v bool) {
+	if v {
+		e.int8(1)
+	} else {
+		e.int8(0)
+	}
+}
+
+func (e *encoder) string(s string) {
+	e.int16(int16(len(s)))
+	e.buf = append(e.buf, s...)
+}
+
+// nullString encodes a null string.
+func (e *encoder) nullString() {
+	e.int16(-1)
+}
+
+// bytes encodes a byte array, nil is encoded as null.
+func (e *encoder) bytes(b []byte) {
+	if b == nil {
+		e.int32(-1)
+		return
+	}
+	e.int32(int32(len(b)))
+	e.buf = append(e.buf, b...)
+}
+
+// decoder reads big-endian protocol primitives from a buffer, the first
+// error is kept and every later read returns zero values.
+type decoder struct {
+	buf []byte
+	err error
+}
+
+func (d *decoder) next(n int) []byte {
+	if d.err != nil {
+		return nil
+	}
+	if n < 0 || len(d.buf) < n {
+		d.err = errMalformed
+		return nil
+	}
+	b := d.buf[:n]
+	d.buf = d.buf[n:]
+	return b
+}
+
+func (d *decoder) int8() int8 {
+	b := d.next(1)
+	if b == nil {
+		return 0
+	}
+	return int8(b[0])
+}
+
+func (d *decoder) int16() int16 {
+	b := d.next(2)
+	if b == nil {
+		return 0
+	}
+	return int16(binary.BigEndian.Uint16(b))
+}
+
+func (d *decoder) int32() int32 {
+	b := d.next(4)
+	if b == nil {
+		return 0
+	}
+	return int32(binary.BigEndian.Uint32(b))
+}
+
+func (d *decoder) int64() int64 {
+	b := d.next(8)
+	if b == nil {
+		return 0
+	}
+	return int64(binary.BigEndian.Uint64(b))
+}
+
+func (d *decoder) bool() bool {
+	return d.int8() != 0
+}
+
+func (d *decoder) string() string {
+	n := d.int16()
+	if n == -1 {
+		return ""
+	}
+	return string(d.next(int(n)))
+}
+
+func (d *decoder) bytes() []byte {
+	n := d.int32()
+	if n == -1 {
+		return nil
+	}
+	return d.next(int(n))
+}
+
+// arrayLen reads the length of an array, guarding against lengths which can
+// not fit the remaining buffer.
+func (d *decoder) arrayLen() int {
+	n := int(d.int32())
+	if n < 0 || n > len(d.buf) {
+		if n != -1 && d.err == nil {
+			d.err = errMalformed
+		}
+		return 0
+	}
+	return n
+}
+
+// encodeRequest frames a request body with its size and header.
+func encodeRequest(apiKey, version int16, correlationID int32, clientID string, body []byte) []byte {
+	e := &encoder{buf: make([]byte, 4, 4+14+len(clientID)+len(body))}
+	e.int16(apiKey)
+	e.int16(version)
+	e.int32(correlationID)
+	e.string(clientID)
+	e.buf = append(e.buf, body...)
+	binary.BigEndian.PutUint32(e.buf, uint32(len(e.buf)-4))
+	return e.buf
+}
+
+// broker is the address of a broker of the cluster.
+type broker struct {
+	id   int32
+	addr string
+}
+
+type partitionMetadata struct {
+	err    kafkaError
+	id     int32
+	leader int32
+}
+
+type topicMetadata struct {
+	err        kafkaError
+	name       string
+	partitions []partitionMetadata
+}
+
+type metadataResponse struct {
+	brokers []broker
+	topics  []topicMetadata
+}
+
+// encodeMetadataRequest encodes the request for the topics, which are
+// created if the cluster allows it.  Before v1 an empty list asks for every
+// topic, after for none.
+func encodeMetadataRequest(version int16, topics []string) []byte {
+	e := &encoder{}
+	e.int32(int32(len(topics)))
+	for _, topic := range topics {
+		e.string(topic)
+	}
+	if version >= 4 {
+		e.bool(true) // allow auto topic creation
+	}
+	return e.buf
+}
+
+func decodeMetadataResponse(version int16, b []byte) (*metadataResponse, error) {
+	d := &decoder{buf: b}
+	resp := &metadataResponse{}
+
+	if version >= 3 {
+		d.int32() // throttle time
+	}
+	n := d.arrayLen()
+	for i := 0; i < n; i++ {
+		id := d.int32()
+		host := d.string()
+		port := d.int32()
+		if version >= 1 {
+			d.string() // rack
+		}
+		resp.brokers = append(resp.brokers, broker{
+			id:   id,
+			addr: fmt.Sprintf("%s:%d", host, port),
+		})
+	}
+	if version >= 2 {
+		d.string() // cluster id
+	}
+	if version >= 1 {
+		d.int32() // controller id
+	}
+
+	n = d.arrayLen()
+	for i := 0; i < n; i++ {
+		topic := topicMetadata{
+			err:  kafkaError(d.int16()),
+			name: d.string(),
+		}
+		if version >= 1 {
+			d.bool() // is internal
+		}
+		np := d.arrayLen()
+		for j := 0; j < np; j++ {
+			partition := partitionMetadata{
+				err:    kafkaError(d.int16()),
+				id:     d.int32(),
+				leader: d.int32(),
+			}
+			for k, nr := 0, d.arrayLen(); k < nr; k++ {
+				d.int32() // replicas
+			}
+			for k, ni := 0, d.arrayLen(); k < ni; k++ {
+				d.int32() // in sync replicas
+			}
+			topic.partitions = append(topic.partitions, partition)
+		}
+		resp.topics = append(resp.topics, topic)
+	}
+	return resp, d.err
+}
+
+// message is a Kafka message, the key may be nil.
+type message struct {
+	key       []byte
+	value     []byte
+	timestamp time.Time
+}
+
+// size returns the encoded size of the message in a message set.
+func (m *message) size() int {
+	return 8 + 4 + 4 + 1 + 1 + 8 + 4 + len(m.key) + 4 + len(m.value)
+}
+
+func encodeMessage(e *encoder, offset int64, attributes int8, timestamp int64, key, value []byte) {
+	e.int64(offset)
+	sizeAt := len(e.buf)
+	e.int32(0)
+	crcAt := len(e.buf)
+	e.int32(0)
+	e.int8(messageMagic)
+	e.int8(attributes)
+	e.int64(timestamp)
+	e.bytes(key)
+	e.bytes(value)
+	binary.BigEndian.PutUint32(e.buf[sizeAt:], uint32(len(e.buf)-crcAt))
+	binary.BigEndian.PutUint32(e.buf[crcAt:], crc32.ChecksumIEEE(e.buf[crcAt+4:]))
+}
+
+func millis(t time.Time) int64 {
+	return t.UnixNano() / int64(time.Millisecond)
+}
+
+// encodeMessageSet encodes the messages in message format v1, wrapping them
+// in a single compressed message unless the codec is codecNone.
+func encodeMessageSet(messages []*message, codec int) ([]byte, error) {
+	e := &encoder{}
+	for i, m := range messages {
+		encodeMessage(e, int64(i), 0, millis(m.timestamp), m.key, m.value)
+	}
+	if codec == codecNone {
+		return e.buf, nil
+	}
+
+	compressed, err := compress(codec, e.buf)
+	if err != nil {
+		return nil, err
+	}
+
+	// The timestamp of the wrapper is the one of the last message.
+	last := messages[len(messages)-1]
+	w := &encoder{}
+	encodeMessage(w, int64(len(messages)-1), int8(codec), millis(last.timestamp), nil, compressed)
+	return w.buf, nil
+}
+
+var castagnoli = crc32.MakeTable(crc32.Castagnoli)
+
+// encodeRecordBatch encodes the messages in a record batch, message format
+// v2, with the records compressed unless the codec is codecNone.
+func encodeRecordBatch(messages []*message, codec int) ([]byte, error) {
+	first := millis(messages[0].timestamp)
+	max := first
+	records := &encoder{}
+	for i, m := range messages {
+		ts := millis(m.timestamp)
+		if ts > max {
+			max = ts
+		}
+
+		r := &encoder{}
+		r.int8(0) // attributes
+		r.varint(ts - first)
+		r.varint(int64(i))
+		if m.key == nil {
+			r.varint(-1)
+		} else {
+			r.varint(int64(len(m.key)))
+			r.buf = append(r.buf, m.key...)
+		}
+		r.varint(int64(len(m.value)))
+		r.buf = append(r.buf, m.value...)
+		r.varint(0) // headers
+
+		records.varint(int64(len(r.buf)))
+		records.buf = append(records.buf, r.buf...)
+	}
+
+	data := records.buf
+	if codec != codecNone {
+		var err error
+		if data, err = compress(codec, data); err != nil {
+			return nil, err
+		}
+	}
+
+	e := &encoder{}
+	e.int64(0) // base offset
+	lengthAt := len(e.buf)
+	e.int32(0)
+	e.int32(-1) // partition leader epoch
+	e.int8(recordMagic)
+	crcAt := len(e.buf)
+	e.int32(0)
+	e.int16(int16(codec)) // attributes
+	e.int32(int32(len(messages) - 1))
+	e.int64(first)
+	e.int64(max)
+	e.int64(-1) // producer id
+	e.int16(-1) // producer epoch
+	e.int32(-1) // base sequence
+	e.int32(int32(len(messages)))
+	e.buf = append(e.buf, data...)
+	binary.BigEndian.PutUint32(e.buf[lengthAt:], uint32(len(e.buf)-lengthAt-4))
+	binary.BigEndian.PutUint32(e.buf[crcAt:], crc32.Checksum(e.buf[crcAt+4:], castagnoli))
+	return e.buf, nil
+}
+
+// encodeRecords encodes the messages in the message format of the produce
+// request version.
+func encodeRecords(version int16, messages []*message, codec int) ([]byte, error) {
+	if version >= 3 {
+		return encodeRecordBatch(messages, codec)
+	}
+	return encodeMessageSet(messages, codec)
+}
+
+func compress(codec int, data []byte) ([]byte, error) {
+	var buf bytes.Buffer
+	switch codec {
+	case codecGzip:
+		w := gzip.NewWriter(&buf)
+		if _, err := w.Write(data); err != nil {
+			return nil, err
+		}
+		if err := w.Close(); err != nil {
+			return nil, err
+		}
+	case codecSnappy:
+		return snappy.Encode(nil, data), nil
+	case codecLZ4:
+		w := lz4.NewWriter(&buf)
+		if _, err := w.Write(data); err != nil {
+			return nil, err
+		}
+		if err := w.Close(); err != nil {
+			return nil, err
+		}
+	default:
+		return nil, fmt.Errorf("kafka: unsupported compression codec %d", codec)
+	}
+	return buf.Bytes(), nil
+}
+
+// produceRequest holds the message sets to produce by topic and partition.
+type produceRequest map[string]map[int32][]byte
+
+func encodeProduceRequest(version int16, acks int16, timeout time.Duration, req produceRequest) []byte {
+	e := &encoder{}
+	if version >= 3 {
+		e.nullString() // transactional id
+	}
+	e.int16(acks)
+	e.int32(int32(timeout / time.Millisecond))
+	e.int32(int32(len(req)))
+	for topic, partitions := range req {
+		e.string(topic)
+		e.int32(int32(len(partitions)))
+		for partition, set := range partitions {
+			e.int32(partition)
+			e.bytes(set)
+		}
+	}
+	return e.buf
+}
+
+// produceResponse holds the error of every partition by topic and partition.
+type produceResponse map[string]map[int32]kafkaError
+
+func decodeProduceResponse(b []byte) (produceResponse, error) {
+	d := &decoder{buf: b}
+	resp := make(produceResponse)
+	n := d.arrayLen()
+	for i := 0; i < n; i++ {
+		topic := d.string()
+		resp[topic] = make(map[int32]kafkaError)
+		np := d.arrayLen()
+		for j := 0; j < np; j++ {
+			partition := d.int32()
+			resp[topic][partition] = kafkaError(d.int16())
+			d.int64() // base offset
+			d.int64() // log append time
+		}
+	}
+	d.int32() // throttle time
+	return resp, d.err
+}
+
+func decodeApiVersionsResponse(b []byte) (kafkaError, apiVersions, error) {
+	d := &decoder{buf: b}
+	code := kafkaError(d.int16())
+	versions := make(apiVersions)
+	for i, n := 0, d.arrayLen(); i < n; i++ {
+		key := d.int16()
+		versions[key] = versionRange{min: d.int16(), max: d.int16()}
+	}
+	return code, versions, d.err
+}
+
+func encodeSaslHandshakeRequest(mechanism string) []byte {
+	e := &encoder{}
+	e.string(mechanism)
+	return e.buf
+}
+
+func decodeSaslHandshakeResponse(b []byte) (kafkaError, []string, error) {
+	d := &decoder{buf: b}
+	code := kafkaError(d.int16())
+	var mechanisms []string
+	for i, n := 0, d.arrayLen(); i < n; i++ {
+		mechanisms = append(mechanisms, d.string())
+	}
+	return code, mechanisms, d.err
+}
+
+func encodeSaslAuthenticateRequest(token []byte) []byte {
+	e := &encoder{}
+	e.bytes(token)
+	return e.buf
+}
+
+func decodeSaslAuthenticateResponse(b []byte) (kafkaError, string, error) {
+	d := &decoder{buf: b}
+	code := kafkaError(d.int16())
+	message := d.string()
+	d.bytes() // auth bytes
+	return code, message, d.err
+}
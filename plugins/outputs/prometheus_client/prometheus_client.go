@@ -0,0 +1,505 @@
+package prometheus_client
+
+import (
+	"context"
+	"crypto/subtle"
+	"crypto/tls"
+	"fmt"
+	"log"
+	"math"
+	"net"
+	"net/http"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/lavaorg/telex"
+	"github.com/lavaorg/telex/internal"
+	tlsint "github.com/lavaorg/telex/internal/tls"
+	"github.com/lavaorg/telex/plugins/outputs"
+)
+
+var (
+	invalidNameCharRE  = regexp.MustCompile(`[^a-zA-Z0-9_:]`)
+	invalidLabelCharRE = regexp.MustCompile(`[^a-zA-Z0-9_]`)
+
+	labelValueEscaper = strings.NewReplacer(`\`, `\\`, "\n", `\n`, `"`, `\"`)
+)
+
+const contentType = "text/plain; version=0.0.4; charset=utf-8"
+
+// sample is a single series of a metric family.  Summaries and histograms
+// keep their quantiles or buckets in bounds, keyed by the quantile or upper
+// bound.
+type sample struct {
+	labels     map[string]string
+	value      float64
+	sum        float64
+	count      float64
+	bounds     map[float64]float64
+	timestamp  time.Time
+	expiration time.Time
+}
+
+type family struct {
+	typ     telex.ValueType
+	samples map[string]*sample
+}
+
+type PrometheusClient struct {
+	Listen             string
+	Path               string
+	BasicUsername      string
+	BasicPassword      string
+	ExpirationInterval internal.Duration
+	StringAsLabel      bool
+	ExportTimestamp    bool
+	tlsint.ServerConfig
+
+	server   *http.Server
+	listener net.Listener
+	url      string
+	wg       sync.WaitGroup
+
+	sync.Mutex
+	families map[string]*family
+	now      func() time.Time
+}
+
+var sampleConfig = `
+  ## Address to listen on
+  listen = ":9273"
+
+  ## Path to publish the metrics on.
+  # path = "/metrics"
+
+  ## Use HTTP Basic Authentication.
+  # basic_username = "Foo"
+  # basic_password = "Bar"
+
+  ## Expiration interval for each series, series which are not updated
+  ## within the interval are no longer exposed.  0 == no expiration
+  # expiration_interval = "60s"
+
+  ## Send string fields as labels, otherwise they are dropped.
+  # string_as_label = true
+
+  ## If set, enable TLS with the given certificate.
+  # tls_cert = "/etc/ssl/telex.crt"
+  # tls_key = "/etc/ssl/telex.key"
+
+  ## Set one or more allowed client CA certificate file names to
+  ## enable mutually authenticated TLS connections
+  # tls_allowed_cacerts = ["/etc/telex/clientca.pem"]
+
+  ## Export metric collection time.
+  # export_timestamp = false
+`
+
+func (p *PrometheusClient) Description() string {
+	return "Configuration for the Prometheus client to spawn"
+}
+
+func (p *PrometheusClient) SampleConfig() string {
+	return sampleConfig
+}
+
+func (p *PrometheusClient) Connect() error {
+	if p.Listen == "" {
+		p.Listen = ":9273"
+	}
+	if p.Path == "" {
+		p.Path = "/metrics"
+	}
+
+	tlsConfig, err := p.TLSConfig()
+	if err != nil {
+		return err
+	}
+
+	mux := http.NewServeMux()
+	mux.Handle(p.Path, p.auth(http.HandlerFunc(p.serveMetrics)))
+
+	p.server = &http.Server{
+		Addr:      p.Listen,
+		Handler:   mux,
+		TLSConfig: tlsConfig,
+	}
+
+	if tlsConfig != nil {
+		p.listener, err = tls.Listen("tcp", p.Listen, tlsConfig)
+	} else {
+		p.listener, err = net.Listen("tcp", p.Listen)
+	}
+	if err != nil {
+		return err
+	}
+
+	scheme := "http"
+	if tlsConfig != nil {
+		scheme = "https"
+	}
+	p.url = scheme + "://" + p.listener.Addr().String() + p.Path
+
+	p.wg.Add(1)
+	go func() {
+		defer p.wg.Done()
+		err := p.server.Serve(p.listener)
+		if err != nil && err != http.ErrServerClosed {
+			log.Printf("E! [outputs.prometheus_client] Error serving %s: %v",
+				p.Listen, err)
+		}
+	}()
+
+	log.Printf("I! [outputs.prometheus_client] Listening on %s", p.URL())
+	return nil
+}
+
+// URL returns the address the metrics are served on.
+func (p *PrometheusClient) URL() string {
+	return p.url
+}
+
+func (p *PrometheusClient) Close() error {
+	if p.server == nil {
+		return nil
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	err := p.server.Shutdown(ctx)
+	p.wg.Wait()
+	p.server = nil
+	return err
+}
+
+func (p *PrometheusClient) auth(h http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if p.BasicUsername != "" && p.BasicPassword != "" {
+			w.Header().Set("WWW-Authenticate", `Basic realm="Restricted"`)
+
+			username, password, ok := r.BasicAuth()
+			if !ok ||
+				subtle.ConstantTimeCompare([]byte(username), []byte(p.BasicUsername)) != 1 ||
+				subtle.ConstantTimeCompare([]byte(password), []byte(p.BasicPassword)) != 1 {
+				http.Error(w, "Not authorized", http.StatusUnauthorized)
+				return
+			}
+		}
+		h.ServeHTTP(w, r)
+	})
+}
+
+func (p *PrometheusClient) serveMetrics(w http.ResponseWriter, r *http.Request) {
+	p.Lock()
+	p.expire()
+	body := p.expose()
+	p.Unlock()
+
+	w.Header().Set("Content-Type", contentType)
+	w.Write([]byte(body))
+}
+
+func (p *PrometheusClient) Write(metrics []telex.Metric) error {
+	p.Lock()
+	defer p.Unlock()
+
+	if p.families == nil {
+		p.families = make(map[string]*family)
+	}
+	now := p.timeNow()
+
+	for _, m := range metrics {
+		labels := make(map[string]string)
+		for _, tag := range m.TagList() {
+			labels[sanitizeLabelName(tag.Key)] = tag.Value
+		}
+		if p.StringAsLabel {
+			for _, field := range m.FieldList() {
+				if s, ok := field.Value.(string); ok {
+					labels[sanitizeLabelName(field.Key)] = s
+				}
+			}
+		}
+
+		var expiration time.Time
+		if p.ExpirationInterval.Duration != 0 {
+			expiration = now.Add(p.ExpirationInterval.Duration)
+		}
+
+		switch m.Type() {
+		case telex.Summary, telex.Histogram:
+			s := &sample{
+				labels:     labels,
+				bounds:     make(map[float64]float64),
+				timestamp:  m.Time(),
+				expiration: expiration,
+			}
+			for _, field := range m.FieldList() {
+				value, ok := floatValue(field.Value)
+				if !ok {
+					continue
+				}
+				switch field.Key {
+				case "sum":
+					s.sum = value
+				case "count":
+					s.count = value
+				default:
+					bound, err := strconv.ParseFloat(field.Key, 64)
+					if err != nil {
+						continue
+					}
+					s.bounds[bound] = value
+				}
+			}
+			if m.Type() == telex.Histogram {
+				if _, ok := s.bounds[math.Inf(1)]; !ok {
+					s.bounds[math.Inf(1)] = s.count
+				}
+			}
+			p.add(sanitizeName(m.Name()), m.Type(), s)
+		default:
+			for _, field := range m.FieldList() {
+				value, ok := floatValue(field.Value)
+				if !ok {
+					continue
+				}
+
+				name := m.Name()
+				if field.Key != "value" {
+					name = name + "_" + field.Key
+				}
+				p.add(sanitizeName(name), m.Type(), &sample{
+					labels:     labels,
+					value:      value,
+					timestamp:  m.Time(),
+					expiration: expiration,
+				})
+			}
+		}
+	}
+
+	p.expire()
+	return nil
+}
+
+// add stores the sample, replacing an older sample with the same labels.
+func (p *PrometheusClient) add(name string, typ telex.ValueType, s *sample) {
+	fam, ok := p.families[name]
+	if !ok {
+		fam = &family{typ: typ, samples: make(map[string]*sample)}
+		p.families[name] = fam
+	} else if fam.typ != typ {
+		log.Printf("W! [outputs.prometheus_client] Mismatched type for %q: %s != %s, dropping series",
+			name, typeName(typ), typeName(fam.typ))
+		return
+	}
+	fam.samples[labelsID(s.labels)] = s
+}
+
+// expire removes the samples which were not updated within the expiration
+// interval.
+func (p *PrometheusClient) expire() {
+	now := p.timeNow()
+	for name, fam := range p.families {
+		for id, s := range fam.samples {
+			if !s.expiration.IsZero() && now.After(s.expiration) {
+				delete(fam.samples, id)
+			}
+		}
+		if len(fam.samples) == 0 {
+			delete(p.families, name)
+		}
+	}
+}
+
+// expose renders all families in the Prometheus text exposition format.
+func (p *PrometheusClient) expose() string {
+	names := make([]string, 0, len(p.families))
+	for name := range p.families {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	var b strings.Builder
+	for _, name := range names {
+		fam := p.families[name]
+		fmt.Fprintf(&b, "# HELP %s Telex collected metric\n", name)
+		fmt.Fprintf(&b, "# TYPE %s %s\n", name, typeName(fam.typ))
+
+		ids := make([]string, 0, len(fam.samples))
+		for id := range fam.samples {
+			ids = append(ids, id)
+		}
+		sort.Strings(ids)
+
+		for _, id := range ids {
+			s := fam.samples[id]
+			switch fam.typ {
+			case telex.Summary:
+				for _, q := range sortedBounds(s.bounds) {
+					p.writeSample(&b, name, s, "quantile", formatFloat(q), s.bounds[q])
+				}
+				p.writeSample(&b, name+"_sum", s, "", "", s.sum)
+				p.writeSample(&b, name+"_count", s, "", "", s.count)
+			case telex.Histogram:
+				for _, le := range sortedBounds(s.bounds) {
+					p.writeSample(&b, name+"_bucket", s, "le", formatFloat(le), s.bounds[le])
+				}
+				p.writeSample(&b, name+"_sum", s, "", "", s.sum)
+				p.writeSample(&b, name+"_count", s, "", "", s.count)
+			default:
+				p.writeSample(&b, name, s, "", "", s.value)
+			}
+		}
+	}
+	return b.String()
+}
+
+func (p *PrometheusClient) writeSample(
+	b *strings.Builder,
+	name string,
+	s *sample,
+	extraLabel string,
+	extraValue string,
+	value float64,
+) {
+	b.WriteString(name)
+
+	keys := make([]string, 0, len(s.labels))
+	for k := range s.labels {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+
+	if len(keys) > 0 || extraLabel != "" {
+		b.WriteByte('{')
+		for i, k := range keys {
+			if i > 0 {
+				b.WriteByte(',')
+			}
+			fmt.Fprintf(b, `%s="%s"`, k, labelValueEscaper.Replace(s.labels[k]))
+		}
+		if extraLabel != "" {
+			if len(keys) > 0 {
+				b.WriteByte(',')
+			}
+			fmt.Fprintf(b, `%s="%s"`, extraLabel, extraValue)
+		}
+		b.WriteByte('}')
+	}
+
+	b.WriteByte(' ')
+	b.WriteString(formatFloat(value))
+	if p.ExportTimestamp {
+		b.WriteByte(' ')
+		b.WriteString(strconv.FormatInt(s.timestamp.UnixNano()/int64(time.Millisecond), 10))
+	}
+	b.WriteByte('\n')
+}
+
+func (p *PrometheusClient) timeNow() time.Time {
+	if p.now != nil {
+		return p.now()
+	}
+	return time.Now()
+}
+
+func typeName(typ telex.ValueType) string {
+	switch typ {
+	case telex.Counter:
+		return "counter"
+	case telex.Gauge:
+		return "gauge"
+	case telex.Summary:
+		return "summary"
+	case telex.Histogram:
+		return "histogram"
+	default:
+		return "untyped"
+	}
+}
+
+func sanitizeName(name string) string {
+	name = invalidNameCharRE.ReplaceAllString(name, "_")
+	if name != "" && name[0] >= '0' && name[0] <= '9' {
+		name = "_" + name
+	}
+	return name
+}
+
+func sanitizeLabelName(name string) string {
+	name = invalidLabelCharRE.ReplaceAllString(name, "_")
+	if name != "" && name[0] >= '0' && name[0] <= '9' {
+		name = "_" + name
+	}
+	return name
+}
+
+// labelsID returns a string which uniquely identifies a label set.
+func labelsID(labels map[string]string) string {
+	keys := make([]string, 0, len(labels))
+	for k := range labels {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+
+	var b strings.Builder
+	for _, k := range keys {
+		b.WriteString(k)
+		b.WriteByte(0)
+		b.WriteString(labels[k])
+		b.WriteByte(0)
+	}
+	return b.String()
+}
+
+func sortedBounds(bounds map[float64]float64) []float64 {
+	keys := make([]float64, 0, len(bounds))
+	for k := range bounds {
+		keys = append(keys, k)
+	}
+	sort.Float64s(keys)
+	return keys
+}
+
+func formatFloat(f float64) string {
+	switch {
+	case math.IsInf(f, 1):
+		return "+Inf"
+	case math.IsInf(f, -1):
+		return "-Inf"
+	case math.IsNaN(f):
+		return "NaN"
+	}
+	return strconv.FormatFloat(f, 'g', -1, 64)
+}
+
+func floatValue(value interface{}) (float64, bool) {
+	switch v := value.(type) {
+	case float64:
+		return v, true
+	case int64:
+		return float64(v), true
+	case uint64:
+		return float64(v), true
+	case bool:
+		if v {
+			return 1.0, true
+		}
+		return 0.0, true
+	}
+	return 0, false
+}
+
+func init() {
+	outputs.Add("prometheus_client", func() telex.Output {
+		return &PrometheusClient{
+			ExpirationInterval: internal.Duration{Duration: time.Second * 60},
+			StringAsLabel:      true,
+		}
+	})
+}
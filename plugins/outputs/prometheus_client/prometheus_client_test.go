@@ -0,0 +1,205 @@
+package prometheus_client
+
+import (
+	"io/ioutil"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/lavaorg/telex"
+	"github.com/lavaorg/telex/internal"
+	"github.com/lavaorg/telex/testutil"
+	"github.com/stretchr/testify/require"
+)
+
+var pki = testutil.NewPKI("../../../testutil/pki")
+
+func newClient(t *testing.T) *PrometheusClient {
+	p := &PrometheusClient{
+		Listen:        "127.0.0.1:0",
+		StringAsLabel: true,
+	}
+	require.NoError(t, p.Connect())
+	return p
+}
+
+func scrape(t *testing.T, client *http.Client, url string) (int, string) {
+	resp, err := client.Get(url)
+	require.NoError(t, err)
+	defer resp.Body.Close()
+
+	body, err := ioutil.ReadAll(resp.Body)
+	require.NoError(t, err)
+	return resp.StatusCode, string(body)
+}
+
+func TestWriteCounterAndGauge(t *testing.T) {
+	p := newClient(t)
+	defer p.Close()
+
+	now := time.Unix(0, 0)
+	require.NoError(t, p.Write([]telex.Metric{
+		testutil.MustMetric("requests",
+			map[string]string{"host": "a", "path": "/x"},
+			map[string]interface{}{"value": int64(42)},
+			now, telex.Counter),
+		testutil.MustMetric("cpu",
+			map[string]string{"host": "a"},
+			map[string]interface{}{"usage_idle": 91.5, "state": "up", "ok": true},
+			now, telex.Gauge),
+	}))
+
+	status, body := scrape(t, http.DefaultClient, p.URL())
+	require.Equal(t, http.StatusOK, status)
+	require.Equal(t, `# HELP cpu_ok Telex collected metric
+# TYPE cpu_ok gauge
+cpu_ok{host="a",state="up"} 1
+# HELP cpu_usage_idle Telex collected metric
+# TYPE cpu_usage_idle gauge
+cpu_usage_idle{host="a",state="up"} 91.5
+# HELP requests Telex collected metric
+# TYPE requests counter
+requests{host="a",path="/x"} 42
+`, body)
+}
+
+func TestWriteUntypedSanitized(t *testing.T) {
+	p := &PrometheusClient{}
+	p.families = nil
+
+	require.NoError(t, p.Write([]telex.Metric{
+		testutil.MustMetric("disk.io",
+			map[string]string{"dev-name": "sda\"1"},
+			map[string]interface{}{"read bytes": uint64(1), "mode": "rw"},
+			time.Unix(1, 0)),
+	}))
+
+	require.Equal(t, `# HELP disk_io_read_bytes Telex collected metric
+# TYPE disk_io_read_bytes untyped
+disk_io_read_bytes{dev_name="sda\"1"} 1
+`, p.expose())
+}
+
+func TestWriteSummaryAndHistogram(t *testing.T) {
+	p := &PrometheusClient{ExportTimestamp: true}
+
+	now := time.Unix(1500000000, 0)
+	require.NoError(t, p.Write([]telex.Metric{
+		testutil.MustMetric("rpc_duration_seconds",
+			map[string]string{},
+			map[string]interface{}{"0.5": 0.05, "0.99": 0.2, "sum": 17.5, "count": int64(200)},
+			now, telex.Summary),
+		testutil.MustMetric("request_size_bytes",
+			map[string]string{"method": "get"},
+			map[string]interface{}{"100": int64(3), "1000": int64(8), "sum": 4200.0, "count": int64(10)},
+			now, telex.Histogram),
+	}))
+
+	require.Equal(t, `# HELP request_size_bytes Telex collected metric
+# TYPE request_size_bytes histogram
+request_size_bytes_bucket{method="get",le="100"} 3 1500000000000
+request_size_bytes_bucket{method="get",le="1000"} 8 1500000000000
+request_size_bytes_bucket{method="get",le="+Inf"} 10 1500000000000
+request_size_bytes_sum{method="get"} 4200 1500000000000
+request_size_bytes_count{method="get"} 10 1500000000000
+# HELP rpc_duration_seconds Telex collected metric
+# TYPE rpc_duration_seconds summary
+rpc_duration_seconds{quantile="0.5"} 0.05 1500000000000
+rpc_duration_seconds{quantile="0.99"} 0.2 1500000000000
+rpc_duration_seconds_sum 17.5 1500000000000
+rpc_duration_seconds_count 200 1500000000000
+`, p.expose())
+}
+
+func TestMismatchedTypeDropped(t *testing.T) {
+	p := &PrometheusClient{}
+
+	require.NoError(t, p.Write([]telex.Metric{
+		testutil.MustMetric("foo", map[string]string{},
+			map[string]interface{}{"value": 1.0}, time.Unix(0, 0), telex.Counter),
+		testutil.MustMetric("foo", map[string]string{"a": "b"},
+			map[string]interface{}{"value": 2.0}, time.Unix(0, 0), telex.Gauge),
+	}))
+
+	require.Equal(t, `# HELP foo Telex collected metric
+# TYPE foo counter
+foo 1
+`, p.expose())
+}
+
+func TestExpiration(t *testing.T) {
+	now := time.Unix(1000, 0)
+	p := &PrometheusClient{
+		ExpirationInterval: internal.Duration{Duration: time.Minute},
+		now:                func() time.Time { return now },
+	}
+
+	require.NoError(t, p.Write([]telex.Metric{
+		testutil.MustMetric("foo", map[string]string{"a": "1"},
+			map[string]interface{}{"value": 1.0}, now),
+	}))
+
+	now = now.Add(30 * time.Second)
+	require.NoError(t, p.Write([]telex.Metric{
+		testutil.MustMetric("foo", map[string]string{"a": "2"},
+			map[string]interface{}{"value": 2.0}, now),
+	}))
+
+	now = now.Add(45 * time.Second)
+	p.expire()
+	require.Equal(t, `# HELP foo Telex collected metric
+# TYPE foo untyped
+foo{a="2"} 2
+`, p.expose())
+
+	now = now.Add(time.Minute)
+	p.expire()
+	require.Equal(t, "", p.expose())
+}
+
+func TestBasicAuth(t *testing.T) {
+	p := &PrometheusClient{
+		Listen:        "127.0.0.1:0",
+		BasicUsername: "user",
+		BasicPassword: "pass",
+	}
+	require.NoError(t, p.Connect())
+	defer p.Close()
+
+	status, _ := scrape(t, http.DefaultClient, p.URL())
+	require.Equal(t, http.StatusUnauthorized, status)
+
+	req, err := http.NewRequest("GET", p.URL(), nil)
+	require.NoError(t, err)
+	req.SetBasicAuth("user", "pass")
+	resp, err := http.DefaultClient.Do(req)
+	require.NoError(t, err)
+	resp.Body.Close()
+	require.Equal(t, http.StatusOK, resp.StatusCode)
+}
+
+func TestTLS(t *testing.T) {
+	p := &PrometheusClient{
+		Listen:       "127.0.0.1:0",
+		ServerConfig: *pki.TLSServerConfig(),
+	}
+	require.NoError(t, p.Connect())
+	defer p.Close()
+
+	require.Equal(t, "https", p.URL()[:5])
+
+	tlsConfig, err := pki.TLSClientConfig().TLSConfig()
+	require.NoError(t, err)
+	client := &http.Client{
+		Transport: &http.Transport{TLSClientConfig: tlsConfig},
+	}
+
+	require.NoError(t, p.Write([]telex.Metric{
+		testutil.MustMetric("foo", map[string]string{},
+			map[string]interface{}{"value": 1.0}, time.Unix(0, 0)),
+	}))
+
+	status, body := scrape(t, client, p.URL())
+	require.Equal(t, http.StatusOK, status)
+	require.Contains(t, body, "foo 1\n")
+}
@@ -11,3 +11,15 @@ var Outputs = map[string]Creator{}
 func Add(name string, creator Creator) {
 	Outputs[name] = creator
 }
+
+// ExternalCreator creates the output running the program of an external
+// plugin at path, configured with the options of its table in TOML.
+type ExternalCreator func(path, config string) telex.Output
+
+// External creates the outputs of the external plugins, it is nil if no
+// plugin is able to run them.
+var External ExternalCreator
+
+func AddExternal(creator ExternalCreator) {
+	External = creator
+}
@@ -0,0 +1,259 @@
+package syslog
+
+import (
+	"crypto/tls"
+	"fmt"
+	"log"
+	"net"
+	"strconv"
+	"strings"
+
+	"github.com/influxdata/go-syslog/nontransparent"
+	"github.com/influxdata/go-syslog/rfc5424"
+
+	"github.com/lavaorg/telex"
+	"github.com/lavaorg/telex/internal"
+	framing "github.com/lavaorg/telex/internal/syslog"
+	tlsint "github.com/lavaorg/telex/internal/tls"
+	"github.com/lavaorg/telex/plugins/outputs"
+)
+
+type Syslog struct {
+	Address             string
+	KeepAlivePeriod     *internal.Duration
+	DefaultSdid         string
+	DefaultSeverityCode uint8
+	DefaultFacilityCode uint8
+	DefaultAppname      string
+	Sdids               []string
+	Separator           string `toml:"sdparam_separator"`
+	Framing             framing.Framing
+	Trailer             nontransparent.TrailerType
+	net.Conn
+	tlsint.ClientConfig
+	mapper *SyslogMapper
+}
+
+var sampleConfig = `
+  ## URL to connect to
+  ## ex: address = "tcp://127.0.0.1:8094"
+  ## ex: address = "tcp4://127.0.0.1:8094"
+  ## ex: address = "tcp6://127.0.0.1:8094"
+  ## ex: address = "tcp6://[2001:db8::1]:8094"
+  ## ex: address = "udp://127.0.0.1:8094"
+  ## ex: address = "udp4://127.0.0.1:8094"
+  ## ex: address = "udp6://127.0.0.1:8094"
+  ## ex: address = "unix:///tmp/syslog.sock"
+  address = "tcp://127.0.0.1:8094"
+
+  ## Optional TLS Config
+  # tls_ca = "/etc/telex/ca.pem"
+  # tls_cert = "/etc/telex/cert.pem"
+  # tls_key = "/etc/telex/key.pem"
+  ## Use TLS but skip chain & host verification
+  # insecure_skip_verify = false
+
+  ## Period between keep alive probes.
+  ## Only applies to TCP sockets.
+  ## 0 disables keep alive probes.
+  ## Defaults to the OS configuration.
+  # keep_alive_period = "5m"
+
+  ## The framing technique with which messages are transported (default = "octet-counting").
+  ## Whether the messages are sent using the octect-counting (RFC5425#section-4.3.1, RFC6587#section-3.4.1),
+  ## or the non-transparent framing technique (RFC6587#section-3.4.2).
+  ## Must be one of "octet-counting", "non-transparent".
+  ## UDP datagrams carry a single message and are never framed (RFC5426).
+  # framing = "octet-counting"
+
+  ## The trailer to be used in case of non-trasparent framing (default = "LF").
+  ## Must be one of "LF", or "NUL".
+  # trailer = "LF"
+
+  ## SD-PARAMs settings
+  ## Syslog messages can contain multiple parameters and multiple identifiers within structured data section.
+  ## Eg., [id1 name1="val1" name2="val2"][id2 name1="val1" nameA="valA"]
+  ## Tags and fields are mapped to SD-PARAMs the same way the syslog input maps
+  ## them back: their key is the SD-ID, the separator, and the parameter name.
+  ## Eg., the field "foo@123_name1" becomes the parameter name1 of the SD-ID foo@123.
+
+  ## Character used as separator between the SD-ID and the parameter name
+  # sdparam_separator = "_"
+
+  ## Default sdid used for tags/fields that don't contain a prefix defined in the explict sdids setting below
+  ## If no default is specified, no SD-PARAMs will be used unless they're explicitly listed in sdids
+  # default_sdid = "default@32473"
+
+  ## List of explicit prefixes to extract from tag/field keys and use as the SDID, if they match (see above example for more details):
+  # sdids = ["foo@123", "bar@456"]
+
+  ## Default severity value. Severity and Facility are used to calculate the message PRI value (RFC5424#section-6.2.1)
+  ## Used when no metric field with key "severity_code" is defined.
+  ## If unset, 5 (notice) is the default
+  # default_severity_code = 5
+
+  ## Default facility value. Facility and Severity are used to calculate the message PRI value (RFC5424#section-6.2.1)
+  ## Used when no metric field with key "facility_code" is defined.
+  ## If unset, 1 (user-level) is the default
+  # default_facility_code = 1
+
+  ## Default APP-NAME value (RFC5424#section-6.2.5)
+  ## Used when no metric tag with key "appname" is defined.
+  ## If unset, "telex" is the default
+  # default_appname = "telex"
+`
+
+func (s *Syslog) Connect() error {
+	s.initializeSyslogMapper()
+
+	spl := strings.SplitN(s.Address, "://", 2)
+	if len(spl) != 2 {
+		return fmt.Errorf("invalid address: %s", s.Address)
+	}
+
+	tlsCfg, err := s.ClientConfig.TLSConfig()
+	if err != nil {
+		return err
+	}
+
+	var c net.Conn
+	if tlsCfg == nil {
+		c, err = net.Dial(spl[0], spl[1])
+	} else {
+		c, err = tls.Dial(spl[0], spl[1], tlsCfg)
+	}
+	if err != nil {
+		return err
+	}
+
+	if err := s.setKeepAlive(c); err != nil {
+		log.Printf("W! [outputs.syslog] Unable to configure keep alive (%s): %s", s.Address, err)
+	}
+
+	s.Conn = c
+	return nil
+}
+
+func (s *Syslog) setKeepAlive(c net.Conn) error {
+	if s.KeepAlivePeriod == nil {
+		return nil
+	}
+	tcpc, ok := c.(*net.TCPConn)
+	if !ok {
+		return fmt.Errorf("cannot set keep alive on a %s socket", strings.SplitN(s.Address, "://", 2)[0])
+	}
+	if s.KeepAlivePeriod.Duration == 0 {
+		return tcpc.SetKeepAlive(false)
+	}
+	if err := tcpc.SetKeepAlive(true); err != nil {
+		return err
+	}
+	return tcpc.SetKeepAlivePeriod(s.KeepAlivePeriod.Duration)
+}
+
+func (s *Syslog) Close() error {
+	if s.Conn == nil {
+		return nil
+	}
+	err := s.Conn.Close()
+	s.Conn = nil
+	return err
+}
+
+func (s *Syslog) SampleConfig() string {
+	return sampleConfig
+}
+
+func (s *Syslog) Description() string {
+	return "Configuration for Syslog server to send metrics to"
+}
+
+func (s *Syslog) Write(metrics []telex.Metric) (err error) {
+	if s.Conn == nil {
+		// previous write failed with permanent error and socket was closed.
+		if err = s.Connect(); err != nil {
+			return err
+		}
+	}
+	for _, metric := range metrics {
+		var msg *rfc5424.SyslogMessage
+		if msg, err = s.mapper.MapMetricToSyslogMessage(metric); err != nil {
+			log.Printf("E! [outputs.syslog] Failed to create syslog message: %v", err)
+			continue
+		}
+		var msgBytesWithFraming []byte
+		if msgBytesWithFraming, err = s.getSyslogMessageBytesWithFraming(msg); err != nil {
+			log.Printf("E! [outputs.syslog] Failed to convert syslog message with framing: %v", err)
+			continue
+		}
+		if _, err = s.Conn.Write(msgBytesWithFraming); err != nil {
+			if netErr, ok := err.(net.Error); !ok || !netErr.Temporary() {
+				// permanent error. close the connection
+				s.Close()
+				return fmt.Errorf("closing connection: %v", err)
+			}
+			return err
+		}
+	}
+	return nil
+}
+
+func (s *Syslog) getSyslogMessageBytesWithFraming(msg *rfc5424.SyslogMessage) ([]byte, error) {
+	var msgString string
+	var err error
+	if msgString, err = msg.String(); err != nil {
+		return nil, err
+	}
+	msgBytes := []byte(msgString)
+
+	// Each datagram holds a single message without framing.
+	if !s.isStream() {
+		return msgBytes, nil
+	}
+
+	if s.Framing == framing.OctetCounting {
+		return append([]byte(strconv.Itoa(len(msgBytes))+" "), msgBytes...), nil
+	}
+	// Non-transparent framing
+	trailer, err := s.Trailer.Value()
+	if err != nil {
+		return nil, err
+	}
+	return append(msgBytes, byte(trailer)), nil
+}
+
+func (s *Syslog) isStream() bool {
+	switch strings.SplitN(s.Address, "://", 2)[0] {
+	case "udp", "udp4", "udp6", "unixgram":
+		return false
+	}
+	return true
+}
+
+func (s *Syslog) initializeSyslogMapper() {
+	if s.mapper != nil {
+		return
+	}
+	s.mapper = newSyslogMapper()
+	s.mapper.DefaultFacilityCode = s.DefaultFacilityCode
+	s.mapper.DefaultSeverityCode = s.DefaultSeverityCode
+	s.mapper.DefaultAppname = s.DefaultAppname
+	s.mapper.Separator = s.Separator
+	s.mapper.DefaultSdid = s.DefaultSdid
+	s.mapper.Sdids = s.Sdids
+}
+
+func newSyslog() *Syslog {
+	return &Syslog{
+		Framing:             framing.OctetCounting,
+		Trailer:             nontransparent.LF,
+		Separator:           "_",
+		DefaultSeverityCode: uint8(5), // notice
+		DefaultFacilityCode: uint8(1), // user-level
+		DefaultAppname:      "telex",
+	}
+}
+
+func init() {
+	outputs.Add("syslog", func() telex.Output { return newSyslog() })
+}
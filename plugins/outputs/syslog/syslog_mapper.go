@@ -0,0 +1,222 @@
+package syslog
+
+import (
+	"errors"
+	"math"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/influxdata/go-syslog/rfc5424"
+
+	"github.com/lavaorg/telex"
+)
+
+// SyslogMapper maps metrics to RFC5424 messages, reversing the mapping done
+// by the syslog input.
+type SyslogMapper struct {
+	DefaultSdid         string
+	DefaultSeverityCode uint8
+	DefaultFacilityCode uint8
+	DefaultAppname      string
+	Sdids               []string
+	Separator           string
+	reservedKeys        map[string]bool
+}
+
+// MapMetricToSyslogMessage maps metrics tags/fields to syslog messages
+func (sm *SyslogMapper) MapMetricToSyslogMessage(metric telex.Metric) (*rfc5424.SyslogMessage, error) {
+	msg := &rfc5424.SyslogMessage{}
+
+	sm.mapPriority(metric, msg)
+	sm.mapStructuredData(metric, msg)
+	sm.mapAppname(metric, msg)
+	mapHostname(metric, msg)
+	mapTimestamp(metric, msg)
+	mapMsgID(metric, msg)
+	mapVersion(metric, msg)
+	mapProcID(metric, msg)
+	mapMsg(metric, msg)
+
+	if !msg.Valid() {
+		return nil, errors.New("metric could not produce valid syslog message")
+	}
+	return msg, nil
+}
+
+func (sm *SyslogMapper) mapStructuredData(metric telex.Metric, msg *rfc5424.SyslogMessage) {
+	for _, tag := range metric.TagList() {
+		sm.mapStructuredDataItem(tag.Key, tag.Value, msg)
+	}
+	for _, field := range metric.FieldList() {
+		// A structured data element without parameters is received as a
+		// true boolean field named after the element.
+		if value, ok := field.Value.(bool); ok && value && sm.isSdid(field.Key) {
+			msg.SetElementID(field.Key)
+			continue
+		}
+		sm.mapStructuredDataItem(field.Key, formatValue(field.Value), msg)
+	}
+}
+
+func (sm *SyslogMapper) isSdid(key string) bool {
+	for _, sdid := range sm.Sdids {
+		if key == sdid {
+			return true
+		}
+	}
+	return false
+}
+
+func (sm *SyslogMapper) mapStructuredDataItem(key string, value string, msg *rfc5424.SyslogMessage) {
+	if sm.reservedKeys[key] {
+		return
+	}
+	for _, sdid := range sm.Sdids {
+		prefix := sdid + sm.Separator
+		if strings.HasPrefix(key, prefix) && len(key) > len(prefix) {
+			msg.SetParameter(sdid, key[len(prefix):], value)
+			return
+		}
+	}
+	if sm.DefaultSdid != "" {
+		k := strings.TrimPrefix(key, sm.DefaultSdid+sm.Separator)
+		msg.SetParameter(sm.DefaultSdid, k, value)
+	}
+}
+
+func (sm *SyslogMapper) mapAppname(metric telex.Metric, msg *rfc5424.SyslogMessage) {
+	if value, ok := metric.GetTag("appname"); ok {
+		msg.SetAppname(formatValue(value))
+	} else {
+		msg.SetAppname(sm.DefaultAppname)
+	}
+}
+
+func mapMsgID(metric telex.Metric, msg *rfc5424.SyslogMessage) {
+	if value, ok := metric.GetField("msgid"); ok {
+		msg.SetMsgID(formatValue(value))
+	} else {
+		// We default to metric name
+		msg.SetMsgID(metric.Name())
+	}
+}
+
+func mapVersion(metric telex.Metric, msg *rfc5424.SyslogMessage) {
+	if value, ok := metric.GetField("version"); ok {
+		if v, ok := toUint(value); ok && v <= 999 {
+			msg.SetVersion(uint16(v))
+			return
+		}
+	}
+	msg.SetVersion(1)
+}
+
+func mapMsg(metric telex.Metric, msg *rfc5424.SyslogMessage) {
+	if value, ok := metric.GetField("message"); ok {
+		msg.SetMessage(formatValue(value))
+	}
+}
+
+func mapProcID(metric telex.Metric, msg *rfc5424.SyslogMessage) {
+	if value, ok := metric.GetField("procid"); ok {
+		msg.SetProcID(formatValue(value))
+	}
+}
+
+func (sm *SyslogMapper) mapPriority(metric telex.Metric, msg *rfc5424.SyslogMessage) {
+	severityCode := sm.DefaultSeverityCode
+	facilityCode := sm.DefaultFacilityCode
+
+	if value, ok := metric.GetField("severity_code"); ok {
+		if v, ok := toUint(value); ok && v <= 7 {
+			severityCode = uint8(v)
+		}
+	}
+
+	if value, ok := metric.GetField("facility_code"); ok {
+		if v, ok := toUint(value); ok && v <= 23 {
+			facilityCode = uint8(v)
+		}
+	}
+
+	msg.SetPriority(facilityCode*8 + severityCode)
+}
+
+func mapHostname(metric telex.Metric, msg *rfc5424.SyslogMessage) {
+	// Try with hostname, then with source, then with host tags, then take OS Hostname
+	if value, ok := metric.GetTag("hostname"); ok {
+		msg.SetHostname(formatValue(value))
+	} else if value, ok := metric.GetTag("source"); ok {
+		msg.SetHostname(formatValue(value))
+	} else if value, ok := metric.GetTag("host"); ok {
+		msg.SetHostname(formatValue(value))
+	} else if value, err := os.Hostname(); err == nil {
+		msg.SetHostname(value)
+	}
+}
+
+func mapTimestamp(metric telex.Metric, msg *rfc5424.SyslogMessage) {
+	timestamp := metric.Time()
+	if value, ok := metric.GetField("timestamp"); ok {
+		if v, ok := value.(int64); ok {
+			timestamp = time.Unix(0, v).UTC()
+		}
+	}
+	// RFC5424 allows at most microseconds.
+	msg.SetTimestamp(timestamp.Format("2006-01-02T15:04:05.999999Z07:00"))
+}
+
+func toUint(value interface{}) (uint64, bool) {
+	switch v := value.(type) {
+	case int64:
+		if v < 0 {
+			return 0, false
+		}
+		return uint64(v), true
+	case uint64:
+		return v, true
+	case float64:
+		if v < 0 || v > math.MaxUint32 {
+			return 0, false
+		}
+		return uint64(v), true
+	}
+	return 0, false
+}
+
+func formatValue(value interface{}) string {
+	switch v := value.(type) {
+	case string:
+		return v
+	case bool:
+		return strconv.FormatBool(v)
+	case uint64:
+		return strconv.FormatUint(v, 10)
+	case int64:
+		return strconv.FormatInt(v, 10)
+	case float64:
+		if math.IsNaN(v) {
+			return ""
+		}
+
+		if math.IsInf(v, 0) {
+			return ""
+		}
+		return strconv.FormatFloat(v, 'f', -1, 64)
+	}
+
+	return ""
+}
+
+func newSyslogMapper() *SyslogMapper {
+	return &SyslogMapper{
+		reservedKeys: map[string]bool{
+			"version": true, "severity": true, "severity_code": true,
+			"facility": true, "facility_code": true, "procid": true,
+			"msgid": true, "message": true, "timestamp": true,
+			"hostname": true, "source": true, "host": true, "appname": true,
+		},
+	}
+}
@@ -0,0 +1,220 @@
+package syslog
+
+import (
+	"bufio"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/influxdata/go-syslog/nontransparent"
+	"github.com/stretchr/testify/require"
+
+	"github.com/lavaorg/telex"
+	framing "github.com/lavaorg/telex/internal/syslog"
+	tlsint "github.com/lavaorg/telex/internal/tls"
+	"github.com/lavaorg/telex/plugins/inputs"
+	syslogin "github.com/lavaorg/telex/plugins/inputs/syslog"
+	"github.com/lavaorg/telex/testutil"
+)
+
+var pki = testutil.NewPKI("../../../testutil/pki")
+
+func TestGetSyslogMessageWithFramingOctectCounting(t *testing.T) {
+	// Init plugin
+	s := newSyslog()
+	s.Address = "tcp://127.0.0.1:514"
+	s.initializeSyslogMapper()
+
+	// Init metrics
+	m1 := testutil.MustMetric(
+		"testmetric",
+		map[string]string{
+			"hostname": "testhost",
+		},
+		map[string]interface{}{},
+		time.Date(2010, time.November, 10, 23, 0, 0, 0, time.UTC),
+	)
+
+	syslogMessage, err := s.mapper.MapMetricToSyslogMessage(m1)
+	require.NoError(t, err)
+	messageBytesWithFraming, err := s.getSyslogMessageBytesWithFraming(syslogMessage)
+	require.NoError(t, err)
+
+	require.Equal(t, "56 <13>1 2010-11-10T23:00:00Z testhost telex - testmetric -", string(messageBytesWithFraming), "Incorrect Octect counting framing")
+}
+
+func TestGetSyslogMessageWithFramingNonTransparent(t *testing.T) {
+	// Init plugin
+	s := newSyslog()
+	s.Address = "tcp://127.0.0.1:514"
+	s.initializeSyslogMapper()
+	s.Framing = framing.NonTransparent
+
+	// Init metrics
+	m1 := testutil.MustMetric(
+		"testmetric",
+		map[string]string{
+			"hostname": "testhost",
+		},
+		map[string]interface{}{},
+		time.Date(2010, time.November, 10, 23, 0, 0, 0, time.UTC),
+	)
+
+	syslogMessage, err := s.mapper.MapMetricToSyslogMessage(m1)
+	require.NoError(t, err)
+	messageBytesWithFraming, err := s.getSyslogMessageBytesWithFraming(syslogMessage)
+	require.NoError(t, err)
+	require.Equal(t, "<13>1 2010-11-10T23:00:00Z testhost telex - testmetric -\n", string(messageBytesWithFraming), "Incorrect LF framing")
+
+	s.Trailer = nontransparent.NUL
+	messageBytesWithFraming, err = s.getSyslogMessageBytesWithFraming(syslogMessage)
+	require.NoError(t, err)
+	require.Equal(t, "<13>1 2010-11-10T23:00:00Z testhost telex - testmetric -\x00", string(messageBytesWithFraming), "Incorrect NUL framing")
+}
+
+func TestGetSyslogMessageUDPNotFramed(t *testing.T) {
+	s := newSyslog()
+	s.Address = "udp://127.0.0.1:514"
+	s.initializeSyslogMapper()
+
+	m1 := testutil.MustMetric(
+		"testmetric",
+		map[string]string{
+			"hostname": "testhost",
+		},
+		map[string]interface{}{},
+		time.Date(2010, time.November, 10, 23, 0, 0, 0, time.UTC),
+	)
+
+	syslogMessage, err := s.mapper.MapMetricToSyslogMessage(m1)
+	require.NoError(t, err)
+	messageBytes, err := s.getSyslogMessageBytesWithFraming(syslogMessage)
+	require.NoError(t, err)
+	require.Equal(t, "<13>1 2010-11-10T23:00:00Z testhost telex - testmetric -", string(messageBytes))
+}
+
+func TestWriteWithReconnect(t *testing.T) {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	defer listener.Close()
+
+	s := newSyslog()
+	s.Address = "tcp://" + listener.Addr().String()
+	require.NoError(t, s.Connect())
+
+	lconn, err := listener.Accept()
+	require.NoError(t, err)
+
+	metrics := []telex.Metric{testutil.TestMetric(1, "testmetric")}
+	require.NoError(t, s.Write(metrics))
+	r := bufio.NewReader(lconn)
+	line, err := r.ReadString('-')
+	require.NoError(t, err)
+	require.Contains(t, line, "<13>1")
+
+	// The connection is opened again after being closed.
+	s.Close()
+	lconn.Close()
+	require.NoError(t, s.Write(metrics))
+	lconn, err = listener.Accept()
+	require.NoError(t, err)
+	defer lconn.Close()
+	r = bufio.NewReader(lconn)
+	line, err = r.ReadString('-')
+	require.NoError(t, err)
+	require.Contains(t, line, "<13>1")
+}
+
+// freeAddress returns a local address nothing listens on.
+func freeAddress(t *testing.T, network string) string {
+	if network == "udp" {
+		pc, err := net.ListenPacket("udp", "127.0.0.1:0")
+		require.NoError(t, err)
+		defer pc.Close()
+		return pc.LocalAddr().String()
+	}
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	defer l.Close()
+	return l.Addr().String()
+}
+
+func TestRoundTrip(t *testing.T) {
+	tests := []struct {
+		name    string
+		network string
+		framing framing.Framing
+		trailer nontransparent.TrailerType
+		tls     bool
+	}{
+		{name: "tcp octet counting", network: "tcp", framing: framing.OctetCounting},
+		{name: "tcp non-transparent", network: "tcp", framing: framing.NonTransparent, trailer: nontransparent.LF},
+		{name: "tcp non-transparent NUL", network: "tcp", framing: framing.NonTransparent, trailer: nontransparent.NUL},
+		{name: "tcp tls octet counting", network: "tcp", framing: framing.OctetCounting, tls: true},
+		{name: "tcp tls non-transparent", network: "tcp", framing: framing.NonTransparent, tls: true},
+		{name: "udp", network: "udp"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			address := tt.network + "://" + freeAddress(t, tt.network)
+
+			receiver := inputs.Inputs["syslog"]().(*syslogin.Syslog)
+			receiver.Address = address
+			receiver.Framing = tt.framing
+			receiver.Trailer = tt.trailer
+			receiver.BestEffort = false
+			receiver.ServerConfig = tlsint.ServerConfig{}
+			if tt.tls {
+				receiver.ServerConfig = *pki.TLSServerConfig()
+			}
+
+			var acc testutil.Accumulator
+			require.NoError(t, receiver.Start(&acc))
+			defer receiver.Stop()
+
+			s := newSyslog()
+			s.Address = address
+			s.Framing = tt.framing
+			s.Trailer = tt.trailer
+			s.Sdids = []string{"foo@123", "origin"}
+			if tt.tls {
+				s.ClientConfig = *pki.TLSClientConfig()
+			}
+			require.NoError(t, s.Connect())
+
+			ts := time.Date(2019, time.April, 29, 8, 30, 0, 123456000, time.UTC)
+			fields := map[string]interface{}{
+				"version":       uint64(1),
+				"severity_code": int64(3),
+				"facility_code": int64(4),
+				"timestamp":     ts.UnixNano(),
+				"procid":        "2013",
+				"msgid":         "ID47",
+				"message":       "An application event",
+				"foo@123_name":  "value",
+				"foo@123_other": "1",
+				"origin":        true,
+			}
+			tags := map[string]string{
+				"severity": "err",
+				"facility": "auth",
+				"hostname": "example.org",
+				"appname":  "evntslog",
+			}
+			metric := testutil.MustMetric("syslog", tags, fields, time.Now())
+			require.NoError(t, s.Write([]telex.Metric{metric, metric}))
+			// The non-transparent parser holds the last message until the
+			// connection is closed.
+			require.NoError(t, s.Close())
+
+			// The input adds the codes and version without conversion.
+			fields["version"] = uint16(1)
+			fields["severity_code"] = 3
+			fields["facility_code"] = 4
+
+			acc.Wait(2)
+			require.Empty(t, acc.Errors)
+			acc.AssertContainsTaggedFields(t, "syslog", fields, tags)
+		})
+	}
+}
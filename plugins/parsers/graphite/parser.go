@@ -0,0 +1,186 @@
+package graphite
+
+import (
+	"bufio"
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/lavaorg/telex"
+	"github.com/lavaorg/telex/internal/templating"
+	"github.com/lavaorg/telex/metric"
+)
+
+// Minimum and maximum supported dates for timestamps.
+var (
+	MinDate = time.Date(1901, 12, 13, 0, 0, 0, 0, time.UTC)
+	MaxDate = time.Date(2038, 1, 19, 0, 0, 0, 0, time.UTC)
+)
+
+// GraphiteParser parses the graphite plaintext protocol, mapping each bucket
+// to a measurement, tags and field using templates.
+type GraphiteParser struct {
+	Separator      string
+	Templates      []string
+	DefaultTags    map[string]string
+	templateEngine *templating.Engine
+}
+
+func (p *GraphiteParser) SetDefaultTags(tags map[string]string) {
+	p.DefaultTags = tags
+}
+
+// NewGraphiteParser creates a GraphiteParser.  Separator is used to join the
+// parts of multi-part measurement and field names.
+func NewGraphiteParser(
+	separator string,
+	templates []string,
+	defaultTags map[string]string,
+) (*GraphiteParser, error) {
+	if separator == "" {
+		separator = templating.DefaultSeparator
+	}
+	p := &GraphiteParser{
+		Separator:   separator,
+		Templates:   templates,
+		DefaultTags: defaultTags,
+	}
+
+	defaultTemplate, _ := templating.NewDefaultTemplateWithPattern("measurement*")
+	engine, err := templating.NewEngine(p.Separator, defaultTemplate, p.Templates)
+	if err != nil {
+		return nil, fmt.Errorf("invalid graphite template: %s", err)
+	}
+	p.templateEngine = engine
+	return p, nil
+}
+
+func (p *GraphiteParser) Parse(buf []byte) ([]telex.Metric, error) {
+	var (
+		metrics []telex.Metric
+		errs    []string
+	)
+
+	reader := bufio.NewReader(bytes.NewReader(buf))
+	for {
+		// Read up to the next newline.
+		line, err := reader.ReadString('\n')
+		if err != nil && err != io.EOF {
+			return metrics, err
+		}
+
+		line = strings.TrimSpace(line)
+		if line != "" {
+			m, perr := p.ParseLine(line)
+			if perr != nil {
+				errs = append(errs, perr.Error())
+			} else {
+				metrics = append(metrics, m)
+			}
+		}
+
+		if err == io.EOF {
+			break
+		}
+	}
+
+	if len(errs) != 0 {
+		return metrics, errors.New(strings.Join(errs, "\n"))
+	}
+	return metrics, nil
+}
+
+// ParseLine parses a single line of the form "bucket value [timestamp]".
+// The bucket may carry tags in the form "bucket;tag1=value1;tag2=value2".
+func (p *GraphiteParser) ParseLine(line string) (telex.Metric, error) {
+	// Break into 3 fields (name, value, timestamp).
+	fields := strings.Fields(line)
+	if len(fields) != 2 && len(fields) != 3 {
+		return nil, fmt.Errorf("received %q which doesn't have required fields", line)
+	}
+
+	bucket, bucketTags, err := parseBucketTags(fields[0])
+	if err != nil {
+		return nil, err
+	}
+
+	// decode the name and tags
+	measurement, tags, field, err := p.templateEngine.Apply(bucket)
+	if err != nil {
+		return nil, err
+	}
+
+	// Could not extract measurement, use the raw value
+	if measurement == "" {
+		measurement = bucket
+	}
+
+	for k, v := range bucketTags {
+		tags[k] = v
+	}
+
+	// Parse value.
+	v, err := strconv.ParseFloat(fields[1], 64)
+	if err != nil {
+		return nil, fmt.Errorf(`field "%s" value: %s`, fields[0], err)
+	}
+
+	if field == "" {
+		field = "value"
+	}
+	fieldValues := map[string]interface{}{field: v}
+
+	// If no 3rd field, use now as timestamp
+	timestamp := time.Now().UTC()
+
+	if len(fields) == 3 {
+		unixTime, err := strconv.ParseFloat(fields[2], 64)
+		if err != nil {
+			return nil, fmt.Errorf(`field "%s" time: %s`, fields[0], err)
+		}
+
+		// -1 is a special value that gets converted to current UTC time
+		// See https://github.com/graphite-project/carbon/issues/54
+		if unixTime != float64(-1) {
+			// Check if we have fractional seconds
+			timestamp = time.Unix(int64(unixTime),
+				int64((unixTime-math.Floor(unixTime))*float64(time.Second)))
+			if timestamp.Before(MinDate) || timestamp.After(MaxDate) {
+				return nil, fmt.Errorf("timestamp out of range")
+			}
+		}
+	}
+
+	// Set the default tags on the point if they are not already set
+	for k, v := range p.DefaultTags {
+		if _, ok := tags[k]; !ok {
+			tags[k] = v
+		}
+	}
+
+	return metric.New(measurement, tags, fieldValues, timestamp)
+}
+
+// parseBucketTags splits the graphite tags from a bucket such as
+// "cpu.load;host=a;dc=b".
+func parseBucketTags(s string) (string, map[string]string, error) {
+	parts := strings.Split(s, ";")
+	if len(parts) == 1 {
+		return s, nil, nil
+	}
+
+	tags := make(map[string]string, len(parts)-1)
+	for _, part := range parts[1:] {
+		kv := strings.SplitN(part, "=", 2)
+		if len(kv) != 2 || kv[0] == "" || kv[1] == "" {
+			return "", nil, fmt.Errorf("invalid graphite tag %q in %q", part, s)
+		}
+		tags[kv[0]] = kv[1]
+	}
+	return parts[0], tags, nil
+}
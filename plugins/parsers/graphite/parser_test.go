@@ -0,0 +1,143 @@
+package graphite
+
+import (
+	"testing"
+	"time"
+
+	"github.com/lavaorg/telex"
+	"github.com/lavaorg/telex/metric"
+	"github.com/lavaorg/telex/plugins/serializers/graphite"
+	"github.com/lavaorg/telex/testutil"
+	"github.com/stretchr/testify/require"
+)
+
+func TestParseLineDefaultTemplate(t *testing.T) {
+	p, err := NewGraphiteParser("", nil, nil)
+	require.NoError(t, err)
+
+	m, err := p.ParseLine("cpu.usage.idle 91.5 1289430000")
+	require.NoError(t, err)
+
+	expected := testutil.MustMetric("cpu.usage.idle",
+		map[string]string{},
+		map[string]interface{}{"value": 91.5},
+		time.Unix(1289430000, 0))
+	testutil.RequireMetricEqual(t, expected, m)
+}
+
+func TestParseLineTemplates(t *testing.T) {
+	p, err := NewGraphiteParser("_", []string{
+		"cpu.* measurement.host.field*",
+		"*.mem.* region.measurement.field dc=west",
+	}, map[string]string{"dc": "east", "env": "prod"})
+	require.NoError(t, err)
+
+	m, err := p.ParseLine("cpu.server01.usage.idle 91.5 1289430000")
+	require.NoError(t, err)
+	expected := testutil.MustMetric("cpu",
+		map[string]string{"host": "server01", "dc": "east", "env": "prod"},
+		map[string]interface{}{"usage_idle": 91.5},
+		time.Unix(1289430000, 0))
+	testutil.RequireMetricEqual(t, expected, m)
+
+	m, err = p.ParseLine("us.mem.used 42 1289430000")
+	require.NoError(t, err)
+	expected = testutil.MustMetric("mem",
+		map[string]string{"region": "us", "dc": "west", "env": "prod"},
+		map[string]interface{}{"used": 42.0},
+		time.Unix(1289430000, 0))
+	testutil.RequireMetricEqual(t, expected, m)
+}
+
+func TestParseLineGraphiteTags(t *testing.T) {
+	p, err := NewGraphiteParser("", []string{"measurement.field"}, nil)
+	require.NoError(t, err)
+
+	m, err := p.ParseLine("cpu.usage_idle;host=localhost;dc=us-west 91.5 1289430000")
+	require.NoError(t, err)
+
+	expected := testutil.MustMetric("cpu",
+		map[string]string{"host": "localhost", "dc": "us-west"},
+		map[string]interface{}{"usage_idle": 91.5},
+		time.Unix(1289430000, 0))
+	testutil.RequireMetricEqual(t, expected, m)
+}
+
+func TestParseLineInvalidTag(t *testing.T) {
+	p, err := NewGraphiteParser("", nil, nil)
+	require.NoError(t, err)
+
+	_, err = p.ParseLine("cpu;host 1 1289430000")
+	require.Error(t, err)
+}
+
+func TestParseLineTimestamps(t *testing.T) {
+	p, err := NewGraphiteParser("", nil, nil)
+	require.NoError(t, err)
+
+	m, err := p.ParseLine("cpu 1 1289430000.5")
+	require.NoError(t, err)
+	require.Equal(t, time.Unix(1289430000, 500000000), m.Time())
+
+	before := time.Now()
+	m, err = p.ParseLine("cpu 1 -1")
+	require.NoError(t, err)
+	require.False(t, m.Time().Before(before.Truncate(time.Second)))
+
+	m, err = p.ParseLine("cpu 1")
+	require.NoError(t, err)
+	require.False(t, m.Time().Before(before.Truncate(time.Second)))
+
+	_, err = p.ParseLine("cpu 1 99999999999")
+	require.Error(t, err)
+}
+
+func TestParseLineInvalid(t *testing.T) {
+	p, err := NewGraphiteParser("", nil, nil)
+	require.NoError(t, err)
+
+	_, err = p.ParseLine("cpu")
+	require.Error(t, err)
+
+	_, err = p.ParseLine("cpu abc 1289430000")
+	require.Error(t, err)
+
+	_, err = p.ParseLine("cpu 1 abc")
+	require.Error(t, err)
+}
+
+func TestParseMultipleLines(t *testing.T) {
+	p, err := NewGraphiteParser("", nil, nil)
+	require.NoError(t, err)
+
+	metrics, err := p.Parse([]byte("\ncpu 1 1289430000\n\nmem 2 1289430000\ninvalid\n"))
+	require.Error(t, err)
+	require.Len(t, metrics, 2)
+	require.Equal(t, "cpu", metrics[0].Name())
+	require.Equal(t, "mem", metrics[1].Name())
+}
+
+func TestParseInvalidTemplate(t *testing.T) {
+	_, err := NewGraphiteParser("", []string{"host.field"}, nil)
+	require.Error(t, err)
+}
+
+func TestSerializerRoundTrip(t *testing.T) {
+	m, err := metric.New("cpu",
+		map[string]string{"host": "localhost", "dc": "us-west"},
+		map[string]interface{}{"usage_idle": 91.5},
+		time.Unix(1289430000, 0))
+	require.NoError(t, err)
+
+	s, err := graphite.NewSerializer("", "", nil, true, "", "")
+	require.NoError(t, err)
+	buf, err := s.Serialize(m)
+	require.NoError(t, err)
+
+	p, err := NewGraphiteParser("", []string{"measurement.field"}, nil)
+	require.NoError(t, err)
+
+	metrics, err := p.Parse(buf)
+	require.NoError(t, err)
+	testutil.RequireMetricsEqual(t, []telex.Metric{m}, metrics)
+}
@@ -0,0 +1,310 @@
+package prometheus
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"math"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/lavaorg/telex"
+	"github.com/lavaorg/telex/metric"
+)
+
+// Parser parses the Prometheus text exposition format.
+//
+// Counters, gauges and untyped metrics become a metric named after the
+// family with a single "value" field.  Summaries and histograms become one
+// metric per label set with "sum" and "count" fields and a field for each
+// quantile or bucket, keyed by the quantile or upper bound.
+type Parser struct {
+	DefaultTags map[string]string
+	TimeFunc    func() time.Time
+}
+
+func NewParser(defaultTags map[string]string) *Parser {
+	return &Parser{
+		DefaultTags: defaultTags,
+		TimeFunc:    time.Now,
+	}
+}
+
+// group collects the samples of a summary or histogram that share a label
+// set.
+type group struct {
+	name   string
+	typ    telex.ValueType
+	tags   map[string]string
+	fields map[string]interface{}
+	tm     time.Time
+}
+
+func (p *Parser) Parse(buf []byte) ([]telex.Metric, error) {
+	now := p.TimeFunc()
+	types := make(map[string]telex.ValueType)
+
+	var groups []*group
+	index := make(map[string]*group)
+
+	scanner := bufio.NewScanner(bytes.NewReader(buf))
+	for lineno := 1; scanner.Scan(); lineno++ {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" {
+			continue
+		}
+
+		if line[0] == '#' {
+			parts := strings.Fields(line)
+			if len(parts) >= 4 && parts[1] == "TYPE" {
+				typ, err := parseType(parts[3])
+				if err != nil {
+					return nil, fmt.Errorf("line %d: %v", lineno, err)
+				}
+				types[parts[2]] = typ
+			}
+			continue
+		}
+
+		name, tags, value, tm, err := parseSample(line)
+		if err != nil {
+			return nil, fmt.Errorf("line %d: %v", lineno, err)
+		}
+		if !isValid(value) {
+			continue
+		}
+		if tm.IsZero() {
+			tm = now
+		}
+
+		family, typ, fieldKey := familyOf(name, types)
+		switch typ {
+		case telex.Summary:
+			if fieldKey == "" {
+				fieldKey = tags["quantile"]
+				delete(tags, "quantile")
+			}
+		case telex.Histogram:
+			if fieldKey == "" {
+				fieldKey = tags["le"]
+				delete(tags, "le")
+			}
+		default:
+			fieldKey = "value"
+		}
+		if fieldKey == "" {
+			return nil, fmt.Errorf("line %d: missing quantile or bucket label for %s", lineno, name)
+		}
+
+		id := family + "\x00" + tagsID(tags) + strconv.FormatInt(tm.UnixNano(), 10)
+		if typ == telex.Summary || typ == telex.Histogram {
+			if g, ok := index[id]; ok {
+				g.fields[fieldKey] = value
+				continue
+			}
+		}
+
+		g := &group{
+			name:   family,
+			typ:    typ,
+			tags:   tags,
+			fields: map[string]interface{}{fieldKey: value},
+			tm:     tm,
+		}
+		index[id] = g
+		groups = append(groups, g)
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+
+	metrics := make([]telex.Metric, 0, len(groups))
+	for _, g := range groups {
+		for k, v := range p.DefaultTags {
+			if _, ok := g.tags[k]; !ok {
+				g.tags[k] = v
+			}
+		}
+		m, err := metric.New(g.name, g.tags, g.fields, g.tm, g.typ)
+		if err != nil {
+			return nil, err
+		}
+		metrics = append(metrics, m)
+	}
+	return metrics, nil
+}
+
+func (p *Parser) ParseLine(line string) (telex.Metric, error) {
+	metrics, err := p.Parse([]byte(line + "\n"))
+	if err != nil {
+		return nil, err
+	}
+
+	if len(metrics) < 1 {
+		return nil, fmt.Errorf("Can not parse the line: %s, for data format: prometheus ", line)
+	}
+
+	return metrics[0], nil
+}
+
+func (p *Parser) SetDefaultTags(tags map[string]string) {
+	p.DefaultTags = tags
+}
+
+func parseType(s string) (telex.ValueType, error) {
+	switch s {
+	case "counter":
+		return telex.Counter, nil
+	case "gauge":
+		return telex.Gauge, nil
+	case "summary":
+		return telex.Summary, nil
+	case "histogram":
+		return telex.Histogram, nil
+	case "untyped":
+		return telex.Untyped, nil
+	}
+	return telex.Untyped, fmt.Errorf("unknown metric type %q", s)
+}
+
+// familyOf returns the family, type and field key of a sample name.  The
+// "_sum", "_count" and "_bucket" samples of summaries and histograms belong
+// to the family without the suffix.
+func familyOf(name string, types map[string]telex.ValueType) (string, telex.ValueType, string) {
+	if typ, ok := types[name]; ok {
+		return name, typ, ""
+	}
+
+	for _, suffix := range []string{"_sum", "_count", "_bucket"} {
+		if !strings.HasSuffix(name, suffix) {
+			continue
+		}
+		family := strings.TrimSuffix(name, suffix)
+		typ, ok := types[family]
+		if !ok {
+			continue
+		}
+		switch {
+		case typ == telex.Histogram && suffix == "_bucket":
+			return family, typ, ""
+		case (typ == telex.Histogram || typ == telex.Summary) && suffix != "_bucket":
+			return family, typ, suffix[1:]
+		}
+	}
+	return name, telex.Untyped, ""
+}
+
+// parseSample parses a line such as `name{label="value"} 42 1500000000000`.
+// The timestamp is zero if not present.
+func parseSample(line string) (string, map[string]string, float64, time.Time, error) {
+	var tm time.Time
+	tags := make(map[string]string)
+
+	end := strings.IndexAny(line, "{ \t")
+	if end <= 0 {
+		return "", nil, 0, tm, fmt.Errorf("invalid sample %q", line)
+	}
+	name := line[:end]
+	rest := line[end:]
+
+	if rest[0] == '{' {
+		var err error
+		rest, err = parseLabels(rest[1:], tags)
+		if err != nil {
+			return "", nil, 0, tm, err
+		}
+	}
+
+	parts := strings.Fields(rest)
+	if len(parts) != 1 && len(parts) != 2 {
+		return "", nil, 0, tm, fmt.Errorf("invalid sample %q", line)
+	}
+
+	value, err := strconv.ParseFloat(parts[0], 64)
+	if err != nil {
+		return "", nil, 0, tm, fmt.Errorf("invalid value %q", parts[0])
+	}
+
+	if len(parts) == 2 {
+		ms, err := strconv.ParseInt(parts[1], 10, 64)
+		if err != nil {
+			return "", nil, 0, tm, fmt.Errorf("invalid timestamp %q", parts[1])
+		}
+		tm = time.Unix(0, ms*int64(time.Millisecond))
+	}
+
+	return name, tags, value, tm, nil
+}
+
+// parseLabels parses the labels following the opening brace and returns the
+// remainder of the line after the closing brace.
+func parseLabels(s string, tags map[string]string) (string, error) {
+	for {
+		s = strings.TrimLeft(s, " \t")
+		if s == "" {
+			return "", fmt.Errorf("unterminated label set")
+		}
+		if s[0] == '}' {
+			return s[1:], nil
+		}
+
+		eq := strings.IndexByte(s, '=')
+		if eq <= 0 {
+			return "", fmt.Errorf("invalid label in %q", s)
+		}
+		key := strings.TrimSpace(s[:eq])
+		s = strings.TrimLeft(s[eq+1:], " \t")
+		if s == "" || s[0] != '"' {
+			return "", fmt.Errorf("label %s: value must be quoted", key)
+		}
+
+		var value strings.Builder
+		i := 1
+		for ; i < len(s) && s[i] != '"'; i++ {
+			if s[i] == '\\' && i+1 < len(s) {
+				i++
+				switch s[i] {
+				case 'n':
+					value.WriteByte('\n')
+				default:
+					value.WriteByte(s[i])
+				}
+				continue
+			}
+			value.WriteByte(s[i])
+		}
+		if i >= len(s) {
+			return "", fmt.Errorf("label %s: unterminated value", key)
+		}
+		tags[key] = value.String()
+
+		s = strings.TrimLeft(s[i+1:], " \t")
+		if s != "" && s[0] == ',' {
+			s = s[1:]
+		}
+	}
+}
+
+func tagsID(tags map[string]string) string {
+	keys := make([]string, 0, len(tags))
+	for k := range tags {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+
+	var b strings.Builder
+	for _, k := range keys {
+		b.WriteString(k)
+		b.WriteByte(0)
+		b.WriteString(tags[k])
+		b.WriteByte(0)
+	}
+	return b.String()
+}
+
+// isValid reports whether the value can be stored in a metric field.
+func isValid(value float64) bool {
+	return !math.IsNaN(value) && !math.IsInf(value, 0)
+}
@@ -0,0 +1,137 @@
+package prometheus
+
+import (
+	"testing"
+	"time"
+
+	"github.com/lavaorg/telex"
+	"github.com/lavaorg/telex/testutil"
+	"github.com/stretchr/testify/require"
+)
+
+var now = time.Unix(1500000000, 0)
+
+func newParser() *Parser {
+	p := NewParser(nil)
+	p.TimeFunc = func() time.Time { return now }
+	return p
+}
+
+const exposition = `# HELP go_goroutines Number of goroutines that currently exist.
+# TYPE go_goroutines gauge
+go_goroutines 15
+# HELP http_requests_total The total number of HTTP requests.
+# TYPE http_requests_total counter
+http_requests_total{method="post",code="200"} 1027 1395066363000
+http_requests_total{method="post",code="400"}    3 1395066363000
+# A comment without type
+process_start_time_seconds 1.5e+09
+`
+
+func TestParseCounterGaugeUntyped(t *testing.T) {
+	metrics, err := newParser().Parse([]byte(exposition))
+	require.NoError(t, err)
+
+	expected := []telex.Metric{
+		testutil.MustMetric("go_goroutines",
+			map[string]string{},
+			map[string]interface{}{"value": 15.0},
+			now, telex.Gauge),
+		testutil.MustMetric("http_requests_total",
+			map[string]string{"method": "post", "code": "200"},
+			map[string]interface{}{"value": 1027.0},
+			time.Unix(1395066363, 0), telex.Counter),
+		testutil.MustMetric("http_requests_total",
+			map[string]string{"method": "post", "code": "400"},
+			map[string]interface{}{"value": 3.0},
+			time.Unix(1395066363, 0), telex.Counter),
+		testutil.MustMetric("process_start_time_seconds",
+			map[string]string{},
+			map[string]interface{}{"value": 1.5e9},
+			now, telex.Untyped),
+	}
+	testutil.RequireMetricsEqual(t, expected, metrics)
+	for i := range expected {
+		require.Equal(t, expected[i].Type(), metrics[i].Type())
+	}
+}
+
+func TestParseSummary(t *testing.T) {
+	metrics, err := newParser().Parse([]byte(`# TYPE rpc_duration_seconds summary
+rpc_duration_seconds{service="a",quantile="0.5"} 0.05
+rpc_duration_seconds{service="a",quantile="0.99"} 0.2
+rpc_duration_seconds{service="a",quantile="0.999"} NaN
+rpc_duration_seconds_sum{service="a"} 17.5
+rpc_duration_seconds_count{service="a"} 200
+rpc_duration_seconds_sum{service="b"} 1
+rpc_duration_seconds_count{service="b"} 2
+`))
+	require.NoError(t, err)
+
+	expected := []telex.Metric{
+		testutil.MustMetric("rpc_duration_seconds",
+			map[string]string{"service": "a"},
+			map[string]interface{}{"0.5": 0.05, "0.99": 0.2, "sum": 17.5, "count": 200.0},
+			now, telex.Summary),
+		testutil.MustMetric("rpc_duration_seconds",
+			map[string]string{"service": "b"},
+			map[string]interface{}{"sum": 1.0, "count": 2.0},
+			now, telex.Summary),
+	}
+	testutil.RequireMetricsEqual(t, expected, metrics)
+	require.Equal(t, telex.Summary, metrics[0].Type())
+}
+
+func TestParseHistogram(t *testing.T) {
+	metrics, err := newParser().Parse([]byte(`# TYPE request_size_bytes histogram
+request_size_bytes_bucket{le="100"} 3
+request_size_bytes_bucket{le="+Inf"} 10
+request_size_bytes_sum 4200
+request_size_bytes_count 10
+`))
+	require.NoError(t, err)
+
+	expected := []telex.Metric{
+		testutil.MustMetric("request_size_bytes",
+			map[string]string{},
+			map[string]interface{}{"100": 3.0, "+Inf": 10.0, "sum": 4200.0, "count": 10.0},
+			now, telex.Histogram),
+	}
+	testutil.RequireMetricsEqual(t, expected, metrics)
+	require.Equal(t, telex.Histogram, metrics[0].Type())
+}
+
+func TestParseLabelEscapes(t *testing.T) {
+	m, err := newParser().ParseLine(`msdos_file_access_time_seconds{path="C:\\DIR\\FILE.TXT",error="Cannot find file:\n\"FILE.TXT\"", empty=""} 1.458255915e9`)
+	require.NoError(t, err)
+
+	require.Equal(t, map[string]string{
+		"path":  `C:\DIR\FILE.TXT`,
+		"error": "Cannot find file:\n\"FILE.TXT\"",
+		"empty": "",
+	}, m.Tags())
+}
+
+func TestParseDefaultTags(t *testing.T) {
+	p := newParser()
+	p.SetDefaultTags(map[string]string{"host": "default", "job": "x"})
+
+	m, err := p.ParseLine(`up{host="a"} 1`)
+	require.NoError(t, err)
+	require.Equal(t, map[string]string{"host": "a", "job": "x"}, m.Tags())
+}
+
+func TestParseInvalid(t *testing.T) {
+	for _, line := range []string{
+		`foo{a="b" 1`,
+		`foo{a=b} 1`,
+		`foo abc`,
+		`foo 1 abc`,
+		`foo 1 2 3`,
+		`{a="b"} 1`,
+		"# TYPE foo widget\nfoo 1",
+	} {
+		_, err := newParser().Parse([]byte(line))
+		require.Error(t, err, line)
+	}
+}
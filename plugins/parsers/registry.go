@@ -6,9 +6,11 @@ import (
 
 	"github.com/lavaorg/telex"
 	"github.com/lavaorg/telex/plugins/parsers/csv"
+	"github.com/lavaorg/telex/plugins/parsers/graphite"
 	"github.com/lavaorg/telex/plugins/parsers/grok"
 	"github.com/lavaorg/telex/plugins/parsers/influx"
 	"github.com/lavaorg/telex/plugins/parsers/json"
+	"github.com/lavaorg/telex/plugins/parsers/prometheus"
 	"github.com/lavaorg/telex/plugins/parsers/value"
 )
 
@@ -53,7 +55,7 @@ type Parser interface {
 // Config is a struct that covers the data types needed for all parser types,
 // and can be used to instantiate _any_ of the parsers.
 type Config struct {
-	// Dataformat can be one of: json, influx, graphite, value, nagios
+	// Dataformat can be one of: json, influx, graphite, value, prometheus
 	DataFormat string `toml:"data_format"`
 
 	// Separator only applied to Graphite data.
@@ -126,6 +128,11 @@ func NewParser(config *Config) (Parser, error) {
 			config.DataType, config.DefaultTags)
 	case "influx":
 		parser, err = NewInfluxParser()
+	case "graphite":
+		parser, err = NewGraphiteParser(config.Separator,
+			config.Templates, config.DefaultTags)
+	case "prometheus":
+		parser, err = NewPrometheusParser(config.DefaultTags)
 	case "grok":
 		parser, err = newGrokParser(
 			config.MetricName,
@@ -273,6 +280,18 @@ func NewInfluxParser() (Parser, error) {
 	return influx.NewParser(handler), nil
 }
 
+func NewGraphiteParser(
+	separator string,
+	templates []string,
+	defaultTags map[string]string,
+) (Parser, error) {
+	return graphite.NewGraphiteParser(separator, templates, defaultTags)
+}
+
+func NewPrometheusParser(defaultTags map[string]string) (Parser, error) {
+	return prometheus.NewParser(defaultTags), nil
+}
+
 func NewValueParser(
 	metricName string,
 	dataType string,
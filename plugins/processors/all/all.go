@@ -2,12 +2,15 @@ package all
 
 import (
 	_ "github.com/lavaorg/telex/plugins/processors/converter"
+	_ "github.com/lavaorg/telex/plugins/processors/dedup"
 	_ "github.com/lavaorg/telex/plugins/processors/enum"
+	_ "github.com/lavaorg/telex/plugins/processors/execd"
 	_ "github.com/lavaorg/telex/plugins/processors/override"
 	_ "github.com/lavaorg/telex/plugins/processors/parser"
 	_ "github.com/lavaorg/telex/plugins/processors/printer"
 	_ "github.com/lavaorg/telex/plugins/processors/regex"
 	_ "github.com/lavaorg/telex/plugins/processors/rename"
+	_ "github.com/lavaorg/telex/plugins/processors/starlark"
 	_ "github.com/lavaorg/telex/plugins/processors/strings"
 	_ "github.com/lavaorg/telex/plugins/processors/topk"
 )
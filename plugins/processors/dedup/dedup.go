@@ -0,0 +1,114 @@
+package dedup
+
+import (
+	"container/list"
+	"time"
+
+	"github.com/lavaorg/telex"
+	"github.com/lavaorg/telex/internal"
+	"github.com/lavaorg/telex/plugins/processors"
+)
+
+var sampleConfig = `
+  ## Maximum time to suppress output, a metric is emitted at least this often
+  ## even if its fields don't change.
+  dedup_interval = "600s"
+
+  ## Maximum number of series tracked, the least recently seen series are
+  ## forgotten and their next metric is emitted.
+  # max_series = 100000
+`
+
+// Dedup drops the metrics whose fields are the same as the last ones
+// emitted for their series.
+type Dedup struct {
+	DedupInterval internal.Duration `toml:"dedup_interval"`
+	MaxSeries     int               `toml:"max_series"`
+
+	// cache holds the last emitted values of the series from the most to
+	// the least recently seen, index maps the series to their element.
+	cache *list.List
+	index map[uint64]*list.Element
+}
+
+type entry struct {
+	id     uint64
+	fields map[string]interface{}
+	time   time.Time
+}
+
+// NewDedup creates a dedup processor with the default settings.
+func NewDedup() *Dedup {
+	return &Dedup{
+		DedupInterval: internal.Duration{Duration: 10 * time.Minute},
+		MaxSeries:     100000,
+		cache:         list.New(),
+		index:         make(map[uint64]*list.Element),
+	}
+}
+
+func (d *Dedup) SampleConfig() string {
+	return sampleConfig
+}
+
+func (d *Dedup) Description() string {
+	return "Drop metrics with the same field values as the last ones of their series"
+}
+
+func (d *Dedup) Apply(in ...telex.Metric) []telex.Metric {
+	out := in[:0]
+	for _, metric := range in {
+		id := metric.HashID()
+		if elem, ok := d.index[id]; ok {
+			d.cache.MoveToFront(elem)
+			e := elem.Value.(*entry)
+			if metric.Time().Sub(e.time) < d.DedupInterval.Duration && sameFields(e.fields, metric) {
+				metric.Drop()
+				continue
+			}
+			e.fields = metric.Fields()
+			e.time = metric.Time()
+		} else {
+			d.index[id] = d.cache.PushFront(&entry{
+				id:     id,
+				fields: metric.Fields(),
+				time:   metric.Time(),
+			})
+			d.evict()
+		}
+		out = append(out, metric)
+	}
+	return out
+}
+
+// evict forgets the least recently seen series above MaxSeries.
+func (d *Dedup) evict() {
+	if d.MaxSeries <= 0 {
+		return
+	}
+	for d.cache.Len() > d.MaxSeries {
+		elem := d.cache.Back()
+		d.cache.Remove(elem)
+		delete(d.index, elem.Value.(*entry).id)
+	}
+}
+
+func sameFields(fields map[string]interface{}, metric telex.Metric) bool {
+	list := metric.FieldList()
+	if len(list) != len(fields) {
+		return false
+	}
+	for _, field := range list {
+		value, ok := fields[field.Key]
+		if !ok || value != field.Value {
+			return false
+		}
+	}
+	return true
+}
+
+func init() {
+	processors.Add("dedup", func() telex.Processor {
+		return NewDedup()
+	})
+}
@@ -0,0 +1,147 @@
+package dedup
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/lavaorg/telex"
+	"github.com/lavaorg/telex/internal"
+	"github.com/lavaorg/telex/metric"
+	"github.com/lavaorg/telex/testutil"
+)
+
+var start = time.Date(2019, time.May, 1, 12, 0, 0, 0, time.UTC)
+
+func newMetric(host string, value interface{}, seconds int) telex.Metric {
+	return testutil.MustMetric("filestat",
+		map[string]string{"host": host},
+		map[string]interface{}{"size_bytes": value},
+		start.Add(time.Duration(seconds)*time.Second),
+	)
+}
+
+func newDedup(interval time.Duration) *Dedup {
+	d := NewDedup()
+	d.DedupInterval = internal.Duration{Duration: interval}
+	return d
+}
+
+func TestSuppressUnchanged(t *testing.T) {
+	d := newDedup(time.Minute)
+
+	out := d.Apply(newMetric("a", int64(1), 0))
+	require.Len(t, out, 1)
+	out = d.Apply(newMetric("a", int64(1), 10))
+	require.Len(t, out, 0)
+	out = d.Apply(newMetric("a", int64(1), 20))
+	require.Len(t, out, 0)
+}
+
+func TestEmitChanged(t *testing.T) {
+	d := newDedup(time.Minute)
+
+	out := d.Apply(
+		newMetric("a", int64(1), 0),
+		newMetric("a", int64(2), 10),
+		newMetric("a", int64(2), 20),
+		newMetric("a", int64(1), 30),
+	)
+	testutil.RequireMetricsEqual(t, []telex.Metric{
+		newMetric("a", int64(1), 0),
+		newMetric("a", int64(2), 10),
+		newMetric("a", int64(1), 30),
+	}, out)
+}
+
+func TestFieldTypeAndKeys(t *testing.T) {
+	d := newDedup(time.Minute)
+
+	out := d.Apply(newMetric("a", int64(1), 0))
+	require.Len(t, out, 1)
+	// Same value with another type.
+	out = d.Apply(newMetric("a", float64(1), 10))
+	require.Len(t, out, 1)
+
+	// Additional field.
+	m := newMetric("a", float64(1), 20)
+	m.AddField("mode", "rw")
+	out = d.Apply(m)
+	require.Len(t, out, 1)
+
+	// Missing field.
+	out = d.Apply(newMetric("a", float64(1), 30))
+	require.Len(t, out, 1)
+}
+
+func TestSeries(t *testing.T) {
+	d := newDedup(time.Minute)
+
+	out := d.Apply(
+		newMetric("a", int64(1), 0),
+		newMetric("b", int64(1), 0),
+		newMetric("a", int64(1), 10),
+		newMetric("b", int64(2), 10),
+	)
+	testutil.RequireMetricsEqual(t, []telex.Metric{
+		newMetric("a", int64(1), 0),
+		newMetric("b", int64(1), 0),
+		newMetric("b", int64(2), 10),
+	}, out)
+}
+
+func TestHeartbeat(t *testing.T) {
+	d := newDedup(time.Minute)
+
+	out := d.Apply(
+		newMetric("a", int64(1), 0),
+		newMetric("a", int64(1), 30),
+		newMetric("a", int64(1), 60),
+		newMetric("a", int64(1), 90),
+		newMetric("a", int64(1), 120),
+	)
+	testutil.RequireMetricsEqual(t, []telex.Metric{
+		newMetric("a", int64(1), 0),
+		newMetric("a", int64(1), 60),
+		newMetric("a", int64(1), 120),
+	}, out)
+}
+
+func TestMaxSeries(t *testing.T) {
+	d := newDedup(time.Minute)
+	d.MaxSeries = 2
+
+	out := d.Apply(
+		newMetric("a", int64(1), 0),
+		newMetric("b", int64(1), 0),
+		newMetric("a", int64(1), 10),
+		// c evicts b, the least recently seen series.
+		newMetric("c", int64(1), 10),
+		newMetric("a", int64(1), 20),
+		newMetric("b", int64(1), 20),
+	)
+	testutil.RequireMetricsEqual(t, []telex.Metric{
+		newMetric("a", int64(1), 0),
+		newMetric("b", int64(1), 0),
+		newMetric("c", int64(1), 10),
+		newMetric("b", int64(1), 20),
+	}, out)
+	require.Len(t, d.index, 2)
+	require.Equal(t, 2, d.cache.Len())
+}
+
+func TestDropTracking(t *testing.T) {
+	d := newDedup(time.Minute)
+
+	var delivered []telex.DeliveryInfo
+	notify := func(info telex.DeliveryInfo) {
+		delivered = append(delivered, info)
+	}
+	d.Apply(newMetric("a", int64(1), 0))
+	m, _ := metric.WithTracking(newMetric("a", int64(1), 10), notify)
+	out := d.Apply(m)
+	require.Len(t, out, 0)
+	require.Len(t, delivered, 1)
+	require.True(t, delivered[0].Delivered())
+}
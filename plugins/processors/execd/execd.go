@@ -0,0 +1,206 @@
+package execd
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"io"
+	"log"
+	"time"
+
+	"github.com/lavaorg/telex"
+	"github.com/lavaorg/telex/internal"
+	"github.com/lavaorg/telex/internal/process"
+	"github.com/lavaorg/telex/plugins/parsers"
+	"github.com/lavaorg/telex/plugins/processors"
+	"github.com/lavaorg/telex/plugins/serializers"
+	"github.com/lavaorg/telex/shim"
+)
+
+var sampleConfig = `
+  ## Program to run, and its arguments.  Metrics are written to its stdin one
+  ## per line, and the metrics it writes to stdout are emitted instead.
+  command = ["/usr/bin/myprocessor", "--foo=bar"]
+
+  ## Environment variables added to the environment of the program, in the
+  ## form "key=value".
+  # environment = ["LD_LIBRARY_PATH=/opt/lib"]
+
+  ## Format of the metrics written to the program, "influx" or "json".
+  # serializer_format = "influx"
+
+  ## Delay before the program is restarted once it exits, doubled on each
+  ## restart up to max_restart_delay.  The delay is reset once the program
+  ## ran for max_restart_delay.
+  # restart_delay = "10s"
+  # max_restart_delay = "5m"
+
+  ## Data format of the metrics written by the program.
+  ## Each data format has its own unique set of configuration options, read
+  ## more about them here:
+  ## https://github.com/lavaorg/telex/blob/master/docs/DATA_FORMATS_INPUT.md
+  data_format = "influx"
+`
+
+// maxLineSize is the size of the longest line read from the program.
+const maxLineSize = 1024 * 1024
+
+// retryInterval is the interval between the writes to a program being
+// restarted.
+const retryInterval = 10 * time.Millisecond
+
+// Execd sends the metrics through a long running program.  A metric is
+// accepted once written to the program.  Writes wait while the program is
+// restarted, the metric is rejected if it does not run again in time.
+type Execd struct {
+	parsers.Config
+	Command          []string          `toml:"command"`
+	Environment      []string          `toml:"environment"`
+	SerializerFormat string            `toml:"serializer_format"`
+	RestartDelay     internal.Duration `toml:"restart_delay"`
+	MaxRestartDelay  internal.Duration `toml:"max_restart_delay"`
+
+	parser     parsers.Parser
+	serializer serializers.Serializer
+	acc        telex.Accumulator
+	process    *process.Process
+
+	// failing is set once a write fails, to log the failures once until a
+	// write succeeds.
+	failing bool
+	// stopped is set by Stop, writes no longer wait for the program then.
+	stopped bool
+}
+
+func NewExecd() *Execd {
+	return &Execd{
+		Config:           parsers.Config{DataFormat: "influx"},
+		SerializerFormat: "influx",
+		RestartDelay:     internal.Duration{Duration: 10 * time.Second},
+		MaxRestartDelay:  internal.Duration{Duration: 5 * time.Minute},
+	}
+}
+
+func (e *Execd) SampleConfig() string {
+	return sampleConfig
+}
+
+func (e *Execd) Description() string {
+	return "Send metrics through a long running program, which writes the metrics to emit"
+}
+
+func (e *Execd) Start(acc telex.Accumulator) error {
+	if len(e.Command) == 0 {
+		return fmt.Errorf("command is required")
+	}
+
+	var err error
+	e.parser, err = parsers.NewParser(&e.Config)
+	if err != nil {
+		return fmt.Errorf("error creating parser: %v", err)
+	}
+	e.serializer, err = serializers.NewSerializer(&serializers.Config{
+		DataFormat:     e.SerializerFormat,
+		TimestampUnits: time.Nanosecond,
+	})
+	if err != nil {
+		return fmt.Errorf("error creating serializer: %v", err)
+	}
+
+	e.acc = acc
+	e.process = process.New("processors.execd", e.Command)
+	e.process.Stdin = true
+	e.process.Env = e.Environment
+	e.process.RestartDelay = e.RestartDelay.Duration
+	e.process.MaxRestartDelay = e.MaxRestartDelay.Duration
+	e.process.ReadStdout = e.readStdout
+	e.process.OnError = acc.AddError
+	return e.process.Start()
+}
+
+// Apply writes the metrics to the program, it blocks while the program does
+// not read them.  The metrics are emitted once the program writes them back.
+func (e *Execd) Apply(in ...telex.Metric) []telex.Metric {
+	// The metrics pass unmodified if the processor could not start.
+	if e.process == nil {
+		return in
+	}
+
+	for _, m := range in {
+		octets, err := e.serializer.Serialize(m)
+		if err != nil {
+			log.Printf("E! [processors.execd] Could not serialize metric: %v", err)
+			m.Reject()
+			continue
+		}
+
+		err = e.write(octets)
+		if err != nil {
+			if !e.failing {
+				log.Printf("E! [processors.execd] Error writing metrics, rejecting "+
+					"them until the program runs again: %v", err)
+				e.failing = true
+			}
+			m.Reject()
+			continue
+		}
+		e.failing = false
+		m.Accept()
+	}
+	return nil
+}
+
+// write writes to the program, waiting while it is restarted for up to twice
+// max_restart_delay, longer than any restart delay.
+func (e *Execd) write(octets []byte) error {
+	deadline := time.Now().Add(2 * e.MaxRestartDelay.Duration)
+	for {
+		err := e.process.Write(octets)
+		if err != process.ErrNotRunning || e.stopped || time.Now().After(deadline) {
+			return err
+		}
+		time.Sleep(retryInterval)
+	}
+}
+
+// Stop closes the stdin of the program, and waits for it to write its last
+// metrics and exit.
+func (e *Execd) Stop() {
+	e.stopped = true
+	e.process.Stop()
+}
+
+func (e *Execd) readStdout(r io.Reader) {
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(make([]byte, 64*1024), maxLineSize)
+	for scanner.Scan() {
+		line := bytes.TrimRight(scanner.Bytes(), "\r")
+		if len(line) == 0 {
+			continue
+		}
+
+		metrics, err := e.parser.Parse(line)
+		if err != nil {
+			e.acc.AddError(fmt.Errorf("parse error: %v", err))
+			continue
+		}
+		for _, m := range metrics {
+			e.acc.AddMetric(m)
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		e.acc.AddError(fmt.Errorf("error reading stdout: %v", err))
+	}
+}
+
+func init() {
+	processors.Add("execd", func() telex.Processor {
+		return NewExecd()
+	})
+	processors.AddExternal(func(path, config string) telex.Processor {
+		e := NewExecd()
+		e.Command = []string{path}
+		e.Environment = []string{shim.ConfigEnv + "=" + config}
+		return e
+	})
+}
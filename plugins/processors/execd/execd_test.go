@@ -0,0 +1,159 @@
+// +build !windows
+
+package execd
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/lavaorg/telex"
+	"github.com/lavaorg/telex/internal"
+	"github.com/lavaorg/telex/metric"
+	"github.com/lavaorg/telex/testutil"
+	"github.com/stretchr/testify/require"
+)
+
+func newTestExecd(script string) *Execd {
+	e := NewExecd()
+	e.Command = []string{"sh", "-c", script}
+	e.RestartDelay = internal.Duration{Duration: 10 * time.Millisecond}
+	e.MaxRestartDelay = internal.Duration{Duration: 40 * time.Millisecond}
+	return e
+}
+
+func newMetric(value int64) telex.Metric {
+	m, _ := metric.New("cpu", map[string]string{"host": "a"},
+		map[string]interface{}{"value": value}, time.Unix(1, 0))
+	return m
+}
+
+func waitFor(t *testing.T, condition func() bool) {
+	deadline := time.Now().Add(5 * time.Second)
+	for !condition() {
+		if time.Now().After(deadline) {
+			t.Fatal("timed out waiting for condition")
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
+
+// deliveries records the delivery of tracking metrics.
+type deliveries struct {
+	sync.Mutex
+	delivered []bool
+}
+
+func (d *deliveries) track(m telex.Metric) telex.Metric {
+	m, _ = metric.WithTracking(m, func(info telex.DeliveryInfo) {
+		d.Lock()
+		d.delivered = append(d.delivered, info.Delivered())
+		d.Unlock()
+	})
+	return m
+}
+
+func (d *deliveries) get() []bool {
+	d.Lock()
+	defer d.Unlock()
+	return append([]bool(nil), d.delivered...)
+}
+
+func TestExecd_Apply(t *testing.T) {
+	e := newTestExecd(`while read -r line; do echo "renamed_$line"; done`)
+	acc := &testutil.Accumulator{}
+	require.NoError(t, e.Start(acc))
+	defer e.Stop()
+
+	d := &deliveries{}
+	require.Empty(t, e.Apply(d.track(newMetric(1)), newMetric(2)))
+
+	acc.Wait(2)
+	acc.Lock()
+	defer acc.Unlock()
+	for i, m := range acc.Metrics {
+		require.Equal(t, "renamed_cpu", m.Measurement)
+		require.Equal(t, map[string]string{"host": "a"}, m.Tags)
+		require.Equal(t, map[string]interface{}{"value": int64(i + 1)}, m.Fields)
+		require.Equal(t, time.Unix(1, 0), m.Time)
+	}
+	require.Equal(t, []bool{true}, d.get())
+}
+
+func TestExecd_StopWaitsForOutput(t *testing.T) {
+	e := newTestExecd(`n=0; while read -r line; do n=$((n+1)); done; echo "count value=${n}i"`)
+	acc := &testutil.Accumulator{}
+	require.NoError(t, e.Start(acc))
+
+	e.Apply(newMetric(1), newMetric(2), newMetric(3))
+	e.Stop()
+
+	value, ok := acc.Int64Field("count", "value")
+	require.True(t, ok)
+	require.Equal(t, int64(3), value)
+}
+
+func TestExecd_WaitsForRestart(t *testing.T) {
+	dir, err := ioutil.TempDir("", "execd")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	// The first run exits at once, the metric is written once the program
+	// is restarted.
+	marker := filepath.Join(dir, "started")
+	e := newTestExecd(`[ -e ` + marker + ` ] || { touch ` + marker + `; exit 1; }; cat`)
+	e.RestartDelay = internal.Duration{Duration: 200 * time.Millisecond}
+	e.MaxRestartDelay = internal.Duration{Duration: 400 * time.Millisecond}
+	acc := &testutil.Accumulator{}
+	require.NoError(t, e.Start(acc))
+	defer e.Stop()
+	waitFor(t, func() bool {
+		_, err := os.Stat(marker)
+		return err == nil && !e.process.Running()
+	})
+
+	d := &deliveries{}
+	require.Empty(t, e.Apply(d.track(newMetric(1))))
+	require.Equal(t, []bool{true}, d.get())
+	acc.Wait(1)
+}
+
+func TestExecd_RejectsWhenNotRunning(t *testing.T) {
+	e := newTestExecd("cat")
+	acc := &testutil.Accumulator{}
+	require.NoError(t, e.Start(acc))
+	e.Stop()
+
+	d := &deliveries{}
+	require.Empty(t, e.Apply(d.track(newMetric(1))))
+	require.Equal(t, []bool{false}, d.get())
+}
+
+func TestExecd_SerializerFormatJSON(t *testing.T) {
+	e := newTestExecd(`read -r line; echo "json,format=$(echo "$line" | cut -c1-9) value=1i"; exec cat >/dev/null`)
+	e.SerializerFormat = "json"
+	acc := &testutil.Accumulator{}
+	require.NoError(t, e.Start(acc))
+	defer e.Stop()
+
+	e.Apply(newMetric(1))
+	acc.Wait(1)
+	require.Equal(t, `{"fields"`, acc.TagValue("json", "format"))
+}
+
+func TestExecd_InvalidConfig(t *testing.T) {
+	e := NewExecd()
+	require.EqualError(t, e.Start(&testutil.Accumulator{}), "command is required")
+
+	e = newTestExecd("cat")
+	e.SerializerFormat = "xml"
+	require.EqualError(t, e.Start(&testutil.Accumulator{}),
+		"error creating serializer: Invalid data format: xml")
+
+	// The metrics pass unmodified if the processor could not start.
+	m := newMetric(1)
+	require.Equal(t, []telex.Metric{m}, e.Apply(m))
+}
@@ -0,0 +1,235 @@
+package starlark
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+
+	"go.starlark.net/starlark"
+)
+
+// mapping is the storage of a Dict.
+type mapping interface {
+	keys() []string
+	get(key string) (starlark.Value, bool, error)
+	set(key string, value starlark.Value) error
+	remove(key string)
+}
+
+// Dict is a dict like view of the tags or fields of a metric.
+type Dict struct {
+	typ     string
+	mapping mapping
+}
+
+var (
+	_ starlark.IterableMapping = (*Dict)(nil)
+	_ starlark.HasSetKey       = (*Dict)(nil)
+	_ starlark.HasAttrs        = (*Dict)(nil)
+	_ starlark.Sequence        = (*Dict)(nil)
+)
+
+var dictMethods = map[string]func(d *Dict, b *starlark.Builtin, args starlark.Tuple, kwargs []starlark.Tuple) (starlark.Value, error){
+	"clear":  dictClear,
+	"get":    dictGet,
+	"items":  dictItems,
+	"keys":   dictKeys,
+	"pop":    dictPop,
+	"update": dictUpdate,
+	"values": dictValues,
+}
+
+func (d *Dict) String() string {
+	var b strings.Builder
+	b.WriteString("{")
+	for i, item := range d.Items() {
+		if i > 0 {
+			b.WriteString(", ")
+		}
+		b.WriteString(item[0].String())
+		b.WriteString(": ")
+		b.WriteString(item[1].String())
+	}
+	b.WriteString("}")
+	return b.String()
+}
+
+func (d *Dict) Type() string          { return d.typ }
+func (d *Dict) Freeze()               {}
+func (d *Dict) Truth() starlark.Bool  { return d.Len() > 0 }
+func (d *Dict) Hash() (uint32, error) { return 0, fmt.Errorf("unhashable type: %s", d.typ) }
+func (d *Dict) Len() int              { return len(d.mapping.keys()) }
+
+func (d *Dict) Get(key starlark.Value) (starlark.Value, bool, error) {
+	k, ok := key.(starlark.String)
+	if !ok {
+		return nil, false, nil
+	}
+	return d.mapping.get(string(k))
+}
+
+func (d *Dict) SetKey(key, value starlark.Value) error {
+	k, ok := key.(starlark.String)
+	if !ok {
+		return fmt.Errorf("%s keys must be strings, not %s", d.typ, key.Type())
+	}
+	return d.mapping.set(string(k), value)
+}
+
+// Iterate iterates over a snapshot of the keys, so the dict may be updated
+// while iterating.
+func (d *Dict) Iterate() starlark.Iterator {
+	return &keyIterator{keys: d.mapping.keys()}
+}
+
+func (d *Dict) Items() []starlark.Tuple {
+	keys := d.mapping.keys()
+	items := make([]starlark.Tuple, 0, len(keys))
+	for _, k := range keys {
+		v, ok, err := d.mapping.get(k)
+		if !ok || err != nil {
+			continue
+		}
+		items = append(items, starlark.Tuple{starlark.String(k), v})
+	}
+	return items
+}
+
+func (d *Dict) AttrNames() []string {
+	names := make([]string, 0, len(dictMethods))
+	for name := range dictMethods {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+func (d *Dict) Attr(name string) (starlark.Value, error) {
+	method, ok := dictMethods[name]
+	if !ok {
+		return nil, nil
+	}
+	return starlark.NewBuiltin(name, func(thread *starlark.Thread, b *starlark.Builtin, args starlark.Tuple, kwargs []starlark.Tuple) (starlark.Value, error) {
+		return method(d, b, args, kwargs)
+	}), nil
+}
+
+type keyIterator struct {
+	keys []string
+}
+
+func (it *keyIterator) Next(p *starlark.Value) bool {
+	if len(it.keys) == 0 {
+		return false
+	}
+	*p = starlark.String(it.keys[0])
+	it.keys = it.keys[1:]
+	return true
+}
+
+func (it *keyIterator) Done() {}
+
+func dictClear(d *Dict, b *starlark.Builtin, args starlark.Tuple, kwargs []starlark.Tuple) (starlark.Value, error) {
+	if err := starlark.UnpackPositionalArgs(b.Name(), args, kwargs, 0); err != nil {
+		return nil, err
+	}
+	for _, k := range d.mapping.keys() {
+		d.mapping.remove(k)
+	}
+	return starlark.None, nil
+}
+
+func dictGet(d *Dict, b *starlark.Builtin, args starlark.Tuple, kwargs []starlark.Tuple) (starlark.Value, error) {
+	var key string
+	var dflt starlark.Value = starlark.None
+	if err := starlark.UnpackPositionalArgs(b.Name(), args, kwargs, 1, &key, &dflt); err != nil {
+		return nil, err
+	}
+	v, ok, err := d.mapping.get(key)
+	if err != nil {
+		return nil, err
+	}
+	if !ok {
+		return dflt, nil
+	}
+	return v, nil
+}
+
+func dictItems(d *Dict, b *starlark.Builtin, args starlark.Tuple, kwargs []starlark.Tuple) (starlark.Value, error) {
+	if err := starlark.UnpackPositionalArgs(b.Name(), args, kwargs, 0); err != nil {
+		return nil, err
+	}
+	items := d.Items()
+	list := make([]starlark.Value, 0, len(items))
+	for _, item := range items {
+		list = append(list, item)
+	}
+	return starlark.NewList(list), nil
+}
+
+func dictKeys(d *Dict, b *starlark.Builtin, args starlark.Tuple, kwargs []starlark.Tuple) (starlark.Value, error) {
+	if err := starlark.UnpackPositionalArgs(b.Name(), args, kwargs, 0); err != nil {
+		return nil, err
+	}
+	keys := d.mapping.keys()
+	list := make([]starlark.Value, 0, len(keys))
+	for _, k := range keys {
+		list = append(list, starlark.String(k))
+	}
+	return starlark.NewList(list), nil
+}
+
+func dictPop(d *Dict, b *starlark.Builtin, args starlark.Tuple, kwargs []starlark.Tuple) (starlark.Value, error) {
+	var key string
+	var dflt starlark.Value
+	if err := starlark.UnpackPositionalArgs(b.Name(), args, kwargs, 1, &key, &dflt); err != nil {
+		return nil, err
+	}
+	v, ok, err := d.mapping.get(key)
+	if err != nil {
+		return nil, err
+	}
+	if !ok {
+		if dflt == nil {
+			return nil, fmt.Errorf("%s: missing key %q", b.Name(), key)
+		}
+		return dflt, nil
+	}
+	d.mapping.remove(key)
+	return v, nil
+}
+
+func dictUpdate(d *Dict, b *starlark.Builtin, args starlark.Tuple, kwargs []starlark.Tuple) (starlark.Value, error) {
+	if len(args) > 1 {
+		return nil, fmt.Errorf("%s: got %d arguments, want at most 1", b.Name(), len(args))
+	}
+	if len(args) == 1 {
+		other, ok := args[0].(starlark.IterableMapping)
+		if !ok {
+			return nil, fmt.Errorf("%s: got %s, want a dict", b.Name(), args[0].Type())
+		}
+		for _, item := range other.Items() {
+			if err := d.SetKey(item[0], item[1]); err != nil {
+				return nil, err
+			}
+		}
+	}
+	for _, kwarg := range kwargs {
+		if err := d.SetKey(kwarg[0], kwarg[1]); err != nil {
+			return nil, err
+		}
+	}
+	return starlark.None, nil
+}
+
+func dictValues(d *Dict, b *starlark.Builtin, args starlark.Tuple, kwargs []starlark.Tuple) (starlark.Value, error) {
+	if err := starlark.UnpackPositionalArgs(b.Name(), args, kwargs, 0); err != nil {
+		return nil, err
+	}
+	items := d.Items()
+	list := make([]starlark.Value, 0, len(items))
+	for _, item := range items {
+		list = append(list, item[1])
+	}
+	return starlark.NewList(list), nil
+}
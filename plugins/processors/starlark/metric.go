@@ -0,0 +1,210 @@
+package starlark
+
+import (
+	"errors"
+	"fmt"
+	"time"
+
+	"go.starlark.net/starlark"
+
+	"github.com/lavaorg/telex"
+	"github.com/lavaorg/telex/metric"
+)
+
+// Metric is the script value of a telex.Metric, its name, tags, fields and
+// time are read and written in place.
+type Metric struct {
+	metric telex.Metric
+}
+
+var (
+	_ starlark.HasAttrs    = (*Metric)(nil)
+	_ starlark.HasSetField = (*Metric)(nil)
+)
+
+func (m *Metric) String() string {
+	return fmt.Sprintf("Metric(%q, tags=%s, fields=%s, time=%d)",
+		m.metric.Name(), m.tags().String(), m.fields().String(), m.metric.Time().UnixNano())
+}
+
+func (m *Metric) Type() string          { return "Metric" }
+func (m *Metric) Freeze()               {}
+func (m *Metric) Truth() starlark.Bool  { return starlark.True }
+func (m *Metric) Hash() (uint32, error) { return 0, errors.New("unhashable type: Metric") }
+
+func (m *Metric) AttrNames() []string {
+	return []string{"fields", "name", "tags", "time"}
+}
+
+func (m *Metric) Attr(name string) (starlark.Value, error) {
+	switch name {
+	case "name":
+		return starlark.String(m.metric.Name()), nil
+	case "tags":
+		return m.tags(), nil
+	case "fields":
+		return m.fields(), nil
+	case "time":
+		return starlark.MakeInt64(m.metric.Time().UnixNano()), nil
+	}
+	return nil, nil
+}
+
+func (m *Metric) SetField(name string, value starlark.Value) error {
+	switch name {
+	case "name":
+		s, ok := value.(starlark.String)
+		if !ok {
+			return fmt.Errorf("metric name must be a string, not %s", value.Type())
+		}
+		m.metric.SetName(string(s))
+		return nil
+	case "time":
+		i, ok := value.(starlark.Int)
+		if !ok {
+			return fmt.Errorf("metric time must be an int, not %s", value.Type())
+		}
+		ns, ok := i.Int64()
+		if !ok {
+			return errors.New("metric time is out of range")
+		}
+		m.metric.SetTime(time.Unix(0, ns))
+		return nil
+	case "tags", "fields":
+		return fmt.Errorf("cannot set metric %s, update them instead", name)
+	}
+	return starlark.NoSuchAttrError(fmt.Sprintf("Metric has no attribute %q", name))
+}
+
+func (m *Metric) tags() *Dict {
+	return &Dict{typ: "Tags", mapping: tagMapping{m.metric}}
+}
+
+func (m *Metric) fields() *Dict {
+	return &Dict{typ: "Fields", mapping: fieldMapping{m.metric}}
+}
+
+type tagMapping struct {
+	metric telex.Metric
+}
+
+func (t tagMapping) keys() []string {
+	tags := t.metric.TagList()
+	keys := make([]string, 0, len(tags))
+	for _, tag := range tags {
+		keys = append(keys, tag.Key)
+	}
+	return keys
+}
+
+func (t tagMapping) get(key string) (starlark.Value, bool, error) {
+	value, ok := t.metric.GetTag(key)
+	return starlark.String(value), ok, nil
+}
+
+func (t tagMapping) set(key string, value starlark.Value) error {
+	s, ok := value.(starlark.String)
+	if !ok {
+		return fmt.Errorf("tag value must be a string, not %s", value.Type())
+	}
+	t.metric.AddTag(key, string(s))
+	return nil
+}
+
+func (t tagMapping) remove(key string) {
+	t.metric.RemoveTag(key)
+}
+
+type fieldMapping struct {
+	metric telex.Metric
+}
+
+func (f fieldMapping) keys() []string {
+	fields := f.metric.FieldList()
+	keys := make([]string, 0, len(fields))
+	for _, field := range fields {
+		keys = append(keys, field.Key)
+	}
+	return keys
+}
+
+func (f fieldMapping) get(key string) (starlark.Value, bool, error) {
+	value, ok := f.metric.GetField(key)
+	if !ok {
+		return nil, false, nil
+	}
+	v, err := toStarlark(value)
+	return v, true, err
+}
+
+func (f fieldMapping) set(key string, value starlark.Value) error {
+	v, err := fromStarlark(value)
+	if err != nil {
+		return err
+	}
+	f.metric.AddField(key, v)
+	return nil
+}
+
+func (f fieldMapping) remove(key string) {
+	f.metric.RemoveField(key)
+}
+
+func toStarlark(value interface{}) (starlark.Value, error) {
+	switch v := value.(type) {
+	case float64:
+		return starlark.Float(v), nil
+	case int64:
+		return starlark.MakeInt64(v), nil
+	case uint64:
+		return starlark.MakeUint64(v), nil
+	case string:
+		return starlark.String(v), nil
+	case bool:
+		return starlark.Bool(v), nil
+	}
+	return nil, fmt.Errorf("unsupported field type %T", value)
+}
+
+func fromStarlark(value starlark.Value) (interface{}, error) {
+	switch v := value.(type) {
+	case starlark.Float:
+		return float64(v), nil
+	case starlark.Int:
+		if i, ok := v.Int64(); ok {
+			return i, nil
+		}
+		if u, ok := v.Uint64(); ok {
+			return u, nil
+		}
+		return nil, errors.New("field value is out of range")
+	case starlark.String:
+		return string(v), nil
+	case starlark.Bool:
+		return bool(v), nil
+	}
+	return nil, fmt.Errorf("field value must be a float, int, string or bool, not %s", value.Type())
+}
+
+// newMetric is the Metric builtin, which creates a metric without tags nor
+// fields at the current time.
+func newMetric(thread *starlark.Thread, b *starlark.Builtin, args starlark.Tuple, kwargs []starlark.Tuple) (starlark.Value, error) {
+	var name string
+	if err := starlark.UnpackPositionalArgs(b.Name(), args, kwargs, 1, &name); err != nil {
+		return nil, err
+	}
+	m, err := metric.New(name, nil, nil, time.Now())
+	if err != nil {
+		return nil, err
+	}
+	return &Metric{metric: m}, nil
+}
+
+// deepcopy is the deepcopy builtin, which returns a copy of a metric.
+func deepcopy(thread *starlark.Thread, b *starlark.Builtin, args starlark.Tuple, kwargs []starlark.Tuple) (starlark.Value, error) {
+	var m *Metric
+	if err := starlark.UnpackPositionalArgs(b.Name(), args, kwargs, 1, &m); err != nil {
+		return nil, err
+	}
+	return &Metric{metric: m.metric.Copy()}, nil
+}
@@ -0,0 +1,221 @@
+package starlark
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"time"
+
+	"go.starlark.net/resolve"
+	"go.starlark.net/starlark"
+
+	"github.com/lavaorg/telex"
+	"github.com/lavaorg/telex/internal"
+	"github.com/lavaorg/telex/plugins/processors"
+)
+
+const (
+	// applyFunc is the function of the script called on each metric.
+	applyFunc = "apply"
+
+	defaultMaxSteps = 100000
+)
+
+var sampleConfig = `
+  ## The Starlark source can be set as a string in this configuration file,
+  ## or by referencing a file containing the script.  Only one source or
+  ## script should be set at once.
+  ##
+  ## The script must define the function apply(metric), called on each
+  ## metric.  It returns None to drop the metric, a metric, or a list of
+  ## metrics.
+
+  ## Source of the Starlark script.
+  source = '''
+def apply(metric):
+  return metric
+'''
+
+  ## File containing a Starlark script.
+  # script = "/usr/local/bin/myscript.star"
+
+  ## Maximum number of computation steps of each call of apply.
+  # max_steps = 100000
+
+  ## Maximum duration of each call of apply, 0 is unlimited.
+  # timeout = "1s"
+`
+
+// Starlark applies a Starlark script to each metric.
+type Starlark struct {
+	Source   string            `toml:"source"`
+	Script   string            `toml:"script"`
+	MaxSteps uint64            `toml:"max_steps"`
+	Timeout  internal.Duration `toml:"timeout"`
+
+	apply *starlark.Function
+	state *starlark.Dict
+}
+
+// NewStarlark creates a Starlark processor with the default settings.
+func NewStarlark() *Starlark {
+	return &Starlark{
+		MaxSteps: defaultMaxSteps,
+		Timeout:  internal.Duration{Duration: time.Second},
+	}
+}
+
+func (s *Starlark) SampleConfig() string {
+	return sampleConfig
+}
+
+func (s *Starlark) Description() string {
+	return "Process metrics using a Starlark script"
+}
+
+// builtins are the values predeclared in the script besides the Starlark
+// universe.
+func (s *Starlark) builtins() starlark.StringDict {
+	return starlark.StringDict{
+		"Metric":   starlark.NewBuiltin("Metric", newMetric),
+		"deepcopy": starlark.NewBuiltin("deepcopy", deepcopy),
+		"state":    s.state,
+	}
+}
+
+// Init executes the script and looks up its apply function, so that an
+// invalid script fails the configuration.
+func (s *Starlark) Init() error {
+	if s.Source != "" && s.Script != "" {
+		return errors.New("both source and script are set")
+	}
+
+	var src interface{}
+	filename := s.Script
+	if s.Source != "" {
+		src = s.Source
+		filename = "processors.starlark.source"
+	} else if s.Script == "" {
+		return errors.New("source or script must be set")
+	}
+
+	s.state = starlark.NewDict(0)
+	thread := s.newThread()
+	globals, err := starlark.ExecFile(thread, filename, src, s.builtins())
+	if err != nil {
+		return err
+	}
+
+	apply, ok := globals[applyFunc].(*starlark.Function)
+	if !ok {
+		return fmt.Errorf("the script must define the function %s", applyFunc)
+	}
+	if apply.NumParams() != 1 {
+		return fmt.Errorf("the function %s must take a single metric argument", applyFunc)
+	}
+	s.apply = apply
+	return nil
+}
+
+func (s *Starlark) newThread() *starlark.Thread {
+	thread := &starlark.Thread{
+		Name: "processors.starlark",
+		Print: func(_ *starlark.Thread, msg string) {
+			log.Printf("I! [processors.starlark] %s", msg)
+		},
+	}
+	if s.MaxSteps > 0 {
+		thread.SetMaxExecutionSteps(s.MaxSteps)
+	}
+	return thread
+}
+
+func (s *Starlark) Apply(in ...telex.Metric) []telex.Metric {
+	if s.apply == nil {
+		log.Printf("E! [processors.starlark] The script is not loaded, the metrics are dropped")
+		for _, m := range in {
+			m.Drop()
+		}
+		return nil
+	}
+
+	results := make([]telex.Metric, 0, len(in))
+	for _, m := range in {
+		out, err := s.call(m)
+		if err != nil {
+			if evalErr, ok := err.(*starlark.EvalError); ok {
+				err = errors.New(evalErr.Backtrace())
+			}
+			log.Printf("E! [processors.starlark] Error calling %s, the metric is dropped: %v", applyFunc, err)
+			m.Drop()
+			continue
+		}
+
+		// Unless it is returned, the input metric is dropped.  A metric
+		// returned more than once is copied so each one can be modified by
+		// the next processors.
+		seen := make(map[telex.Metric]bool, len(out))
+		for _, o := range out {
+			if seen[o] {
+				o = o.Copy()
+			}
+			seen[o] = true
+			results = append(results, o)
+		}
+		if !seen[m] {
+			m.Drop()
+		}
+	}
+	return results
+}
+
+// call calls the apply function on a metric and returns the metrics it
+// returned.
+func (s *Starlark) call(m telex.Metric) ([]telex.Metric, error) {
+	thread := s.newThread()
+	if s.Timeout.Duration > 0 {
+		timer := time.AfterFunc(s.Timeout.Duration, func() {
+			thread.Cancel("timeout")
+		})
+		defer timer.Stop()
+	}
+
+	rv, err := starlark.Call(thread, s.apply, starlark.Tuple{&Metric{metric: m}}, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	switch rv := rv.(type) {
+	case starlark.NoneType:
+		return nil, nil
+	case *Metric:
+		return []telex.Metric{rv.metric}, nil
+	case starlark.Iterable:
+		var metrics []telex.Metric
+		iter := rv.Iterate()
+		defer iter.Done()
+		var v starlark.Value
+		for iter.Next(&v) {
+			metric, ok := v.(*Metric)
+			if !ok {
+				return nil, fmt.Errorf("%s returned a %s in a %s, want Metric", applyFunc, v.Type(), rv.Type())
+			}
+			metrics = append(metrics, metric.metric)
+		}
+		return metrics, nil
+	}
+	return nil, fmt.Errorf("%s returned a %s, want None, Metric or a list of Metric", applyFunc, rv.Type())
+}
+
+func init() {
+	// Floats, sets, lambdas and nested functions are part of the language
+	// but are still behind flags in this version of starlark-go.
+	resolve.AllowFloat = true
+	resolve.AllowSet = true
+	resolve.AllowLambda = true
+	resolve.AllowNestedDef = true
+
+	processors.Add("starlark", func() telex.Processor {
+		return NewStarlark()
+	})
+}
@@ -0,0 +1,278 @@
+package starlark
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/lavaorg/telex"
+	"github.com/lavaorg/telex/internal"
+	"github.com/lavaorg/telex/testutil"
+)
+
+var now = time.Date(2019, time.May, 1, 12, 0, 0, 0, time.UTC)
+
+func newProcessor(source string) *Starlark {
+	s := NewStarlark()
+	s.Source = source
+	return s
+}
+
+func TestApply(t *testing.T) {
+	tests := []struct {
+		name     string
+		source   string
+		input    []telex.Metric
+		expected []telex.Metric
+	}{
+		{
+			name: "pass through",
+			source: `
+def apply(metric):
+    return metric
+`,
+			input: []telex.Metric{
+				testutil.MustMetric("cpu", map[string]string{"cpu": "cpu0"}, map[string]interface{}{"usage": 42.0}, now),
+			},
+			expected: []telex.Metric{
+				testutil.MustMetric("cpu", map[string]string{"cpu": "cpu0"}, map[string]interface{}{"usage": 42.0}, now),
+			},
+		},
+		{
+			name: "drop",
+			source: `
+def apply(metric):
+    return None
+`,
+			input: []telex.Metric{
+				testutil.MustMetric("cpu", nil, map[string]interface{}{"usage": 42.0}, now),
+			},
+			expected: []telex.Metric{},
+		},
+		{
+			name: "compute a field from two others",
+			source: `
+def apply(metric):
+    metric.fields["used_percent"] = 100.0 * metric.fields["used"] / metric.fields["total"]
+    return metric
+`,
+			input: []telex.Metric{
+				testutil.MustMetric("mem", nil, map[string]interface{}{"used": int64(25), "total": int64(200)}, now),
+			},
+			expected: []telex.Metric{
+				testutil.MustMetric("mem", nil, map[string]interface{}{"used": int64(25), "total": int64(200), "used_percent": 12.5}, now),
+			},
+		},
+		{
+			name: "conditional tagging",
+			source: `
+def apply(metric):
+    if metric.fields.get("status", 0) >= 500:
+        metric.tags["error"] = "true"
+    metric.tags.pop("host", None)
+    return metric
+`,
+			input: []telex.Metric{
+				testutil.MustMetric("http", map[string]string{"host": "a"}, map[string]interface{}{"status": int64(503)}, now),
+				testutil.MustMetric("http", map[string]string{"host": "b"}, map[string]interface{}{"status": int64(200)}, now),
+			},
+			expected: []telex.Metric{
+				testutil.MustMetric("http", map[string]string{"error": "true"}, map[string]interface{}{"status": int64(503)}, now),
+				testutil.MustMetric("http", map[string]string{}, map[string]interface{}{"status": int64(200)}, now),
+			},
+		},
+		{
+			name: "split a metric",
+			source: `
+def apply(metric):
+    metrics = []
+    for k, v in sorted(metric.fields.items()):
+        m = Metric(metric.name + "_" + k)
+        m.tags.update(metric.tags)
+        m.fields["value"] = v
+        m.time = metric.time
+        metrics.append(m)
+    return metrics
+`,
+			input: []telex.Metric{
+				testutil.MustMetric("disk", map[string]string{"path": "/"}, map[string]interface{}{"free": uint64(1 << 63), "used": int64(5)}, now),
+			},
+			expected: []telex.Metric{
+				testutil.MustMetric("disk_free", map[string]string{"path": "/"}, map[string]interface{}{"value": uint64(1 << 63)}, now),
+				testutil.MustMetric("disk_used", map[string]string{"path": "/"}, map[string]interface{}{"value": int64(5)}, now),
+			},
+		},
+		{
+			name: "rename and shift time",
+			source: `
+def apply(metric):
+    metric.name = "renamed"
+    metric.time = metric.time - 1000000000
+    for k in metric.fields:
+        if k.startswith("tmp_"):
+            metric.fields.pop(k)
+    return metric
+`,
+			input: []telex.Metric{
+				testutil.MustMetric("cpu", nil, map[string]interface{}{"tmp_a": true, "b": "x"}, now),
+			},
+			expected: []telex.Metric{
+				testutil.MustMetric("renamed", nil, map[string]interface{}{"b": "x"}, now.Add(-time.Second)),
+			},
+		},
+		{
+			name: "same metric returned twice",
+			source: `
+def apply(metric):
+    copy = deepcopy(metric)
+    copy.tags["copy"] = "true"
+    return [metric, copy, metric]
+`,
+			input: []telex.Metric{
+				testutil.MustMetric("cpu", nil, map[string]interface{}{"usage": 1.0}, now),
+			},
+			expected: []telex.Metric{
+				testutil.MustMetric("cpu", nil, map[string]interface{}{"usage": 1.0}, now),
+				testutil.MustMetric("cpu", map[string]string{"copy": "true"}, map[string]interface{}{"usage": 1.0}, now),
+				testutil.MustMetric("cpu", nil, map[string]interface{}{"usage": 1.0}, now),
+			},
+		},
+		{
+			name: "state across calls",
+			source: `
+def apply(metric):
+    state["count"] = state.get("count", 0) + 1
+    metric.fields["count"] = state["count"]
+    return metric
+`,
+			input: []telex.Metric{
+				testutil.MustMetric("cpu", nil, map[string]interface{}{}, now),
+				testutil.MustMetric("cpu", nil, map[string]interface{}{}, now),
+			},
+			expected: []telex.Metric{
+				testutil.MustMetric("cpu", nil, map[string]interface{}{"count": int64(1)}, now),
+				testutil.MustMetric("cpu", nil, map[string]interface{}{"count": int64(2)}, now),
+			},
+		},
+		{
+			name: "error drops the metric",
+			source: `
+def apply(metric):
+    if metric.name == "bad":
+        metric.tags["value"] = 1
+    return metric
+`,
+			input: []telex.Metric{
+				testutil.MustMetric("bad", nil, map[string]interface{}{"a": 1.0}, now),
+				testutil.MustMetric("good", nil, map[string]interface{}{"a": 1.0}, now),
+			},
+			expected: []telex.Metric{
+				testutil.MustMetric("good", nil, map[string]interface{}{"a": 1.0}, now),
+			},
+		},
+		{
+			name: "invalid return value",
+			source: `
+def apply(metric):
+    return "metric"
+`,
+			input: []telex.Metric{
+				testutil.MustMetric("cpu", nil, map[string]interface{}{"a": 1.0}, now),
+			},
+			expected: []telex.Metric{},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s := newProcessor(tt.source)
+			require.NoError(t, s.Init())
+			actual := s.Apply(tt.input...)
+			testutil.RequireMetricsEqual(t, tt.expected, actual)
+		})
+	}
+}
+
+func TestMaxSteps(t *testing.T) {
+	s := newProcessor(`
+def apply(metric):
+    for i in range(metric.fields["n"]):
+        pass
+    return metric
+`)
+	s.MaxSteps = 1000
+	require.NoError(t, s.Init())
+
+	actual := s.Apply(
+		testutil.MustMetric("loop", nil, map[string]interface{}{"n": int64(10)}, now),
+		testutil.MustMetric("loop", nil, map[string]interface{}{"n": int64(100000)}, now),
+		testutil.MustMetric("loop", nil, map[string]interface{}{"n": int64(20)}, now),
+	)
+	// The limit applies to each call.
+	require.Len(t, actual, 2)
+}
+
+func TestTimeout(t *testing.T) {
+	s := newProcessor(`
+def apply(metric):
+    for i in range(1000000000):
+        pass
+    return metric
+`)
+	s.MaxSteps = 0
+	s.Timeout = internal.Duration{Duration: 10 * time.Millisecond}
+	require.NoError(t, s.Init())
+
+	start := time.Now()
+	actual := s.Apply(testutil.MustMetric("loop", nil, map[string]interface{}{"a": 1.0}, now))
+	require.Len(t, actual, 0)
+	require.True(t, time.Since(start) < 5*time.Second)
+}
+
+func TestScript(t *testing.T) {
+	dir, err := ioutil.TempDir("", "starlark")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+	script := filepath.Join(dir, "script.star")
+	require.NoError(t, ioutil.WriteFile(script, []byte(`
+def apply(metric):
+    metric.tags["script"] = "true"
+    return metric
+`), 0644))
+
+	s := NewStarlark()
+	s.Script = script
+	require.NoError(t, s.Init())
+	actual := s.Apply(testutil.MustMetric("cpu", nil, map[string]interface{}{"a": 1.0}, now))
+	testutil.RequireMetricsEqual(t,
+		[]telex.Metric{testutil.MustMetric("cpu", map[string]string{"script": "true"}, map[string]interface{}{"a": 1.0}, now)},
+		actual)
+}
+
+func TestInvalidScript(t *testing.T) {
+	tests := []struct {
+		name   string
+		source string
+		script string
+	}{
+		{name: "no source", source: ""},
+		{name: "source and script", source: "def apply(metric):\n    return metric\n", script: "script.star"},
+		{name: "syntax error", source: "def apply(metric)\n"},
+		{name: "no apply", source: "def process(metric):\n    return metric\n"},
+		{name: "apply arguments", source: "def apply(metric, other):\n    return metric\n"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s := newProcessor(tt.source)
+			s.Script = tt.script
+			require.Error(t, s.Init())
+
+			// Without a script the metrics are dropped.
+			input := []telex.Metric{testutil.MustMetric("cpu", nil, map[string]interface{}{"a": 1.0}, now)}
+			require.Empty(t, s.Apply(input...))
+		})
+	}
+}
@@ -0,0 +1,358 @@
+package graphite
+
+import (
+	"bytes"
+	"fmt"
+	"math"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/lavaorg/telex"
+	"github.com/lavaorg/telex/filter"
+)
+
+const DEFAULT_TEMPLATE = "host.tags.measurement.field"
+
+var (
+	strictAllowedChars = regexp.MustCompile(`[^a-zA-Z0-9-:._=\p{L}]`)
+	hyphenChars        = strings.NewReplacer("/", "-", "@", "-", "*", "-")
+	dropChars          = strings.NewReplacer(`\`, "", "..", ".")
+
+	// Per https://graphite.readthedocs.io/en/latest/tags.html
+	compatibleAllowedCharsName  = regexp.MustCompile(`[^ "-:\<>-\]_a-~\p{L}]`)
+	compatibleAllowedCharsValue = regexp.MustCompile(`[^ -:<-~\p{L}]`)
+	compatibleLeadingTildeDrop  = regexp.MustCompile(`^[~]*(.*)`)
+
+	fieldDeleter = strings.NewReplacer(".FIELDNAME", "", "FIELDNAME.", "")
+)
+
+// GraphiteTemplate is a template applied to metrics whose name matches the
+// filter.
+type GraphiteTemplate struct {
+	Filter filter.Filter
+	Value  string
+}
+
+type GraphiteSerializer struct {
+	Prefix     string
+	Template   string
+	Templates  []*GraphiteTemplate
+	TagSupport bool
+
+	// TagSanitizeMode is either "strict" or "compatible", it selects the
+	// characters allowed in tag names and values when TagSupport is set.
+	TagSanitizeMode string
+
+	// Separator joins the prefix, measurement and field when TagSupport is
+	// set.
+	Separator string
+}
+
+// NewSerializer creates a GraphiteSerializer.  Each of the templates is of
+// the form "[filter] template", templates without a filter replace the
+// default template.
+func NewSerializer(
+	prefix string,
+	template string,
+	templates []string,
+	tagSupport bool,
+	tagSanitizeMode string,
+	separator string,
+) (*GraphiteSerializer, error) {
+	switch tagSanitizeMode {
+	case "":
+		tagSanitizeMode = "strict"
+	case "strict", "compatible":
+	default:
+		return nil, fmt.Errorf("unknown graphite_tag_sanitize_mode %q", tagSanitizeMode)
+	}
+
+	if separator == "" {
+		separator = "."
+	}
+
+	graphiteTemplates, defaultTemplate, err := InitGraphiteTemplates(templates)
+	if err != nil {
+		return nil, err
+	}
+	if defaultTemplate != "" {
+		template = defaultTemplate
+	}
+
+	return &GraphiteSerializer{
+		Prefix:          prefix,
+		Template:        template,
+		Templates:       graphiteTemplates,
+		TagSupport:      tagSupport,
+		TagSanitizeMode: tagSanitizeMode,
+		Separator:       separator,
+	}, nil
+}
+
+func (s *GraphiteSerializer) Serialize(metric telex.Metric) ([]byte, error) {
+	out := []byte{}
+
+	// Convert UnixNano to Unix timestamps
+	timestamp := metric.Time().UnixNano() / 1000000000
+
+	if s.TagSupport {
+		for _, field := range metric.FieldList() {
+			fieldValue := formatValue(field.Value)
+			if fieldValue == "" {
+				continue
+			}
+			bucket := SerializeBucketNameWithTags(metric.Name(), metric.Tags(),
+				s.Prefix, s.Separator, field.Key, s.TagSanitizeMode)
+			out = append(out, fmt.Sprintf("%s %s %d\n",
+				bucket, fieldValue, timestamp)...)
+		}
+		return out, nil
+	}
+
+	template := s.Template
+	for _, graphiteTemplate := range s.Templates {
+		if graphiteTemplate.Filter.Match(metric.Name()) {
+			template = graphiteTemplate.Value
+			break
+		}
+	}
+
+	bucket := SerializeBucketName(metric.Name(), metric.Tags(), template, s.Prefix)
+	if bucket == "" {
+		return out, nil
+	}
+
+	for _, field := range metric.FieldList() {
+		fieldValue := formatValue(field.Value)
+		if fieldValue == "" {
+			continue
+		}
+		out = append(out, fmt.Sprintf("%s %s %d\n",
+			strictSanitize(InsertField(bucket, field.Key)), fieldValue, timestamp)...)
+	}
+	return out, nil
+}
+
+func (s *GraphiteSerializer) SerializeBatch(metrics []telex.Metric) ([]byte, error) {
+	var batch bytes.Buffer
+	for _, m := range metrics {
+		buf, err := s.Serialize(m)
+		if err != nil {
+			return nil, err
+		}
+		batch.Write(buf)
+	}
+	return batch.Bytes(), nil
+}
+
+// formatValue returns the graphite representation of a field value, or the
+// empty string if the value can not be sent to graphite.
+func formatValue(value interface{}) string {
+	switch v := value.(type) {
+	case bool:
+		if v {
+			return "1"
+		}
+		return "0"
+	case uint64:
+		return strconv.FormatUint(v, 10)
+	case int64:
+		return strconv.FormatInt(v, 10)
+	case float64:
+		if math.IsNaN(v) || math.IsInf(v, 0) {
+			return ""
+		}
+		return strconv.FormatFloat(v, 'f', -1, 64)
+	}
+	return ""
+}
+
+// SerializeBucketName will take the given measurement name and tags and
+// produce a graphite bucket. It will use the given template, or
+// DEFAULT_TEMPLATE if it is empty.
+//
+// NOTE: SerializeBucketName replaces the "field" portion of the template with
+// FIELDNAME. It is up to the user to replace this. This is so that
+// SerializeBucketName can be called just once per measurement, rather than
+// once per field. See InsertField.
+func SerializeBucketName(
+	measurement string,
+	tags map[string]string,
+	template string,
+	prefix string,
+) string {
+	if template == "" {
+		template = DEFAULT_TEMPLATE
+	}
+	tagsCopy := make(map[string]string)
+	for k, v := range tags {
+		tagsCopy[k] = v
+	}
+
+	var out []string
+	for _, templatePart := range strings.Split(template, ".") {
+		switch templatePart {
+		case "measurement":
+			out = append(out, measurement)
+		case "tags":
+			// we will replace this later
+			out = append(out, "TAGS")
+		case "field":
+			// user of SerializeBucketName needs to replace this
+			out = append(out, "FIELDNAME")
+		default:
+			// This is a tag being applied
+			if tagvalue, ok := tagsCopy[templatePart]; ok {
+				out = append(out, strings.Replace(tagvalue, ".", "_", -1))
+				delete(tagsCopy, templatePart)
+			}
+		}
+	}
+
+	// insert remaining tags into output name
+	for i, templatePart := range out {
+		if templatePart == "TAGS" {
+			out[i] = buildTags(tagsCopy)
+			break
+		}
+	}
+
+	if len(out) == 0 {
+		return ""
+	}
+
+	if prefix == "" {
+		return strings.Join(out, ".")
+	}
+	return prefix + "." + strings.Join(out, ".")
+}
+
+// InitGraphiteTemplates compiles the filters of the templates and returns
+// the template without a filter, if any, as the default template.
+func InitGraphiteTemplates(templates []string) ([]*GraphiteTemplate, string, error) {
+	var graphiteTemplates []*GraphiteTemplate
+	defaultTemplate := ""
+
+	for i, t := range templates {
+		parts := strings.Fields(t)
+
+		if len(parts) == 0 {
+			return nil, "", fmt.Errorf("missing template at position: %d", i)
+		}
+		if len(parts) == 1 {
+			if parts[0] == "" {
+				return nil, "", fmt.Errorf("missing template at position: %d", i)
+			}
+			// Override default template
+			defaultTemplate = t
+			continue
+		}
+
+		if len(parts) > 2 {
+			return nil, "", fmt.Errorf("invalid template format: '%s'", t)
+		}
+
+		tFilter, err := filter.Compile([]string{parts[0]})
+		if err != nil {
+			return nil, "", err
+		}
+
+		graphiteTemplates = append(graphiteTemplates, &GraphiteTemplate{
+			Filter: tFilter,
+			Value:  parts[1],
+		})
+	}
+
+	return graphiteTemplates, defaultTemplate, nil
+}
+
+// SerializeBucketNameWithTags will take the given measurement name and tags
+// and produce a graphite bucket using the tag format described at
+// http://graphite.readthedocs.io/en/latest/tags.html
+func SerializeBucketNameWithTags(
+	measurement string,
+	tags map[string]string,
+	prefix string,
+	separator string,
+	field string,
+	tagSanitizeMode string,
+) string {
+	var out string
+	var tagsCopy []string
+	for k, v := range tags {
+		if k == "name" {
+			k = "_name"
+		}
+		if tagSanitizeMode == "compatible" {
+			tagsCopy = append(tagsCopy, compatibleSanitize(k, v))
+		} else {
+			tagsCopy = append(tagsCopy, strictSanitize(k+"="+v))
+		}
+	}
+	sort.Strings(tagsCopy)
+
+	if prefix != "" {
+		out = prefix + separator
+	}
+
+	out += measurement
+
+	if field != "value" {
+		out += separator + field
+	}
+
+	out = strictSanitize(out)
+
+	if len(tagsCopy) > 0 {
+		out += ";" + strings.Join(tagsCopy, ";")
+	}
+
+	return out
+}
+
+// InsertField takes the bucket string from SerializeBucketName and replaces the
+// FIELDNAME portion. If fieldName == "value", it will simply delete the
+// FIELDNAME portion.
+func InsertField(bucket, fieldName string) string {
+	// if the field name is "value", then dont use it
+	if fieldName == "value" {
+		return fieldDeleter.Replace(bucket)
+	}
+	return strings.Replace(bucket, "FIELDNAME", fieldName, 1)
+}
+
+func buildTags(tags map[string]string) string {
+	var keys []string
+	for k := range tags {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+
+	var values []string
+	for _, k := range keys {
+		values = append(values, strings.Replace(tags[k], ".", "_", -1))
+	}
+	return strings.Join(values, ".")
+}
+
+// strictSanitize replaces all characters which are not alphanumeric or one of
+// "-:._=" with an underscore.
+func strictSanitize(value string) string {
+	// Apply special hyphenation rules to preserve backwards compatibility
+	value = hyphenChars.Replace(value)
+	// Apply rule to drop some chars to preserve backwards compatibility
+	value = dropChars.Replace(value)
+	// Replace any remaining illegal chars
+	return strictAllowedChars.ReplaceAllLiteralString(value, "_")
+}
+
+// compatibleSanitize only replaces the characters graphite does not accept
+// in tag names and values.
+func compatibleSanitize(name string, value string) string {
+	name = compatibleAllowedCharsName.ReplaceAllLiteralString(name, "_")
+	value = compatibleAllowedCharsValue.ReplaceAllLiteralString(value, "_")
+	value = compatibleLeadingTildeDrop.FindStringSubmatch(value)[1]
+	return name + "=" + value
+}
@@ -0,0 +1,172 @@
+package graphite
+
+import (
+	"sort"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/lavaorg/telex"
+	"github.com/lavaorg/telex/metric"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+var defaultTags = map[string]string{
+	"host":       "localhost",
+	"cpu":        "cpu0",
+	"datacenter": "us-west-2",
+}
+
+func newMetric(t *testing.T, name string, tags map[string]string, fields map[string]interface{}) telex.Metric {
+	m, err := metric.New(name, tags, fields, time.Unix(1289430000, 0))
+	require.NoError(t, err)
+	return m
+}
+
+func serializeSorted(t *testing.T, s *GraphiteSerializer, m telex.Metric) []string {
+	buf, err := s.Serialize(m)
+	require.NoError(t, err)
+	lines := strings.Split(strings.TrimSuffix(string(buf), "\n"), "\n")
+	sort.Strings(lines)
+	return lines
+}
+
+func TestSerializeMetricNoHost(t *testing.T) {
+	m := newMetric(t, "cpu",
+		map[string]string{"cpu": "cpu0", "datacenter": "us-west-2"},
+		map[string]interface{}{"usage_idle": float64(91.5), "usage_busy": float64(8.5)})
+
+	s, err := NewSerializer("", "", nil, false, "", "")
+	require.NoError(t, err)
+
+	expected := []string{
+		"cpu0.us-west-2.cpu.usage_busy 8.5 1289430000",
+		"cpu0.us-west-2.cpu.usage_idle 91.5 1289430000",
+	}
+	assert.Equal(t, expected, serializeSorted(t, s, m))
+}
+
+func TestSerializeMetricHostWithPrefix(t *testing.T) {
+	m := newMetric(t, "cpu", defaultTags,
+		map[string]interface{}{"usage_idle": float64(91.5), "usage_busy": float64(8.5)})
+
+	s, err := NewSerializer("prefix", "", nil, false, "", "")
+	require.NoError(t, err)
+
+	expected := []string{
+		"prefix.localhost.cpu0.us-west-2.cpu.usage_busy 8.5 1289430000",
+		"prefix.localhost.cpu0.us-west-2.cpu.usage_idle 91.5 1289430000",
+	}
+	assert.Equal(t, expected, serializeSorted(t, s, m))
+}
+
+func TestSerializeValueField(t *testing.T) {
+	m := newMetric(t, "cpu", defaultTags,
+		map[string]interface{}{"value": int64(42)})
+
+	s, err := NewSerializer("", "", nil, false, "", "")
+	require.NoError(t, err)
+
+	assert.Equal(t, []string{"localhost.cpu0.us-west-2.cpu 42 1289430000"},
+		serializeSorted(t, s, m))
+}
+
+func TestSerializeValueTypes(t *testing.T) {
+	m := newMetric(t, "cpu", map[string]string{"host": "localhost"},
+		map[string]interface{}{
+			"bool":   true,
+			"uint":   uint64(42),
+			"string": "ignored",
+		})
+
+	s, err := NewSerializer("", "", nil, false, "", "")
+	require.NoError(t, err)
+
+	expected := []string{
+		"localhost.cpu.bool 1 1289430000",
+		"localhost.cpu.uint 42 1289430000",
+	}
+	assert.Equal(t, expected, serializeSorted(t, s, m))
+}
+
+func TestSerializeMetricWithTemplates(t *testing.T) {
+	s, err := NewSerializer("", "", []string{
+		"cpu host.measurement.tags.field",
+		"measurement.field",
+	}, false, "", "")
+	require.NoError(t, err)
+
+	m := newMetric(t, "cpu", defaultTags,
+		map[string]interface{}{"usage_idle": float64(91.5)})
+	assert.Equal(t, []string{"localhost.cpu.cpu0.us-west-2.usage_idle 91.5 1289430000"},
+		serializeSorted(t, s, m))
+
+	m = newMetric(t, "mem", defaultTags,
+		map[string]interface{}{"used": int64(42)})
+	assert.Equal(t, []string{"mem.used 42 1289430000"},
+		serializeSorted(t, s, m))
+}
+
+func TestSerializeSanitizesBucket(t *testing.T) {
+	m := newMetric(t, "cpu", map[string]string{"host": "local host", "path": "/var/log"},
+		map[string]interface{}{"usage@idle": float64(91.5)})
+
+	s, err := NewSerializer("", "host.path.measurement.field", nil, false, "", "")
+	require.NoError(t, err)
+
+	assert.Equal(t, []string{"local_host.-var-log.cpu.usage-idle 91.5 1289430000"},
+		serializeSorted(t, s, m))
+}
+
+func TestSerializeTagSupport(t *testing.T) {
+	m := newMetric(t, "cpu", defaultTags,
+		map[string]interface{}{"usage_idle": float64(91.5), "value": float64(1)})
+
+	s, err := NewSerializer("prefix", "", nil, true, "", "_")
+	require.NoError(t, err)
+
+	expected := []string{
+		"prefix_cpu;cpu=cpu0;datacenter=us-west-2;host=localhost 1 1289430000",
+		"prefix_cpu_usage_idle;cpu=cpu0;datacenter=us-west-2;host=localhost 91.5 1289430000",
+	}
+	assert.Equal(t, expected, serializeSorted(t, s, m))
+}
+
+func TestSerializeTagSanitizeMode(t *testing.T) {
+	m := newMetric(t, "cpu",
+		map[string]string{"name": "a b", "path": "~/var/log"},
+		map[string]interface{}{"value": float64(1)})
+
+	strict, err := NewSerializer("", "", nil, true, "strict", "")
+	require.NoError(t, err)
+	assert.Equal(t, []string{"cpu;_name=a_b;path=_-var-log 1 1289430000"},
+		serializeSorted(t, strict, m))
+
+	compatible, err := NewSerializer("", "", nil, true, "compatible", "")
+	require.NoError(t, err)
+	assert.Equal(t, []string{"cpu;_name=a b;path=/var/log 1 1289430000"},
+		serializeSorted(t, compatible, m))
+}
+
+func TestSerializeInvalidSanitizeMode(t *testing.T) {
+	_, err := NewSerializer("", "", nil, true, "loose", "")
+	require.Error(t, err)
+}
+
+func TestSerializeBatch(t *testing.T) {
+	m := newMetric(t, "cpu", map[string]string{"host": "localhost"},
+		map[string]interface{}{"value": int64(42)})
+
+	s, err := NewSerializer("", "", nil, false, "", "")
+	require.NoError(t, err)
+
+	buf, err := s.SerializeBatch([]telex.Metric{m, m})
+	require.NoError(t, err)
+	assert.Equal(t, "localhost.cpu 42 1289430000\nlocalhost.cpu 42 1289430000\n", string(buf))
+}
+
+func TestInitGraphiteTemplatesInvalid(t *testing.T) {
+	_, _, err := InitGraphiteTemplates([]string{"cpu host.measurement extra"})
+	require.Error(t, err)
+}
@@ -6,6 +6,7 @@ import (
 
 	"github.com/lavaorg/telex"
 
+	"github.com/lavaorg/telex/plugins/serializers/graphite"
 	"github.com/lavaorg/telex/plugins/serializers/influx"
 	"github.com/lavaorg/telex/plugins/serializers/json"
 )
@@ -40,6 +41,14 @@ type Config struct {
 	// Support tags in graphite protocol
 	GraphiteTagSupport bool
 
+	// Character set used for tags in graphite protocol, either "strict" or
+	// "compatible"
+	GraphiteTagSanitizeMode string
+
+	// Separator of the measurement and field when graphite tags are
+	// supported
+	GraphiteSeparator string
+
 	// Maximum line length in bytes; influx format only
 	InfluxMaxLineBytes int
 
@@ -57,6 +66,10 @@ type Config struct {
 	// only supports Graphite
 	Template string
 
+	// Templates with filters for converting telex metrics into Graphite,
+	// only supports Graphite
+	Templates []string
+
 	// Timestamp units to use for JSON formatted output
 	TimestampUnits time.Duration
 
@@ -73,6 +86,8 @@ func NewSerializer(config *Config) (Serializer, error) {
 		serializer, err = NewInfluxSerializerConfig(config)
 	case "json":
 		serializer, err = NewJsonSerializer(config.TimestampUnits)
+	case "graphite":
+		serializer, err = NewGraphiteSerializer(config)
 	default:
 		err = fmt.Errorf("Invalid data format: %s", config.DataFormat)
 	}
@@ -83,6 +98,16 @@ func NewJsonSerializer(timestampUnits time.Duration) (Serializer, error) {
 	return json.NewSerializer(timestampUnits)
 }
 
+func NewGraphiteSerializer(config *Config) (Serializer, error) {
+	return graphite.NewSerializer(
+		config.Prefix,
+		config.Template,
+		config.Templates,
+		config.GraphiteTagSupport,
+		config.GraphiteTagSanitizeMode,
+		config.GraphiteSeparator)
+}
+
 func NewInfluxSerializerConfig(config *Config) (Serializer, error) {
 	var sort influx.FieldSortOrder
 	if config.InfluxSortFields {
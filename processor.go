@@ -10,3 +10,18 @@ type Processor interface {
 	// Apply the filter to the given metric.
 	Apply(in ...Metric) []Metric
 }
+
+// StreamingProcessor is a Processor emitting metrics asynchronously, like
+// the metrics of a program it runs.  The metrics added to the Accumulator
+// continue through the following processors.
+type StreamingProcessor interface {
+	Processor
+
+	// Start is called before the first Apply.  The Accumulator may be
+	// retained and used until Stop returns.
+	Start(Accumulator) error
+
+	// Stop is called after the last Apply, it returns once all the metrics
+	// are emitted.
+	Stop()
+}
@@ -87,6 +87,14 @@ func RegisterTiming(measurement, field string, tags map[string]string) Stat {
 	})
 }
 
+// Unregister removes the stats registered with the given measurement and
+// tags from the registry, they are no longer returned by Metrics().
+func Unregister(measurement string, tags map[string]string) {
+	registry.mu.Lock()
+	defer registry.mu.Unlock()
+	delete(registry.stats, key("internal_"+measurement, tags))
+}
+
 // Metrics returns all registered stats as telex metrics.
 func Metrics() []telex.Metric {
 	registry.mu.Lock()
@@ -120,6 +128,24 @@ func Metrics() []telex.Metric {
 	return metrics
 }
 
+// Values returns the values, by field, of the stats registered with the
+// given measurement and tags.  Unlike Metrics it does not reset the timing
+// stats, whose last average is returned.
+func Values(measurement string, tags map[string]string) map[string]int64 {
+	registry.mu.Lock()
+	defer registry.mu.Unlock()
+
+	values := make(map[string]int64)
+	for field, stat := range registry.stats[key("internal_"+measurement, tags)] {
+		if timing, ok := stat.(*timingStat); ok {
+			values[field] = timing.peek()
+		} else {
+			values[field] = stat.Get()
+		}
+	}
+	return values
+}
+
 type rgstry struct {
 	stats map[uint64]map[string]Stat
 	mu    sync.Mutex
@@ -108,6 +108,38 @@ func TestRegisterTimingAndIncrAndSet(t *testing.T) {
 	assert.Equal(t, "internal_test", foo.Name())
 }
 
+func TestValues(t *testing.T) {
+	testLock.Lock()
+	defer testCleanup()
+	s1 := Register("test", "test_field1", map[string]string{"test": "foo"})
+	s2 := RegisterTiming("test", "test_field2_ns", map[string]string{"test": "foo"})
+	Register("test", "test_field3", map[string]string{"test": "bar"})
+
+	s1.Incr(10)
+	s2.Incr(10)
+	s2.Incr(20)
+	expected := map[string]int64{"test_field1": 10, "test_field2_ns": 15}
+	assert.Equal(t, expected, Values("test", map[string]string{"test": "foo"}))
+
+	// timings are not reset
+	assert.Equal(t, int64(15), s2.Get())
+	assert.Equal(t, expected, Values("test", map[string]string{"test": "foo"}))
+
+	assert.Empty(t, Values("test", map[string]string{"test": "baz"}))
+}
+
+func TestUnregister(t *testing.T) {
+	testLock.Lock()
+	defer testCleanup()
+	Register("test", "test_field1", map[string]string{"test": "foo"})
+	Register("test", "test_field2", map[string]string{"test": "foo"})
+	Register("test", "test_field1", map[string]string{"test": "bar"})
+
+	Unregister("test", map[string]string{"test": "foo"})
+	assert.Empty(t, Values("test", map[string]string{"test": "foo"}))
+	assert.Len(t, Metrics(), 1)
+}
+
 func TestStatKeyConsistency(t *testing.T) {
 	s := &stat{
 		measurement: "internal_stat",
@@ -0,0 +1,155 @@
+package shim
+
+import (
+	"time"
+
+	"github.com/lavaorg/telex"
+	"github.com/lavaorg/telex/metric"
+)
+
+// accumulator writes the metrics of the plugin to stdout, and its errors to
+// stderr.  A tracking metric is accepted once written.
+type accumulator struct {
+	shim      *Shim
+	precision time.Duration
+}
+
+func newAccumulator(s *Shim) *accumulator {
+	return &accumulator{shim: s, precision: time.Nanosecond}
+}
+
+func (a *accumulator) AddFields(
+	measurement string,
+	fields map[string]interface{},
+	tags map[string]string,
+	t ...time.Time,
+) {
+	a.addFields(measurement, tags, fields, telex.Untyped, t...)
+}
+
+func (a *accumulator) AddGauge(
+	measurement string,
+	fields map[string]interface{},
+	tags map[string]string,
+	t ...time.Time,
+) {
+	a.addFields(measurement, tags, fields, telex.Gauge, t...)
+}
+
+func (a *accumulator) AddCounter(
+	measurement string,
+	fields map[string]interface{},
+	tags map[string]string,
+	t ...time.Time,
+) {
+	a.addFields(measurement, tags, fields, telex.Counter, t...)
+}
+
+func (a *accumulator) AddSummary(
+	measurement string,
+	fields map[string]interface{},
+	tags map[string]string,
+	t ...time.Time,
+) {
+	a.addFields(measurement, tags, fields, telex.Summary, t...)
+}
+
+func (a *accumulator) AddHistogram(
+	measurement string,
+	fields map[string]interface{},
+	tags map[string]string,
+	t ...time.Time,
+) {
+	a.addFields(measurement, tags, fields, telex.Histogram, t...)
+}
+
+func (a *accumulator) addFields(
+	measurement string,
+	tags map[string]string,
+	fields map[string]interface{},
+	tp telex.ValueType,
+	t ...time.Time,
+) {
+	tm := time.Now()
+	if len(t) > 0 {
+		tm = t[0]
+	}
+	m, err := metric.New(measurement, tags, fields, tm.Round(a.precision), tp)
+	if err != nil {
+		return
+	}
+	a.AddMetric(m)
+}
+
+func (a *accumulator) AddMetric(m telex.Metric) {
+	m.SetTime(m.Time().Round(a.precision))
+	if err := a.shim.writeMetric(m); err != nil {
+		a.AddError(err)
+		m.Reject()
+		return
+	}
+	m.Accept()
+}
+
+func (a *accumulator) AddError(err error) {
+	if err == nil {
+		return
+	}
+	a.shim.writeError(err)
+}
+
+func (a *accumulator) SetPrecision(precision, interval time.Duration) {
+	if precision > 0 {
+		a.precision = precision
+		return
+	}
+	switch {
+	case interval >= time.Second:
+		a.precision = time.Second
+	case interval >= time.Millisecond:
+		a.precision = time.Millisecond
+	case interval >= time.Microsecond:
+		a.precision = time.Microsecond
+	default:
+		a.precision = time.Nanosecond
+	}
+}
+
+func (a *accumulator) WithTracking(maxTracked int) telex.TrackingAccumulator {
+	return &trackingAccumulator{
+		accumulator: a,
+		delivered:   make(chan telex.DeliveryInfo, maxTracked),
+	}
+}
+
+type trackingAccumulator struct {
+	*accumulator
+	delivered chan telex.DeliveryInfo
+}
+
+func (a *trackingAccumulator) AddTrackingMetric(m telex.Metric) telex.TrackingID {
+	dm, id := metric.WithTracking(m, a.onDelivery)
+	a.AddMetric(dm)
+	return id
+}
+
+func (a *trackingAccumulator) AddTrackingMetricGroup(group []telex.Metric) telex.TrackingID {
+	db, id := metric.WithGroupTracking(group, a.onDelivery)
+	for _, m := range db {
+		a.AddMetric(m)
+	}
+	return id
+}
+
+func (a *trackingAccumulator) Delivered() <-chan telex.DeliveryInfo {
+	return a.delivered
+}
+
+func (a *trackingAccumulator) onDelivery(info telex.DeliveryInfo) {
+	select {
+	case a.delivered <- info:
+	default:
+		// More items were sent for tracking than space requested.
+		panic("channel is full")
+	}
+}
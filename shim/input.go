@@ -0,0 +1,30 @@
+package shim
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/lavaorg/telex"
+)
+
+// runInput gathers from the input each time a line is read.  A service
+// input is started first, and stopped once stdin is closed.
+func (s *Shim) runInput() error {
+	acc := newAccumulator(s)
+	if si, ok := s.input.(telex.ServiceInput); ok {
+		if err := si.Start(acc); err != nil {
+			return fmt.Errorf("error starting input: %v", err)
+		}
+		defer si.Stop()
+	}
+
+	return s.scanLines(func(line []byte) {
+		var err error
+		if ci, ok := s.input.(telex.ContextInput); ok {
+			err = ci.GatherContext(context.Background(), acc)
+		} else {
+			err = s.input.Gather(acc)
+		}
+		acc.AddError(err)
+	})
+}
@@ -0,0 +1,54 @@
+package shim
+
+import (
+	"bytes"
+	"fmt"
+
+	"github.com/lavaorg/telex"
+	"github.com/lavaorg/telex/plugins/parsers/influx"
+)
+
+// batchPrefix starts the line ending a numbered batch, "#batch <id>".
+var batchPrefix = []byte("#batch ")
+
+// runOutput writes the batches read to the output, a batch is ended by the
+// line "#batch <id>" or by an empty line.  The result of each write is
+// written to stdout, "ok" or the error, after the id of a numbered batch.
+func (s *Shim) runOutput() error {
+	if err := s.output.Connect(); err != nil {
+		return fmt.Errorf("error connecting output: %v", err)
+	}
+	defer s.output.Close()
+
+	parser := influx.NewParser(influx.NewMetricHandler())
+	// A batch cut short by stdin closing is not acknowledged, the agent
+	// writes it again.
+	var batch []telex.Metric
+	return s.scanLines(func(line []byte) {
+		var id string
+		if bytes.HasPrefix(line, batchPrefix) {
+			id = string(bytes.TrimSpace(line[len(batchPrefix):]))
+		} else if len(line) > 0 {
+			metrics, err := parser.Parse(line)
+			if err != nil {
+				s.writeError(fmt.Errorf("parse error: %v", err))
+				return
+			}
+			batch = append(batch, metrics...)
+			return
+		}
+
+		result := "ok"
+		if err := s.output.Write(batch); err != nil {
+			result = oneLine(err.Error())
+			if result == "" || result == "ok" {
+				result = "error writing batch"
+			}
+		}
+		batch = nil
+		if id != "" {
+			result = id + " " + result
+		}
+		s.writeLine(result)
+	})
+}
@@ -0,0 +1,36 @@
+package shim
+
+import (
+	"fmt"
+
+	"github.com/lavaorg/telex"
+	"github.com/lavaorg/telex/plugins/parsers/influx"
+)
+
+// runProcessor applies the processor to the metrics read, and writes the
+// metrics it returns.  A streaming processor is started first, and stopped
+// once stdin is closed.
+func (s *Shim) runProcessor() error {
+	acc := newAccumulator(s)
+	if sp, ok := s.processor.(telex.StreamingProcessor); ok {
+		if err := sp.Start(acc); err != nil {
+			return fmt.Errorf("error starting processor: %v", err)
+		}
+		defer sp.Stop()
+	}
+
+	parser := influx.NewParser(influx.NewMetricHandler())
+	return s.scanLines(func(line []byte) {
+		if len(line) == 0 {
+			return
+		}
+		metrics, err := parser.Parse(line)
+		if err != nil {
+			acc.AddError(fmt.Errorf("parse error: %v", err))
+			return
+		}
+		for _, m := range s.processor.Apply(metrics...) {
+			acc.AddMetric(m)
+		}
+	})
+}
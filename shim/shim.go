@@ -0,0 +1,247 @@
+// Package shim runs a telex plugin as a standalone program, an external
+// plugin the agent loads from its plugin_directory.
+//
+// The program wraps a single input, processor or output:
+//
+//	func main() {
+//		s := shim.New()
+//		if err := s.AddInput(&mycollector.Collector{}); err != nil {
+//			fmt.Fprintln(os.Stderr, err)
+//			os.Exit(1)
+//		}
+//		if err := s.Run(); err != nil {
+//			fmt.Fprintln(os.Stderr, err)
+//			os.Exit(1)
+//		}
+//	}
+//
+// The plugin talks to the agent over stdin and stdout, metrics are written
+// in the influx line protocol:
+//
+//   - an input gathers each time it reads a line, and writes the metrics it
+//     gathers;
+//   - a processor reads metrics, and writes the metrics it emits;
+//   - an output reads batches of metrics ended by the line "#batch <id>",
+//     and writes "<id> ok" once a batch is written, or the id and the error
+//     writing it.
+//
+// The errors of the plugin are written to stderr, one per line.  The program
+// exits once stdin is closed.
+package shim
+
+import (
+	"bufio"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"log"
+	"os"
+	"strings"
+	"sync"
+
+	"github.com/lavaorg/telex"
+	"github.com/lavaorg/telex/internal/toml"
+	"github.com/lavaorg/telex/plugins/serializers/influx"
+)
+
+// ConfigEnv is the environment variable holding the configuration of the
+// plugin, the options of its table in the configuration of the agent.
+const ConfigEnv = "TELEX_PLUGIN_CONFIG"
+
+// maxLineSize is the size of the longest line read from stdin.
+const maxLineSize = 1024 * 1024
+
+// Shim runs a plugin, talking to the agent over stdin and stdout.
+type Shim struct {
+	input     telex.Input
+	processor telex.Processor
+	output    telex.Output
+
+	stdin  io.Reader
+	stdout io.Writer
+	stderr io.Writer
+
+	// mu serializes the writes to stdout and stderr.
+	mu         sync.Mutex
+	serializer *influx.Serializer
+}
+
+// New returns a Shim reading os.Stdin and writing os.Stdout.
+func New() *Shim {
+	return &Shim{
+		stdin:      os.Stdin,
+		stdout:     os.Stdout,
+		stderr:     os.Stderr,
+		serializer: influx.NewSerializer(),
+	}
+}
+
+// AddInput sets the plugin to the input.
+func (s *Shim) AddInput(input telex.Input) error {
+	if s.plugin() != nil {
+		return errors.New("a plugin is already added")
+	}
+	s.input = input
+	return nil
+}
+
+// AddProcessor sets the plugin to the processor.
+func (s *Shim) AddProcessor(processor telex.Processor) error {
+	if s.plugin() != nil {
+		return errors.New("a plugin is already added")
+	}
+	s.processor = processor
+	return nil
+}
+
+// AddOutput sets the plugin to the output.
+func (s *Shim) AddOutput(output telex.Output) error {
+	if s.plugin() != nil {
+		return errors.New("a plugin is already added")
+	}
+	s.output = output
+	return nil
+}
+
+// plugin returns the plugin, nil if none is added.
+func (s *Shim) plugin() interface {
+	SampleConfig() string
+	Description() string
+} {
+	switch {
+	case s.input != nil:
+		return s.input
+	case s.processor != nil:
+		return s.processor
+	case s.output != nil:
+		return s.output
+	}
+	return nil
+}
+
+// LoadConfig sets the options of the plugin from the TOML configuration, and
+// initializes it.
+func (s *Shim) LoadConfig(data []byte) error {
+	plugin := s.plugin()
+	if plugin == nil {
+		return errors.New("no plugin added")
+	}
+
+	tbl, err := toml.Parse(data)
+	if err != nil {
+		return err
+	}
+	if err := toml.UnmarshalTable(tbl, plugin); err != nil {
+		return err
+	}
+	if p, ok := plugin.(telex.Initializer); ok {
+		return p.Init()
+	}
+	return nil
+}
+
+// Run parses the command line flags, loads the configuration of the plugin
+// from the -config file or the ConfigEnv variable, and runs the plugin until
+// stdin is closed.
+func (s *Shim) Run() error {
+	plugin := s.plugin()
+	if plugin == nil {
+		return errors.New("no plugin added")
+	}
+
+	fs := flag.NewFlagSet(os.Args[0], flag.ContinueOnError)
+	config := fs.String("config", "",
+		"file holding the configuration of the plugin, instead of $"+ConfigEnv)
+	sampleConfig := fs.Bool("sample-config", false,
+		"print the sample configuration of the plugin and exit")
+	if err := fs.Parse(os.Args[1:]); err != nil {
+		return err
+	}
+
+	if *sampleConfig {
+		fmt.Fprintf(s.stdout, "# %s\n%s", plugin.Description(), plugin.SampleConfig())
+		return nil
+	}
+
+	data := []byte(os.Getenv(ConfigEnv))
+	if *config != "" {
+		var err error
+		if data, err = ioutil.ReadFile(*config); err != nil {
+			return err
+		}
+	}
+	if err := s.LoadConfig(data); err != nil {
+		return fmt.Errorf("error loading configuration: %v", err)
+	}
+
+	// The lines logged by the plugin are read by the agent, which adds the
+	// time.
+	log.SetOutput(s.stderr)
+	log.SetFlags(0)
+
+	return s.run()
+}
+
+func (s *Shim) run() error {
+	switch {
+	case s.input != nil:
+		return s.runInput()
+	case s.processor != nil:
+		return s.runProcessor()
+	default:
+		return s.runOutput()
+	}
+}
+
+// scanLines calls fn with each line read from stdin, without its line ending.
+func (s *Shim) scanLines(fn func(line []byte)) error {
+	scanner := bufio.NewScanner(s.stdin)
+	scanner.Buffer(make([]byte, 64*1024), maxLineSize)
+	for scanner.Scan() {
+		fn(trimLine(scanner.Bytes()))
+	}
+	return scanner.Err()
+}
+
+// writeMetric writes the metric to stdout in line protocol.
+func (s *Shim) writeMetric(m telex.Metric) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	octets, err := s.serializer.Serialize(m)
+	if err != nil {
+		return err
+	}
+	_, err = s.stdout.Write(octets)
+	return err
+}
+
+// writeLine writes a line to stdout.
+func (s *Shim) writeLine(line string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	_, err := io.WriteString(s.stdout, line+"\n")
+	return err
+}
+
+// writeError writes the error to stderr, on a single line.
+func (s *Shim) writeError(err error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	fmt.Fprintln(s.stderr, oneLine(err.Error()))
+}
+
+func trimLine(line []byte) []byte {
+	for len(line) > 0 && line[len(line)-1] == '\r' {
+		line = line[:len(line)-1]
+	}
+	return line
+}
+
+func oneLine(s string) string {
+	return strings.Join(strings.Fields(s), " ")
+}
@@ -0,0 +1,144 @@
+package shim
+
+import (
+	"bytes"
+	"errors"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/lavaorg/telex"
+	"github.com/lavaorg/telex/testutil"
+	"github.com/stretchr/testify/require"
+)
+
+type testInput struct {
+	Value int64  `toml:"value"`
+	Fail  string `toml:"fail"`
+}
+
+func (i *testInput) SampleConfig() string { return "  value = 1\n" }
+func (i *testInput) Description() string  { return "Test input" }
+func (i *testInput) Gather(acc telex.Accumulator) error {
+	if i.Fail != "" {
+		return errors.New(i.Fail)
+	}
+	acc.AddFields("test", map[string]interface{}{"value": i.Value}, nil,
+		time.Unix(0, 0))
+	return nil
+}
+
+type testProcessor struct{}
+
+func (p *testProcessor) SampleConfig() string { return "" }
+func (p *testProcessor) Description() string  { return "" }
+func (p *testProcessor) Apply(in ...telex.Metric) []telex.Metric {
+	for _, m := range in {
+		m.AddTag("processed", "true")
+	}
+	return in
+}
+
+type testOutput struct {
+	metrics [][]telex.Metric
+	fail    error
+	closed  bool
+}
+
+func (o *testOutput) SampleConfig() string { return "" }
+func (o *testOutput) Description() string  { return "" }
+func (o *testOutput) Connect() error       { return nil }
+func (o *testOutput) Close() error {
+	o.closed = true
+	return nil
+}
+func (o *testOutput) Write(metrics []telex.Metric) error {
+	if o.fail != nil {
+		return o.fail
+	}
+	o.metrics = append(o.metrics, metrics)
+	return nil
+}
+
+func newTestShim(stdin string) (*Shim, *bytes.Buffer, *bytes.Buffer) {
+	var stdout, stderr bytes.Buffer
+	s := New()
+	s.stdin = strings.NewReader(stdin)
+	s.stdout = &stdout
+	s.stderr = &stderr
+	return s, &stdout, &stderr
+}
+
+func TestShim_Input(t *testing.T) {
+	s, stdout, stderr := newTestShim("\n\n")
+	require.NoError(t, s.AddInput(&testInput{}))
+	require.NoError(t, s.LoadConfig([]byte("value = 42")))
+	require.NoError(t, s.run())
+
+	require.Equal(t, "test value=42i 0\ntest value=42i 0\n", stdout.String())
+	require.Empty(t, stderr.String())
+}
+
+func TestShim_InputError(t *testing.T) {
+	s, stdout, stderr := newTestShim("\n")
+	require.NoError(t, s.AddInput(&testInput{Fail: "no\nsample"}))
+	require.NoError(t, s.run())
+
+	require.Empty(t, stdout.String())
+	require.Equal(t, "no sample\n", stderr.String())
+}
+
+func TestShim_Processor(t *testing.T) {
+	s, stdout, stderr := newTestShim("cpu value=1 0\n\ncpu,host=a value=2 0\nbad\n")
+	require.NoError(t, s.AddProcessor(&testProcessor{}))
+	require.NoError(t, s.run())
+
+	require.Equal(t,
+		"cpu,processed=true value=1 0\ncpu,host=a,processed=true value=2 0\n",
+		stdout.String())
+	require.Contains(t, stderr.String(), "parse error")
+}
+
+func TestShim_Output(t *testing.T) {
+	s, stdout, _ := newTestShim("cpu value=1 0\ncpu value=2 0\n\nmem value=3 0\n\ndisk value=4 0\n")
+	output := &testOutput{}
+	require.NoError(t, s.AddOutput(output))
+	require.NoError(t, s.run())
+
+	require.Equal(t, "ok\nok\n", stdout.String())
+	require.Len(t, output.metrics, 2)
+	require.Len(t, output.metrics[0], 2)
+	testutil.RequireMetricEqual(t, testutil.MustMetric("mem", nil,
+		map[string]interface{}{"value": 3.0}, time.Unix(0, 0)), output.metrics[1][0])
+	require.True(t, output.closed)
+}
+
+func TestShim_OutputError(t *testing.T) {
+	s, stdout, _ := newTestShim("cpu value=1 0\n\n")
+	require.NoError(t, s.AddOutput(&testOutput{fail: errors.New("server\nunavailable")}))
+	require.NoError(t, s.run())
+
+	require.Equal(t, "server unavailable\n", stdout.String())
+}
+
+func TestShim_OutputBatchID(t *testing.T) {
+	s, stdout, _ := newTestShim("cpu value=1 0\n#batch 7\nmem value=3 0\n#batch 8\n")
+	output := &testOutput{}
+	require.NoError(t, s.AddOutput(output))
+	require.NoError(t, s.run())
+
+	require.Equal(t, "7 ok\n8 ok\n", stdout.String())
+	require.Len(t, output.metrics, 2)
+}
+
+func TestShim_SinglePlugin(t *testing.T) {
+	s := New()
+	require.NoError(t, s.AddInput(&testInput{}))
+	require.Error(t, s.AddOutput(&testOutput{}))
+}
+
+func TestShim_LoadConfigUnknownOption(t *testing.T) {
+	s := New()
+	require.NoError(t, s.AddInput(&testInput{}))
+	require.Error(t, s.LoadConfig([]byte("unknown = 1")))
+}
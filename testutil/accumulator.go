@@ -19,8 +19,7 @@ var (
 )
 
 func newTrackingID() telex.TrackingID {
-	atomic.AddUint64(&lastID, 1)
-	return telex.TrackingID(lastID)
+	return telex.TrackingID(atomic.AddUint64(&lastID, 1))
 }
 
 // Metric defines a single point measurement